@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"strings"
+	"sync/atomic"
 
 	"mk/token"
 )
@@ -10,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // 节点第一个字符的位置
+	End() token.Position // 节点最后一个字符之后的位置
 }
 
 type Statement interface {
@@ -52,6 +55,9 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+
+// 是否为 const 声明
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -96,6 +102,76 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// throw 语句
+// throw expr;
+type ThrowStatement struct {
+	Token token.Token // 'throw'
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// struct 声明, 定义结构体类型
+// struct Point { x, y }
+type StructStatement struct {
+	Token  token.Token // 'struct'
+	Name   *Identifier
+	Fields []*Identifier
+	Rbrace token.Position // '}' 的位置
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+	if len(fields) == 0 {
+		return ss.TokenLiteral() + " " + ss.Name.String() + " { }"
+	}
+	return ss.TokenLiteral() + " " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// yield 语句, 只能在生成器函数中使用
+// yield expr;    交出一个值
+// yield* expr;   依次交出另一个生成器(或者数组, 区间)中的所有值
+type YieldStatement struct {
+	Token    token.Token // 'yield'
+	Value    Expression
+	Delegate bool // yield*
+}
+
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+func (ys *YieldStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ys.TokenLiteral())
+	if ys.Delegate {
+		out.WriteString("*")
+	}
+	out.WriteString(" ")
+	if ys.Value != nil {
+		out.WriteString(ys.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -119,6 +195,28 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// 小数字面量, 例如 12.50d
+// Value 为去掉后缀 d 的数字, 保留小数部分末尾的0
+type DecimalLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (dl *DecimalLiteral) expressionNode()      {}
+func (dl *DecimalLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DecimalLiteral) String() string       { return dl.Token.Literal }
+
+// 时长字面量, 例如 500ms, 1h30m
+// Value 为源码中的写法, 数值在执行时转换
+type DurationLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (dl *DurationLiteral) expressionNode()      {}
+func (dl *DurationLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DurationLiteral) String() string       { return dl.Token.Literal }
+
 type InfixExpression struct {
 	Token    token.Token
 	Operator string
@@ -193,9 +291,91 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// try 表达式
+// try { ... } catch (e: TypeError) { ... } catch (e) { ... } finally { ... }
+// catch 和 finally 至少有一个
+type TryExpression struct {
+	Token   token.Token     // 'try'
+	Block   *BlockStatement // try 部分语句
+	Catches []*CatchClause  // 按顺序匹配, 只执行第一个匹配的
+	Finally *BlockStatement // 可以为nil
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	for _, c := range te.Catches {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// catch 分支
+// Kind 不为nil时只捕获该类型的错误
+type CatchClause struct {
+	Token token.Token // 'catch'
+	Param *Identifier // 绑定错误信息的变量
+	Kind  *Identifier // 错误类型, 例如 TypeError, 可以为nil
+	Body  *BlockStatement
+}
+
+func (cc *CatchClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *CatchClause) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("catch (")
+	out.WriteString(cc.Param.String())
+	if cc.Kind != nil {
+		out.WriteString(": ")
+		out.WriteString(cc.Kind.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(cc.Body.String())
+
+	return out.String()
+}
+
+// 三元表达式
+// cond ? a : b
+type TernaryExpression struct {
+	Token       token.Token // '?'
+	Condition   Expression  // 条件表达式
+	Consequence Expression  // 条件为真时的值
+	Alternative Expression  // 条件为假时的值
+}
+
+func (te *TernaryExpression) expressionNode()      {}
+func (te *TernaryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TernaryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(te.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(te.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(te.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Position // '}' 的位置
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -211,9 +391,15 @@ func (bs *BlockStatement) String() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token     // 'fn'
-	Parameters []*Identifier   // 标识符列表
-	Body       *BlockStatement // 方法体(语句列表)
+	Token      token.Token           // 'fn'
+	Parameters []*Identifier         // 标识符列表
+	Defaults   map[string]Expression // 参数默认值, 例如 fn(x, y = 1)
+	Rest       *Identifier           // 剩余参数, 例如 fn(x, ...rest)
+	Body       *BlockStatement       // 方法体(语句列表)
+
+	// 求值器对函数的分析结果, 第一次求值时计算, 用 sync/atomic 读写
+	EnvEscapes int32 // 见 evaluator/escape.go
+	Yields     int32 // 见 evaluator/generator.go
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -223,7 +409,14 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		if def, ok := fl.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -236,9 +429,10 @@ func (fl *FunctionLiteral) String() string {
 }
 
 type CallExpression struct {
-	Token     token.Token  // '('
-	Function  Expression   // 函数
-	Arguments []Expression // 参数列表
+	Token     token.Token    // '('
+	Function  Expression     // 函数
+	Arguments []Expression   // 参数列表
+	Rparen    token.Position // ')' 的位置
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -259,10 +453,53 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// 管道 x |> f(a, b), 执行时等价于调用 f(x, a, b); 右边不是调用时等价于 f(x)
+// 语法树中保留管道的写法, 格式化时原样输出
+type PipeExpression struct {
+	Token token.Token // '|>'
+	Left  Expression  // 作为第一个参数的值
+	Right Expression  // 调用或者函数
+}
+
+func (pe *PipeExpression) expressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) String() string {
+	return "(" + pe.Left.String() + " |> " + pe.Right.String() + ")"
+}
+
+// 区间表达式
+// 1..10 包含结束值, 1..<10 不包含结束值
+type RangeExpression struct {
+	Token     token.Token // '..' 或者 '..<'
+	Start     Expression
+	Stop      Expression
+	Exclusive bool // 是否不包含结束值
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	return "(" + re.Start.String() + re.Token.Literal + re.Stop.String() + ")"
+}
+
+// 展开表达式
+// 用在函数调用参数和数组字面量中: f(...args), [0, ...arr]
+type SpreadExpression struct {
+	Token token.Token // '...'
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 // 字符串表达式
 type StringLiteral struct {
 	Token token.Token
 	Value string
+
+	// 求值器缓存的字符串对象, 同一个字面量每次求值都返回它, 见 evaluator.literalString
+	Object atomic.Value
 }
 
 func (sl *StringLiteral) expressionNode()      {}
@@ -272,6 +509,7 @@ func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	Rbracket token.Position // ']' 的位置
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -290,9 +528,10 @@ func (al *ArrayLiteral) String() string {
 
 // 调用数组时，下标表达式
 type IndexExpression struct {
-	Token token.Token // The [ token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The [ token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Position // ']' 的位置
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -307,11 +546,64 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// 切片表达式
+// a[start:stop], Start 和 Stop 都可以省略(为nil)
+type SliceExpression struct {
+	Token    token.Token // The [ token
+	Left     Expression
+	Start    Expression
+	Stop     Expression
+	Rbracket token.Position // ']' 的位置
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.Stop != nil {
+		out.WriteString(se.Stop.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// 成员访问表达式
+// person.name 等价于 person["name"]
+type DotExpression struct {
+	Token token.Token // The . token
+	Left  Expression
+	Name  *Identifier
+
+	// 求值器缓存的作为 key 的字符串对象, 见 evaluator.literalString
+	Key atomic.Value
+}
+
+func (de *DotExpression) expressionNode()      {}
+func (de *DotExpression) TokenLiteral() string { return de.Token.Literal }
+func (de *DotExpression) String() string {
+	return "(" + de.Left.String() + "." + de.Name.String() + ")"
+}
+
 // map类型
 // key 和 value 都是表达式
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	Token  token.Token    // the '{' token
+	Pairs  []HashPair     // 按在源码中出现的顺序排列
+	Rbrace token.Position // '}' 的位置
+}
+
+// map 字面量中的一个 key: value
+// 相同的 key 出现多次时都会保留, 执行时后面的覆盖前面的
+type HashPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -319,11 +611,57 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+// match 表达式
+// match (x) { 1 => "one", "a" => "A", _ => "other" }
+// 从上到下依次比较, 只执行第一个匹配的分支(不会穿透到下一个分支)
+type MatchExpression struct {
+	Token   token.Token    // 'match'
+	Subject Expression     // 被匹配的值
+	Arms    []*MatchArm    // 分支列表
+	Rbrace  token.Position // '}' 的位置
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// match 表达式中的单个分支
+// Pattern 为 nil 时表示默认分支 '_'
+type MatchArm struct {
+	Token   token.Token // 分支的第一个token
+	Pattern Expression
+	Body    Expression
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) String() string {
+	pattern := "_"
+	if ma.Pattern != nil {
+		pattern = ma.Pattern.String()
+	}
+	return pattern + " => " + ma.Body.String()
+}
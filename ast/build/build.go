@@ -0,0 +1,221 @@
+// build 提供构造语法树的辅助函数, 自动填好每个节点的 Token,
+// 用于代码生成, 宏以及测试等需要用程序生成 mk 代码的场景:
+//
+//	program := build.Program(
+//		build.Let("add", build.Fn([]string{"a", "b"},
+//			build.Expr(build.Infix(build.Ident("a"), "+", build.Ident("b"))))),
+//		build.Expr(build.Call(build.Ident("add"), build.Int(1), build.Int(2))),
+//	)
+//
+// 生成的语法树可以直接交给 evaluator.Eval 执行, String() 的结果和解析源码得到的相同
+package build
+
+import (
+	"strconv"
+
+	"mk/ast"
+	"mk/token"
+)
+
+func tok(t token.TokenType, literal string) token.Token {
+	return token.Token{Type: t, Literal: literal}
+}
+
+// 程序
+func Program(statements ...ast.Statement) *ast.Program {
+	if statements == nil {
+		statements = []ast.Statement{}
+	}
+	return &ast.Program{Statements: statements}
+}
+
+// let name = value;
+func Let(name string, value ast.Expression) *ast.LetStatement {
+	return &ast.LetStatement{Token: tok(token.LET, "let"), Name: Ident(name), Value: value}
+}
+
+// const name = value;
+func Const(name string, value ast.Expression) *ast.LetStatement {
+	return &ast.LetStatement{Token: tok(token.CONST, "const"), Name: Ident(name), Value: value}
+}
+
+// return value;
+func Return(value ast.Expression) *ast.ReturnStatement {
+	return &ast.ReturnStatement{Token: tok(token.RETURN, "return"), ReturnValue: value}
+}
+
+// throw value;
+func Throw(value ast.Expression) *ast.ThrowStatement {
+	return &ast.ThrowStatement{Token: tok(token.THROW, "throw"), Value: value}
+}
+
+// 表达式语句
+func Expr(expression ast.Expression) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Token: expressionToken(expression), Expression: expression}
+}
+
+// 代码块
+func Block(statements ...ast.Statement) *ast.BlockStatement {
+	if statements == nil {
+		statements = []ast.Statement{}
+	}
+	return &ast.BlockStatement{Token: tok(token.LBRACE, "{"), Statements: statements}
+}
+
+// 标识符
+func Ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: tok(token.IDENT, name), Value: name}
+}
+
+// 整数
+func Int(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: tok(token.INT, strconv.FormatInt(value, 10)), Value: value}
+}
+
+// 字符串
+func Str(value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: tok(token.STRING, value), Value: value}
+}
+
+// true / false
+func Bool(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: tok(token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: tok(token.FALSE, "false"), Value: false}
+}
+
+// 前缀表达式, operator 为 "-" 或者 "!"
+func Prefix(operator string, right ast.Expression) *ast.PrefixExpression {
+	return &ast.PrefixExpression{
+		Token:    tok(token.TokenType(operator), operator),
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+// 中缀表达式, operator 为运算符本身, 例如 "+", "==", 也可以是自定义运算符
+func Infix(left ast.Expression, operator string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{
+		Token:    tok(token.TokenType(operator), operator),
+		Left:     left,
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+// if (condition) { consequence } else { alternative }
+// alternative 可以为nil
+func If(condition ast.Expression, consequence, alternative *ast.BlockStatement) *ast.IfExpression {
+	return &ast.IfExpression{
+		Token:       tok(token.IF, "if"),
+		Condition:   condition,
+		Consequence: consequence,
+		Alternative: alternative,
+	}
+}
+
+// condition ? consequence : alternative
+func Ternary(condition, consequence, alternative ast.Expression) *ast.TernaryExpression {
+	return &ast.TernaryExpression{
+		Token:       tok(token.QUESTION, "?"),
+		Condition:   condition,
+		Consequence: consequence,
+		Alternative: alternative,
+	}
+}
+
+// fn(params...) { body... }
+func Fn(params []string, body ...ast.Statement) *ast.FunctionLiteral {
+	parameters := make([]*ast.Identifier, len(params))
+	for i, name := range params {
+		parameters[i] = Ident(name)
+	}
+	return &ast.FunctionLiteral{
+		Token:      tok(token.FUNCTION, "fn"),
+		Parameters: parameters,
+		Body:       Block(body...),
+	}
+}
+
+// function(args...)
+func Call(function ast.Expression, args ...ast.Expression) *ast.CallExpression {
+	if args == nil {
+		args = []ast.Expression{}
+	}
+	return &ast.CallExpression{Token: tok(token.LPAREN, "("), Function: function, Arguments: args}
+}
+
+// left |> right, right 为调用时 left 作为第一个参数
+func Pipe(left, right ast.Expression) *ast.PipeExpression {
+	return &ast.PipeExpression{Token: tok(token.PIPE, "|>"), Left: left, Right: right}
+}
+
+// [elements...]
+func Array(elements ...ast.Expression) *ast.ArrayLiteral {
+	if elements == nil {
+		elements = []ast.Expression{}
+	}
+	return &ast.ArrayLiteral{Token: tok(token.LBRACKET, "["), Elements: elements}
+}
+
+// {k1: v1, k2: v2, ...}, 参数为交替出现的 key 和 value
+// 参数个数为奇数时 panic
+func Hash(keysAndValues ...ast.Expression) *ast.HashLiteral {
+	if len(keysAndValues)%2 != 0 {
+		panic("build.Hash: odd number of arguments")
+	}
+
+	pairs := make([]ast.HashPair, 0, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		pairs = append(pairs, ast.HashPair{Key: keysAndValues[i], Value: keysAndValues[i+1]})
+	}
+	return &ast.HashLiteral{Token: tok(token.LBRACE, "{"), Pairs: pairs}
+}
+
+// left[index]
+func Index(left, index ast.Expression) *ast.IndexExpression {
+	return &ast.IndexExpression{Token: tok(token.LBRACKET, "["), Left: left, Index: index}
+}
+
+// left.name
+func Dot(left ast.Expression, name string) *ast.DotExpression {
+	return &ast.DotExpression{Token: tok(token.DOT, "."), Left: left, Name: Ident(name)}
+}
+
+// start..end 或者 start..<end
+func Range(start, end ast.Expression, exclusive bool) *ast.RangeExpression {
+	t := tok(token.RANGE, "..")
+	if exclusive {
+		t = tok(token.RANGE_LT, "..<")
+	}
+	return &ast.RangeExpression{Token: t, Start: start, Stop: end, Exclusive: exclusive}
+}
+
+// ...value
+func Spread(value ast.Expression) *ast.SpreadExpression {
+	return &ast.SpreadExpression{Token: tok(token.ELLIPSIS, "..."), Value: value}
+}
+
+// 表达式语句的 Token 为表达式的第一个 token
+func expressionToken(expression ast.Expression) token.Token {
+	switch e := expression.(type) {
+	case *ast.InfixExpression:
+		return expressionToken(e.Left)
+	case *ast.CallExpression:
+		return expressionToken(e.Function)
+	case *ast.PipeExpression:
+		return expressionToken(e.Left)
+	case *ast.IndexExpression:
+		return expressionToken(e.Left)
+	case *ast.DotExpression:
+		return expressionToken(e.Left)
+	case *ast.TernaryExpression:
+		return expressionToken(e.Condition)
+	case *ast.RangeExpression:
+		return expressionToken(e.Start)
+	case nil:
+		return token.Token{}
+	}
+	return tok(token.TokenType(expression.TokenLiteral()), expression.TokenLiteral())
+}
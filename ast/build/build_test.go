@@ -0,0 +1,80 @@
+package build
+
+import (
+	"testing"
+
+	"mk/ast"
+	"mk/lexer"
+	"mk/parser"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{Let("x", Int(1)), "let x = 1;"},
+		{Const("name", Str("mk")), "const name = mk;"},
+		{Return(Bool(true)), "return true;"},
+		{Expr(Infix(Int(1), "+", Infix(Int(2), "*", Int(3)))), "(1 + (2 * 3))"},
+		{Expr(Prefix("-", Ident("a"))), "(-a)"},
+		{Expr(Call(Ident("add"), Int(1), Int(2))), "add(1, 2)"},
+		{Expr(Pipe(Int(1), Call(Ident("add"), Int(2)))), "(1 |> add(2))"},
+		{Expr(Index(Array(Int(1), Int(2)), Int(0))), "([1, 2][0])"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.String() != tt.expected {
+			t.Errorf("String() wrong. expected=%q, got=%q", tt.expected, tt.node.String())
+		}
+	}
+}
+
+// 构造的语法树和解析源码得到的语法树输出相同
+func TestMatchesParser(t *testing.T) {
+	tests := []struct {
+		program *ast.Program
+		input   string
+	}{
+		{
+			Program(Let("add", Fn([]string{"a", "b"},
+				Expr(Infix(Ident("a"), "+", Ident("b")))))),
+			"let add = fn(a, b) { a + b };",
+		},
+		{
+			Program(Expr(If(Infix(Ident("x"), "<", Int(10)),
+				Block(Expr(Ident("x"))), Block(Return(Int(10)))))),
+			"if (x < 10) { x } else { return 10; }",
+		},
+		{
+			Program(Expr(Ternary(Bool(false), Str("a"), Dot(Ident("h"), "b")))),
+			`false ? "a" : h.b`,
+		},
+		{
+			Program(Expr(Range(Int(1), Int(5), true))),
+			"1..<5",
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		expected := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		if tt.program.String() != expected.String() {
+			t.Errorf("program wrong. expected=%q, got=%q",
+				expected.String(), tt.program.String())
+		}
+	}
+}
+
+func TestHashOddArguments(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on odd number of arguments")
+		}
+	}()
+	Hash(Str("a"))
+}
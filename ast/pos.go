@@ -0,0 +1,218 @@
+package ast
+
+import (
+	"mk/token"
+)
+
+// 各个节点在源码中的范围: [Pos(), End())
+// 没有位置信息的节点(例如 ast/build 构造的节点)返回零值
+
+// token 最后一个字符之后的位置
+// 字符串字面量的 Literal 不包含两边的引号
+func tokenEnd(tok token.Token) token.Position {
+	if tok.Pos.Line == 0 {
+		return token.Position{}
+	}
+
+	literal := tok.Literal
+	if tok.Type == token.STRING {
+		literal = `"` + literal + `"`
+	}
+	return advance(tok.Pos, literal)
+}
+
+// 从 pos 开始经过 s 之后的位置
+func advance(pos token.Position, s string) token.Position {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// 单个字符的结束符号(')', ']', '}')之后的位置
+func closeEnd(pos token.Position, fallback token.Position) token.Position {
+	if pos.Line == 0 {
+		return fallback
+	}
+	pos.Column++
+	return pos
+}
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{}
+	}
+	return p.Statements[0].Pos()
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{}
+	}
+	return p.Statements[len(p.Statements)-1].End()
+}
+
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value == nil {
+		return ls.Name.End()
+	}
+	return ls.Value.End()
+}
+
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return tokenEnd(i.Token) }
+
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue == nil {
+		return tokenEnd(rs.Token)
+	}
+	return rs.ReturnValue.End()
+}
+
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position {
+	if ts.Value == nil {
+		return tokenEnd(ts.Token)
+	}
+	return ts.Value.End()
+}
+
+func (ys *YieldStatement) Pos() token.Position { return ys.Token.Pos }
+func (ys *YieldStatement) End() token.Position {
+	if ys.Value == nil {
+		return tokenEnd(ys.Token)
+	}
+	return ys.Value.End()
+}
+
+func (ss *StructStatement) Pos() token.Position { return ss.Token.Pos }
+func (ss *StructStatement) End() token.Position {
+	fallback := ss.Name.End()
+	if len(ss.Fields) != 0 {
+		fallback = ss.Fields[len(ss.Fields)-1].End()
+	}
+	return closeEnd(ss.Rbrace, fallback)
+}
+
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression == nil {
+		return es.Token.Pos
+	}
+	return es.Expression.Pos()
+}
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression == nil {
+		return tokenEnd(es.Token)
+	}
+	return es.Expression.End()
+}
+
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return tokenEnd(il.Token) }
+
+func (dl *DecimalLiteral) Pos() token.Position { return dl.Token.Pos }
+func (dl *DecimalLiteral) End() token.Position { return tokenEnd(dl.Token) }
+
+func (dl *DurationLiteral) Pos() token.Position { return dl.Token.Pos }
+func (dl *DurationLiteral) End() token.Position { return tokenEnd(dl.Token) }
+
+func (ie *InfixExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *InfixExpression) End() token.Position { return ie.Right.End() }
+
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position { return pe.Right.End() }
+
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) End() token.Position { return tokenEnd(b.Token) }
+
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+
+func (te *TryExpression) Pos() token.Position { return te.Token.Pos }
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if len(te.Catches) != 0 {
+		return te.Catches[len(te.Catches)-1].End()
+	}
+	return te.Block.End()
+}
+
+func (cc *CatchClause) Pos() token.Position { return cc.Token.Pos }
+func (cc *CatchClause) End() token.Position { return cc.Body.End() }
+
+func (te *TernaryExpression) Pos() token.Position { return te.Condition.Pos() }
+func (te *TernaryExpression) End() token.Position { return te.Alternative.End() }
+
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	fallback := token.Position{}
+	if len(bs.Statements) != 0 {
+		fallback = bs.Statements[len(bs.Statements)-1].End()
+	}
+	return closeEnd(bs.Rbrace, fallback)
+}
+
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position { return fl.Body.End() }
+
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position {
+	return closeEnd(ce.Rparen, ce.Function.End())
+}
+
+func (pe *PipeExpression) Pos() token.Position { return pe.Left.Pos() }
+func (pe *PipeExpression) End() token.Position { return pe.Right.End() }
+
+func (re *RangeExpression) Pos() token.Position { return re.Start.Pos() }
+func (re *RangeExpression) End() token.Position { return re.Stop.End() }
+
+func (se *SpreadExpression) Pos() token.Position { return se.Token.Pos }
+func (se *SpreadExpression) End() token.Position { return se.Value.End() }
+
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return tokenEnd(sl.Token) }
+
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position {
+	return closeEnd(al.Rbracket, tokenEnd(al.Token))
+}
+
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position {
+	return closeEnd(ie.Rbracket, ie.Index.End())
+}
+
+func (se *SliceExpression) Pos() token.Position { return se.Left.Pos() }
+func (se *SliceExpression) End() token.Position {
+	return closeEnd(se.Rbracket, tokenEnd(se.Token))
+}
+
+func (de *DotExpression) Pos() token.Position { return de.Left.Pos() }
+func (de *DotExpression) End() token.Position { return de.Name.End() }
+
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position {
+	return closeEnd(hl.Rbrace, tokenEnd(hl.Token))
+}
+
+func (me *MatchExpression) Pos() token.Position { return me.Token.Pos }
+func (me *MatchExpression) End() token.Position {
+	return closeEnd(me.Rbrace, tokenEnd(me.Token))
+}
+
+func (ma *MatchArm) Pos() token.Position { return ma.Token.Pos }
+func (ma *MatchArm) End() token.Position { return ma.Body.End() }
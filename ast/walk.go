@@ -0,0 +1,182 @@
+package ast
+
+// 遍历语法树
+// Walk 先调用 v.Visit(node), 返回的 w 不为nil时用 w 依次遍历 node 的子节点, 最后调用 w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// 按源码顺序深度优先遍历语法树
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+
+	case *ThrowStatement:
+		walkExpression(v, n.Value)
+
+	case *YieldStatement:
+		walkExpression(v, n.Value)
+
+	case *StructStatement:
+		Walk(v, n.Name)
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *Identifier, *IntegerLiteral, *DecimalLiteral, *DurationLiteral, *StringLiteral, *Boolean:
+		// 没有子节点
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *TryExpression:
+		Walk(v, n.Block)
+		for _, c := range n.Catches {
+			Walk(v, c)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+
+	case *CatchClause:
+		Walk(v, n.Param)
+		if n.Kind != nil {
+			Walk(v, n.Kind)
+		}
+		Walk(v, n.Body)
+
+	case *TernaryExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+
+	// 参数的默认值紧跟在参数后面
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+			walkExpression(v, n.Defaults[param.Value])
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+		Walk(v, n.Body)
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkList(v, n.Arguments)
+
+	case *PipeExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *RangeExpression:
+		Walk(v, n.Start)
+		Walk(v, n.Stop)
+
+	case *SpreadExpression:
+		Walk(v, n.Value)
+
+	case *ArrayLiteral:
+		walkList(v, n.Elements)
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *SliceExpression:
+		Walk(v, n.Left)
+		walkExpression(v, n.Start)
+		walkExpression(v, n.Stop)
+
+	case *DotExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Name)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			Walk(v, pair.Key)
+			Walk(v, pair.Value)
+		}
+
+	case *MatchExpression:
+		Walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+
+	// 默认分支 '_' 的 Pattern 为nil
+	case *MatchArm:
+		walkExpression(v, n.Pattern)
+		Walk(v, n.Body)
+	}
+
+	v.Visit(nil)
+}
+
+// 可以为nil的子节点
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkList(v Visitor, list []Expression) {
+	for _, exp := range list {
+		Walk(v, exp)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// 按源码顺序深度优先遍历语法树, 对每个节点调用 f(node)
+// f 返回 false 时不再遍历该节点的子节点; 子节点遍历完之后调用 f(nil)
+//
+//	ast.Inspect(program, func(node ast.Node) bool {
+//		if call, ok := node.(*ast.CallExpression); ok {
+//			fmt.Println(call.Function)
+//		}
+//		return true
+//	})
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,71 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"mk/ast"
+	"mk/lexer"
+	"mk/parser"
+)
+
+func TestInspect(t *testing.T) {
+	input := `let f = fn(a, b = 1, ...c) { a[1:b] };
+try { f(x.y) } catch (e: TypeError) { -e } finally { [1..2, ...z] };
+match (f) { 1 => a ? b : c, _ => {"k": !d} }`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	idents := []string{}
+	depth, maxDepth := 0, 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	expected := "f a b c a b f x y e TypeError e z f a b c d"
+	if got := strings.Join(idents, " "); got != expected {
+		t.Errorf("wrong identifiers.\nexpected=%q\ngot=%q", expected, got)
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) not called once per node. depth=%d", depth)
+	}
+	if maxDepth < 5 {
+		t.Errorf("tree not walked deeply enough. maxDepth=%d", maxDepth)
+	}
+}
+
+// f 返回 false 时不遍历子节点
+func TestInspectSkip(t *testing.T) {
+	p := parser.New(lexer.New(`let g = fn(x) { x + inner }; outer`))
+	program := p.ParseProgram()
+
+	idents := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	if got := strings.Join(idents, " "); got != "g outer" {
+		t.Errorf("wrong identifiers. got=%q", got)
+	}
+}
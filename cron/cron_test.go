@@ -0,0 +1,81 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2024-01-01 是星期一
+	from := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"* * * * *", "2024-01-01 10:08"},
+		{"*/5 * * * *", "2024-01-01 10:10"},
+		{"0 * * * *", "2024-01-01 11:00"},
+		{"30 9 * * *", "2024-01-02 09:30"},
+		{"0 0 1 * *", "2024-02-01 00:00"},
+		{"0 12 * * 0", "2024-01-07 12:00"},
+		{"0 12 * * 7", "2024-01-07 12:00"},
+		{"0 0 * * 1-5", "2024-01-02 00:00"},
+		{"15,45 10 * * *", "2024-01-01 10:15"},
+		{"10-20/5 * * * *", "2024-01-01 10:10"},
+		{"5/20 * * * *", "2024-01-01 10:25"},
+		{"0 0 29 2 *", "2024-02-29 00:00"},
+		// 日和星期都指定时满足其一即可
+		{"0 0 15 * 3", "2024-01-03 00:00"},
+		{"@hourly", "2024-01-01 11:00"},
+		{"@yearly", "2025-01-01 00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %s", tt.spec, err)
+		}
+
+		got := s.Next(from).Format("2006-01-02 15:04")
+		if got != tt.expected {
+			t.Errorf("Next for %q wrong. expected=%s, got=%s", tt.spec, tt.expected, got)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse error: %s", err)
+	}
+
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected zero time, got %s", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"* * * *", `cron: expected 5 fields, got 4 in "* * * *"`},
+		{"60 * * * *", "cron: value 60 out of range [0, 59] in minute field"},
+		{"* * 0 * *", "cron: value 0 out of range [1, 31] in day of month field"},
+		{"*/0 * * * *", `cron: invalid step "0" in minute field`},
+		{"5-1 * * * *", `cron: invalid range "5-1" in minute field`},
+		{"a * * * *", `cron: invalid value "a" in minute field`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if err == nil {
+			t.Errorf("Parse(%q) expected error", tt.spec)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.spec, tt.expected, err.Error())
+		}
+	}
+}
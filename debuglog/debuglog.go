@@ -0,0 +1,194 @@
+package debuglog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 解释器内部的调试日志, 给贡献者和高级用户排查问题用
+// 环境变量 MK_DEBUG 选择打开的子系统和级别, 用逗号分隔, 例如:
+//
+//	MK_DEBUG=eval,parse        eval 和 parse 的 debug 级别
+//	MK_DEBUG=eval:trace        eval 的 trace 级别(包括 debug 级别)
+//	MK_DEBUG=all:trace         所有子系统
+//
+// 每条日志一行, 格式为 logfmt, 例如:
+//
+//	mk eval level=trace event=statement pos=1:1 stmt="let x = 1" result=INTEGER
+//
+// 没有打开时 Enabled 只是读取并比较一个整数, 调用方应先判断再准备日志的参数
+const ENV = "MK_DEBUG"
+
+// 日志级别
+type Level int
+
+const (
+	OFF Level = iota
+	DEBUG
+	TRACE
+)
+
+var levelNames = map[Level]string{
+	OFF:   "off",
+	DEBUG: "debug",
+	TRACE: "trace",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "Level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// 日志的输出, 默认为标准错误
+var Output io.Writer = os.Stderr
+
+// 一个子系统的日志
+type Logger struct {
+	name  string
+	level atomic.Int32 // Level, Configure 可能和 Enabled 同时执行
+}
+
+var (
+	mu      sync.Mutex
+	loggers = map[string]*Logger{}
+	config  = map[string]Level{}
+)
+
+func init() {
+	if spec := os.Getenv(ENV); spec != "" {
+		if err := Configure(spec); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", ENV, err)
+		}
+	}
+}
+
+// 注册子系统 name 的日志, 通常在包级变量中调用一次
+func New(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := &Logger{name: name}
+	l.level.Store(int32(configured(name)))
+	loggers[name] = l
+	return l
+}
+
+// 按 MK_DEBUG 的格式重新设置所有子系统的级别, 没有列出的子系统关闭
+// 空字符串关闭所有日志; 子系统的名字在注册之前也可以出现
+func Configure(spec string) error {
+	parsed := map[string]Level{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, level := item, DEBUG
+		if i := strings.IndexByte(item, ':'); i >= 0 {
+			name = item[:i]
+			var ok bool
+			if level, ok = parseLevel(item[i+1:]); !ok {
+				return fmt.Errorf("unknown level %q for %s, want debug or trace", item[i+1:], name)
+			}
+		}
+		parsed[name] = level
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	config = parsed
+	for name, l := range loggers {
+		l.level.Store(int32(configured(name)))
+	}
+	return nil
+}
+
+func parseLevel(s string) (Level, bool) {
+	for level, name := range levelNames {
+		if name == s {
+			return level, true
+		}
+	}
+	return OFF, false
+}
+
+// 子系统的级别, 单独指定的优先于 all
+func configured(name string) Level {
+	if level, ok := config[name]; ok {
+		return level
+	}
+	return config["all"]
+}
+
+// 已经注册的子系统, 按名字排序
+func Subsystems() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 是否输出 level 级别的日志
+func (l *Logger) Enabled(level Level) bool {
+	return level != OFF && Level(l.level.Load()) >= level
+}
+
+func (l *Logger) Debug(event string, fields ...interface{}) {
+	l.Log(DEBUG, event, fields...)
+}
+
+func (l *Logger) Trace(event string, fields ...interface{}) {
+	l.Log(TRACE, event, fields...)
+}
+
+// 输出一条日志, fields 为交替的键和值, 值用 %v 格式化
+// 包含空格, 引号或者 '=' 的值加上引号; 多出的一个键的值为空
+func (l *Logger) Log(level Level, event string, fields ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("mk ")
+	b.WriteString(l.name)
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" event=")
+	b.WriteString(quote(event))
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(" ")
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteString("=")
+		if i+1 < len(fields) {
+			b.WriteString(quote(fmt.Sprint(fields[i+1])))
+		}
+	}
+	b.WriteString("\n")
+
+	mu.Lock()
+	io.WriteString(Output, b.String())
+	mu.Unlock()
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package debuglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	saved := Output
+	Output = &buf
+	defer func() {
+		Output = saved
+		Configure("")
+	}()
+
+	eval := New("test_eval")
+	parse := New("test_parse")
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"", ""},
+		{"test_eval", "mk test_eval level=debug event=call fn=f\n"},
+		{"test_eval:trace", "mk test_eval level=debug event=call fn=f\n" +
+			"mk test_eval level=trace event=statement stmt=\"let x = 1;\" result=INTEGER\n"},
+		{"test_parse", "mk test_parse level=debug event=error message=\"a=b\" empty=\"\" odd=\n"},
+		{"all", "mk test_eval level=debug event=call fn=f\n" +
+			"mk test_parse level=debug event=error message=\"a=b\" empty=\"\" odd=\n"},
+		{"all:trace, test_parse:off", "mk test_eval level=debug event=call fn=f\n" +
+			"mk test_eval level=trace event=statement stmt=\"let x = 1;\" result=INTEGER\n"},
+	}
+	for _, tt := range tests {
+		if err := Configure(tt.spec); err != nil {
+			t.Fatalf("Configure(%q) failed: %s", tt.spec, err)
+		}
+		buf.Reset()
+		eval.Debug("call", "fn", "f")
+		eval.Trace("statement", "stmt", "let x = 1;", "result", "INTEGER")
+		parse.Debug("error", "message", "a=b", "empty", "", "odd")
+		if buf.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q", tt.spec, tt.expected, buf.String())
+		}
+	}
+
+	if err := Configure("eval:verbose"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+	if New("test_eval") != eval {
+		t.Errorf("New should return the registered logger")
+	}
+}
+
+// 其他 goroutine 正在记录日志时也可以重新设置级别, 用 go test -race 检查
+func TestConfigureConcurrently(t *testing.T) {
+	saved := Output
+	Output = &bytes.Buffer{}
+	defer func() {
+		Output = saved
+		Configure("")
+	}()
+
+	l := New("test_concurrent")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			l.Enabled(DEBUG)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		Configure("test_concurrent:trace")
+		Configure("")
+	}
+	<-done
+}
@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"strconv"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 嵌套访问中间的值为 null, 例如 data["items"][3]["name"] 中 data["items"][3] 为 null
+// 默认结果为 null, 不再执行后面的下标(和可选链相同); Options.StrictIndex 为 true 时返回 IndexError,
+// 错误信息中包含为 null 的访问路径, 例如 `data["items"][3] is null`
+func nullAccess(left ast.Expression, env *object.Environment) object.Object {
+	if !interpreterOf(env).StrictIndex {
+		return NULL
+	}
+	return newKindError(object.IndexError, "%s is null", accessPath(left, env))
+}
+
+// 下标越界: Options.StrictIndex 为 true 时 evalIndexExpression 返回 IndexError,
+// 在错误信息前加上访问路径, 例如 `data["items"][3]: index out of range: 3, length 3`
+func indexAccess(result object.Object, node *ast.IndexExpression, env *object.Environment) object.Object {
+	if err, ok := result.(*object.Error); ok && err.Kind == object.IndexError {
+		err.Message = accessPath(node, env) + ": " + err.Message
+	}
+	return result
+}
+
+// 访问路径的显示形式
+// 成员访问和下标统一写成 [...] 的形式, 例如 data.items[i] 显示为 data["items"][1];
+// 变量下标显示变量当前的值, 不重新执行下标表达式, 其他表达式显示源码
+func accessPath(exp ast.Expression, env *object.Environment) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value
+	case *ast.DotExpression:
+		return accessPath(exp.Left, env) + "[" + strconv.Quote(exp.Name.Value) + "]"
+	case *ast.IndexExpression:
+		return accessPath(exp.Left, env) + indexPath(exp.Index, env)
+	default:
+		return exp.String()
+	}
+}
+
+func indexPath(index ast.Expression, env *object.Environment) string {
+	var value object.Object
+	switch index := index.(type) {
+	case *ast.StringLiteral:
+		value = &object.String{Value: index.Value}
+	case *ast.IntegerLiteral:
+		value = &object.Integer{Value: index.Value}
+	case *ast.Identifier:
+		value, _ = env.Get(index.Value)
+	}
+
+	switch value := value.(type) {
+	case *object.String:
+		return "[" + strconv.Quote(value.Value) + "]"
+	case *object.Integer:
+		return "[" + value.Inspect() + "]"
+	}
+	return "[" + index.String() + "]"
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"math/big"
+	"strings"
+
+	"mk/object"
+)
+
+// 任意精度的整数
+// INTEGER 是 64 位的, 溢出时回绕; 需要更大的数(金额的最小单位, 密码学中的大数等)时用 bigint(x) 构造
+// 大整数和大整数, 或者大整数和整数运算时结果为大整数, 支持 + - * / < > == !=, 除法向0截断;
+// 和小数运算时结果为小数, 和浮点数混合运算是类型错误, 需要先用 float(b) 显式转换
+//
+//	bigint(x)   x 为整数, 大整数, 小数(向0截断)或者字符串; 字符串为十进制, 也可以带 0x, 0o, 0b 前缀
+//	int(b)      转换为整数, 超出 64 位的范围时报 ArithmeticError
+//
+// 例如:
+//
+//	let max = bigint("9223372036854775807");
+//	max + 1                                    // 9223372036854775808
+//	bigint(2) * bigint("0xffffffffffffffff")   // 36893488147419103230
+//	to_hex(bigint(2) * max)                    // "fffffffffffffffe"
+func init() {
+	builtins["bigint"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.BigInt:
+				return arg
+			case *object.Integer:
+				return &object.BigInt{Value: big.NewInt(arg.Value)}
+			case *object.Decimal:
+				return &object.BigInt{Value: roundDecimal(arg, 0, ROUND_DOWN).Value}
+			case *object.String:
+				n, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+				if !ok {
+					return newError("invalid bigint: %q", arg.Value)
+				}
+				return &object.BigInt{Value: n}
+			default:
+				return newError("argument to `bigint` must be STRING, INTEGER, BIGINT or DECIMAL, got %s",
+					args[0].Type())
+			}
+		},
+	}
+}
+
+// 大整数和大整数, 或者大整数和整数的中缀表达式
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, rightVal := toBigInt(left), toBigInt(right)
+
+	switch operator {
+	case "+":
+		return &object.BigInt{Value: new(big.Int).Add(leftVal, rightVal)}
+	case "-":
+		return &object.BigInt{Value: new(big.Int).Sub(leftVal, rightVal)}
+	case "*":
+		return &object.BigInt{Value: new(big.Int).Mul(leftVal, rightVal)}
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newKindError(object.ArithmeticError, "division by zero: %s / 0", left.Inspect())
+		}
+		// 和 INTEGER 一样向0截断
+		return &object.BigInt{Value: new(big.Int).Quo(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// 可以参与大整数运算的值
+func isBigIntOperand(obj object.Object) bool {
+	return obj.Type() == object.BIGINT_OBJ || obj.Type() == object.INTEGER_OBJ
+}
@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 执行步数的限制(Options.MaxSteps), 用于运行不可信的脚本
+// 每执行一个语法树节点计一步, 超过限制时返回不可恢复的 ResourceError;
+// 和超时不同, 同一个脚本总是在同一个位置停止. 为0时不限制
+// 步数在解释器中累计(包括 import 的模块, 定时任务和 on_exit 函数), 宿主每次执行时新建解释器;
+// CallFunction 的每个回调在新的解释器中执行, 各自从0开始计数
+
+// 这个解释器已经执行的步数, 只在 MaxSteps 大于0时计数
+func (in *Interpreter) Steps() int64 {
+	return in.steps
+}
+
+// 计一步, 超过限制时返回错误
+func (in *Interpreter) countStep() *object.Error {
+	in.steps++
+	if in.steps > in.MaxSteps {
+		return newFatalError(object.ResourceError, "step limit exceeded: %d", in.MaxSteps)
+	}
+	return nil
+}
+
+// 内存用量的限制(Options.MaxMemory, 近似的字节数), 防止一个脚本耗尽宿主的内存
+// 统计脚本创建的字符串, 字节串, 数组和 map 的大小, 超过限制时返回可以被捕获的 ResourceError;
+// 不扣除已经被回收的对象, 限制的是解释器中分配的总量. 为0时不限制
+// 运算符, 字面量和切片在分配之前记录; 内置函数(包括宿主注册的运算符)的结果由 callBuiltin 统一记录,
+// 会产生很大结果的内置函数(例如 take)在分配的过程中用 checkMemory 提前停止
+
+// 估算对象大小时使用的字节数
+const (
+	STRING_OVERHEAD = 32 // 字符串对象, 另加每字节1
+	ARRAY_OVERHEAD  = 32 // 数组对象, 另加每个元素 ELEMENT_SIZE
+	ELEMENT_SIZE    = 16
+	HASH_OVERHEAD   = 48 // map 对象, 另加每个键值对 ENTRY_SIZE
+	ENTRY_SIZE      = 64
+)
+
+// 这个解释器已经分配的字节数, 只在 MaxMemory 大于0时统计
+func (in *Interpreter) Allocated() int64 {
+	return in.allocated
+}
+
+// 记录分配 size 字节, 超过限制时不记录并返回错误
+// 应当在真正分配之前调用, 避免超大的对象先耗尽内存
+func (in *Interpreter) allocate(size int64) *object.Error {
+	if err := in.checkMemory(size); err != nil {
+		return err
+	}
+	if in.MaxMemory > 0 {
+		in.allocated += size
+	}
+	return nil
+}
+
+// 再分配 size 字节是否会超过限制, 不记录
+func (in *Interpreter) checkMemory(size int64) *object.Error {
+	if in.MaxMemory <= 0 || size <= in.MaxMemory-in.allocated {
+		return nil
+	}
+	return newKindError(object.ResourceError, "memory limit exceeded: allocating %d bytes, %d of %d bytes used",
+		size, in.allocated, in.MaxMemory)
+}
+
+// 记录内置函数新创建的结果, 超过限制时返回错误代替结果
+// 原样返回的参数不是新分配的, 不再记录
+func (in *Interpreter) allocateResult(result object.Object, args []object.Object) object.Object {
+	if in.MaxMemory <= 0 {
+		return result
+	}
+	for _, arg := range args {
+		if arg == result {
+			return result
+		}
+	}
+	if err := in.allocate(objectSize(result)); err != nil {
+		return err
+	}
+	return result
+}
+
+// 对象本身的大小, 不包括元素引用的其他对象
+func objectSize(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.String:
+		return stringSize(len(obj.Value))
+	case *object.Bytes:
+		return stringSize(len(obj.Value))
+	case *object.Array:
+		return arraySize(int64(len(obj.Elements)))
+	case *object.Hash:
+		return hashSize(obj.Len())
+	}
+	return 0
+}
+
+func stringSize(length int) int64 {
+	return STRING_OVERHEAD + int64(length)
+}
+
+func arraySize(length int64) int64 {
+	return ARRAY_OVERHEAD + length*ELEMENT_SIZE
+}
+
+func hashSize(length int) int64 {
+	return HASH_OVERHEAD + int64(length)*ENTRY_SIZE
+}
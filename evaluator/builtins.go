@@ -2,7 +2,6 @@ package evaluator
 
 import (
 	"fmt"
-	"time"
 
 	"mk/object"
 )
@@ -29,8 +28,14 @@ var builtins = map[string]*object.Builtin{
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
 
+			case *object.Bytes:
+				return &object.Integer{Value: int64(len(arg.Value))}
+
 			case *object.Hash:
-				return &object.Integer{Value: int64(len(arg.Pairs))}
+				return &object.Integer{Value: int64(arg.Len())}
+
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
 
 			default:
 				return newError("argument to `len` not supported, got=%s",
@@ -151,13 +156,34 @@ var builtins = map[string]*object.Builtin{
 	"puts": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(Stdout, arg.Inspect())
 			}
 			return NULL
 		},
 	},
 
-	// 显示当前时间
+	// 退出执行: exit() 或者 exit(n)
+	"exit": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			if len(args) == 0 {
+				return &object.Exit{Code: 0}
+			}
+
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `exit` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			return &object.Exit{Code: code.Value}
+		},
+	},
+
+	// 当前时间, 本地时区的 TIME, 可以和时长相加减, 例如 now() + 5m
 	"now": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			// 检查参数个数
@@ -165,8 +191,27 @@ var builtins = map[string]*object.Builtin{
 				return newError("too many parameters, expect :0, given :%d", len(args))
 			}
 
-			// 打印当前时间
-			return &object.String{Value: time.Now().Format("2006-01-02 15:04:05")}
+			return &object.Time{Value: timeNow()}
 		},
 	},
 }
+
+// 以字符串为key从map中取值, 不存在时返回nil
+func hashGet(hash *object.Hash, name string) object.Object {
+	key := &object.String{Value: name}
+	if pair, ok := hash.Get(key.HashKey()); ok {
+		return pair.Value
+	}
+	return nil
+}
+
+// 以字符串为key向map中设置值
+func hashSet(hash *object.Hash, name string, value object.Object) {
+	key := &object.String{Value: name}
+	hash.Set(key.HashKey(), object.HashPair{Key: key, Value: value})
+}
+
+// 新建一个空map
+func newHash() *object.Hash {
+	return object.NewHash(0)
+}
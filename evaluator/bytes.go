@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"mk/object"
+)
+
+// 字节串
+// 下标取得 0 到 255 的整数, 切片得到新的字节串, len 为字节数, + 连接, == 和 != 逐字节比较
+//
+//	bytes(x [, encoding])           构造字节串: x 为字符串时按 encoding 解码, encoding 为
+//	                                "utf8"(默认), "hex" 或 "base64"; x 也可以是 0 到 255 的整数组成的数组
+//	bytes_to_string(b [, encoding]) 按 encoding 编码为字符串, "utf8" 时 b 必须是合法的 UTF-8
+//
+// 例如:
+//
+//	let b = bytes("474946", "hex");     // b"GIF"
+//	b[0]                                // 71
+//	b + bytes([56, 57, 97])             // b"GIF89a"
+//	bytes_to_string(bytes("hi"), "hex") // "6869"
+func init() {
+	builtins["bytes"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			encoding, err := encodingArgument("bytes", args)
+			if err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Bytes:
+				return &object.Bytes{Value: append([]byte{}, arg.Value...)}
+			case *object.String:
+				return decodeBytes(arg.Value, encoding)
+			case *object.Array:
+				value := make([]byte, len(arg.Elements))
+				for i, el := range arg.Elements {
+					n, ok := el.(*object.Integer)
+					if !ok || n.Value < 0 || n.Value > 255 {
+						return newError("elements of array argument to `bytes` must be INTEGER from 0 to 255, got %s",
+							el.Inspect())
+					}
+					value[i] = byte(n.Value)
+				}
+				return &object.Bytes{Value: value}
+			default:
+				return newError("first argument to `bytes` must be STRING, ARRAY or BYTES, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["bytes_to_string"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			b, ok := args[0].(*object.Bytes)
+			if !ok {
+				return newError("first argument to `bytes_to_string` must be BYTES, got %s",
+					args[0].Type())
+			}
+			encoding, err := encodingArgument("bytes_to_string", args)
+			if err != nil {
+				return err
+			}
+
+			switch encoding {
+			case "hex":
+				return &object.String{Value: hex.EncodeToString(b.Value)}
+			case "base64":
+				return &object.String{Value: base64.StdEncoding.EncodeToString(b.Value)}
+			default:
+				if !utf8.Valid(b.Value) {
+					return newError("bytes are not valid UTF-8")
+				}
+				return &object.String{Value: string(b.Value)}
+			}
+		},
+	}
+}
+
+// 可选的第二个参数: 编码方式
+func encodingArgument(name string, args []object.Object) (string, *object.Error) {
+	if len(args) < 2 {
+		return "utf8", nil
+	}
+	s, ok := args[1].(*object.String)
+	if !ok {
+		return "", newError("second argument to `%s` must be STRING, got %s", name, args[1].Type())
+	}
+	switch s.Value {
+	case "utf8", "hex", "base64":
+		return s.Value, nil
+	default:
+		return "", newError("unknown encoding: %q, want utf8, hex or base64", s.Value)
+	}
+}
+
+func decodeBytes(s string, encoding string) object.Object {
+	switch encoding {
+	case "hex":
+		value, err := hex.DecodeString(s)
+		if err != nil {
+			return newError("invalid hex: %s", err)
+		}
+		return &object.Bytes{Value: value}
+	case "base64":
+		value, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return newError("invalid base64: %s", err)
+		}
+		return &object.Bytes{Value: value}
+	default:
+		return &object.Bytes{Value: []byte(s)}
+	}
+}
+
+// 字节串的下标, 结果为 0 到 255 的整数
+func evalBytesIndexExpression(in *Interpreter, b *object.Bytes, index *object.Integer) object.Object {
+	length := int64(len(b.Value))
+	idx, ok := in.resolveIndex(index.Value, length)
+	if !ok {
+		return in.indexOutOfRange(index, length)
+	}
+	return &object.Integer{Value: int64(b.Value[idx])}
+}
+
+// 两个字节串的中缀表达式
+func evalBytesInfixExpression(in *Interpreter, operator string, left, right *object.Bytes) object.Object {
+	switch operator {
+	case "+":
+		if err := in.allocate(stringSize(len(left.Value) + len(right.Value))); err != nil {
+			return err
+		}
+		value := make([]byte, 0, len(left.Value)+len(right.Value))
+		value = append(value, left.Value...)
+		return &object.Bytes{Value: append(value, right.Value...)}
+	case "==":
+		return nativeBoolToBooleanObject(bytes.Equal(left.Value, right.Value))
+	case "!=":
+		return nativeBoolToBooleanObject(!bytes.Equal(left.Value, right.Value))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
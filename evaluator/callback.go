@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"context"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 在 ctx 控制下执行代码, 用于在服务器中嵌入解释器, 防止脚本运行过久或者陷入无限递归:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//	defer cancel()
+//	result, err := evaluator.EvalContext(ctx, program, env)
+//
+// ctx 在每次调用函数, 迭代(take, 展开 [...xs] 和 yield* 等)的每一轮以及每执行 CANCEL_CHECK_INTERVAL 个节点时检查,
+// 事件循环(run_forever)等待时也会因为取消而返回; 正在执行的内置函数(例如读取子进程的输出)不会被打断
+// 在 env 所属的解释器中执行, 不同解释器中的 EvalContext 可以并发调用;
+// 定时任务和 on_exit 注册的函数(见 eventloop.go)是整个进程共用的, 只应该由一个宿主 goroutine 使用
+// 取消时返回 ctx.Err(), 其余和 CallFunction 相同
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	in := interpreterOf(env)
+	prev := in.cancelled
+	in.cancelled = ctx.Done()
+	defer func() { in.cancelled = prev }()
+
+	return hostResult(ctx, safely(in, func() object.Object { return Eval(node, env) }))
+}
+
+// 宿主调用脚本中的函数(回调)
+// 例如脚本把函数交给宿主作为 HTTP 处理函数, 宿主在 Eval 返回之后的任意 goroutine 中调用:
+//
+//	result, err := evaluator.CallFunction(ctx, handler, &object.String{Value: path})
+//
+// 每次调用使用一个新的解释器, 选项和函数所属的解释器相同, 运行状态(模块, 监视函数, 容错模式记录的错误等)各自独立,
+// 所以回调之间可以并发执行, 也可以在回调执行期间(例如回调调用的宿主函数中)再调用 CallFunction;
+// 整个进程共用的状态见 Interpreter, 其中事件循环(schedule, on_exit)不能在并发执行的回调中使用;
+// 并发执行的回调修改同一个闭包中的变量时由宿主负责同步
+// ctx 取消时在下一次检查时中止, 返回 ctx.Err()
+// 执行结果为错误或者 exit(n) 时作为 error 返回(*object.Error 或 *object.Exit)
+func CallFunction(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return nil, newError("not a function: nil")
+	}
+	if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+		return nil, newError("not a function %s", fn.Type())
+	}
+
+	in := ownerOf(fn).fork()
+	in.cancelled = ctx.Done()
+
+	return hostResult(ctx, safely(in, func() object.Object { return applyFunction(in, fn, args) }))
+}
+
+// 把执行结果转换成宿主使用的返回值
+func hostResult(ctx context.Context, result object.Object) (object.Object, error) {
+	switch result := result.(type) {
+	case *object.Error:
+		// 因为取消而中止时返回 ctx 的错误, 方便宿主判断
+		if err := ctx.Err(); err != nil && result.Kind == object.ResourceError {
+			return nil, err
+		}
+		return nil, result
+	case *object.Exit:
+		return nil, result
+	}
+	return result, nil
+}
+
+// 在 EvalContext 或者回调中时, 每执行多少个节点检查一次是否被取消
+// 没有函数调用的长时间计算(例如对很长的数组做运算)也能被取消
+const CANCEL_CHECK_INTERVAL = 1024
+
+// 被取消时返回错误, 由 applyFunction 在调用用户函数之前和迭代的每一轮检查
+func (in *Interpreter) checkCancelled() *object.Error {
+	if in.cancelled == nil {
+		return nil
+	}
+	select {
+	case <-in.cancelled:
+		return newFatalError(object.ResourceError, "evaluation cancelled")
+	default:
+		return nil
+	}
+}
+
+// 由 Eval 在每个节点调用, 每 CANCEL_CHECK_INTERVAL 个节点检查一次
+func (in *Interpreter) tick() *object.Error {
+	in.ticks++
+	if in.ticks%CANCEL_CHECK_INTERVAL != 0 {
+		return nil
+	}
+	return in.checkCancelled()
+}
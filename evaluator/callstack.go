@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+	"mk/token"
+)
+
+// 调用帧
+// 每调用一次用户定义函数压入一帧, 函数返回后弹出
+type frame struct {
+	name string         // 函数名, 匿名函数为 <anonymous>
+	pos  token.Position // 调用处的位置
+}
+
+// 在解释器 in 的调用栈中压入调用帧, callee 为被调用的表达式, pos 为调用处的位置
+func pushFrame(in *Interpreter, callee ast.Expression, pos token.Position) {
+	name := "<anonymous>"
+	if ident, ok := callee.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+	in.callStack = append(in.callStack, frame{name: name, pos: pos})
+}
+
+// 弹出调用帧
+func popFrame(in *Interpreter) {
+	in.callStack = in.callStack[:len(in.callStack)-1]
+}
+
+// 错误第一次从函数中返回时记录当前的调用栈, 之后外层的函数返回时不再改变
+func attachStack(in *Interpreter, result object.Object) {
+	err, ok := result.(*object.Error)
+	if !ok || err.Stack != nil || len(in.callStack) == 0 {
+		return
+	}
+	err.Stack = make([]object.StackFrame, len(in.callStack))
+	for i, f := range in.callStack {
+		err.Stack[len(in.callStack)-1-i] = object.StackFrame{Name: f.name, Pos: f.pos}
+	}
+}
+
+// callstack() 返回调用方的解释器中正在执行中的调用
+// 最外层的调用在前, 每一帧为 {"name": 函数名, "line": 调用处行号}
+func init() {
+	builtins["callstack"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			callStack := stateInterpreter(state).callStack
+			elements := make([]object.Object, len(callStack))
+			for i, f := range callStack {
+				hash := newHash()
+				hashSet(hash, "name", &object.String{Value: f.name})
+				hashSet(hash, "line", &object.Integer{Value: int64(f.pos.Line)})
+				elements[i] = hash
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+}
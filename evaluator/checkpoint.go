@@ -0,0 +1,202 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 断点, 用于可能被中断的长时间运行的批处理脚本
+//
+//	checkpoint(name)  把顶层环境中可以序列化的变量保存到 Options.CheckpointFile, 并记录 name 已经完成
+//
+// 只保存可以序列化的值(见 serialize), 其他的变量(函数, 模块等)不保存
+//
+// mk run --resume 时先读取断点文件(见 LoadCheckpoint): 最后完成的断点所在的顶层语句以及之前的语句不再执行,
+// 其中 struct 声明和值为函数字面量或者 import(...) 的 let 语句除外(这些值不能保存, 需要重新定义),
+// 然后恢复保存的变量, 从这个断点之后继续执行. 例如:
+//
+//	let rows = fetch_all();
+//	checkpoint("fetched");
+//	let report = summarize(rows);    // 中断之后 --resume 从这里继续, rows 从文件中恢复
+//	checkpoint("summarized");
+//
+// 只有作为顶层语句的 checkpoint("...") 调用可以恢复; 脚本成功执行完之后由宿主删除断点文件(见 ClearCheckpoint)
+func init() {
+	builtins["checkpoint"] = &object.Builtin{
+		EnvFn: func(env *object.Environment, args ...object.Object) object.Object {
+			name, err := configArg("checkpoint", args)
+			if err != nil {
+				return err
+			}
+			if env == nil {
+				return newError("`checkpoint` must be called directly, not as a callback")
+			}
+
+			// 没有断点文件(例如 mk -e 和 REPL)时什么也不做
+			in := interpreterOf(env)
+			if in.CheckpointFile == "" {
+				return NULL
+			}
+
+			for env.Outer() != nil {
+				env = env.Outer()
+			}
+			in.checkpointsDone = append(in.checkpointsDone, name)
+			if err := saveCheckpoint(in.CheckpointFile, in.checkpointsDone, env); err != nil {
+				return newError("could not save checkpoint %q: %s", name, err)
+			}
+			return NULL
+		},
+	}
+}
+
+// 断点文件的内容
+type checkpointState struct {
+	Completed []string             `json:"completed"`
+	Vars      []checkpointVariable `json:"vars"`
+}
+
+type checkpointVariable struct {
+	Name  string     `json:"name"`
+	Const bool       `json:"const,omitempty"`
+	Value serialized `json:"value"`
+}
+
+// 读取 Options.CheckpointFile, 之后这个解释器第一次执行的顶层程序从最后完成的断点之后继续
+// 文件不存在时(还没有完成任何断点)从头执行
+func (in *Interpreter) LoadCheckpoint() error {
+	path := in.CheckpointFile
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := &checkpointState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("invalid checkpoint file %s: %s", path, err)
+	}
+	in.resumeState = nil
+	if len(state.Completed) != 0 {
+		in.resumeState = state
+	}
+	return nil
+}
+
+// 删除断点文件, 脚本成功执行完之后调用
+func (in *Interpreter) ClearCheckpoint() error {
+	if in.CheckpointFile == "" {
+		return nil
+	}
+	if err := os.Remove(in.CheckpointFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 把已经完成的断点和 env 中可以序列化的变量写入文件
+// 先写入临时文件再改名, 保存时被中断也不会破坏上一个断点
+func saveCheckpoint(path string, completed []string, env *object.Environment) error {
+	state := checkpointState{Completed: completed, Vars: []checkpointVariable{}}
+	for _, name := range env.Names() {
+		value, _ := env.Get(name)
+		encoded, ok := serialize(value)
+		if !ok {
+			continue
+		}
+		state.Vars = append(state.Vars, checkpointVariable{Name: name, Const: env.IsConst(name), Value: encoded})
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 从断点恢复: 返回继续执行的第一个语句的下标
+// 跳过的语句中只执行函数, 结构体定义和 import, 然后恢复保存的变量
+func resumeProgram(in *Interpreter, state *checkpointState, program *ast.Program, env *object.Environment) (int, object.Object) {
+	name := state.Completed[len(state.Completed)-1]
+	stop := -1
+	for i, statement := range program.Statements {
+		if isCheckpointCall(statement, name) {
+			stop = i
+			break
+		}
+	}
+	if stop < 0 {
+		return 0, newError("cannot resume: checkpoint(%q) is not a top-level statement", name)
+	}
+
+	for _, statement := range program.Statements[:stop] {
+		switch s := statement.(type) {
+		case *ast.StructStatement:
+		case *ast.LetStatement:
+			if !isDefinition(s.Value) {
+				continue
+			}
+		default:
+			continue
+		}
+		if result := Eval(statement, env); isAbrupt(result) {
+			return 0, result
+		}
+	}
+
+	for _, v := range state.Vars {
+		value, err := deserialize(v.Value)
+		if err != nil {
+			return 0, newError("cannot resume: invalid value of %s: %s", v.Name, err)
+		}
+		if v.Const {
+			env.SetConst(v.Name, value)
+		} else {
+			env.Set(v.Name, value)
+		}
+	}
+	in.checkpointsDone = append([]string{}, state.Completed...)
+	return stop + 1, nil
+}
+
+// 语句是否为 checkpoint(name)
+func isCheckpointCall(statement ast.Statement, name string) bool {
+	es, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	call, ok := es.Expression.(*ast.CallExpression)
+	if !ok || len(call.Arguments) != 1 {
+		return false
+	}
+	fn, ok := call.Function.(*ast.Identifier)
+	if !ok || fn.Value != "checkpoint" {
+		return false
+	}
+	arg, ok := call.Arguments[0].(*ast.StringLiteral)
+	return ok && arg.Value == name
+}
+
+// 恢复时需要重新执行的 let 语句的值: 函数字面量和 import(...)
+func isDefinition(value ast.Expression) bool {
+	switch value := value.(type) {
+	case *ast.FunctionLiteral:
+		return true
+	case *ast.CallExpression:
+		fn, ok := value.Function.(*ast.Identifier)
+		return ok && fn.Value == "import"
+	default:
+		return false
+	}
+}
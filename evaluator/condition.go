@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// if 和三元表达式的条件
+// 常见的条件是比较运算和 '!', 直接计算出 Go 的 bool,
+// 不再经过 object.Boolean 和 isTruthy, 整数字面量也不再分配 object.Integer
+// 结果和 isTruthy(Eval(exp, env)) 相同, 出错时返回错误
+// 有步数限制或者钩子时每个节点都要经过 Eval 计数和调用钩子, 不走快速路径
+func evalCondition(exp ast.Expression, env *object.Environment) (bool, object.Object) {
+	in := interpreterOf(env)
+	if in.MaxSteps > 0 || in.hooked() {
+		return evalTruthy(exp, env)
+	}
+
+	switch exp := exp.(type) {
+
+	case *ast.Boolean:
+		return exp.Value, nil
+
+	// !x 和 !isTruthy(x) 相同
+	case *ast.PrefixExpression:
+		if exp.Operator == "!" {
+			truthy, err := evalCondition(exp.Right, env)
+			return !truthy, err
+		}
+
+	case *ast.InfixExpression:
+		if !in.HasOperator(exp.Operator) && isComparison(exp.Operator) {
+			return evalComparison(exp, env)
+		}
+	}
+	return evalTruthy(exp, env)
+}
+
+func evalTruthy(exp ast.Expression, env *object.Environment) (bool, object.Object) {
+	condition := Eval(exp, env)
+	if isAbrupt(condition) {
+		return false, condition
+	}
+	return isTruthy(condition), nil
+}
+
+func isComparison(operator string) bool {
+	switch operator {
+	case "<", ">", "==", "!=":
+		return true
+	}
+	return false
+}
+
+// 比较运算, 两边都是整数时直接比较
+func evalComparison(exp *ast.InfixExpression, env *object.Environment) (bool, object.Object) {
+	left, leftVal, leftInt := evalOperand(exp.Left, env)
+	if isAbrupt(left) {
+		return false, left
+	}
+	right, rightVal, rightInt := evalOperand(exp.Right, env)
+	if isAbrupt(right) {
+		return false, right
+	}
+
+	if leftInt && rightInt {
+		switch exp.Operator {
+		case "<":
+			return leftVal < rightVal, nil
+		case ">":
+			return leftVal > rightVal, nil
+		case "==":
+			return leftVal == rightVal, nil
+		default:
+			return leftVal != rightVal, nil
+		}
+	}
+
+	if left == nil {
+		left = &object.Integer{Value: leftVal}
+	}
+	if right == nil {
+		right = &object.Integer{Value: rightVal}
+	}
+
+	result := tolerate(env, evalInfixExpression(interpreterOf(env), exp.Operator, left, right), exp)
+	if isAbrupt(result) {
+		return false, result
+	}
+	return isTruthy(result), nil
+}
+
+// 执行比较运算的一边
+// 整数字面量不分配对象, 直接返回它的值(obj 为nil)
+func evalOperand(exp ast.Expression, env *object.Environment) (obj object.Object, value int64, isInt bool) {
+	if lit, ok := exp.(*ast.IntegerLiteral); ok {
+		return nil, lit.Value, true
+	}
+
+	obj = Eval(exp, env)
+	if integer, ok := obj.(*object.Integer); ok {
+		return obj, integer.Value, true
+	}
+	return obj, 0, false
+}
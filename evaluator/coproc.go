@@ -0,0 +1,194 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"mk/object"
+)
+
+// 交互式子进程
+// coproc(cmd) 启动子进程并连接它的标准输入和标准输出, cmd 为字符串时通过 sh -c 执行,
+// 为字符串数组时第一个元素是程序, 其余是参数; 子进程的标准错误输出到 Stderr
+// 返回一个map:
+//
+//	write_line(s)  向子进程写入一行(自动加换行符)
+//	read_line()    读取子进程输出的一行(不包含换行符), 输出结束时返回 null
+//	close()        关闭子进程的标准输入并等待退出, 返回退出码; 重复调用返回同样的结果
+//	               不会因为标准输入关闭而退出的子进程(例如 yes)会一直等待
+//	pid            子进程的进程号
+//
+// 例如:
+//
+//	let bc = coproc("bc");
+//	bc.write_line("1 + 2");
+//	puts(bc.read_line());
+//	bc.close();
+func init() {
+	builtins["coproc"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			var argv []string
+			switch arg := args[0].(type) {
+			case *object.String:
+				argv = []string{"sh", "-c", arg.Value}
+			case *object.Array:
+				for _, el := range arg.Elements {
+					s, ok := el.(*object.String)
+					if !ok {
+						return newError("argument to `coproc` must be ARRAY of STRING, got %s in array",
+							el.Type())
+					}
+					argv = append(argv, s.Value)
+				}
+				if len(argv) == 0 {
+					return newError("argument to `coproc` must not be empty")
+				}
+			default:
+				return newError("argument to `coproc` must be STRING or ARRAY, got %s",
+					args[0].Type())
+			}
+
+			return startCoproc(argv)
+		},
+	}
+}
+
+// 一个运行中的子进程
+type coproc struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	closed bool
+	code   int64 // 退出码, closed 之后有效
+}
+
+// 还没有 close() 的子进程, Shutdown() 时结束; 不同的解释器可能同时启动子进程
+var (
+	coprocsMu sync.Mutex
+	coprocs   = map[*coproc]bool{}
+)
+
+func startCoproc(argv []string) object.Object {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stderr = Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return newKindError(object.IOError, "coproc %s: %s", argv[0], err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return newKindError(object.IOError, "coproc %s: %s", argv[0], err)
+	}
+	if err := cmd.Start(); err != nil {
+		return newKindError(object.IOError, "coproc %s: %s", argv[0], err)
+	}
+
+	c := &coproc{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	coprocsMu.Lock()
+	coprocs[c] = true
+	coprocsMu.Unlock()
+
+	writeLine := func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1",
+				len(args))
+		}
+		s, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `write_line` must be STRING, got %s",
+				args[0].Type())
+		}
+		if c.closed {
+			return newKindError(object.IOError, "coproc is closed")
+		}
+		if _, err := io.WriteString(c.stdin, s.Value+"\n"); err != nil {
+			return newKindError(object.IOError, "coproc write: %s", err)
+		}
+		return NULL
+	}
+
+	readLine := func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0",
+				len(args))
+		}
+		if c.closed {
+			return newKindError(object.IOError, "coproc is closed")
+		}
+		line, err := c.stdout.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return NULL
+		}
+		if err != nil && err != io.EOF {
+			return newKindError(object.IOError, "coproc read: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		return &object.String{Value: line}
+	}
+
+	closeFn := func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0",
+				len(args))
+		}
+		if err := c.close(); err != nil {
+			return newKindError(object.IOError, "coproc close: %s", err)
+		}
+		return &object.Integer{Value: c.code}
+	}
+
+	hash := newHash()
+	hashSet(hash, "write_line", &object.Builtin{Fn: writeLine})
+	hashSet(hash, "read_line", &object.Builtin{Fn: readLine})
+	hashSet(hash, "close", &object.Builtin{Fn: closeFn})
+	hashSet(hash, "pid", &object.Integer{Value: int64(cmd.Process.Pid)})
+	return hash
+}
+
+// 关闭标准输入, 丢弃没有读取的输出, 等待子进程退出
+// 必须先读完输出再 Wait, 否则子进程可能阻塞在写输出上
+func (c *coproc) close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	coprocsMu.Lock()
+	delete(coprocs, c)
+	coprocsMu.Unlock()
+
+	c.stdin.Close()
+	io.Copy(ioutil.Discard, c.stdout)
+
+	err := c.cmd.Wait()
+	if _, ok := err.(*exec.ExitError); ok {
+		err = nil
+	}
+	c.code = int64(c.cmd.ProcessState.ExitCode())
+	return err
+}
+
+// 结束所有还没有关闭的子进程
+func killCoprocs() {
+	coprocsMu.Lock()
+	running := make([]*coproc, 0, len(coprocs))
+	for c := range coprocs {
+		running = append(running, c)
+	}
+	coprocsMu.Unlock()
+
+	for _, c := range running {
+		c.cmd.Process.Kill()
+		c.close()
+	}
+}
@@ -0,0 +1,27 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 调试器
+// REPL 等宿主通过设置 Debugger 挂载调试器,
+// 脚本执行到 breakpoint() 时以当前环境调用 Debugger, 返回后继续执行
+// 没有挂载调试器时 breakpoint() 不做任何事
+var Debugger func(env *object.Environment)
+
+func init() {
+	builtins["breakpoint"] = &object.Builtin{
+		EnvFn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			if Debugger != nil && env != nil {
+				Debugger(env)
+			}
+			return NULL
+		},
+	}
+}
@@ -0,0 +1,258 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 任意精度的十进制小数
+// 字面量: 12.50d, 12d; 构造: decimal("12.50"), decimal(12)
+// +, -, * 的结果是精确的, 小数位数分别为两边中较多的和两边之和;
+// / 的结果保留 DIVISION_SCALE 位小数(按 half_up 舍入), 再去掉末尾多余的0, 但不少于两边的小数位数
+// 和整数, 大整数运算时先转换成小数; 支持 <, >, ==, != 比较和取负; decimal(f) 按浮点数的最短写法转换
+//
+//	round(d, places, mode)  舍入到 places 位小数, mode 默认为 "half_up", 可选值见 roundingModes
+//
+// 例如:
+//
+//	let price = 19.99d;
+//	let total = price * 3;           // 59.97
+//	round(total / 7, 2)              // 8.57
+//	round(2.345d, 2, "half_even")    // 2.34
+const DIVISION_SCALE = 16
+
+// 舍入方式
+const (
+	ROUND_HALF_UP   = "half_up"   // 四舍五入, .5 远离0
+	ROUND_HALF_DOWN = "half_down" // .5 靠近0
+	ROUND_HALF_EVEN = "half_even" // .5 取偶数(银行家舍入)
+	ROUND_UP        = "up"        // 远离0
+	ROUND_DOWN      = "down"      // 靠近0(截断)
+	ROUND_CEILING   = "ceiling"   // 向正无穷
+	ROUND_FLOOR     = "floor"     // 向负无穷
+)
+
+var roundingModes = map[string]bool{
+	ROUND_HALF_UP:   true,
+	ROUND_HALF_DOWN: true,
+	ROUND_HALF_EVEN: true,
+	ROUND_UP:        true,
+	ROUND_DOWN:      true,
+	ROUND_CEILING:   true,
+	ROUND_FLOOR:     true,
+}
+
+func init() {
+	builtins["decimal"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Decimal:
+				return arg
+			case *object.Integer:
+				return integerToDecimal(arg)
+			case *object.BigInt:
+				return toDecimal(arg)
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newKindError(object.ArithmeticError, "cannot convert %s to DECIMAL", arg.Inspect())
+				}
+				d, _ := object.ParseDecimal(strconv.FormatFloat(arg.Value, 'f', -1, 64))
+				return d
+			case *object.String:
+				d, ok := object.ParseDecimal(arg.Value)
+				if !ok {
+					return newError("invalid decimal: %q", arg.Value)
+				}
+				return d
+			default:
+				return newError("argument to `decimal` must be STRING, INTEGER, BIGINT, FLOAT or DECIMAL, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["round"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 2 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+
+			var d *object.Decimal
+			var f *object.Float
+			switch arg := args[0].(type) {
+			case *object.Decimal:
+				d = arg
+			case *object.Integer:
+				d = integerToDecimal(arg)
+			case *object.Float:
+				f = arg
+			default:
+				return newError("first argument to `round` must be DECIMAL, INTEGER or FLOAT, got %s",
+					args[0].Type())
+			}
+
+			places, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("second argument to `round` must be INTEGER, got %s",
+					args[1].Type())
+			}
+			if places.Value < 0 {
+				return newError("negative decimal places: %d", places.Value)
+			}
+
+			mode := ROUND_HALF_UP
+			if len(args) == 3 {
+				s, ok := args[2].(*object.String)
+				if !ok {
+					return newError("third argument to `round` must be STRING, got %s",
+						args[2].Type())
+				}
+				if !roundingModes[s.Value] {
+					return newError("unknown rounding mode: %q", s.Value)
+				}
+				mode = s.Value
+			}
+			if f != nil {
+				return roundFloat(f, int(places.Value), mode)
+			}
+			return roundDecimal(d, int(places.Value), mode)
+		},
+	}
+}
+
+// 执行小数字面量, 字面量由词法分析保证格式正确
+func evalDecimalLiteral(node *ast.DecimalLiteral) object.Object {
+	d, ok := object.ParseDecimal(node.Value)
+	if !ok {
+		return newError("could not parse %q as decimal", node.Token.Literal)
+	}
+	return d
+}
+
+func integerToDecimal(i *object.Integer) *object.Decimal {
+	return &object.Decimal{Value: big.NewInt(i.Value), Scale: 0}
+}
+
+// 小数和小数, 或者小数和整数的中缀表达式
+func evalDecimalInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, rightVal := toDecimal(left), toDecimal(right)
+	scale := leftVal.Scale
+	if rightVal.Scale > scale {
+		scale = rightVal.Scale
+	}
+
+	switch operator {
+	case "+":
+		return &object.Decimal{Value: new(big.Int).Add(leftVal.Rescale(scale), rightVal.Rescale(scale)), Scale: scale}
+	case "-":
+		return &object.Decimal{Value: new(big.Int).Sub(leftVal.Rescale(scale), rightVal.Rescale(scale)), Scale: scale}
+	case "*":
+		return &object.Decimal{Value: new(big.Int).Mul(leftVal.Value, rightVal.Value), Scale: leftVal.Scale + rightVal.Scale}
+	case "/":
+		if rightVal.Value.Sign() == 0 {
+			return newKindError(object.ArithmeticError, "division by zero: %s / 0", left.Inspect())
+		}
+		return divideDecimal(leftVal, rightVal, scale)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func toDecimal(obj object.Object) *object.Decimal {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return integerToDecimal(obj)
+	case *object.BigInt:
+		return &object.Decimal{Value: obj.Value, Scale: 0}
+	default:
+		return obj.(*object.Decimal)
+	}
+}
+
+// 除法保留 DIVISION_SCALE 位小数, 然后去掉末尾的0, 最少保留 minScale 位
+func divideDecimal(left, right *object.Decimal, minScale int) *object.Decimal {
+	scale := DIVISION_SCALE
+	if minScale > scale {
+		scale = minScale
+	}
+
+	// left / right = (lv × 10^scale × 10^rs) / (rv × 10^ls) × 10^-scale
+	num := new(big.Int).Mul(left.Value, object.Pow10(scale+right.Scale))
+	den := new(big.Int).Mul(right.Value, object.Pow10(left.Scale))
+	result := &object.Decimal{Value: roundQuotient(num, den, ROUND_HALF_UP), Scale: scale}
+
+	trimmed := result.Normalize()
+	if trimmed.Scale < minScale {
+		return &object.Decimal{Value: trimmed.Rescale(minScale), Scale: minScale}
+	}
+	return trimmed
+}
+
+// 舍入到 places 位小数, 位数不够时在末尾补0
+func roundDecimal(d *object.Decimal, places int, mode string) *object.Decimal {
+	if d.Scale <= places {
+		return &object.Decimal{Value: d.Rescale(places), Scale: places}
+	}
+	value := roundQuotient(d.Value, object.Pow10(d.Scale-places), mode)
+	return &object.Decimal{Value: value, Scale: places}
+}
+
+// 按舍入方式计算 num / den
+func roundQuotient(num, den *big.Int, mode string) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// 结果的符号, 以及余数是否超过了一半
+	sign := num.Sign() * den.Sign()
+	half := new(big.Int).Abs(r)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(new(big.Int).Abs(den))
+
+	away := false
+	switch mode {
+	case ROUND_UP:
+		away = true
+	case ROUND_DOWN:
+		away = false
+	case ROUND_CEILING:
+		away = sign > 0
+	case ROUND_FLOOR:
+		away = sign < 0
+	case ROUND_HALF_UP:
+		away = cmp >= 0
+	case ROUND_HALF_DOWN:
+		away = cmp > 0
+	case ROUND_HALF_EVEN:
+		away = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+	}
+
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+// 可以参与小数运算的值
+func isDecimalOperand(obj object.Object) bool {
+	return obj.Type() == object.DECIMAL_OBJ || obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
@@ -0,0 +1,234 @@
+package evaluator
+
+import (
+	"math"
+	"time"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 时长
+// 字面量: 500ms, 30s, 5m, 1h30m; 构造: duration("1h30m"), duration(1500)(毫秒)
+//
+//	time_diff(a, b)   时间 a 减去时间 b 得到的时长, 参数为 TIME 或者 parse_time 可以解析的字符串
+//	humanize(d)       简略的输出, 只保留最大的两个单位, 例如 "2h 3m"
+//	milliseconds(d)   时长的毫秒数
+//
+// 运算:
+//
+//	时长 + 时长, 时长 - 时长, 时长 * 整数, 整数 * 时长, 时长 / 整数, 取负, 比较
+//	时间 + 时长, 时长 + 时间, 时间 - 时长 得到时间; 时间 - 时间 得到时长
+//
+// 时长的范围约为 ±292 年(time.Duration), 字面量, duration(n) 和运算的结果超出范围时是 ArithmeticError
+//
+// 例如:
+//
+//	let start = parse_time("2024-01-01 10:00:00", "UTC");
+//	let end = parse_time("2024-01-01 12:03:20", "UTC");
+//	start + 1h30m                  // 2024-01-01 11:30:00 +00:00 UTC
+//	humanize(time_diff(end, start)) // "2h 3m"
+func init() {
+	builtins["duration"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Duration:
+				return arg
+			case *object.Integer:
+				d, ok := mulDuration(time.Millisecond, arg.Value)
+				if !ok {
+					return durationOverflow("%dms", arg.Value)
+				}
+				return newDuration(d)
+			case *object.String:
+				d, err := time.ParseDuration(arg.Value)
+				if err != nil {
+					return newError("invalid duration: %q", arg.Value)
+				}
+				return newDuration(d)
+			default:
+				return newError("argument to `duration` must be STRING, INTEGER or DURATION, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["time_diff"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			a, err := timeArgument("time_diff", args[0])
+			if err != nil {
+				return err
+			}
+			b, err := timeArgument("time_diff", args[1])
+			if err != nil {
+				return err
+			}
+			return newDuration(a.Value.Sub(b.Value))
+		},
+	}
+
+	builtins["humanize"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			d, ok := args[0].(*object.Duration)
+			if !ok {
+				return newError("argument to `humanize` must be DURATION, got %s",
+					args[0].Type())
+			}
+			return &object.String{Value: d.Humanize()}
+		},
+	}
+
+	builtins["milliseconds"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			d, ok := args[0].(*object.Duration)
+			if !ok {
+				return newError("argument to `milliseconds` must be DURATION, got %s",
+					args[0].Type())
+			}
+			return &object.Integer{Value: int64(d.Value / time.Millisecond)}
+		},
+	}
+}
+
+// 精度为毫秒, 不足一毫秒的部分舍去
+func newDuration(d time.Duration) *object.Duration {
+	return &object.Duration{Value: d.Truncate(time.Millisecond)}
+}
+
+// 执行时长字面量, 字面量由词法分析保证格式正确
+func evalDurationLiteral(node *ast.DurationLiteral) object.Object {
+	// 格式已经检查过, 出错只能是超出范围
+	d, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return durationOverflow("%s", node.Value)
+	}
+	return newDuration(d)
+}
+
+// 结果超出时长的范围
+func durationOverflow(format string, args ...interface{}) *object.Error {
+	return newKindError(object.ArithmeticError, "duration overflow: "+format, args...)
+}
+
+// 两个时长相加, 溢出时 ok 为 false
+func addDurations(a, b time.Duration) (sum time.Duration, ok bool) {
+	sum = a + b
+	return sum, (sum > a) == (b > 0)
+}
+
+// 时长乘以整数, 溢出时 ok 为 false
+func mulDuration(d time.Duration, n int64) (product time.Duration, ok bool) {
+	if d == 0 || n == 0 {
+		return 0, true
+	}
+	product = d * time.Duration(n)
+	if product/time.Duration(n) != d || (n == -1 && d == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
+
+// 至少一边是时长的中缀表达式
+func evalDurationInfixExpression(operator string, left, right object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Duration:
+		switch right := right.(type) {
+		case *object.Duration:
+			return evalDurationPair(operator, left.Value, right.Value)
+		case *object.Integer:
+			switch operator {
+			case "*":
+				d, ok := mulDuration(left.Value, right.Value)
+				if !ok {
+					return durationOverflow("%s * %d", left.Inspect(), right.Value)
+				}
+				return newDuration(d)
+			case "/":
+				if right.Value == 0 {
+					return newKindError(object.ArithmeticError, "division by zero: %s / 0", left.Inspect())
+				}
+				return newDuration(left.Value / time.Duration(right.Value))
+			}
+		case *object.Time:
+			if operator == "+" {
+				return &object.Time{Value: right.Value.Add(left.Value)}
+			}
+		}
+
+	case *object.Integer:
+		if operator == "*" {
+			d, ok := mulDuration(right.(*object.Duration).Value, left.Value)
+			if !ok {
+				return durationOverflow("%d * %s", left.Value, right.Inspect())
+			}
+			return newDuration(d)
+		}
+
+	case *object.Time:
+		switch operator {
+		case "+":
+			return &object.Time{Value: left.Value.Add(right.(*object.Duration).Value)}
+		case "-":
+			return &object.Time{Value: left.Value.Add(-right.(*object.Duration).Value)}
+		}
+	}
+
+	if left.Type() != right.Type() {
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// 两个时长的运算
+func evalDurationPair(operator string, left, right time.Duration) object.Object {
+	switch operator {
+	case "+":
+		sum, ok := addDurations(left, right)
+		if !ok {
+			return durationOverflow("%s + %s", formatDurationValue(left), formatDurationValue(right))
+		}
+		return newDuration(sum)
+	case "-":
+		// 减去 right 等于加上 -right, -right 不会溢出(时长是毫秒的整数倍)
+		difference, ok := addDurations(left, -right)
+		if !ok {
+			return durationOverflow("%s - %s", formatDurationValue(left), formatDurationValue(right))
+		}
+		return newDuration(difference)
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	case "==":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: DURATION %s DURATION", operator)
+	}
+}
+
+// 时长的显示形式, 用于错误信息
+func formatDurationValue(d time.Duration) string {
+	return (&object.Duration{Value: d}).Inspect()
+}
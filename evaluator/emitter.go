@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 事件订阅/发布
+// emitter() 返回一个包含 on / emit / off 三个内置函数的map
+// 例如:
+//
+//	let bus = emitter();
+//	bus.on("tick", fn(x) { puts(x); });
+//	bus.emit("tick", 1);
+func init() {
+	builtins["emitter"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			return newEmitter()
+		},
+	}
+}
+
+// 构造一个emitter
+// 监听函数按事件名保存, 同一事件按注册顺序调用
+func newEmitter() *object.Hash {
+	listeners := make(map[string][]object.Object)
+
+	// 注册监听函数: on(ev, fn)
+	on := func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2",
+				len(args))
+		}
+
+		ev, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `on` must be STRING, got %s",
+				args[0].Type())
+		}
+
+		if !isCallable(args[1]) {
+			return newError("argument to `on` must be FUNCTION, got %s",
+				args[1].Type())
+		}
+
+		listeners[ev.Value] = append(listeners[ev.Value], args[1])
+		return NULL
+	}
+
+	// 触发事件: emit(ev, payload)
+	// 任何一个监听函数出错都会中止并返回该错误
+	emit := func(state object.State, args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments. got=%d, want=1 or 2",
+				len(args))
+		}
+
+		ev, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `emit` must be STRING, got %s",
+				args[0].Type())
+		}
+
+		// 复制一份, 防止监听函数在调用过程中修改监听列表
+		fns := make([]object.Object, len(listeners[ev.Value]))
+		copy(fns, listeners[ev.Value])
+
+		for _, fn := range fns {
+			result := applyFunction(stateInterpreter(state), fn, args[1:])
+			if isAbrupt(result) {
+				return result
+			}
+		}
+		return NULL
+	}
+
+	// 取消监听: off(ev, fn), 不传fn时移除该事件的所有监听函数
+	off := func(args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments. got=%d, want=1 or 2",
+				len(args))
+		}
+
+		ev, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `off` must be STRING, got %s",
+				args[0].Type())
+		}
+
+		if len(args) == 1 {
+			delete(listeners, ev.Value)
+			return NULL
+		}
+
+		kept := []object.Object{}
+		for _, fn := range listeners[ev.Value] {
+			if fn != args[1] {
+				kept = append(kept, fn)
+			}
+		}
+		listeners[ev.Value] = kept
+		return NULL
+	}
+
+	hash := newHash()
+	hashSet(hash, "on", &object.Builtin{Fn: on})
+	hashSet(hash, "emit", &object.Builtin{StateFn: emit})
+	hashSet(hash, "off", &object.Builtin{Fn: off})
+	return hash
+}
+
+// 检查是否可以被调用
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin, *object.StructType:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,103 @@
+package evaluator
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 函数调用环境的复用
+// 函数体中没有函数字面量(闭包)时, 调用结束后没有任何对象引用它的运行时环境,
+// 这种环境在调用结束后放回池中, 下次调用时清空后直接使用, 减少调用密集的脚本的GC压力
+
+// 空闲的函数运行时环境
+var envPool = sync.Pool{
+	New: func() interface{} { return object.NewEnvironment() },
+}
+
+// 从池中取出一个以 outer 为外层的环境
+func acquireEnv(outer *object.Environment) *object.Environment {
+	env := envPool.Get().(*object.Environment)
+	env.Reset(outer)
+	return env
+}
+
+// 放回池中, 同时清空以便尽早释放参数和局部变量
+func releaseEnv(env *object.Environment) {
+	env.Reset(nil)
+	envPool.Put(env)
+}
+
+// 调用结束后能否把函数的运行时环境放回池中
+// 执行钩子可能保留了 env(例如调试器), 解释器 in 有钩子时不复用
+func canReleaseEnv(in *Interpreter, fn *object.Function) bool {
+	return fn.Pooled && !in.hooked()
+}
+
+// ast.FunctionLiteral.EnvEscapes 的取值
+const (
+	ESCAPE_UNKNOWN = 0
+	ESCAPE_NO      = 1
+	ESCAPE_YES     = 2
+)
+
+// 函数的运行时环境在调用结束后是否可能还被引用
+// 结果保存在函数字面量上, 每个字面量只分析一次; 并发求值时最多重复分析几次
+func functionEscapes(fl *ast.FunctionLiteral) bool {
+	switch atomic.LoadInt32(&fl.EnvEscapes) {
+	case ESCAPE_NO:
+		return false
+	case ESCAPE_YES:
+		return true
+	}
+
+	escapes := escapingNode(fl.Body)
+	for _, def := range fl.Defaults {
+		escapes = escapes || escapingNode(def)
+	}
+	result := int32(ESCAPE_NO)
+	if escapes {
+		result = ESCAPE_YES
+	}
+	atomic.StoreInt32(&fl.EnvEscapes, result)
+	return escapes
+}
+
+// 节点中是否有会引用当前环境的代码:
+// 函数字面量(闭包), 需要调用处环境的内置函数(例如 breakpoint, vars)以及可能是这种内置函数的调用;
+// 内置函数可以赋给变量或者作为参数传递(let v = vars; v()), 所以只有直接调用不需要环境的内置函数时才确定不会引用
+func escapingNode(node ast.Node) bool {
+	escapes := false
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			escapes = true
+		case *ast.Identifier:
+			if builtin, ok := builtins[node.Value]; ok && builtin.EnvFn != nil {
+				escapes = true
+			}
+		case *ast.CallExpression:
+			escapes = !isPlainBuiltin(node.Function)
+		case *ast.PipeExpression:
+			// x |> f(a) 中的调用由 CallExpression 检查
+			if _, ok := node.Right.(*ast.CallExpression); !ok {
+				escapes = !isPlainBuiltin(node.Right)
+			}
+		}
+		return !escapes
+	})
+	return escapes
+}
+
+// 被调用的是不需要调用处环境的内置函数
+// 同名的变量遮盖了内置函数时调用的是用户定义函数, 它在定义时的环境中执行, 同样不会引用调用处的环境
+func isPlainBuiltin(callee ast.Expression) bool {
+	ident, ok := callee.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	builtin, ok := builtins[ident.Value]
+	return ok && builtin.EnvFn == nil
+}
@@ -1,13 +1,21 @@
 package evaluator
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
 
 	"mk/ast"
+	"mk/debuglog"
 	"mk/object"
 	//"mk/token"
 )
 
+// 执行过程的调试日志, MK_DEBUG=eval 打开, 见 debuglog
+var evalLog = debuglog.New("eval")
+
 var (
 	NULL  = &object.Null{}                // null
 	TRUE  = &object.Boolean{Value: true}  // true
@@ -23,27 +31,82 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
+// 字符串字面量对应的对象, 缓存在语法树节点上
+// 字符串是不可变的, 相同的字面量每次求值都返回同一个 object.String, 不再重复分配;
+// 缓存随语法树一起回收, 并发执行同一个语法树时最多多分配几次
+func literalString(cache *atomic.Value, value string) *object.String {
+	if str, ok := cache.Load().(*object.String); ok {
+		return str
+	}
+	str := &object.String{Value: value}
+	// 先计算 HashKey, 共享之后不再写入 str
+	str.HashKey()
+	cache.Store(str)
+	return str
+}
+
 // 执行 Node (Statement | Expression)
 // 新增一个执行中环境,用于关联变量
 func Eval(node ast.Node, env *object.Environment) object.Object {
 
+	// 在 EvalContext 或者回调中时定期检查是否被取消, 见 callback.go
+	in := interpreterOf(env)
+	if in.cancelled != nil {
+		if err := in.tick(); err != nil {
+			return err
+		}
+	}
+
+	// 执行步数的限制, 见 budget.go
+	if in.MaxSteps > 0 {
+		if err := in.countStep(); err != nil {
+			return err
+		}
+	}
+
+	// 执行的钩子, 见 hooks.go
+	var result object.Object
+	if in.hooked() {
+		result = evalHooked(in, node, env)
+	} else {
+		result = eval(node, env)
+	}
+
+	// 错误记下第一次出现时所在节点的位置, 外层的节点不再改变
+	if err, ok := result.(*object.Error); ok && err.Pos.Line == 0 && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
-	// 语句列表
+	// 语句列表, 执行中的 panic 转换为错误, 见 recover.go
 	case *ast.Program:
-		return evalProgram(node, env)
+		return safely(interpreterOf(env), func() object.Object { return evalProgram(node, env) })
 
 	// 表达式语句
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
-	// 需要检查一下
+	// 代码块有自己的作用域: 块中 let 声明的变量只在块中可见,
+	// 和外层同名时遮盖外层的变量, 块执行完之后外层的变量不变
+	// 函数体直接在函数的运行时环境中执行, 见 applyFunction
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
 
 	// 整型
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	// 小数
+	case *ast.DecimalLiteral:
+		return evalDecimalLiteral(node)
+
+	// 时长
+	case *ast.DurationLiteral:
+		return evalDurationLiteral(node)
+
 	// 布尔类型
 	case *ast.Boolean:
 		// 返回全局的引用
@@ -51,7 +114,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	// 字符串
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return literalString(&node.Object, node.Value)
 
 	//前缀表达式
 	case *ast.PrefixExpression:
@@ -60,39 +123,55 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// 所以先把执行出来结果再进行前缀操作
 		right := Eval(node.Right, env)
 
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalPrefix(node.Operator, right)
+		return tolerate(env, evalPrefix(node.Operator, right), node)
 
 	// 中缀表达式
 	// 先分别求出左，右表达式再进行计算
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 
 		right := Eval(node.Right, env)
 
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return tolerate(env, evalInfixExpression(interpreterOf(env), node.Operator, left, right), node)
 
 	// if 类型表达式
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	// 三元表达式
+	case *ast.TernaryExpression:
+		return evalTernaryExpression(node, env)
+
 	// return 语句
 	// 返回return类型值
+	// throw 语句
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+
+	// yield, 见 generator.go
+	case *ast.YieldStatement:
+		return evalYieldStatement(node, env)
+
+	// try 表达式
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 
@@ -102,81 +181,228 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	// let语句的返回值就是变量代表的表达式的值
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
+		// let f = fn() {...} 时记下函数名
+		if fn, ok := val.(*object.Function); ok {
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = node.Name.Value
+			}
+		}
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot assign to constant %s", node.Name.Value)
+		}
+		if interpreterOf(env).Strict && env.Has(node.Name.Value) {
+			return newKindError(object.NameError, "%s is already declared in this scope", node.Name.Value)
+		}
+		if node.IsConst() {
+			return env.SetConst(node.Name.Value, val)
+		}
 		return env.Set(node.Name.Value, val)
 
+	// struct语句定义结构体类型
+	case *ast.StructStatement:
+		return evalStructStatement(node, env)
+
 	// 执行标识符的时候,需要传入环境
 	// 在环境中取值然后执行
 	case *ast.Identifier:
-		return evalIdentifer(node, env)
+		return tolerate(env, evalIdentifer(node, env), node)
 
 	// 定义函数
 	case *ast.FunctionLiteral:
+		if interpreterOf(env).Strict {
+			if err := checkParameters(node); err != nil {
+				return err
+			}
+		}
 		params := node.Parameters
+		defaults := node.Defaults
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		rest := node.Rest
+		return &object.Function{Parameters: params, Defaults: defaults,
+			Rest: rest, Env: env, Body: body, Pooled: !functionEscapes(node), Generator: functionYields(node)}
 
 	// 调用函数
 	case *ast.CallExpression:
-		// 解析出object.Function类型
-		function := Eval(node.Function, env)
+		return evalCall(node, node.Function, node.Arguments, env)
 
-		if isError(function) {
-			return function
-		}
-
-		// 运行参数表达式,解析[]object.Object做为参数
-		args := evalExpressions(node.Arguments, env)
-
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
+	// 管道, 按调用执行
+	case *ast.PipeExpression:
+		return evalPipeExpression(node, env)
 
 	// 解析数组
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
+		if err := interpreterOf(env).allocate(arraySize(int64(len(elements)))); err != nil {
+			return tolerate(env, err, node)
+		}
 		return &object.Array{Elements: elements}
 
 	// 解析下标
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if left == NULL {
+			return tolerate(env, nullAccess(node.Left, env), node)
+		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return tolerate(env, indexAccess(evalIndexExpression(interpreterOf(env), left, index), node, env), node)
+
+	// 解析切片
+	case *ast.SliceExpression:
+		return tolerate(env, evalSliceExpression(node, env), node)
+
+	// 解析成员访问, 等价于以字符串为下标访问map
+	case *ast.DotExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		return evalDotExpression(node, left, env)
 
 	// 解析map类型
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+
+	// match 表达式
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	// 区间
+	case *ast.RangeExpression:
+		return evalRangeExpression(node, env)
+
+	// 展开表达式只能出现在函数调用参数和数组字面量中, 由 evalExpressions 处理
+	case *ast.SpreadExpression:
+		return newError("spread is only allowed in call arguments and array literals")
 	}
 
-	return nil
+	// 解析器不会产生未知类型的节点, 出现即为内部错误
+	return newFatalError(object.InternalError, "unknown node type %T", node)
+}
+
+// 调用函数, node 为调用表达式或者管道, 用于调用帧和错误的位置
+func evalCall(node ast.Expression, callee ast.Expression, arguments []ast.Expression,
+	env *object.Environment) object.Object {
+
+	// 解析出object.Function类型, obj.method(...) 时同时得到接收者
+	function, self := evalCallee(callee, env)
+
+	if isAbrupt(function) {
+		return function
+	}
+
+	// 运行参数表达式,解析[]object.Object做为参数
+	args := evalExpressions(arguments, env)
+
+	if len(args) == 1 && isAbrupt(args[0]) {
+		return args[0]
+	}
+
+	// 需要调用处环境的内置函数
+	in := interpreterOf(env)
+	if builtin, ok := function.(*object.Builtin); ok && builtin.EnvFn != nil {
+		return callBuiltin(in, env, builtin, args)
+	}
+
+	// 用户定义函数记录调用帧, 函数中出错时把调用栈记录到错误中
+	if _, ok := function.(*object.Function); ok {
+		pushFrame(in, callee, node.Pos())
+		defer popFrameOrRecordPanic(in)
+
+		result := applyMethod(in, function, self, args)
+		attachStack(in, result)
+		return tolerate(env, result, node)
+	}
+
+	return tolerate(env, applyFunction(in, function, args), node)
 }
 
-// 使方法作用于参数
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// 管道 x |> f(a, b) 按调用 f(x, a, b) 执行, 右边不是调用时按 f(x) 执行
+// 和调用一样先求值函数, 再从 x 开始依次求值参数
+func evalPipeExpression(node *ast.PipeExpression, env *object.Environment) object.Object {
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		arguments := make([]ast.Expression, 0, len(call.Arguments)+1)
+		arguments = append(append(arguments, node.Left), call.Arguments...)
+		return evalCall(node, call.Function, arguments, env)
+	}
+	return evalCall(node, node.Right, []ast.Expression{node.Left}, env)
+}
+
+// 解析成员访问, 等价于以字符串为下标访问map
+func evalDotExpression(node *ast.DotExpression, left object.Object, env *object.Environment) object.Object {
+	if left == NULL {
+		return tolerate(env, nullAccess(node.Left, env), node)
+	}
+	if ext, ok := left.(*object.External); ok {
+		return tolerate(env, externalMethod(ext, node.Name.Value), node)
+	}
+	if s, ok := left.(*object.Struct); ok {
+		return tolerate(env, structField(s, node.Name.Value), node)
+	}
+	if left.Type() != object.HASH_OBJ {
+		return tolerate(env, newError("dot access not supported: %s", left.Type()), node)
+	}
+	// 使用常量池中的字符串, 重复访问时不用再计算 HashKey
+	return tolerate(env, evalHashIndexExpression(left, literalString(&node.Key, node.Name.Value)), node)
+}
+
+// 使方法作用于参数, in 为调用方的解释器, 用户定义函数在其中执行
+func applyFunction(in *Interpreter, fn object.Object, args []object.Object) object.Object {
+	return applyMethod(in, fn, nil, args)
+}
+
+// 和 applyFunction 相同, self 不为 nil 时用户定义函数的运行时环境中 self 为接收者
+func applyMethod(in *Interpreter, fn object.Object, self object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	// 用户定义函数
 	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
+		if err := in.checkCancelled(); err != nil {
+			return err
+		}
+		if in.MaxCallDepth > 0 && in.callDepth >= in.MaxCallDepth {
+			return newKindError(object.ResourceError, "maximum recursion depth exceeded: limit %d", in.MaxCallDepth)
+		}
+		extendEnv, err := extendFunctionEnv(in, fn, self, args)
+		if err != nil {
+			return err
+		}
+		if fn.Generator {
+			return newGenerator(fn, extendEnv)
+		}
+		if evalLog.Enabled(debuglog.DEBUG) {
+			name := fn.Name
+			if name == "" {
+				name = "<anonymous>"
+			}
+			evalLog.Debug("call", "fn", name, "args", len(args), "depth", in.callDepth+1)
+		}
+		in.callDepth++
+		evaluated := evalFunctionBody(fn.Body, extendEnv)
+		in.callDepth--
+		if canReleaseEnv(in, fn) {
+			releaseEnv(extendEnv)
+		}
 		return unwrapReturnValue(evaluated)
 
+	// 结构体类型, 构造实例
+	case *object.StructType:
+		return newStruct(in, fn, args)
+
 	// 内置函数
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return callBuiltin(in, nil, fn, args)
 
 	//
 	default:
@@ -187,15 +413,69 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 // 以函数结构体环境为外环境(函数定义时的环境,定义时传入)
 // 以当前参数组成的环境为内环境
 // 返回一个新的函数运行时环境
-func extendFunctionEnv(fn *object.Function,
-	args []object.Object) *object.Environment {
-
-	env := object.NewEnclosedEnvironment(fn.Env)
+// 缺少的参数使用默认值, 默认值在调用时于新环境中执行, 所以可以引用前面的参数
+// 作为方法调用时先绑定 self, 同名的参数优先
+// 新环境从池中取出, 见 escape.go; 新环境属于调用方的解释器 in
+func extendFunctionEnv(in *Interpreter, fn *object.Function, self object.Object,
+	args []object.Object) (*object.Environment, *object.Error) {
+
+	env := acquireEnv(fn.Env)
+	env.SetState(in)
+	if self != nil {
+		if err, ok := env.Set(SELF, self).(*object.Error); ok {
+			return nil, err
+		}
+	}
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			if err, ok := env.Set(param.Value, args[paramIdx]).(*object.Error); ok {
+				return nil, err
+			}
+			continue
+		}
+
+		def, ok := fn.Defaults[param.Value]
+		if !ok {
+			return nil, newError("wrong number of arguments. got=%d, want=%d",
+				len(args), len(fn.Parameters)-len(fn.Defaults))
+		}
+
+		val := Eval(def, env)
+		if err, ok := val.(*object.Error); ok {
+			return nil, err
+		}
+		if err, ok := env.Set(param.Value, val).(*object.Error); ok {
+			return nil, err
+		}
+	}
+
+	// 多余的参数放入剩余参数
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		if err, ok := env.Set(fn.Rest.Value, &object.Array{Elements: rest}).(*object.Error); ok {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// 调用内置函数, 按需要传入调用处的环境 env 或者解释器 in
+// env 为 nil(内置函数作为回调调用)时 EnvFn 收到 nil; 新创建的结果计入内存限制, 见 budget.go
+func callBuiltin(in *Interpreter, env *object.Environment, fn *object.Builtin, args []object.Object) object.Object {
+	var result object.Object
+	switch {
+	case fn.StateFn != nil:
+		result = fn.StateFn(in, args...)
+	case fn.EnvFn != nil:
+		result = fn.EnvFn(env, args...)
+	default:
+		result = fn.Fn(args...)
 	}
-	return env
+	return in.allocateResult(result, args)
 }
 
 // 剥离return值的包裹
@@ -218,11 +498,40 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 
 	// 挨个解析表达式,并加入到结果列表中
 	for _, e := range exps {
+		// 展开表达式: 把可迭代对象中的值逐个加入结果列表
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			evaluated := Eval(spread.Value, env)
+			if isAbrupt(evaluated) {
+				return []object.Object{evaluated}
+			}
+
+			it, ok := iterOf(evaluated)
+			if !ok {
+				return []object.Object{
+					newError("cannot spread %s, want %s", evaluated.Type(), ITERABLE_TYPES),
+				}
+			}
+			// 很大的区间在展开之前就报错
+			if sized, ok := evaluated.(object.Sized); ok {
+				if err := interpreterOf(env).allocate(sized.Len() * ELEMENT_SIZE); err != nil {
+					return []object.Object{err}
+				}
+			}
+			err := eachValue(interpreterOf(env), it, func(value object.Object) bool {
+				result = append(result, value)
+				return true
+			})
+			if err != nil {
+				return []object.Object{err}
+			}
+			continue
+		}
+
 		// 执行表达式
 		evaluated := Eval(e, env)
 
 		// 执行错误直接返回
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
@@ -235,9 +544,25 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
-	for _, statement := range program.Statements {
+	// --resume 时从最后完成的断点之后继续
+	statements := program.Statements
+	if in := interpreterOf(env); in.resumeState != nil {
+		state := in.resumeState
+		in.resumeState = nil
+		start, err := resumeProgram(in, state, program, env)
+		if err != nil {
+			return err
+		}
+		statements = statements[start:]
+	}
+
+	for _, statement := range statements {
 		result = Eval(statement, env)
 
+		if evalLog.Enabled(debuglog.TRACE) {
+			traceStatement(statement, result)
+		}
+
 		switch result := result.(type) {
 
 		// 如果是return类型,直接返回值
@@ -247,6 +572,10 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 		// 如果是错误类型,直接返回错误
 		case *object.Error:
 			return result
+
+		// exit(n), 停止执行
+		case *object.Exit:
+			return result
 		}
 	}
 	return result
@@ -263,8 +592,30 @@ func evalStatements(stmts []ast.Statement, env *object.Environment) object.Objec
 	return result
 }
 
+// 执行函数体
+// 和 Eval 一样计步并调用钩子, 但不再为代码块新建作用域: 函数的运行时环境已经是新的环境,
+// 参数和函数体中的变量在同一个作用域中
+func evalFunctionBody(body *ast.BlockStatement, env *object.Environment) object.Object {
+	in := interpreterOf(env)
+	if in.MaxSteps > 0 {
+		if err := in.countStep(); err != nil {
+			return err
+		}
+	}
+
+	if in.EnterHook != nil {
+		in.EnterHook(body, env)
+	}
+	result := evalBlockStatement(body, env)
+	if in.TraceHook != nil {
+		in.TraceHook(body, env, result)
+	}
+	return result
+}
+
+// 空代码块的值为 null
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
-	var result object.Object
+	var result object.Object = NULL
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
 
@@ -273,21 +624,28 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 		// 因为有些语句会嵌套执行,提前返回
 		// 例如:if (10 > 1) {if (10 > 1) {return 10;} return 1;};
 
-		// ----------------- 调试专用 -------------------
-		// fmt.Printf("\n")
-		// println(statement.String())
-		// fmt.Printf("%T", result)
-		// fmt.Printf("\n")
-		// ----------------- 调试专用结束-----------------
+		if evalLog.Enabled(debuglog.TRACE) {
+			traceStatement(statement, result)
+		}
 
-		if result.Type() == object.RETURN_VALUE_OBJ ||
-			result.Type() == object.ERROR_OBJ {
+		if result.Type() == object.RETURN_VALUE_OBJ || isAbrupt(result) {
 			return result
 		}
 	}
 	return result
 }
 
+// 输出一条语句执行的结果
+func traceStatement(statement ast.Statement, result object.Object) {
+	pos := statement.Pos()
+	kind := "<nil>"
+	if result != nil {
+		kind = string(result.Type())
+	}
+	evalLog.Trace("statement", "pos", fmt.Sprintf("%d:%d", pos.Line, pos.Column),
+		"stmt", statement.String(), "result", kind)
+}
+
 // 解析前缀表达式
 func evalPrefix(operator string, right object.Object) object.Object {
 	switch operator {
@@ -322,8 +680,24 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 // 解析'-'前缀表达式
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 
+	if d, ok := right.(*object.Decimal); ok {
+		return &object.Decimal{Value: new(big.Int).Neg(d.Value), Scale: d.Scale}
+	}
+
+	if d, ok := right.(*object.Duration); ok {
+		return &object.Duration{Value: -d.Value}
+	}
+
+	if f, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -f.Value}
+	}
+
+	if b, ok := right.(*object.BigInt); ok {
+		return &object.BigInt{Value: new(big.Int).Neg(b.Value)}
+	}
+
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknon operator: -%s", right.Type())
+		return newError("unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -331,26 +705,75 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 }
 
 // 解析中缀表达式
-func evalInfixExpression(operator string, left object.Object,
+func evalInfixExpression(in *Interpreter, operator string, left object.Object,
 	right object.Object) object.Object {
 
+	// 宿主注册的运算符, 结果和内置函数一样计入内存限制
+	if fn, ok := in.Operators[operator]; ok {
+		return in.allocateResult(fn(left, right), []object.Object{left, right})
+	}
+
 	switch {
 
 	// 左右都是数值类型
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 
+	// 大整数, 或者大整数和整数
+	case isBigIntOperand(left) && isBigIntOperand(right):
+		return evalBigIntInfixExpression(operator, left, right)
+
+	// 小数, 或者小数和整数, 大整数
+	case isDecimalOperand(left) && isDecimalOperand(right) &&
+		(left.Type() == object.DECIMAL_OBJ || right.Type() == object.DECIMAL_OBJ):
+		return evalDecimalInfixExpression(operator, left, right)
+
+	// 浮点数, 或者浮点数和整数
+	case isFloatOperand(left) && isFloatOperand(right):
+		return evalFloatInfixExpression(operator, left, right)
+
 	// 左右都是string类型
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return evalStringInfixExpression(in, operator, left, right)
+
+	// 左右都是字节串
+	case left.Type() == object.BYTES_OBJ && right.Type() == object.BYTES_OBJ:
+		return evalBytesInfixExpression(in, operator, left.(*object.Bytes), right.(*object.Bytes))
+
+	// 左右都是数组
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayInfixExpression(in, operator, left, right)
 
-	// "==" 还能判断更多的类型,比如boolean
+	// 左右都是map
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
+		return evalHashInfixExpression(in, operator, left, right)
+
+	// 时长, 或者时长和时间, 整数
+	case left.Type() == object.DURATION_OBJ || right.Type() == object.DURATION_OBJ:
+		return evalDurationInfixExpression(operator, left, right)
+
+	// 左右都是时间
+	case left.Type() == object.TIME_OBJ && right.Type() == object.TIME_OBJ:
+		return evalTimeInfixExpression(operator, left.(*object.Time), right.(*object.Time))
+
+	// 字符串重复: "ab" * 3, 3 * "ab"
+	case operator == "*" && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalStringRepeat(in, left.(*object.String), right.(*object.Integer))
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringRepeat(in, right.(*object.String), left.(*object.Integer))
+
+	// 左右类型不一致
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator,
+			right.Type())
+
+	// "==" 还能判断更多的类型,比如boolean, 结构体按字段比较
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 
 	// "!=" 还能判断更多的类型,比如boolean
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 
 	// 如果暂时无法处理,返回一个错误
 	default:
@@ -359,6 +782,95 @@ func evalInfixExpression(operator string, left object.Object,
 	}
 }
 
+// 处理数组类型的中缀表达式
+// '+' 连接成新数组, '==' 和 '!=' 逐个元素比较
+func evalArrayInfixExpression(in *Interpreter, operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Array)
+	rightVal := right.(*object.Array)
+
+	switch operator {
+
+	case "+":
+		if err := in.allocate(arraySize(int64(len(leftVal.Elements) + len(rightVal.Elements)))); err != nil {
+			return err
+		}
+		elements := make([]object.Object, 0, len(leftVal.Elements)+len(rightVal.Elements))
+		elements = append(elements, leftVal.Elements...)
+		elements = append(elements, rightVal.Elements...)
+		return &object.Array{Elements: elements}
+
+	case "==":
+		return nativeBoolToBooleanObject(arraysEqual(leftVal, rightVal))
+
+	case "!=":
+		return nativeBoolToBooleanObject(!arraysEqual(leftVal, rightVal))
+
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator,
+			right.Type())
+	}
+}
+
+// 长度相同并且每个元素都相等(元素按 objectsEqual 比较)
+func arraysEqual(left, right *object.Array) bool {
+	if len(left.Elements) != len(right.Elements) {
+		return false
+	}
+	for i, el := range left.Elements {
+		if !objectsEqual(el, right.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 处理map类型的中缀表达式
+// '+' 合并成新map, 相同的key取右边的值(位置在左边), 右边新的key排在后面; '==' 和 '!=' 逐个key比较, 与顺序无关
+func evalHashInfixExpression(in *Interpreter, operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Hash)
+	rightVal := right.(*object.Hash)
+
+	switch operator {
+
+	case "+":
+		if err := in.allocate(hashSize(leftVal.Len() + rightVal.Len())); err != nil {
+			return err
+		}
+		hash := object.NewHash(leftVal.Len() + rightVal.Len())
+		for _, key := range leftVal.Keys {
+			hash.Set(key, leftVal.Pairs[key])
+		}
+		for _, key := range rightVal.Keys {
+			hash.Set(key, rightVal.Pairs[key])
+		}
+		return hash
+
+	case "==":
+		return nativeBoolToBooleanObject(hashesEqual(leftVal, rightVal))
+
+	case "!=":
+		return nativeBoolToBooleanObject(!hashesEqual(leftVal, rightVal))
+
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator,
+			right.Type())
+	}
+}
+
+// key 相同并且每个key对应的值都相等(值按 objectsEqual 比较)
+func hashesEqual(left, right *object.Hash) bool {
+	if left.Len() != right.Len() {
+		return false
+	}
+	for key, pair := range left.Pairs {
+		other, ok := right.Get(key)
+		if !ok || !objectsEqual(pair.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
+
 // 解析处理integer类型的中缀表达式
 func evalIntegerInfixExpression(operator string,
 	left object.Object, right object.Object) object.Object {
@@ -378,6 +890,9 @@ func evalIntegerInfixExpression(operator string,
 		return &object.Integer{Value: leftVal * rightVal}
 
 	case "/":
+		if rightVal == 0 {
+			return newKindError(object.ArithmeticError, "division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 
 	case "<":
@@ -399,34 +914,61 @@ func evalIntegerInfixExpression(operator string,
 }
 
 // 处理string类型中缀表达式
-// 暂时只有连字符'+'
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+// 连字符'+'以及按值比较的'==', '!='
+func evalStringInfixExpression(in *Interpreter, operator string, left, right object.Object) object.Object {
 
-	if operator != "+" {
-		return newError("unknow operator: %s %s %s",
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+
+	case "+":
+		if err := in.allocate(stringSize(len(leftVal) + len(rightVal))); err != nil {
+			return err
+		}
+		return &object.String{Value: leftVal + rightVal}
+
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+
+	default:
+		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
+}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+// 重复后的字符串最大长度(字节)
+const MAX_REPEAT_LENGTH = 1 << 26
+
+// 字符串重复 count 次, count 为0时为空字符串
+func evalStringRepeat(in *Interpreter, s *object.String, count *object.Integer) object.Object {
+	if count.Value < 0 {
+		return newError("negative repeat count: %d", count.Value)
+	}
+	if len(s.Value) != 0 && count.Value > MAX_REPEAT_LENGTH/int64(len(s.Value)) {
+		return newKindError(object.ResourceError, "repeated string too long: %d * %d bytes, limit %d",
+			count.Value, len(s.Value), MAX_REPEAT_LENGTH)
+	}
+	if err := in.allocate(stringSize(len(s.Value) * int(count.Value))); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.Repeat(s.Value, int(count.Value))}
 }
 
 // 解析if表达式
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 
 	// 执行条件表达式
-	condition := Eval(ie.Condition, env)
-
-	//println(condition.Type())
-	//println(condition.Inspect())
-
-	if isError(condition) {
-		return condition
+	truthy, err := evalCondition(ie.Condition, env)
+	if err != nil {
+		return err
 	}
 
 	// 条件表达式为真,执行then部分
-	if isTruthy(condition) {
+	if truthy {
 		return Eval(ie.Consequence, env)
 
 		// 条件表达式为假,执行else部分
@@ -439,6 +981,107 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+// 解析三元表达式
+// 和if表达式一样, 只执行被选中的一边
+func evalTernaryExpression(te *ast.TernaryExpression, env *object.Environment) object.Object {
+	truthy, err := evalCondition(te.Condition, env)
+	if err != nil {
+		return err
+	}
+
+	if truthy {
+		return Eval(te.Consequence, env)
+	}
+	return Eval(te.Alternative, env)
+}
+
+// 解析区间表达式
+func evalRangeExpression(re *ast.RangeExpression, env *object.Environment) object.Object {
+	start := Eval(re.Start, env)
+	if isAbrupt(start) {
+		return start
+	}
+
+	end := Eval(re.Stop, env)
+	if isAbrupt(end) {
+		return end
+	}
+
+	if start.Type() != object.INTEGER_OBJ || end.Type() != object.INTEGER_OBJ {
+		return newError("range bounds must be INTEGER, got %s%s%s",
+			start.Type(), re.Token.Literal, end.Type())
+	}
+
+	return &object.Range{
+		Start:     start.(*object.Integer).Value,
+		End:       end.(*object.Integer).Value,
+		Exclusive: re.Exclusive,
+	}
+}
+
+// 解析match表达式
+// 依次比较每个分支, 执行第一个匹配分支的表达式
+// 没有任何分支匹配且没有默认分支时返回null
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		// 默认分支
+		if arm.Pattern == nil {
+			return Eval(arm.Body, env)
+		}
+
+		pattern := Eval(arm.Pattern, env)
+		if isAbrupt(pattern) {
+			return pattern
+		}
+
+		if objectsEqual(subject, pattern) || matchesStructType(subject, pattern) {
+			return Eval(arm.Body, env)
+		}
+	}
+
+	return NULL
+}
+
+// 比较两个值是否相等
+// 数值和字符串按值比较, 数组和map逐个元素比较, 其他类型按引用比较
+func objectsEqual(left, right object.Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Decimal:
+		return left.Cmp(right.(*object.Decimal)) == 0
+	case *object.Float:
+		return left.Value == right.(*object.Float).Value
+	case *object.BigInt:
+		return left.Value.Cmp(right.(*object.BigInt).Value) == 0
+	case *object.Bytes:
+		return bytes.Equal(left.Value, right.(*object.Bytes).Value)
+	case *object.Time:
+		return left.Value.Equal(right.(*object.Time).Value)
+	case *object.Duration:
+		return left.Value == right.(*object.Duration).Value
+	case *object.Array:
+		return arraysEqual(left, right.(*object.Array))
+	case *object.Hash:
+		return hashesEqual(left, right.(*object.Hash))
+	case *object.Struct:
+		return structsEqual(left, right.(*object.Struct))
+	default:
+		return left == right
+	}
+}
+
 // 检查object是不是boolean
 // 需要兼容其他类型
 func isTruthy(obj object.Object) bool {
@@ -459,16 +1102,45 @@ func isTruthy(obj object.Object) bool {
 }
 
 // 生成错误(辅助函数)
+// 大部分运行时错误都是类型错误, 其他类别使用 newKindError
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return newKindError(object.TypeError, format, a...)
 }
 
-// 检查是不是错误
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+// 生成指定类别的错误
+func newKindError(kind object.ErrorKind, format string,
+	a ...interface{}) *object.Error {
+
+	err := &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+	if evalLog.Enabled(debuglog.DEBUG) {
+		evalLog.Debug("error", "kind", err.Kind, "message", err.Message)
 	}
-	return false
+	return err
+}
+
+// 生成不可恢复的错误
+// 用于内部状态错误以及宿主要求不可恢复的资源限制
+func newFatalError(kind object.ErrorKind, format string,
+	a ...interface{}) *object.Error {
+
+	err := newKindError(kind, format, a...)
+	err.Fatal = true
+	return err
+}
+
+// 检查是不是错误, 不包括 exit(n)
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+// 检查是不是 exit(n) 的结果
+func isExit(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.EXIT_OBJ
+}
+
+// 检查是不是中止执行的结果: 错误或者 exit(n), 两者都需要中止执行并上抛
+func isAbrupt(obj object.Object) bool {
+	return isError(obj) || isExit(obj)
 }
 
 // 运行标识符表达式
@@ -487,16 +1159,34 @@ func evalIdentifer(node *ast.Identifier, env *object.Environment) object.Object
 	}
 
 	// 如果都查找不到则返回错误
-	return newError("idenfier not found: " + node.Value)
+	return newKindError(object.NameError, "identifier not found: %s", node.Value)
 }
 
 // 解析下标表达式
-func evalIndexExpression(left, index object.Object) object.Object {
+func evalIndexExpression(in *Interpreter, left, index object.Object) object.Object {
 	switch {
 
 	// 左值是数组,index是数字,则解析的是数组表达式
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
+		return evalArrayIndexExpression(in, left, index)
+
+	// 字符串下标, 按字符(rune)取值
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(in, left, index)
+
+	// 字节串下标, 按字节取值
+	case left.Type() == object.BYTES_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalBytesIndexExpression(in, left.(*object.Bytes), index.(*object.Integer))
+
+	// 区间下标
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		rng := left.(*object.Range)
+		idx, ok := in.resolveIndex(index.(*object.Integer).Value, rng.Len())
+		if !ok {
+			return in.indexOutOfRange(index, rng.Len())
+		}
+		n, _ := rng.At(idx)
+		return &object.Integer{Value: n}
 
 	// map类型没有要求,map类型的key可以是任何类型,只要HashKey()相同即可
 	case left.Type() == object.HASH_OBJ:
@@ -508,30 +1198,173 @@ func evalIndexExpression(left, index object.Object) object.Object {
 }
 
 // 解析数组类型下标表达式
-func evalArrayIndexExpression(array, index object.Object) object.Object {
+func evalArrayIndexExpression(in *Interpreter, array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 
-	idx := index.(*object.Integer).Value
+	length := int64(len(arrayObject.Elements))
 
 	// 检查下标是否越界
-	max := int64(len(arrayObject.Elements) - 1)
-	if idx < 0 || idx > max {
-		return NULL
+	idx, ok := in.resolveIndex(index.(*object.Integer).Value, length)
+	if !ok {
+		return in.indexOutOfRange(index, length)
 	}
 
 	return arrayObject.Elements[idx]
 }
 
+// 解析字符串类型下标表达式
+// 返回只包含一个字符的字符串
+func evalStringIndexExpression(in *Interpreter, str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	length := int64(len(runes))
+
+	idx, ok := in.resolveIndex(index.(*object.Integer).Value, length)
+	if !ok {
+		return in.indexOutOfRange(index, length)
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+// 严格模式下检查函数字面量中重复的参数名(包括剩余参数)
+func checkParameters(node *ast.FunctionLiteral) *object.Error {
+	seen := make(map[string]bool, len(node.Parameters)+1)
+	params := node.Parameters
+	if node.Rest != nil {
+		params = append(params[:len(params):len(params)], node.Rest)
+	}
+	for _, param := range params {
+		if seen[param.Value] {
+			return newKindError(object.NameError, "duplicate parameter %s", param.Value)
+		}
+		seen[param.Value] = true
+	}
+	return nil
+}
+
+// 把下标转换为 [0, length) 之间的位置, 越界时ok为false
+// 下标规则见 Options.NegativeIndex 和 Options.StrictIndex
+func (in *Interpreter) resolveIndex(idx int64, length int64) (int64, bool) {
+	if idx < 0 && in.NegativeIndex {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return 0, false
+	}
+	return idx, true
+}
+
+// 下标越界的结果
+func (in *Interpreter) indexOutOfRange(index object.Object, length int64) object.Object {
+	if in.StrictIndex {
+		return newKindError(object.IndexError,
+			"index out of range: %s, length %d", index.Inspect(), length)
+	}
+	return NULL
+}
+
+// 解析切片表达式
+// 返回新的数组/字符串/字节串, 下标超出范围时截断到范围之内(不受 StrictIndex 影响)
+// 字符串按字符(rune)切片, 字节串按字节切片
+func evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(se.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	var length int64
+	var runes []rune
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		runes = []rune(left.Value)
+		length = int64(len(runes))
+	case *object.Bytes:
+		length = int64(len(left.Value))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	start, err := evalSliceBound(se.Start, env, 0, length)
+	if err != nil {
+		return err
+	}
+	end, err := evalSliceBound(se.Stop, env, length, length)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		start = end
+	}
+
+	if arr, ok := left.(*object.Array); ok {
+		if err := interpreterOf(env).allocate(arraySize(int64(end - start))); err != nil {
+			return err
+		}
+		elements := make([]object.Object, end-start)
+		copy(elements, arr.Elements[start:end])
+		return &object.Array{Elements: elements}
+	}
+	if err := interpreterOf(env).allocate(stringSize(int(end - start))); err != nil {
+		return err
+	}
+	if b, ok := left.(*object.Bytes); ok {
+		return &object.Bytes{Value: append([]byte{}, b.Value[start:end]...)}
+	}
+	return &object.String{Value: string(runes[start:end])}
+}
+
+// 解析切片的一个下标, 省略时使用默认值, 结果截断到 [0, length]
+func evalSliceBound(exp ast.Expression, env *object.Environment,
+	def int64, length int64) (int64, object.Object) {
+
+	if exp == nil {
+		return def, nil
+	}
+
+	bound := Eval(exp, env)
+	if isAbrupt(bound) {
+		return 0, bound
+	}
+
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice index must be INTEGER, got %s", bound.Type())
+	}
+
+	return interpreterOf(env).clampSliceBound(integer.Value, length), nil
+}
+
+// 把切片下标截断到 [0, length]
+// 负数下标和下标一样从末尾开始计数
+func (in *Interpreter) clampSliceBound(i int64, length int64) int64 {
+	if i < 0 && in.NegativeIndex {
+		i += length
+	}
+	switch {
+	case i < 0:
+		return 0
+	case i > length:
+		return length
+	default:
+		return i
+	}
+}
+
 // 解析map类型
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Pairs))
+
+	// 按源码中的顺序执行, 相同的 key 后面的覆盖前面的(位置不变)
+	for _, pair := range node.Pairs {
+		keyNode, valueNode := pair.Key, pair.Value
 
-	for keyNode, valueNode := range node.Pairs {
 		// 因为key也可以是表达式,所以先执行获取key的值
 		// 例如: let a = {11+22 : "33"};最终会被解析为{33: "33"}
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -543,14 +1376,16 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 		// 执行value表达式
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	if err := interpreterOf(env).allocate(hashSize(hash.Len())); err != nil {
+		return err
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 // 解析map下标
@@ -564,7 +1399,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	}
 
 	// 通过下标获取值
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key.HashKey())
 	if !ok {
 		return NULL
 	}
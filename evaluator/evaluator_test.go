@@ -1,8 +1,29 @@
 package evaluator
 
 import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"mk/ast"
 	"mk/lexer"
 	"mk/object"
 	"mk/parser"
@@ -23,11 +44,18 @@ func TestEvalIntegetExpression(t *testing.T) {
 }
 
 func testEval(input string) object.Object {
+	in := New(DefaultOptions())
+	defer in.Close()
+	return testEvalWith(in, input)
+}
+
+// 在给定的解释器中执行, 用于测试选项和执行之后解释器的状态
+func testEvalWith(in *Interpreter, input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	env := object.NewEnviroment()
-	return Eval(program, env)
+	env := object.NewEnvironment()
+	return in.Eval(program, env)
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -177,6 +205,8 @@ func TestErrorHandling(t *testing.T) {
 }`, "unknown operator: BOOLEAN + BOOLEAN"},
 		{"foobar", "identifier not found: foobar"},
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"let f = fn(n) { 100 / (n - 1) }; f(1)", "division by zero: 100 / 0"},
 	}
 
 	for _, tt := range tests {
@@ -199,10 +229,10 @@ func TestStatement(t *testing.T) {
 		input    string
 		expected int64
 	}{
-		{"let a = 4; a ;", 5},
+		{"let a = 4; a ;", 4},
 		{"let a = 5 * 5; ", 25},
 		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b; c;", 15},
+		{"let a = 5; let b = a; let c = a + b; c;", 10},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -216,10 +246,32 @@ func TestErrorHanding(t *testing.T) {
 	}{
 		{
 			"footbar",
-			"Identifier not found: foobar",
+			"identifier not found: footbar",
+		},
+		{
+			"let f = fn(x) { x + y }; f(1)",
+			"identifier not found: y",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"5 + true",
+			"type mismatch: INTEGER + BOOLEAN",
 		},
 	}
-	// [....]
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
 }
 
 func TestFunctionObject(t *testing.T) {
@@ -256,6 +308,3815 @@ func TestFunctionApplication(t *testing.T) {
 		{"fn(x){x;}(5)", 5},
 	}
 	for _, tt := range tests {
-		testDecimalObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEmitter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let bus = emitter();
+		  bus["on"]("ev", fn(x) { x + true });
+		  bus["emit"]("ev", 1);`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`let bus = emitter();
+		  bus["on"]("ev", fn(x) { x + true });
+		  bus["emit"]("other", 1);`, "null"},
+		{`let bus = emitter();
+		  let handler = fn(x) { x + true };
+		  bus["on"]("ev", handler);
+		  bus["off"]("ev", handler);
+		  bus["emit"]("ev", 1);`, "null"},
+		{`let bus = emitter();
+		  bus["on"]("ev", fn(x) { x + true });
+		  bus["off"]("ev");
+		  bus["emit"]("ev", 1);`, "null"},
+		{`emitter()["on"]("ev", 1)`, "ERROR: argument to `on` must be FUNCTION, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+	// 监听函数收到 emit 传入的值, 同一事件按注册顺序调用
+	var got []string
+	env := object.NewEnvironment()
+	env.Set("record", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		got = append(got, args[0].Inspect())
+		return NULL
+	}})
+	input := `let bus = emitter();
+bus.on("ev", fn(x) { record(x) });
+bus.on("ev", fn(x) { record(x * 2) });
+bus.on("other", fn(x) { record("other") });
+bus.emit("ev", 21);
+bus.emit("ev", "a");`
+	result := New(DefaultOptions()).Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	if isAbrupt(result) {
+		t.Fatalf("emit failed: %s", result.Inspect())
+	}
+	if strings.Join(got, ",") != "21,42,a,aa" {
+		t.Errorf("listeners recorded %v, want [21 42 a aa]", got)
+	}
+}
+
+func TestCoproc(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let c = coproc("cat");
+		  c.write_line("hello");
+		  c.write_line("world");
+		  [c.read_line(), c.read_line(), c.close()]`, "[hello, world, 0]"},
+		{`let c = coproc(["sh", "-c", "read x; echo got $x; exit 3"]);
+		  c.write_line("1");
+		  [c.read_line(), c.read_line(), c.close(), c.close()]`, "[got 1, null, 3, 3]"},
+		// close() 时没有读取的输出被丢弃
+		{`let c = coproc("seq 1 100000; cat"); c.read_line(); c.close()`, "0"},
+		{`let c = coproc("cat"); c.close(); c.write_line("x")`, "ERROR: coproc is closed"},
+		{`let c = coproc("cat"); c.close(); c.read_line()`, "ERROR: coproc is closed"},
+		{`coproc(1)`, "ERROR: argument to `coproc` must be STRING or ARRAY, got INTEGER"},
+		{`coproc([])`, "ERROR: argument to `coproc` must not be empty"},
+		{`coproc(["cat", 1])`, "ERROR: argument to `coproc` must be ARRAY of STRING, got INTEGER in array"},
+		{`try { coproc(["./no-such-program"]) } catch (e: IOError) { "io" }`, "io"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Shutdown() 结束没有关闭的子进程
+	testEval(`coproc("cat")`)
+	if len(coprocs) != 1 {
+		t.Fatalf("expected 1 running coproc, got=%d", len(coprocs))
+	}
+	Shutdown()
+	if len(coprocs) != 0 {
+		t.Errorf("coprocs not killed by Shutdown, got=%d", len(coprocs))
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`platform().os`, runtime.GOOS},
+		{`platform().arch`, runtime.GOARCH},
+		{`platform().mk_version`, VERSION},
+		{`platform().backend`, "tree-walking"},
+		{`has_builtin("len")`, "true"},
+		{`has_builtin("no_such_builtin")`, "false"},
+		{`let f = fn() { 1 }; has_builtin("f")`, "false"},
+		{`has_feature("pipe")`, "true"},
+		{`has_feature("goto")`, "false"},
+		{`has_feature(1)`, "ERROR: argument to `has_feature` must be STRING, got INTEGER"},
+		{`has_builtin()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMachine(t *testing.T) {
+	spec := `let m = machine({
+		"initial": "idle",
+		"transitions": {
+			"idle": {"start": "running"},
+			"running": {"stop": "idle", "fail": "broken"}
+		},
+		"handlers": {"broken": fn(from, event) { from + 1 }}
+	});`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{spec + `state(m);`, "idle"},
+		{spec + `fire(m, "start");`, "running"},
+		{spec + `fire(m, "start"); fire(m, "stop"); state(m);`, "idle"},
+		{spec + `fire(m, "stop");`, `ERROR: no transition for event "stop" in state "idle"`},
+		{spec + `fire(m, "start"); fire(m, "fail");`, "ERROR: type mismatch: STRING + INTEGER"},
+		{`machine({"transitions": {}})`, "ERROR: machine spec must have a STRING `initial` state"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2] + [3]`, "[1, 2, 3]"},
+		{`[] + [1] + []`, "[1]"},
+		{`let a = [1]; let b = a + [2]; [a, b]`, "[[1], [1, 2]]"},
+		{`[1, 2] == [1, 2]`, "true"},
+		{`[1, "a", [true]] == [1, "a", [true]]`, "true"},
+		{`[1, 2] == [2, 1]`, "false"},
+		{`[1, 2] == [1, 2, 3]`, "false"},
+		{`[1] == ["1"]`, "false"},
+		{`[1, 2] != [1, 2]`, "false"},
+		{`[[1]] != [[2]]`, "true"},
+		{`[] == []`, "true"},
+		{`[1] - [1]`, "ERROR: unknown operator: ARRAY - ARRAY"},
+		{`[1] + 1`, "ERROR: type mismatch: ARRAY + INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {"a": 1, "b": 2} + {"b": 3, "c": 4}; [h.a, h.b, h.c, len(h)]`, "[1, 3, 4, 3]"},
+		{`let a = {"a": 1}; let b = a + {"a": 2}; [a.a, b.a]`, "[1, 2]"},
+		{`{} + {"a": 1}`, "{a: 1}"},
+		{`{"a": 1, "b": [1, 2]} == {"b": [1, 2], "a": 1}`, "true"},
+		{`{"a": {"b": true}} == {"a": {"b": true}}`, "true"},
+		{`{"a": 1} == {"a": 2}`, "false"},
+		{`{"a": 1} == {"b": 1}`, "false"},
+		{`{"a": 1} == {"a": 1, "b": 2}`, "false"},
+		{`{1: "a"} == {"1": "a"}`, "false"},
+		{`{"a": 1} != {"a": 1}`, "false"},
+		{`match ({"k": 1}) { {"k": 1} => "one", _ => "other" }`, "one"},
+		{`{"a": 1} - {"a": 1}`, "ERROR: unknown operator: HASH - HASH"},
+		{`{"a": 1} + [1]`, "ERROR: type mismatch: HASH + ARRAY"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => 10, 2 => 20, _ => 30 }`, 10},
+		{`match (2) { 1 => 10, 2 => 20, _ => 30 }`, 20},
+		{`match (3) { 1 => 10, 2 => 20, _ => 30 }`, 30},
+		{`match (3) { 1 => 10, 2 => 20 }`, nil},
+		{`match ("a") { "b" => 1, "a" => 2 }`, 2},
+		{`match (true) { 1 => 1, true => 2 }`, 2},
+		{`let x = 5; match (x * 2) { x + 5 => x, _ => 0 }`, 5},
+		{`match (1) { 1 => 10, 1 => 20 }`, 10},
+		{`match ([1, [2]]) { [1, 2] => 1, [1, [2]] => 2 }`, 2},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestBreakpoint(t *testing.T) {
+	// 未挂载调试器时为空操作
+	if evaluated := testEval(`breakpoint(); 5`); evaluated.Inspect() != "5" {
+		t.Errorf("breakpoint without debugger should be a no-op. got=%q",
+			evaluated.Inspect())
+	}
+
+	var hits []int64
+	Debugger = func(env *object.Environment) {
+		x, ok := env.Get("x")
+		if !ok {
+			t.Errorf("x not found in breakpoint environment")
+			return
+		}
+		hits = append(hits, x.(*object.Integer).Value)
+	}
+	defer func() { Debugger = nil }()
+
+	testEval(`let f = fn(x) { breakpoint(); x }; let x = 1; breakpoint(); f(2);`)
+
+	if len(hits) != 2 || hits[0] != 1 || hits[1] != 2 {
+		t.Errorf("breakpoint hits wrong. got=%v", hits)
+	}
+}
+
+func TestTernaryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"1 < 2 ? 10 : 20", 10},
+		{"1 > 2 ? 10 : 1 > 0 ? 20 : 30", 20},
+		{"let max = fn(a, b) { a > b ? a : b }; max(3, 7);", 7},
+		{"false ? 1 + true : 3", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	builtins["test_panic"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			var hash *object.Hash
+			return hash.Pairs[object.HashKey{}].Value
+		},
+	}
+	defer delete(builtins, "test_panic")
+
+	tests := []struct {
+		input string
+		stack string
+	}{
+		{`test_panic()`, ""},
+		{`let inner = fn() { test_panic() };
+let outer = fn() { [1, inner()] };
+outer()`, "    at inner (line 2, column 24)\n    at outer (line 3, column 1)"},
+		// 不能被脚本捕获
+		{`let f = fn() { test_panic() };
+try { f() } catch (e) { "caught" } finally { 1 }`, "    at f (line 2, column 7)"},
+	}
+
+	for _, tt := range tests {
+		in := New(DefaultOptions())
+		err, ok := testEvalWith(in, tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if err.Kind != object.InternalError || err.Recoverable() {
+			t.Errorf("expected fatal InternalError. got=%s, fatal=%t", err.Kind, err.Fatal)
+		}
+		if !strings.HasPrefix(err.Message, "internal error: runtime error: invalid memory address or nil pointer dereference (at evaluator/evaluator_test.go:") {
+			t.Errorf("wrong message. got=%q", err.Message)
+		}
+		if trace := err.StackTrace(); trace != tt.stack {
+			t.Errorf("wrong stack for %q.\nexpected=%q\ngot=%q", tt.input, tt.stack, trace)
+		}
+		if len(in.callStack) != 0 || in.tryDepth != 0 || in.panicked != nil {
+			t.Errorf("evaluator state not restored. frames=%d, tryDepth=%d", len(in.callStack), in.tryDepth)
+		}
+	}
+
+	// on_exit 中的 panic
+	testEval(`on_exit(fn() { test_panic() })`)
+	if result := Shutdown(); !isError(result) || result.(*object.Error).Kind != object.InternalError {
+		t.Errorf("expected InternalError from Shutdown. got=%s", result.Inspect())
+	}
+}
+
+func TestCallstack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`callstack()`, `[]`},
+		{`let f = fn() { callstack() };
+f()`, `[{line: 2, name: f}]`},
+		{`let inner = fn() { callstack() };
+let outer = fn() {
+	inner()
+};
+outer();`, `[{line: 5, name: outer}, {line: 3, name: inner}]`},
+		{`fn() { len(callstack()) }()`, `1`},
+	}
+	in := New(DefaultOptions())
+	for _, tt := range tests {
+		evaluated := testEvalWith(in, tt.input)
+		actual := evaluated.Inspect()
+		if arr, ok := evaluated.(*object.Array); ok {
+			frames := []string{}
+			for _, el := range arr.Elements {
+				hash := el.(*object.Hash)
+				frames = append(frames, fmt.Sprintf("{line: %s, name: %s}",
+					hashGet(hash, "line").Inspect(), hashGet(hash, "name").Inspect()))
+			}
+			actual = "[" + strings.Join(frames, ", ") + "]"
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong callstack for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+
+	if len(in.callStack) != 0 {
+		t.Errorf("call stack not empty after evaluation. got=%d frames", len(in.callStack))
+	}
+
+	// 宿主回调在自己的解释器中执行, 看不到调用宿主函数的脚本中的调用帧
+	builtins["test_callback"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			result, err := CallFunction(context.Background(), args[0])
+			if err != nil {
+				return newError("%s", err)
+			}
+			return result
+		},
+	}
+	defer delete(builtins, "test_callback")
+
+	evaluated := testEvalWith(in, `let inner = fn() { callstack() };
+let cb = fn() { [len(callstack()), len(inner())] };
+let outer = fn() { test_callback(cb) };
+outer()`)
+	if evaluated.Inspect() != "[0, 1]" {
+		t.Errorf("wrong callstack in callback. got=%s", evaluated.Inspect())
+	}
+	if len(in.callStack) != 0 {
+		t.Errorf("call stack not empty after callback. got=%d frames", len(in.callStack))
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + true`, ""},
+		{`let inner = fn(x) { x + true };
+let outer = fn() {
+	inner(1)
+};
+outer();`, "    at inner (line 3, column 2)\n    at outer (line 5, column 1)"},
+		{`let f = fn() { throw "boom" }; fn() { f() }()`,
+			"    at f (line 1, column 39)\n    at <anonymous> (line 1, column 32)"},
+		{`let f = fn(x) { x.y }; 1 |> f`, "    at f (line 1, column 24)"},
+		{`let f = fn(x, y) { x.y };
+let g = fn() { [1]
+	|> f(2) };
+g()`, "    at f (line 2, column 16)\n    at g (line 4, column 1)"},
+		// 在函数中被捕获的错误不会带上调用栈
+		{`let f = fn() { 1 + true };
+let g = fn() { try { f() } catch (e) { e.message } };
+g() + true`, ""},
+		{`let f = fn() { 1 + true };
+let g = fn() { try { f() } catch (e) { e.message } };
+let h = fn() { g() + true };
+h()`, "    at h (line 4, column 1)"},
+	}
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if trace := err.StackTrace(); trace != tt.expected {
+			t.Errorf("wrong stack trace for %q.\nexpected=%q\ngot=%q",
+				tt.input, tt.expected, trace)
+		}
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	down := `let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } };`
+	tests := []struct {
+		maxDepth int
+		input    string
+		expected interface{}
+	}{
+		{10000, down + `down(5000)`, 0},
+		{10, down + `down(9)`, 0},
+		{10, down + `down(10)`, "maximum recursion depth exceeded: limit 10"},
+		{10, down + `try { down(100) } catch (e: ResourceError) { e.kind }`, "ResourceError"},
+		{0, down + `down(20000)`, 0},
+	}
+	for _, tt := range tests {
+		in := New(Options{MaxCallDepth: tt.maxDepth})
+		evaluated := testEvalWith(in, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong result. expected=%q, got=%q", expected, result.Value)
+				}
+			default:
+				t.Errorf("unexpected result %T (%+v)", evaluated, evaluated)
+			}
+		}
+		if in.callDepth != 0 {
+			t.Errorf("callDepth not restored after %q, got=%d", tt.input, in.callDepth)
+		}
+	}
+
+	err, ok := testEvalWith(New(Options{MaxCallDepth: 5}), down+"\ndown(10)").(*object.Error)
+	if !ok {
+		t.Fatalf("expected error")
+	}
+	expected := "    at down (line 1, column 45)\n    ... repeated 4 more times\n    at down (line 2, column 1)"
+	if trace := err.StackTrace(); trace != expected {
+		t.Errorf("wrong stack trace.\nexpected=%q\ngot=%q", expected, trace)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	changes := []string{}
+	in := New(DefaultOptions())
+	in.Watch("x", func(old, val object.Object) object.Object {
+		changes = append(changes, old.Inspect()+" -> "+val.Inspect())
+		return nil
+	})
+	testEvalWith(in, `let x = 1; let x = x + 1; let f = fn(x) { let y = x; y }; f(10); let z = 3;`)
+	// 其他解释器中的赋值不触发监视
+	testEval(`let x = 50`)
+	in.Unwatch("x")
+	testEvalWith(in, `let x = 100`)
+
+	expected := []string{"null -> 1", "1 -> 2", "2 -> 10"}
+	if len(changes) != len(expected) {
+		t.Fatalf("wrong changes. expected=%q, got=%q", expected, changes)
+	}
+	for i, change := range expected {
+		if changes[i] != change {
+			t.Errorf("changes[%d] wrong. expected=%q, got=%q", i, change, changes[i])
+		}
+	}
+	if in.Watches("x") {
+		t.Errorf("x still watched after unwatch")
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let n = 0; watch("x", fn(old, new) { new * 2 }); let x = 5; x`, 5},
+		{`watch("x", fn(old, new) { if (new > 2) { throw "too big" } }); let x = 1; let x = 3; x`, "too big"},
+		{`watch("x", fn(old, new) { if (new > 2) { throw "too big" } });
+		  try { let x = 3; 0 } catch (e) { e.message }`, "too big"},
+		{`watch("x", fn(old, new) { throw "param" }); let f = fn(x) { x }; f(1)`, "param"},
+		// 监视函数中的赋值不会再触发监视
+		{`watch("x", fn(old, new) { let x = new + 1; x }); let x = 1; x`, 1},
+		{`watch(1, fn() {})`, "argument to `watch` must be STRING, got INTEGER"},
+		{`watch("x", 1)`, "argument to `watch` must be FUNCTION, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong result. expected=%q, got=%q", expected, result.Value)
+				}
+			default:
+				t.Errorf("unexpected result %T (%+v) for %q", evaluated, evaluated, tt.input)
+			}
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`12.50d`, "12.50"},
+		{`12d`, "12"},
+		{`-0.05d`, "-0.05"},
+		{`0.1d + 0.2d`, "0.3"},
+		{`decimal("0.1") + decimal("0.2") == 0.3d`, "true"},
+		{`19.99d * 3`, "59.97"},
+		{`1.10d * 2.5d`, "2.750"},
+		{`10d - 0.01d`, "9.99"},
+		{`1 + 0.5d`, "1.5"},
+		{`1d / 3`, "0.3333333333333333"},
+		{`2d / 3`, "0.6666666666666667"},
+		{`10.00d / 4`, "2.50"},
+		{`1d / 8`, "0.125"},
+		{`1.5d > 1`, "true"},
+		{`1.5d < 1.49d`, "false"},
+		{`1.50d == 1.5d`, "true"},
+		{`1d == 1`, "true"},
+		{`1.5d != 1.5d`, "false"},
+		{`{1.5d: "a"}[1.50d]`, "a"},
+		{`decimal(-3)`, "-3"},
+		{`decimal("+0.001")`, "0.001"},
+		{`round(2.345d, 2)`, "2.35"},
+		{`round(2.345d, 2, "half_even")`, "2.34"},
+		{`round(2.355d, 2, "half_even")`, "2.36"},
+		{`round(2.345d, 2, "half_down")`, "2.34"},
+		{`round(-2.5d, 0)`, "-3"},
+		{`round(-2.1d, 0, "floor")`, "-3"},
+		{`round(-2.9d, 0, "ceiling")`, "-2"},
+		{`round(2.01d, 1, "up")`, "2.1"},
+		{`round(2.09d, 1, "down")`, "2.0"},
+		{`round(1.5d, 3)`, "1.500"},
+		{`round(7, 2)`, "7.00"},
+		{`match (1.50d) { 1.5d => "x", _ => "y" }`, "x"},
+		{`1d / 0`, "division by zero: 1 / 0"},
+		{`1.5d + "a"`, "type mismatch: DECIMAL + STRING"},
+		{`decimal("1.")`, `invalid decimal: "1."`},
+		{`decimal("1e5")`, `invalid decimal: "1e5"`},
+		{`round(1d, -1)`, "negative decimal places: -1"},
+		{`round(1d, 1, "nearest")`, `unknown rounding mode: "nearest"`},
+		{`try { 1d / 0 } catch (e: ArithmeticError) { e.kind }`, "ArithmeticError"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if err, ok := evaluated.(*object.Error); ok {
+			got = err.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	down := `let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } };`
+	tests := []struct {
+		maxSteps int64
+		input    string
+		expected interface{}
+	}{
+		{0, down + `down(1000)`, 0},
+		{100000, down + `down(1000)`, 0},
+		{1000, down + `down(1000)`, "step limit exceeded: 1000"},
+		// 不能被 try 捕获
+		{1000, down + `try { down(1000) } catch (e) { 1 }`, "step limit exceeded: 1000"},
+		{3, `1 + 2 + 3`, "step limit exceeded: 3"},
+		// 条件中的节点也计数: Program, ExpressionStatement, if, (1 < 2), 1, 2, 代码块, ExpressionStatement, 1
+		{9, `if (1 < 2) { 1 }`, 1},
+		{8, `if (1 < 2) { 1 }`, "step limit exceeded: 8"},
+		{7, `1 < 2 ? 1 : 0`, 1},
+		{6, `1 < 2 ? 1 : 0`, "step limit exceeded: 6"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(Options{MaxSteps: tt.maxSteps}), tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok || err.Message != expected || err.Kind != object.ResourceError || err.Recoverable() {
+				t.Errorf("expected fatal ResourceError %q for %q. got=%+v", expected, tt.input, evaluated)
+			}
+		}
+	}
+
+	// 相同的脚本总是执行相同的步数
+	first, second := New(Options{MaxSteps: 1 << 40}), New(Options{MaxSteps: 1 << 40})
+	testEvalWith(first, down+`down(100)`)
+	testEvalWith(second, down+`down(100)`)
+	if first.Steps() == 0 || second.Steps() != first.Steps() {
+		t.Errorf("step count not deterministic. first=%d, second=%d", first.Steps(), second.Steps())
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	grow := `let grow = fn(s, n) { if (n == 0) { s } else { grow(s + s, n - 1) } };`
+	tests := []struct {
+		maxMemory int64
+		input     string
+		expected  string
+	}{
+		{0, grow + `len(grow("x", 10))`, "1024"},
+		{1 << 20, grow + `len(grow("x", 10))`, "1024"},
+		{1 << 20, grow + `len(grow("x", 40))`, "memory limit exceeded: allocating 524320 bytes, 524862 of 1048576 bytes used"},
+		// 可以被捕获, 捕获之后还可以继续执行
+		{1 << 20, grow + `let r = try { grow("x", 40) } catch (e: ResourceError) { e.kind }; r + "!"`, "ResourceError!"},
+		{1000, `len([...(1..1000)])`, "memory limit exceeded: allocating 16000 bytes, 0 of 1000 bytes used"},
+		{1000, `"ab" * 1000`, "memory limit exceeded: allocating 2032 bytes, 0 of 1000 bytes used"},
+		{1000, `let f = fn(a, n) { if (n == 0) { a } else { f(push(a, n), n - 1) } }; len(f([], 100))`,
+			"memory limit exceeded: allocating 176 bytes, 864 of 1000 bytes used"},
+		{1000, `let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; h + h`,
+			"memory limit exceeded: allocating 1072 bytes, 560 of 1000 bytes used"},
+		// 内置函数的结果同样计入, take 在取值的过程中就停止
+		{10000, `len(take(1..200000, 200000))`, "memory limit exceeded: allocating 10016 bytes, 0 of 10000 bytes used"},
+		{10000, `len(take(1..1000000000000, 1000000000000))`, "memory limit exceeded: allocating 10016 bytes, 0 of 10000 bytes used"},
+		{10000, `len(take(1..100, 100))`, "100"},
+		{10000, `let s = "x" * 5000; len(graphemes(s))`, "memory limit exceeded: allocating 80032 bytes, 5032 of 10000 bytes used"},
+		{10000, `let s = "x" * 4000; len(upper(s) + "")`, "memory limit exceeded: allocating 4032 bytes, 8064 of 10000 bytes used"},
+		// 回调中调用的内置函数
+		{10000, `let f = bind(fn(n) { take(1..n, n) }, {}); len(f(1000))`, "memory limit exceeded: allocating 9968 bytes, 48 of 10000 bytes used"},
+	}
+	for _, tt := range tests {
+		options := DefaultOptions()
+		options.MaxMemory = tt.maxMemory
+		evaluated := testEvalWith(New(options), tt.input)
+		got := evaluated.Inspect()
+		if err, ok := evaluated.(*object.Error); ok {
+			got = err.Message
+			if err.Kind != object.ResourceError || !err.Recoverable() {
+				t.Errorf("expected recoverable ResourceError for %q. got=%+v", tt.input, err)
+			}
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEvalHooks(t *testing.T) {
+	options := DefaultOptions()
+	depth, maxDepth := 0, 0
+	trace := []string{}
+	options.EnterHook = func(node ast.Node, env *object.Environment) {
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	options.TraceHook = func(node ast.Node, env *object.Environment, result object.Object) {
+		depth--
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Value == "x" {
+				x, _ := env.Get("x")
+				trace = append(trace, "x="+x.Inspect())
+			}
+		case *ast.CallExpression:
+			trace = append(trace, node.String()+"="+result.Inspect())
+		}
+	}
+
+	evaluated := testEvalWith(New(options), `let f = fn(x) { x * 2 }; f(3) + f(1 + 1)`)
+	testIntegerObject(t, evaluated, 10)
+	// 钩子只属于设置了它的解释器
+	testEval(`let f = fn(x) { x * 2 }; f(5)`)
+
+	expected := []string{"x=3", "f(3)=6", "x=2", "f((1 + 1))=4"}
+	if strings.Join(trace, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong trace. expected=%q, got=%q", expected, trace)
+	}
+	if depth != 0 || maxDepth < 4 {
+		t.Errorf("unbalanced hooks. depth=%d, maxDepth=%d", depth, maxDepth)
+	}
+
+	// if 的条件也经过钩子, 钩子保留的环境在调用结束之后不会被复用
+	envs := []*object.Environment{}
+	conditions := []string{}
+	options.EnterHook = func(node ast.Node, env *object.Environment) {
+		if _, ok := node.(*ast.InfixExpression); ok {
+			envs = append(envs, env)
+		}
+	}
+	options.TraceHook = func(node ast.Node, env *object.Environment, result object.Object) {
+		if node, ok := node.(*ast.InfixExpression); ok && node.Operator == ">" {
+			conditions = append(conditions, node.String()+"="+result.Inspect())
+		}
+	}
+	testEvalWith(New(options), `let f = fn(n) { if (n > 1) { 1 } else { 0 } }; f(1); f(2)`)
+	if strings.Join(conditions, " ") != "(n > 1)=false (n > 1)=true" {
+		t.Errorf("hooks should see if conditions. got=%q", conditions)
+	}
+	kept := []string{}
+	for _, env := range envs {
+		n, _ := env.Get("n")
+		if n == nil {
+			kept = append(kept, "<nil>")
+		} else {
+			kept = append(kept, n.Inspect())
+		}
+	}
+	if strings.Join(kept, " ") != "1 2" {
+		t.Errorf("environments kept by hooks should not be reused. got=%q", kept)
+	}
+
+	// 钩子中的 panic 转换为 InternalError
+	options.EnterHook = nil
+	options.TraceHook = func(node ast.Node, env *object.Environment, result object.Object) {
+		panic("hook failed")
+	}
+	err, ok := testEvalWith(New(options), `1`).(*object.Error)
+	if !ok || err.Kind != object.InternalError || !strings.HasPrefix(err.Message, "internal error: hook failed") {
+		t.Errorf("expected internal error from hook. got=%+v", err)
+	}
+}
+
+func TestNullAccess(t *testing.T) {
+	data := `let f = fn() { };
+let nil = f();
+let data = {"items": [{"name": "a"}, nil], "meta": nil, "first name": nil};
+let i = 1;
+`
+	tests := []struct {
+		input   string
+		lenient string
+		strict  string
+	}{
+		{`data["items"][0]["name"]`, "a", "a"},
+		{`data.items[0].name`, "a", "a"},
+		{`data["items"][1]["name"]`, "null", `data["items"][1] is null`},
+		{`data.items[i].name`, "null", `data["items"][1] is null`},
+		{`data.items[i - 0].name`, "null", `data["items"][(i - 0)] is null`},
+		{`data["meta"]["count"][0]`, "null", `data["meta"] is null`},
+		{`data["missing"].x`, "null", `data["missing"] is null`},
+		{`data["first name"][0]`, "null", `data["first name"] is null`},
+		{`f()["x"]`, "null", "f() is null"},
+		{`nil.x`, "null", "nil is null"},
+		// 为 null 时不再执行后面的下标
+		{`data.meta[undefined_name]`, "null", `data["meta"] is null`},
+		{`try { data.meta.x } catch (e: IndexError) { e.message }`, "null", `data["meta"] is null`},
+		{`1[0]`, "index operator not supported: INTEGER", "index operator not supported: INTEGER"},
+	}
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			options := DefaultOptions()
+			options.StrictIndex = strict
+			expected := tt.lenient
+			if strict {
+				expected = tt.strict
+			}
+
+			evaluated := testEvalWith(New(options), data+tt.input)
+			got := evaluated.Inspect()
+			if err, ok := evaluated.(*object.Error); ok {
+				got = err.Message
+			}
+			if got != expected {
+				t.Errorf("wrong result for %q (strict=%t). expected=%q, got=%q", tt.input, strict, expected, got)
+			}
+		}
+	}
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let greet = fn(name, greeting = "hello") { greeting + " " + name };
+		  greet("mk")`, "hello mk"},
+		{`let greet = fn(name, greeting = "hello") { greeting + " " + name };
+		  greet("mk", "hi")`, "hi mk"},
+		{`let f = fn(x, y = x * 2) { x + y }; f(3)`, "9"},
+		{`let n = 10; let f = fn(x = n) { x }; f()`, "10"},
+		{`let f = fn(x, y = 1) { x + y }; f()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`let f = fn(x = 1 + true) { x }; f()`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedKind object.ErrorKind
+	}{
+		{"5 + true", object.TypeError},
+		{"-true", object.TypeError},
+		{`"a" - "b"`, object.TypeError},
+		{"foobar", object.NameError},
+		{"len(1)", object.TypeError},
+		{"let f = fn(x) { y }; f(1)", object.NameError},
+		{"{[1]: 2}", object.TypeError},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind for %q. expected=%s, got=%s",
+				tt.input, tt.expectedKind, errObj.Kind)
+		}
+	}
+}
+
+func TestFatalError(t *testing.T) {
+	if !testEval("5 + true").(*object.Error).Recoverable() {
+		t.Errorf("type errors should be recoverable")
+	}
+
+	evaluated := Eval(nil, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Recoverable() || errObj.Kind != object.InternalError {
+		t.Errorf("expected fatal internal error. got=%+v", errObj)
+	}
+	if errObj.Inspect() != "FATAL: unknown node type <nil>" {
+		t.Errorf("wrong inspect. got=%q", errObj.Inspect())
+	}
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(first, ...rest) { rest }; f(1, 2, 3)`, "[2, 3]"},
+		{`let f = fn(first, ...rest) { rest }; f(1)`, "[]"},
+		{`let f = fn(first, ...rest) { first }; f(...[7, 8])`, "7"},
+		{`let sum = fn(...xs) {
+			let iter = fn(xs, acc) { len(xs) == 0 ? acc : iter(rest(xs), acc + first(xs)) };
+			iter(xs, 0)
+		  };
+		  sum(1, ...[2, 3], 4)`, "10"},
+		{`let a = [2, 3]; [1, ...a, 4]`, "[1, 2, 3, 4]"},
+		{`len(...[[1, 2]])`, "2"},
+		{`len(...1)`, "ERROR: cannot spread INTEGER, want ARRAY, HASH, STRING, RANGE or GENERATOR"},
+		{`let a = ...[1];`, "ERROR: spread is only allowed in call arguments and array literals"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"exit(); 5", 0},
+		{"exit(3); 5", 3},
+		{"let f = fn() { if (true) { exit(7); } 1 }; f(); 5", 7},
+		{"len([exit(2)])", 2},
+		{"let bus = emitter(); bus[\"on\"](\"ev\", fn() { exit(4) }); bus[\"emit\"](\"ev\"); 5", 4},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		exit, ok := evaluated.(*object.Exit)
+		if !ok {
+			t.Errorf("object is not Exit. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("wrong exit code for %q. expected=%d, got=%d",
+				tt.input, tt.expected, exit.Code)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	Stdin = strings.NewReader("first\r\nsecond\n\nlast")
+	defer func() { Stdin = os.Stdin }()
+
+	evaluated := testEval(`lines()`)
+	if evaluated.Inspect() != "[first, second, , last]" {
+		t.Errorf("wrong lines. got=%q", evaluated.Inspect())
+	}
+
+	if evaluated := testEval(`lines()`); evaluated.Inspect() != "[]" {
+		t.Errorf("stdin should be exhausted. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestDotExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let person = {"name": "mk", "age": 3}; person.name`, "mk"},
+		{`let c = {"db": {"host": "localhost"}}; c.db.host`, "localhost"},
+		{`{"a": 1}.b`, "null"},
+		{`{"f": fn(x) { x * 2 }}.f(4)`, "8"},
+		{`let bus = emitter(); bus.on("ev", fn() { 1 + true }); bus.emit("ev")`,
+			"ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`5.a`, "ERROR: dot access not supported: INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExternal(t *testing.T) {
+	// 宿主的 Go 值
+	type counter struct{ n int64 }
+
+	newCounter := func() *object.External {
+		return &object.External{
+			Name:  "Counter",
+			Value: &counter{},
+			Methods: map[string]object.ExternalMethod{
+				"add": func(self *object.External, args ...object.Object) object.Object {
+					c := self.Value.(*counter)
+					for _, arg := range args {
+						n, ok := arg.(*object.Integer)
+						if !ok {
+							return newError("argument to `add` must be INTEGER, got %s", arg.Type())
+						}
+						c.n += n.Value
+					}
+					return nil
+				},
+				"value": func(self *object.External, args ...object.Object) object.Object {
+					return &object.Integer{Value: self.Value.(*counter).n}
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`c.add(1, 2); c.add(3); c.value()`, "6"},
+		{`c.add(1)`, "null"},
+		{`let add = c.add; add(5); c.value()`, "5"},
+		{`[1, 2, 3] |> c.add(10); c.value()`, "ERROR: argument to `add` must be INTEGER, got ARRAY"},
+		{`c`, "external(Counter)"},
+		{`c == c`, "true"},
+		{`c.reset()`, "ERROR: unknown method reset for Counter"},
+		{`try { c.reset() } catch (e: NameError) { "name" }`, "name"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("c", newCounter())
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	// 无限递归直到超时, 不受调用深度的限制
+	in := New(Options{MaxCallDepth: 0})
+	env := object.NewEnvironment()
+	in.Eval(parser.New(lexer.New(`
+let add = fn(a, b) { a + b };
+let fail = fn() { 1 + true };
+let quit = fn() { exit(3) };
+let loop = fn(n) { loop(n + 1) };
+`)).ParseProgram(), env)
+	get := func(name string) object.Object {
+		obj, _ := env.Get(name)
+		return obj
+	}
+	ctx := context.Background()
+
+	result, err := CallFunction(ctx, get("add"), &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil || result.Inspect() != "3" {
+		t.Errorf("add(1, 2) wrong. got=%v, %v", result, err)
+	}
+
+	// 多个 goroutine 同时回调
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			CallFunction(ctx, get("add"), &object.Integer{Value: 1}, &object.Integer{Value: 1})
+		}()
+	}
+	wg.Wait()
+
+	if _, err := CallFunction(ctx, get("fail")); err == nil || err.Error() != "ERROR: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("expected error from fail(). got=%v", err)
+	}
+	if _, err := CallFunction(ctx, get("quit")); err == nil || err.(*object.Exit).Code != 3 {
+		t.Errorf("expected exit(3) from quit(). got=%v", err)
+	}
+	if _, err := CallFunction(ctx, &object.Integer{Value: 1}); err == nil || err.Error() != "ERROR: not a function INTEGER" {
+		t.Errorf("expected not a function error. got=%v", err)
+	}
+	if _, err := CallFunction(ctx, nil); err == nil || err.Error() != "ERROR: not a function: nil" {
+		t.Errorf("expected not a function error for nil. got=%v", err)
+	}
+
+	// 回调调用的宿主函数中再调用 CallFunction
+	builtins["test_reenter"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			result, err := CallFunction(ctx, args[0], args[1:]...)
+			if err != nil {
+				return newError("%s", err)
+			}
+			return result
+		},
+	}
+	defer delete(builtins, "test_reenter")
+	in.Eval(parser.New(lexer.New(`
+let outer = fn(n) { test_reenter(add, n, test_reenter(add, n, 1)) };
+`)).ParseProgram(), env)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := CallFunction(ctx, get("outer"), &object.Integer{Value: 10})
+		if err != nil || result.Inspect() != "21" {
+			t.Errorf("re-entrant callback wrong. got=%v, %v", result, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("re-entrant CallFunction deadlocked")
+	}
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := CallFunction(cancelledCtx, get("add")); err != context.Canceled {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := CallFunction(timeout, get("loop"), &object.Integer{Value: 0}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded. got=%v", err)
+	}
+	// 回调在新的解释器中执行, 不影响函数所属的解释器
+	if in.cancelled != nil || len(in.callStack) != 0 || in.callDepth != 0 {
+		t.Errorf("state of the owner changed by callback")
+	}
+}
+
+// 多个 goroutine 同时回调不同的函数, 每个函数使用一种解释器上的状态(生成器, 模块, 监视函数, 容错模式)
+// 或者进程内共用的缓存(时区, 字符串的 HashKey); 结果不对或者共用的 map 被同时写入(运行时报错退出)时失败, 不依赖 -race
+func TestConcurrentCallFunction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mk-callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "inc.mk"), []byte(`let inc = fn(n) { n + 1 };`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions()
+	options.ModuleDir = dir
+	options.Tolerant = true
+	in := New(options)
+	defer in.Close()
+	env := object.NewEnvironment()
+	in.Eval(parser.New(lexer.New(`
+let key = "na" + "me";
+let zones = ["Asia/Shanghai", "America/New_York", "Europe/Berlin", "Asia/Tokyo", "Europe/London", "America/Chicago",
+	"Australia/Sydney", "Asia/Kolkata", "America/Sao_Paulo", "Africa/Cairo", "Europe/Moscow", "Pacific/Auckland",
+	"Asia/Dubai", "America/Denver", "Asia/Singapore", "Europe/Paris"];
+let t = parse_time("2024-01-01 10:00:00", "UTC");
+let pairs = fn(n) { let g = fn(k) { yield k; yield k * 2 }; take(g(n), 2) };
+let module = fn(n) { import("inc.mk").inc(n) };
+let watched = fn(n) { watch("w", fn(old, v) { if (v != n) { 1 + true } }); let w = n; w };
+let tolerant = fn(n) { [n, missing_name] };
+let lookup = fn(n) { let h = {key: n}; h[key] + h.name };
+let offset = fn(n) { tz_offset(time_in(t, zones[n - n / 16 * 16])) };
+let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } };
+`)).ParseProgram(), env)
+
+	zones := []string{"Asia/Shanghai", "America/New_York", "Europe/Berlin", "Asia/Tokyo", "Europe/London", "America/Chicago",
+		"Australia/Sydney", "Asia/Kolkata", "America/Sao_Paulo", "Africa/Cairo", "Europe/Moscow", "Pacific/Auckland",
+		"Asia/Dubai", "America/Denver", "Asia/Singapore", "Europe/Paris"}
+	offset := func(n int) string {
+		loc, err := time.LoadLocation(zones[n%len(zones)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, seconds := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).In(loc).Zone()
+		return fmt.Sprint(seconds)
+	}
+	calls := []struct {
+		name     string
+		expected func(n int) string
+	}{
+		{"pairs", func(n int) string { return fmt.Sprintf("[%d, %d]", n, 2*n) }},
+		{"module", func(n int) string { return fmt.Sprint(n + 1) }},
+		{"watched", func(n int) string { return fmt.Sprint(n) }},
+		{"tolerant", func(n int) string { return fmt.Sprintf("[%d, null]", n) }},
+		{"lookup", func(n int) string { return fmt.Sprint(2 * n) }},
+		{"offset", offset},
+		{"depth", func(n int) string { return fmt.Sprint(n) }},
+	}
+
+	// 时区在回调中第一次加载
+	locationsMu.Lock()
+	locations = map[string]*time.Location{}
+	locationsMu.Unlock()
+
+	ctx := context.Background()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var failures int32
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < 50; i++ {
+				n := g*50 + i
+				call := calls[(g+i)%len(calls)]
+				// 每个 goroutine 先同时加载不同的时区
+				if i == 0 {
+					n, call = g, calls[5]
+				}
+				fn, _ := env.Get(call.name)
+				result, err := CallFunction(ctx, fn, &object.Integer{Value: int64(n)})
+				if err != nil || result.Inspect() != call.expected(n) {
+					if atomic.AddInt32(&failures, 1) <= 5 {
+						t.Errorf("%s(%d) wrong. expected=%s, got=%v, %v", call.name, n, call.expected(n), result, err)
+					}
+				}
+			}
+		}(g)
+	}
+	close(start)
+	wg.Wait()
+
+	// 回调的状态不会留在函数所属的解释器上
+	if len(in.modules) != 0 || len(in.watchers) != 0 || len(in.TakeToleratedErrors()) != 0 {
+		t.Errorf("callbacks changed the state of the owner: modules=%d, watchers=%d", len(in.modules), len(in.watchers))
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	parse := func(input string) *ast.Program {
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+	ctx := context.Background()
+
+	result, err := EvalContext(ctx, parse(`let add = fn(a, b) { a + b }; add(1, 2)`), object.NewEnvironment())
+	if err != nil || result.Inspect() != "3" {
+		t.Errorf("add(1, 2) wrong. got=%v, %v", result, err)
+	}
+	if _, err := EvalContext(ctx, parse(`1 + true`), object.NewEnvironment()); err == nil ||
+		err.Error() != "ERROR: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("expected type mismatch error. got=%v", err)
+	}
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := EvalContext(cancelledCtx, parse(`1`), object.NewEnvironment()); err != context.Canceled {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+
+	tests := []string{
+		// 无限递归直到超时, 不受调用深度的限制
+		`let loop = fn(n) { loop(n + 1) }; loop(0)`,
+		// 超时不能被 try 捕获
+		`let loop = fn(n) { loop(n + 1) }; try { loop(0) } catch (e) { 1 }`,
+		// 没有定时任务的事件循环只能因为取消而返回
+		`run_forever()`,
+		// 没有函数调用的长时间迭代在每一轮检查
+		`len(take(1..1000000000000, 1000000000000))`,
+		`len([...(1..1000000000000)])`,
+	}
+	for _, input := range tests {
+		env := object.NewEnvironment()
+		in := New(Options{MaxCallDepth: 0})
+		env.SetState(in)
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		_, err := EvalContext(timeout, parse(input), env)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected context.DeadlineExceeded for %q. got=%v", input, err)
+		}
+		if in.cancelled != nil || len(in.callStack) != 0 || in.callDepth != 0 {
+			t.Errorf("state not restored after %q", input)
+		}
+	}
+
+	// 不同环境中的 EvalContext 可以同时执行, 互不影响
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			if _, err := EvalContext(timeout, parse(`len(take(1..1000000000000, 1000000000000))`), object.NewEnvironment()); err != context.DeadlineExceeded {
+				t.Errorf("expected context.DeadlineExceeded. got=%v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestI18nStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 词尾的 Σ 转为 ς
+		{`lower("ÀÉÎ ΣΑΣ")`, "àéî σας"},
+		{`upper("straße")`, "STRASSE"},
+		{`upper("ǆemal")`, "ǄEMAL"},
+		{`upper("istanbul", "tr")`, "İSTANBUL"},
+		{`lower("DİYARBAKIR", "tr-TR")`, "diyarbakır"},
+		{`upper("istanbul", "en")`, "ISTANBUL"},
+		{`casefold("ΣΑΣ") == casefold("σας")`, "true"},
+		{`collate("apple", "Banana")`, "-1"},
+		{`collate("b", "B")`, "-1"},
+		{`collate("é", "É")`, "-1"},
+		{`collate_sort(["banana", "Cherry", "apple", "Apple"])`, "[apple, Apple, banana, Cherry]"},
+		{`collate_sort([1])`, "ERROR: elements of `collate_sort` must be STRING, got INTEGER"},
+		// 完整大小写折叠
+		{`casefold("Straße")`, "strasse"},
+		{`casefold("ẞ") == casefold("SS")`, "true"},
+		// 先比较基本字母, 重音和大小写只用来区分基本字母相同的字符串
+		{`collate("é", "f")`, "-1"},
+		{`collate("e", "é")`, "-1"},
+		{`collate("éa", "eb")`, "-1"},
+		{`collate("ß", "st")`, "-1"},
+		{`collate("Ä", "z")`, "-1"},
+		{`collate_sort(["z", "é", "Ä", "f", "e", "a"])`, "[a, Ä, e, é, f, z]"},
+		// locale 中的单独字母
+		{`collate("ä", "z", "sv")`, "1"},
+		{`collate_sort(["ö", "z", "ä", "å", "a"], "sv_SE")`, "[a, z, å, ä, ö]"},
+		{`collate("ñ", "nz")`, "-1"},
+		{`collate("ñ", "nz", "es")`, "1"},
+		{`collate_sort(["ilk", "ırmak", "hat", "Istanbul"], "tr")`, "[hat, ırmak, Istanbul, ilk]"},
+		{`collate_sort(["å", "ø", "z", "æ", "Ø"], "da")`, "[z, æ, ø, Ø, å]"},
+		{`collate_sort(["å", "ø", "z", "æ"], "nb-NO")`, "[z, æ, ø, å]"},
+		// 缩写: 捷克语中 "ch" 是排在 "h" 后面的一个字母
+		{`collate_sort(["ch", "d", "cz", "i", "h"], "cs")`, "[cz, d, h, ch, i]"},
+		{`collate_sort(["ı", "i", "x", "h", "j"], "az")`, "[h, x, ı, i, j]"},
+		{`collate_sort(["o", "ŋ", "n", "nz"], "de")`, "[n, nz, ŋ, o]"},
+		{`collate("ŋ", "o")`, "-1"},
+		{`collate("a", "b", 1)`, "ERROR: argument to `collate` must be STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRangeExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..5", "1..5"},
+		{"len(1..5)", "5"},
+		{"len(1..<5)", "4"},
+		{"len(5..1)", "0"},
+		{"(1..5)[0]", "1"},
+		{"(1..5)[4]", "5"},
+		{"(1..<5)[4]", "null"},
+		{"[...(1..<4)]", "[1, 2, 3]"},
+		{"let n = 3; [0, ...(1..n)]", "[0, 1, 2, 3]"},
+		{`1.."a"`, "ERROR: range bounds must be INTEGER, got INTEGER..STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSliceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:4]", "[2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3][:]", "[1, 2, 3]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"[1, 2, 3][-5:10]", "[1, 2, 3]"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[3:]`, "lo"},
+		{`"你好世界"[1:3]`, "好世"},
+		{`"abc"[10:]`, ""},
+		{`let a = [1, 2, 3]; let b = a[:]; len(push(b, 4)) + len(a)`, "7"},
+		{`5[1:2]`, "ERROR: slice operator not supported: INTEGER"},
+		{`[1][true:]`, "ERROR: slice index must be INTEGER, got BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// len 按字节计算
+		{`len(normalize("é", "NFC"))`, "2"},
+		{`len(normalize("é", "NFD"))`, "3"},
+		{`normalize("é", "NFC") == "é"`, "true"},
+		{`normalize("ệ", "NFD") == "ệ"`, "true"},
+		{`normalize("ệ", "NFC") == "ệ"`, "true"},
+		{`len(normalize("한", "NFD"))`, "9"},
+		{`normalize(normalize("한글", "NFD"), "NFC") == "한글"`, "true"},
+		// 分解表覆盖拉丁字母以外的字符
+		{`normalize("ά", "NFD") == "ά"`, "true"},
+		{`normalize("й", "NFD") == "й"`, "true"},
+		{`normalize("ά", "NFC") == "ά"`, "true"},
+		{`normalize("й", "NFC") == "й"`, "true"},
+		{`normalize("ᾅ", "NFD") == "ᾅ"`, "true"},
+		{`normalize("ᾅ", "NFC") == "ᾅ"`, "true"},
+		{`normalize("𑂚", "NFD") == "𑂚"`, "true"},
+		{`normalize("𑂚", "NFC") == "𑂚"`, "true"},
+		// 单字符分解和组合排除的字符不会组合回来
+		{`normalize("Å", "NFC") == "Å"`, "true"},
+		{`normalize("क़", "NFC") == "क़"`, "true"},
+		{`normalize("a", "NFKC")`, `ERROR: unsupported normalization form: "NFKC", want NFC or NFD`},
+		{`grapheme_len("é")`, "1"},
+		{`grapheme_len("👍🏽!")`, "2"},
+		{`grapheme_len("👨‍👩‍👧")`, "1"},
+		{`grapheme_len("🇨🇳🇯🇵")`, "2"},
+		{`grapheme_len("")`, "0"},
+		{`len(graphemes("aé👍🏽"))`, "3"},
+		{`grapheme_slice("aé👍🏽", 1, 2) == "é"`, "true"},
+		{`grapheme_slice("🇨🇳🇯🇵", 1)`, "🇯🇵"},
+		{`grapheme_slice("abc", 5)`, ""},
+		{`grapheme_slice("abc", "1")`, "ERROR: argument to `grapheme_slice` must be INTEGER, got STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(x) { x + 2; }`, "fn(x) { ... 1 statement ... }"},
+		{`fn() { }`, "fn() { }"},
+		{`let add = fn(a, b) { let c = a + b; c }; add`, "fn add(a, b) { ... 2 statements ... }"},
+		{`let f = fn(a, b = 1, ...rest) { a }; let g = f; g`, "fn f(a, b = 1, ...rest) { ... 1 statement ... }"},
+		{`let h = fn() { fn() { 1 } }; h()`, "fn() { ... 1 statement ... }"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	object.VerboseInspect = true
+	defer func() { object.VerboseInspect = false }()
+
+	evaluated := testEval(`let add = fn(a, b) { a + b }; add`)
+	expected := "fn add(a, b) {\n(a + b)\n}"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong verbose result. expected=%q, got=%q",
+			expected, evaluated.Inspect())
+	}
+}
+
+func TestNegativeIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][-1]", "3"},
+		{"[1, 2, 3][-3]", "1"},
+		{"[1, 2, 3][-4]", "null"},
+		{"[1, 2, 3][3]", "null"},
+		{"(1..10)[-1]", "10"},
+		{"(1..<10)[-2]", "8"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{`"hello"[-3:-1]`, "ll"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	options := DefaultOptions()
+	options.StrictIndex = true
+	options.NegativeIndex = false
+	strict := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][3]", "ERROR: [1, 2, 3][3]: index out of range: 3, length 3"},
+		{"[1, 2, 3][-1]", "ERROR: [1, 2, 3][(-1)]: index out of range: -1, length 3"},
+		{"(1..3)[5]", "ERROR: (1..3)[5]: index out of range: 5, length 3"},
+		{`let data = {"items": [1, 2, 3]}; let i = 3; data.items[i]`, `ERROR: data["items"][3]: index out of range: 3, length 3`},
+		{`let items = [1, 2, 3]; items[1 + 2]`, "ERROR: items[(1 + 2)]: index out of range: 3, length 3"},
+		{"[1, 2, 3][-2:]", "[1, 2, 3]"},
+		{"[1, 2, 3][1:10]", "[2, 3]"},
+	}
+	for _, tt := range strict {
+		evaluated := testEvalWith(New(options), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestInspectBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`inspect("a b")`, `"a b"`},
+		{`inspect(1)`, "1"},
+		{`inspect(if (false) { 1 })`, "<null>"},
+		{`inspect([])`, "[]"},
+		{`inspect({})`, "{}"},
+		{`inspect([1, "a"])`, "[\n  1,\n  \"a\"\n]"},
+		{`inspect({"b": 2, "a": [1, {}]})`, "{\n  \"a\": [\n    1,\n    {}\n  ],\n  \"b\": 2\n}"},
+		{`let add = fn(a, b) { a + b }; inspect(add)`, "<function add/2>"},
+		{`inspect(fn() { 1 })`, "<function <anonymous>/0>"},
+		{`inspect(len)`, "<builtin>"},
+		{`inspect(1..3)`, "1..3"},
+		{`inspect()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	var out strings.Builder
+	Stderr = &out
+	defer func() { Stderr = os.Stderr }()
+
+	evaluated := testEval(`dump("x", [1])`)
+	if evaluated != NULL {
+		t.Fatalf("dump should return null. got=%s", evaluated.Inspect())
+	}
+
+	expected := "\"x\"\n[\n  1\n]\n"
+	if out.String() != expected {
+		t.Errorf("wrong dump output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStringRepeat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`"-" * 5`, "-----"},
+		{`3 * "ab"`, "ababab"},
+		{`"ab" * 0`, ""},
+		{`"" * 1000000000000`, ""},
+		{`let n = 2; "x" * (n + 1) + "!"`, "xxx!"},
+		{`"ab" * -1`, "ERROR: negative repeat count: -1"},
+		{`"ab" * 100000000`, "ERROR: repeated string too long: 100000000 * 2 bytes, limit 67108864"},
+		{`"ab" * "2"`, "ERROR: unknown operator: STRING * STRING"},
+		{`"ab" - 2`, "ERROR: type mismatch: STRING - INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringIndexExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello"[1]`, "e"},
+		{`"hello"[0]`, "h"},
+		{`"hello"[-1]`, "o"},
+		{`"你好"[1]`, "好"},
+		{`"hello"[5]`, "null"},
+		{`"hello"[1] == "e"`, "true"},
+		{`"hello"["a"]`, "ERROR: index operator not supported: STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIntegerBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`to_hex(255)`, "ff"},
+		{`to_hex(-255)`, "-ff"},
+		{`to_bin(5)`, "101"},
+		{`to_oct(8)`, "10"},
+		{`to_hex("1")`, "ERROR: argument to `to_hex` must be INTEGER or BIGINT, got STRING"},
+		{`format("%d %x %X %o %b", 10, 255, 255, 8, 5)`, "10 ff FF 10 101"},
+		{`format("%08b|%#x|%-4d|", 5, 255, 7)`, "00000101|0xff|7   |"},
+		{`format("%s=%v, %v", "a", "a", [1, 2])`, `a="a", [1, 2]`},
+		{`format("100%%")`, "100%"},
+		{`format("%d")`, "ERROR: format: missing argument for %d"},
+		{`format("%x", "a")`, "ERROR: format: %x wants INTEGER or BIGINT, got STRING"},
+		{`format("%q", 1)`, "ERROR: format: unknown verb %q"},
+		{`format("%d", 1, 2)`, "ERROR: format: too many arguments. got=2, want=1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("MK_TEST_USER", "gopher")
+	defer os.Unsetenv("MK_TEST_USER")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`expand_env("Hello $MK_TEST_USER!")`, "Hello gopher!"},
+		{`expand_env("${MK_TEST_USER}s")`, "gophers"},
+		{`expand_env("[$MK_TEST_UNDEFINED]")`, "[]"},
+		{`expand_env("${name}:${port}", {"name": "db", "port": 5432})`, "db:5432"},
+		{`expand_env("$MK_TEST_USER", {})`, ""},
+		{`expand_env(1)`, "ERROR: argument to `expand_env` must be STRING, got INTEGER"},
+		{`expand_env("", [])`, "ERROR: argument to `expand_env` must be HASH, got ARRAY"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const PI = 3; PI * 2", "6"},
+		{"const PI = 3; let PI = 4;", "ERROR: cannot assign to constant PI"},
+		{"const PI = 3; const PI = 4;", "ERROR: cannot assign to constant PI"},
+		{"let x = 1; const x = 2; x", "2"},
+		{"const PI = 3; let f = fn(PI) { PI }; f(4)", "4"},
+		{"const PI = 3; let f = fn() { let PI = 4; PI }; f() + PI", "7"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 块中声明的变量不会泄漏到外层
+		{"if (true) { let y = 2; }; y", "ERROR: identifier not found: y"},
+		{"if (false) { 1 } else { let y = 2; }; y", "ERROR: identifier not found: y"},
+		{"try { let y = 2; } catch (e) { }; y", "ERROR: identifier not found: y"},
+		{"try { error(\"x\") } catch (e) { let y = 2; }; y", "ERROR: identifier not found: y"},
+		{"let f = fn() { if (true) { let y = 2; }; y }; f()", "ERROR: identifier not found: y"},
+		// 遮盖外层同名变量, 块执行完后外层的值不变
+		{"let x = 1; if (true) { let x = 2; }; x", "1"},
+		{"let x = 1; if (true) { let x = x + 1; x }", "2"},
+		{"let x = 1; if (true) { let x = 2; if (true) { let x = 3; }; x }", "2"},
+		{"let f = fn(x) { if (true) { let x = 5; }; x }; f(1)", "1"},
+		{"const C = 1; if (true) { let C = 2; C }", "2"},
+		{"const C = 1; if (true) { let C = 2; }; C", "1"},
+		// 块中可以访问外层的变量
+		{"let x = 1; if (true) { if (true) { x + 1 } }", "2"},
+		// 闭包引用定义时所在的块
+		{"let f = if (true) { let n = 10; fn() { n } }; f()", "10"},
+		{"let n = 1; let f = if (true) { let n = 10; fn() { n } }; [f(), n]", "[10, 1]"},
+		{"let make = fn() { if (true) { let n = 1; fn(x) { x + n } } }; make()(2)", "3"},
+		{`let counters = fn(start) {
+  let get = if (start > 0) { let base = start * 10; fn() { base } } else { fn() { 0 } };
+  get
+};
+[counters(1)(), counters(2)(), counters(0)()]`, "[10, 20, 0]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	base := `let t = parse_time("2024-01-01 10:00:00", "UTC");
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`t`, "2024-01-01 10:00:00 +00:00 UTC"},
+		{`time_in(t, "Asia/Shanghai")`, "2024-01-01 18:00:00 +08:00 CST"},
+		{`time_in(t, "America/New_York")`, "2024-01-01 05:00:00 -05:00 EST"},
+		{`tz_offset(time_in(t, "Asia/Shanghai"))`, "28800"},
+		{`tz_offset(time_in(t, "America/New_York"))`, "-18000"},
+		{`tz_offset(time_in("2024-07-01 10:00:00 UTC", "America/New_York"))`, "-14400"},
+		{`tz_offset(t)`, "0"},
+		// 字符串末尾的时区名
+		{`parse_time("2024-07-01 10:00:00 America/New_York")`, "2024-07-01 10:00:00 -04:00 EDT"},
+		{`parse_time("2024-01-01 Asia/Tokyo")`, "2024-01-01 00:00:00 +09:00 JST"},
+		{`parse_time("2024-01-01T10:00:00+08:00", "UTC")`, "2024-01-01 10:00:00 +08:00 +0800"},
+		// 同一时刻在不同时区中相等
+		{`time_in(t, "Asia/Shanghai") == t`, "true"},
+		{`parse_time("2024-01-01 05:00:00 -05:00 EST") == t`, "true"},
+		{`parse_time("2024-01-01 18:00:00 Asia/Shanghai") == t`, "true"},
+		{`parse_time("2024-01-01 10:00:01", "UTC") > t`, "true"},
+		{`time_in(t, "Asia/Shanghai") < t`, "false"},
+		{`time_in(t, "UTC") + t`, "ERROR: unknown operator: TIME + TIME"},
+		{`parse_time("2024-01-01", "Nowhere/City")`, `ERROR: unknown time zone: "Nowhere/City"`},
+		{`time_in(t, 8)`, "ERROR: time zone argument to `time_in` must be STRING, got INTEGER"},
+		{`parse_time("yesterday")`, `ERROR: invalid time: "yesterday"`},
+		{`tz_offset(1)`, "ERROR: argument to `tz_offset` must be TIME or STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(base + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	base := `let start = parse_time("2024-01-01 10:00:00", "UTC");
+let end = parse_time("2024-01-01 12:03:20", "UTC");
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1h30m`, "1h30m"},
+		{`90m`, "1h30m"},
+		{`1500ms`, "1s500ms"},
+		{`0s`, "0s"},
+		{`-1h`, "-1h"},
+		{`time_diff(end, start)`, "2h3m20s"},
+		{`time_diff(start, end)`, "-2h3m20s"},
+		{`time_diff("2024-01-01 10:00:00 Asia/Shanghai", "2024-01-01 10:00:00 UTC")`, "-8h"},
+		{`end - start`, "2h3m20s"},
+		{`start + 1h30m`, "2024-01-01 11:30:00 +00:00 UTC"},
+		{`1h30m + start`, "2024-01-01 11:30:00 +00:00 UTC"},
+		{`start - 90s`, "2024-01-01 09:58:30 +00:00 UTC"},
+		{`start + (end - start) == end`, "true"},
+		{`1h + 30m - 15m`, "1h15m"},
+		{`1h * 3`, "3h"},
+		{`3 * 1h`, "3h"},
+		{`1h / 4`, "15m"},
+		{`1h / 0`, "ERROR: division by zero: 1h / 0"},
+		{`1h > 59m`, "true"},
+		{`60m == 1h`, "true"},
+		{`60m != 1h`, "false"},
+		{`{1h: "x"}[60m]`, "x"},
+		{`1h + 1`, "ERROR: type mismatch: DURATION + INTEGER"},
+		{`1h * 1h`, "ERROR: unknown operator: DURATION * DURATION"},
+		{`start * 1h`, "ERROR: type mismatch: TIME * DURATION"},
+		// 简略输出
+		{`humanize(time_diff(end, start))`, "2h 3m"},
+		{`humanize(1500ms)`, "1s 500ms"},
+		{`humanize(2h5s)`, "2h"},
+		{`humanize(45s)`, "45s"},
+		{`humanize(0s)`, "0s"},
+		{`humanize(-3m)`, "-3m"},
+		{`humanize(1)`, "ERROR: argument to `humanize` must be DURATION, got INTEGER"},
+		// 和毫秒数的转换
+		{`milliseconds(1m)`, "60000"},
+		{`duration(1500)`, "1s500ms"},
+		{`duration(milliseconds(1h30m))`, "1h30m"},
+		{`duration("2h45m")`, "2h45m"},
+		{`duration("soon")`, `ERROR: invalid duration: "soon"`},
+		// 超出范围
+		{`duration(9223372036854775)`, "ERROR: duration overflow: 9223372036854775ms"},
+		{`duration(-9223372036854775)`, "ERROR: duration overflow: -9223372036854775ms"},
+		{`2562047h * 2`, "ERROR: duration overflow: 2562047h * 2"},
+		{`-2 * 2562047h`, "ERROR: duration overflow: -2 * 2562047h"},
+		{`1h * 9223372036854775807`, "ERROR: duration overflow: 1h * 9223372036854775807"},
+		{`2562047h + 2562047h`, "ERROR: duration overflow: 2562047h + 2562047h"},
+		{`-2562047h - 2562047h`, "ERROR: duration overflow: -2562047h - 2562047h"},
+		{`3000000h`, "ERROR: duration overflow: 3000000h"},
+		{`parse_time("2400-01-01 00:00:00", "UTC") - start`, "ERROR: duration overflow: 2400-01-01 00:00:00 +00:00 UTC - 2024-01-01 10:00:00 +00:00 UTC"},
+		{`try { 2562047h * 2 } catch (e: ArithmeticError) { "caught" }`, "caught"},
+		{`2562047h + 47m - 1h`, "2562046h47m"},
+		// now() 是当前的时间
+		{`let t = now(); (t + 5m) - t`, "5m"},
+		{`now() - 1s < now()`, "true"},
+		{`time_diff(now(), now() - 90s) > 89s`, "true"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(base + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		lenient string
+		strict  string
+	}{
+		{"let x = 1; let x = 2; x", "2", "ERROR: x is already declared in this scope"},
+		{"let f = fn(x) { let x = x + 1; x }; f(1)", "2", "ERROR: x is already declared in this scope"},
+		// 内层代码块中的遮盖不是重复声明
+		{"let x = 1; if (true) { let x = 2; x }", "2", "2"},
+		{"let x = 1; let f = fn() { let x = 2; x }; f()", "2", "2"},
+		// 每次调用都是新的作用域
+		{"let f = fn() { let y = 1; y }; f() + f()", "2", "2"},
+		{"let x = 1; const x = 2; x", "2", "ERROR: x is already declared in this scope"},
+		{"try { let x = 1; let x = 2; } catch (e: NameError) { e.message }", "2", "x is already declared in this scope"},
+		{"let y = 1; z", "ERROR: identifier not found: z", "ERROR: identifier not found: z"},
+		// 重复的参数名
+		{"let f = fn(a, a) { a }; f(1, 2)", "2", "ERROR: duplicate parameter a"},
+		{"fn(a, ...a) { a }(1, 2)", "[2]", "ERROR: duplicate parameter a"},
+		{"fn(a, b = 1, ...c) { a + b }(1)", "2", "2"},
+	}
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			options := DefaultOptions()
+			options.Strict = strict
+			expected := tt.lenient
+			if strict {
+				expected = tt.strict
+			}
+			evaluated := testEvalWith(New(options), tt.input)
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q (strict=%t). expected=%q, got=%q",
+					tt.input, strict, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestConfigDecode(t *testing.T) {
+	ini := "; 注释\nname = mk\n\n[server]\nhost = \"0.0.0.0\"\r\nport=8080\n# 注释\n[db]\nurl = a=b\n[server]\nport = 9090\n"
+	props := "# 注释\n! 注释\napp.name = mk\napp.title: hello \\\n    world\npath c:\\\\tmp\n" +
+		"key\\=with\\:sep=v\nunicode=\\u4e2d\\u6587\nempty\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`ini_decode(ini).name`, "mk"},
+		{`ini_decode(ini).server.host`, "0.0.0.0"},
+		{`ini_decode(ini)["server"]["port"]`, "9090"},
+		{`ini_decode(ini).db.url`, "a=b"},
+		{`len(ini_decode(ini))`, "3"},
+		{`ini_decode("[a]
+b")`, `ERROR: ini: line 2: expected key = value, got "b"`},
+		{`ini_decode("[a
+b = 1")`, `ERROR: ini: line 1: unterminated section header "[a"`},
+		{`ini_decode("[ ]")`, "ERROR: ini: line 1: empty section name"},
+		{`ini_decode(1)`, "ERROR: argument to `ini_decode` must be STRING, got INTEGER"},
+		{`properties_decode(props)["app.name"]`, "mk"},
+		{`properties_decode(props)["app.title"]`, "hello world"},
+		{`properties_decode(props)["path"]`, `c:\tmp`},
+		{`properties_decode(props)["key=with:sep"]`, "v"},
+		{`properties_decode(props)["unicode"]`, "中文"},
+		{`properties_decode(props)["empty"]`, ""},
+		{`len(properties_decode(props))`, "6"},
+		{`properties_decode("a=\u12")`, `ERROR: properties: line 1: invalid escape in "a=\\u12"`},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("ini", &object.String{Value: ini})
+		env.Set("props", &object.String{Value: props})
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 1; let y = "a"; let v = vars(); [len(v), v.x, v.y]`, `[2, 1, a]`},
+		{`vars()`, `{}`},
+		{`let x = 1; let f = fn(a) { let b = 2; vars() }; let v = f(0); [len(v), v.a, v.b]`, `[2, 0, 2]`},
+		// 内层的变量遮盖外层的同名变量
+		{`let x = 1; let f = fn(a) { let x = 2; vars(true) }; let v = f(0); [len(v), v.a, v.x, v.f]`,
+			`[3, 0, 2, fn f(a) { ... 2 statements ... }]`},
+		{`let x = 1; if (true) { let y = 2; [vars(), len(vars(true)), vars(true).x] }`, `[{y: 2}, 2, 1]`},
+		// 内层作用域在前, 同一作用域中按名字排序(和 vars.go 中的例子相同)
+		{`let x = 1; let f = fn() { let y = 2; [vars(), vars(true)] }; f()`,
+			`[{y: 2}, {y: 2, f: fn f() { ... 2 statements ... }, x: 1}]`},
+		{`let x = 1; vars(false)`, `{x: 1}`},
+		{`vars(1)`, "ERROR: argument to `vars` must be BOOLEAN, got INTEGER"},
+		{`vars(true, 1)`, "ERROR: wrong number of arguments. got=2, want=0 or 1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 作为回调调用时没有调用处的环境
+	if got := builtins["vars"].EnvFn(nil).Inspect(); got != "ERROR: `vars` must be called directly, not as a callback" {
+		t.Errorf("wrong result for vars without environment: %q", got)
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let e = error("IndexError", "boom"); [e.kind, e.message, e.value, e.line]`, "[IndexError, boom, null, 0]"},
+		{`error("ConfigError", "bad port", {"port": -1}).value.port`, "-1"},
+		// 构造的错误可以直接 throw, 按 kind 捕获, 位置为 throw 的位置
+		{`let check = fn(n) { if (n < 0) { throw error("RangeError", "negative", n) }; n };
+try { check(-1) } catch (e: RangeError) { [e.value, e.message, e.line, e.column] }`, "[-1, negative, 1, 34]"},
+		{`try { throw error("IndexError", "x") } catch (e: TypeError) { 1 } catch (e: IndexError) { 2 }`, "2"},
+		{`throw error("IOError", "disk full")`, "ERROR: disk full"},
+		// 检查错误值
+		{`is_error(error("UserError", "x"))`, "true"},
+		{`try { 1 / 0 } catch (e) { is_error(e) }`, "true"},
+		{`[is_error(1), is_error("x"), is_error({}), is_error({"kind": "x"}), is_error({"kind": 1, "message": "m"})]`,
+			"[false, false, false, false, false]"},
+		// 只有形状相同的普通 map 不是错误值
+		{`is_error({"kind": "x", "message": "y"})`, "false"},
+		{`let e = error("UserError", "x"); is_error({"kind": e.kind, "message": e.message})`, "false"},
+		{`try { throw {"kind": "IOError", "message": "m"} } catch (e) { is_error(e) }`, "true"},
+		{`error("", "x")`, "ERROR: first argument to `error` must be a non-empty STRING, got "},
+		{`error("UserError", 1)`, "ERROR: second argument to `error` must be STRING, got INTEGER"},
+		{`error("UserError")`, "ERROR: wrong number of arguments. got=1, want=2 or 3"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestXML(t *testing.T) {
+	doc := `let doc = xml_decode("<?xml version='1.0'?>
+<config xmlns:x='urn:x'>
+  <server name='web' x:port='8080'>
+    hello &amp; welcome
+    <path>/a</path>
+    <path>/b</path>
+  </server>
+  <server name='db'/>
+  <!-- 注释 -->
+  <cache><![CDATA[<raw>]]></cache>
+</config>");
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`doc.tag`, "config"},
+		{`len(doc.children)`, "3"},
+		{`doc.children[0].attrs.name`, "web"},
+		{`doc.children[0].attrs.port`, "8080"},
+		{`doc.children[0].text`, "hello & welcome"},
+		{`doc.children[1].children`, "[]"},
+		{`doc.children[2].text`, "<raw>"},
+		{`xml_find(doc, "config/server/@name")`, "[web, db]"},
+		{`xml_find(doc, "/config/server/path/text()")`, "[/a, /b]"},
+		{`xml_find(doc, "config/*/@name")`, "[web, db]"},
+		{`len(xml_find(doc, "config/server"))`, "2"},
+		{`xml_find(doc, "config/server/@missing")`, "[]"},
+		{`xml_find(doc, "other/server")`, "[]"},
+		{`xml_find(doc, "config//server")`, `ERROR: xml_find: empty step in path "config//server"`},
+		{`xml_decode("<a><b></a>")`, "ERROR: xml: XML syntax error on line 1: element <b> closed by </a>"},
+		{`xml_decode("<a/><b/>")`, "ERROR: xml: more than one root element"},
+		{`xml_decode("")`, "ERROR: xml: no root element"},
+		{`xml_find(1, "a")`, "ERROR: first argument to `xml_find` must be HASH, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(doc + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let count = fn(n) { yield n; yield n + 1; yield n + 2 }; let g = count(10); [next(g), take(g, 5), next(g, -1), next(g)]`,
+			"[10, [11, 12], -1, null]"},
+		// 调用生成器函数时不执行函数体
+		{`let log = []; let f = fn() { push(log, 1); yield 1 }; let g = f(); g`, "generator f"},
+		{`let g = fn() { yield 1 }(); inspect(g)`, "<generator <anonymous>>"},
+		// 递归的 yield* 表示无限序列
+		{`let naturals = fn(n) { yield n; yield* naturals(n + 1) }; take(naturals(1), 5)`, "[1, 2, 3, 4, 5]"},
+		{`let fib = fn(a, b) { yield a; yield* fib(b, a + b) }; take(fib(0, 1), 10)`, "[0, 1, 1, 2, 3, 5, 8, 13, 21, 34]"},
+		{`let g = fn() { yield* 1..3; yield* [7, 8]; return 0; yield 99 }; take(g(), 10)`, "[1, 2, 3, 7, 8]"},
+		// 每次调用得到独立的生成器, 局部变量在两次取值之间保留
+		{`let f = fn(start) { let x = start * 2; yield x; let y = x + 1; yield y };
+let a = f(1); let b = f(10); [next(a), next(b), next(a), next(b)]`, "[2, 20, 3, 21]"},
+		// 生成器中使用另一个生成器
+		{`let evens = fn(g) { let x = next(g, 0); if (x > 0) { if (x / 2 * 2 == x) { yield x }; yield* evens(g) } };
+let nums = fn() { yield* 1..10 }; take(evens(nums()), 10)`, "[2, 4, 6, 8, 10]"},
+		{`let f = fn() { try { yield 1; throw "boom" } catch (e) { yield e.message } }; take(f(), 5)`, "[1, boom]"},
+		// 函数体中的错误由取值的一方得到
+		{`let f = fn() { yield 1; 1 / 0; yield 2 }; let g = f(); [next(g), try { next(g) } catch (e: ArithmeticError) { e.message }, next(g)]`,
+			"[1, division by zero: 1 / 0, null]"},
+		{`let f = fn() { yield 1; undefined_name }; take(f(), 3)`, "ERROR: identifier not found: undefined_name"},
+		{`let f = fn() { yield next(me) }; let me = f(); next(me)`, "ERROR: generator is already running"},
+		{`yield 1`, "ERROR: yield outside generator function"},
+		{`let f = fn() { yield* 1 }; next(f())`, "ERROR: cannot yield* INTEGER, want ARRAY, HASH, STRING, RANGE or GENERATOR"},
+		{`next([1])`, "ERROR: first argument to `next` must be GENERATOR, got ARRAY"},
+		{`let f = fn() { yield 1 }; take(f(), "a")`, "ERROR: second argument to `take` must be INTEGER, got STRING"},
+		// 函数字面量中的 yield 不会让外层函数成为生成器
+		{`let f = fn() { let inner = fn() { yield 1 }; next(inner()) + 1 }; f()`, "2"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 不同解释器中的生成器同时执行, 每个 yield 交给自己解释器中的生成器
+func TestConcurrentGenerators(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf(`let count = fn(n) { yield n; yield n + 1; yield n + 2 };
+let loop = fn(k, sum) { if (k == 0) { sum } else { loop(k - 1, sum + len(take(count(%d), 3)) + next(count(%d))) } };
+loop(200, 0)`, i, i)
+			expected := fmt.Sprintf("%d", 200*(3+i))
+			if got := testEval(input).Inspect(); got != expected {
+				t.Errorf("wrong result in goroutine %d. expected=%s, got=%s", i, expected, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 被变量引用的生成器的 goroutine 在 Close 之后结束, 之后取值时生成器已经结束
+func TestGeneratorClose(t *testing.T) {
+	base := generatorGoroutines()
+
+	var input strings.Builder
+	input.WriteString("let count = fn(n) { yield n; yield n + 1 };\n")
+	for i := 0; i < 200; i++ {
+		// 标识符中不能有数字, 用字母编号
+		name := fmt.Sprintf("g_%c%c", 'a'+i/26, 'a'+i%26)
+		fmt.Fprintf(&input, "let %s = count(%d); next(%s);\n", name, i, name)
+	}
+	// 宿主回调中创建的生成器记录在函数所属的解释器上
+	input.WriteString("let make = fn() { let g = count(0); next(g); g };\n")
+	input.WriteString("[g_aa, g_hr]")
+
+	in := New(DefaultOptions())
+	program := parser.New(lexer.New(input.String())).ParseProgram()
+	env := object.NewEnvironment()
+	gens, ok := in.Eval(program, env).(*object.Array)
+	if !ok {
+		t.Fatalf("expected array of generators")
+	}
+	maker, _ := env.Get("make")
+	if _, err := CallFunction(context.Background(), maker); err != nil {
+		t.Fatalf("CallFunction: %v", err)
+	}
+	if n := generatorGoroutines(); n < base+201 {
+		t.Fatalf("expected at least %d goroutines before Close, got=%d", base+201, n)
+	}
+
+	in.Close()
+	if n := generatorGoroutines(); n > base {
+		t.Errorf("goroutines left after Close. expected=%d, got=%d", base, n)
+	}
+
+	// 结束之后的生成器和之后新建的生成器都不再交出值
+	for _, g := range gens.Elements {
+		if value, ok := g.(*object.Generator).Next(); ok {
+			t.Errorf("closed generator yielded %s", value.Inspect())
+		}
+	}
+	if got := in.Eval(parser.New(lexer.New("next(count(5), -1)")).ParseProgram(), env).Inspect(); got != "-1" {
+		t.Errorf("generator started after Close. expected=-1, got=%s", got)
+	}
+}
+
+// 正在执行生成器函数体的 goroutine 数
+func generatorGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), "evaluator.(*generator).run(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`html_escape("<a href='x'>Tom & Jerry</a>")`, "&lt;a href=&#39;x&#39;&gt;Tom &amp; Jerry&lt;/a&gt;"},
+		{`html_unescape("&lt;b&gt; &amp;amp; &#39;&#x27; &quot;")`, "<b> &amp; '' \""},
+		{`html_unescape(html_escape("<p class='a'>&</p>"))`, "<p class='a'>&</p>"},
+		{`shell_quote("simple-name_1.txt")`, "simple-name_1.txt"},
+		{`shell_quote("")`, "''"},
+		{`shell_quote("my file")`, "'my file'"},
+		{`shell_quote("it's; rm -rf /")`, `'it'\''s; rm -rf /'`},
+		{`shell_quote("$HOME")`, "'$HOME'"},
+		{`shell_quote(["ls", "-l", "my file"])`, "ls -l 'my file'"},
+		{`shell_quote([])`, ""},
+		{`json_escape("a
+b	</script> & \\")`, `a\nb\t\u003c/script\u003e \u0026 \\\\`},
+		{`json_escape("中文")`, "中文"},
+		{`html_escape(1)`, "ERROR: argument to `html_escape` must be STRING, got INTEGER"},
+		{`shell_quote(["a", 1])`, "ERROR: elements of array argument to `shell_quote` must be STRING, got INTEGER"},
+		{`shell_quote(1)`, "ERROR: argument to `shell_quote` must be STRING or ARRAY, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`float(3)`, "3.0"},
+		{`float("1.5")`, "1.5"},
+		{`float(" 1e-3 ")`, "0.001"},
+		{`float("1e21")`, "1e+21"},
+		{`float(12.50d)`, "12.5"},
+		{`float("0.1") + float("0.2")`, "0.30000000000000004"},
+		{`float(3) / 2`, "1.5"},
+		{`7 / float(2)`, "3.5"},
+		{`7 / 2`, "3"},
+		{`1 - float("0.5")`, "0.5"},
+		{`float(2) * float("1.25")`, "2.5"},
+		{`-float("1.5")`, "-1.5"},
+		{`1 / float(0)`, "Inf"},
+		{`-1 / float(0)`, "-Inf"},
+		{`float(0) / 0`, "NaN"},
+		{`float("inf")`, "Inf"},
+		{`float("-Inf")`, "-Inf"},
+		{`float("1e400")`, "Inf"},
+		{`let nan = float("nan"); nan == nan`, "false"},
+		{`let nan = float("nan"); nan != nan`, "true"},
+		{`let nan = float("nan"); [nan < 1, nan > 1]`, "[false, false]"},
+		{`float(1) == 1`, "true"},
+		{`float("1.5") > 1`, "true"},
+		{`2 < float("1.5")`, "false"},
+		{`[float(1)] == [float(1)]`, "true"},
+		{`[float(1)] == [1]`, "false"},
+		{`is_nan(float("nan"))`, "true"},
+		{`is_nan(1)`, "false"},
+		{`is_inf(1 / float(0))`, "true"},
+		{`is_inf(1 / float(0), -1)`, "false"},
+		{`is_inf(-1 / float(0), -1)`, "true"},
+		{`int(float("2.7"))`, "2"},
+		{`int(float("-2.7"))`, "-2"},
+		{`int(12.99d)`, "12"},
+		{`int(-12.99d)`, "-12"},
+		{`int(" 42 ")`, "42"},
+		{`int(float("nan"))`, "ERROR: cannot convert NaN to INTEGER"},
+		{`int(float("1e19"))`, "ERROR: integer overflow: 1e+19"},
+		{`int("99999999999999999999")`, `ERROR: integer overflow: "99999999999999999999"`},
+		{`int("1.5")`, `ERROR: invalid integer: "1.5"`},
+		{`decimal(float("0.1"))`, "0.1"},
+		{`decimal(float("inf"))`, "ERROR: cannot convert Inf to DECIMAL"},
+		{`round(float("2.675"), 2)`, "2.68"},
+		{`round(float("2.5"), 0, "half_even")`, "2.0"},
+		{`round(float("-1.25"), 1, "floor")`, "-1.3"},
+		{`round(float("nan"), 2)`, "NaN"},
+		{`float("1.5") + 1.5d`, "ERROR: type mismatch: FLOAT + DECIMAL"},
+		{`float("1.5") + "a"`, "ERROR: type mismatch: FLOAT + STRING"},
+		{`float("abc")`, `ERROR: invalid float: "abc"`},
+		{`float(true)`, "ERROR: argument to `float` must be STRING, INTEGER, BIGINT, FLOAT or DECIMAL, got BOOLEAN"},
+		{`format("%.2f|%6.1f|%e|%g", float("3.14159"), 2, float("1234.5"), float("0.5"))`, "3.14|   2.0|1.234500e+03|0.5"},
+		{`format("%f", "x")`, "ERROR: format: %f wants FLOAT or INTEGER, got STRING"},
+		{`let h = {float(1): "a"}; [h[float(1)], h[float(0)] == fn(){}(), h[1] == fn(){}()]`, "[a, true, true]"},
+		{`let h = {float(0): "zero"}; h[-float(0)]`, "zero"},
+		{`has_feature("float")`, "true"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSemver(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let v = semver_parse("v1.2.3-beta.1+build.5"); [v.major, v.minor, v.patch, v.prerelease, v.build]`, "[1, 2, 3, beta.1, build.5]"},
+		{`semver_parse("1.2.3").prerelease`, ""},
+		{`semver_parse("1.2")`, `ERROR: invalid semver: "1.2"`},
+		{`semver_parse("01.2.3")`, `ERROR: invalid semver: "01.2.3"`},
+		{`semver_parse("1.2.3-beta..1")`, `ERROR: invalid semver: "1.2.3-beta..1"`},
+		{`semver_parse(1)`, "ERROR: argument to `semver_parse` must be STRING, got INTEGER"},
+		{`semver_cmp("1.10.0", "1.9.3")`, "1"},
+		{`semver_cmp("1.2.3", "v1.2.3+meta")`, "0"},
+		{`semver_cmp("1.0.0-alpha", "1.0.0")`, "-1"},
+		{`semver_cmp("1.0.0-alpha", "1.0.0-alpha.1")`, "-1"},
+		{`semver_cmp("1.0.0-alpha.1", "1.0.0-alpha.beta")`, "-1"},
+		{`semver_cmp("1.0.0-beta.11", "1.0.0-beta.2")`, "1"},
+		{`semver_cmp("1.0.0-rc.1", "1.0.0-beta.11")`, "1"},
+		{`semver_satisfies("1.4.2", "^1.2")`, "true"},
+		{`semver_satisfies("2.0.0", "^1.2")`, "false"},
+		{`semver_satisfies("1.1.9", "^1.2")`, "false"},
+		{`semver_satisfies("0.2.9", "^0.2.3")`, "true"},
+		{`semver_satisfies("0.3.0", "^0.2.3")`, "false"},
+		{`semver_satisfies("0.0.4", "^0.0.3")`, "false"},
+		{`semver_satisfies("1.2.9", "~1.2.3")`, "true"},
+		{`semver_satisfies("1.3.0", "~1.2.3")`, "false"},
+		{`semver_satisfies("1.9.0", "~1")`, "true"},
+		{`semver_satisfies("1.2.7", "1.2.x")`, "true"},
+		{`semver_satisfies("1.3.0", "1.2")`, "false"},
+		{`semver_satisfies("5.0.0", "*")`, "true"},
+		{`semver_satisfies("1.5.0", ">=1.0 <2")`, "true"},
+		{`semver_satisfies("1.5.0", ">= 1.0 < 1.5")`, "false"},
+		{`semver_satisfies("2.0.0", ">=1.0 <2 || 3")`, "false"},
+		{`semver_satisfies("3.1.0", ">=1.0 <2 || 3")`, "true"},
+		{`semver_satisfies("1.3.0", ">1.2")`, "true"},
+		{`semver_satisfies("1.2.9", ">1.2")`, "false"},
+		{`semver_satisfies("1.2.9", "<=1.2")`, "true"},
+		{`semver_satisfies("1.2.3", "=1.2.3")`, "true"},
+		{`semver_satisfies("1.2.3-rc.1", ">=1.2.3-beta")`, "true"},
+		{`semver_satisfies("1.3.0-alpha", ">=1.2.3-beta")`, "false"},
+		{`semver_satisfies("2.0.0-alpha", "^1.2")`, "false"},
+		{`semver_satisfies("1.2.3", "^x.y")`, `ERROR: invalid semver range: "^x.y"`},
+		{`semver_satisfies("1.2.3", 1)`, "ERROR: second argument to `semver_satisfies` must be STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`bytes("GIF")`, `b"GIF"`},
+		{`bytes("ff00d8", "hex")`, `b"\xff\x00\xd8"`},
+		{`bytes("aGk=", "base64")`, `b"hi"`},
+		{`bytes([71, 73, 70, 0, 255])`, `b"GIF\x00\xff"`},
+		{`bytes("中")`, `b"\xe4\xb8\xad"`},
+		{`len(bytes("中"))`, "3"},
+		{`len(bytes(""))`, "0"},
+		{`bytes("ff00", "hex")[0]`, "255"},
+		{`bytes("ff00", "hex")[-1]`, "0"},
+		{`bytes("ab")[5]`, "null"},
+		{`bytes("hello")[1:3]`, `b"el"`},
+		{`bytes("hello")[-2:]`, `b"lo"`},
+		{`bytes("GIF") + bytes([56, 57, 97])`, `b"GIF89a"`},
+		{`bytes("a") == bytes([97])`, "true"},
+		{`bytes("a") != bytes("b")`, "true"},
+		{`[bytes("a")] == [bytes("a")]`, "true"},
+		{`let h = {bytes("k"): 1}; h[bytes("k")]`, "1"},
+		{`bytes_to_string(bytes("hi"), "hex")`, "6869"},
+		{`bytes_to_string(bytes("hi"), "base64")`, "aGk="},
+		{`bytes_to_string(bytes("中文"))`, "中文"},
+		{`bytes_to_string(bytes("ff", "hex"))`, "ERROR: bytes are not valid UTF-8"},
+		{`bytes_to_string(bytes(bytes("hi")))`, "hi"},
+		{`bytes("zz", "hex")`, "ERROR: invalid hex: encoding/hex: invalid byte: U+007A 'z'"},
+		{`bytes("a", "latin1")`, `ERROR: unknown encoding: "latin1", want utf8, hex or base64`},
+		{`bytes([256])`, "ERROR: elements of array argument to `bytes` must be INTEGER from 0 to 255, got 256"},
+		{`bytes(1)`, "ERROR: first argument to `bytes` must be STRING, ARRAY or BYTES, got INTEGER"},
+		{`bytes("a") + "b"`, "ERROR: type mismatch: BYTES + STRING"},
+		{`bytes("a") - bytes("b")`, "ERROR: unknown operator: BYTES - BYTES"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStyle(t *testing.T) {
+	defer func(color string) { Color = color }(Color)
+
+	Color = COLOR_ALWAYS
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`style("ok", "green")`, "\x1b[32mok\x1b[0m"},
+		{`style("FAIL", ["bold", "red"])`, "\x1b[1;31mFAIL\x1b[0m"},
+		{`style("x", ["bright_white", "bg_blue", "bg_bright_black"])`, "\x1b[97;44;100mx\x1b[0m"},
+		{`style("plain", [])`, "plain"},
+		{`style("x", "purple")`, `ERROR: unknown style: "purple"`},
+		{`style("x", "bright_bold")`, `ERROR: unknown style: "bright_bold"`},
+		{`style("x", [1])`, "ERROR: style names must be STRING, got INTEGER"},
+		{`style(1, "red")`, "ERROR: first argument to `style` must be STRING, got INTEGER"},
+		{`is_tty("stdout")`, "false"},
+		{`is_tty("tape")`, `ERROR: unknown stream: "tape", want stdout, stderr or stdin`},
+		{`terminal_width() > 0`, "true"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 不输出颜色时原样返回
+	for _, color := range []string{COLOR_NEVER, COLOR_AUTO} {
+		Color = color
+		if got := testEval(`style("FAIL", ["bold", "red"])`).Inspect(); got != "FAIL" {
+			t.Errorf("Color=%s: expected plain text, got=%q", color, got)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var out strings.Builder
+	Stderr = &out
+	defer func() { Stderr = os.Stderr }()
+	defer func(columns string) { os.Setenv("COLUMNS", columns) }(os.Getenv("COLUMNS"))
+	os.Setenv("COLUMNS", "40")
+
+	// 标准错误不是终端时什么也不输出
+	testEval(`let bar = progress(4); bar.tick(); bar.done(); let s = spinner("wait"); s.tick(); s.done("ok")`)
+	if out.String() != "" {
+		t.Fatalf("progress should not render without a terminal. got=%q", out.String())
+	}
+
+	defer func(enabled func() bool) { progressEnabled = enabled }(progressEnabled)
+	progressEnabled = func() bool { return true }
+
+	testEval(`let bar = progress(4, "copy"); bar.tick(); bar.tick(0); bar.tick(2); bar.done(); bar.tick()`)
+	expected := "\rcopy [#####------------------]  25% 1/4" +
+		"\rcopy [#################------]  75% 3/4" +
+		"\rcopy [#######################] 100% 4/4\n"
+	if out.String() != expected {
+		t.Errorf("wrong progress output. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	testEval(`let s = spinner("wait"); s.tick(); s.tick(); s.done("ok"); s.tick()`)
+	expected = "\r| wait\r/ wait\r\x1b[Kok\n"
+	if out.String() != expected {
+		t.Errorf("wrong spinner output. expected=%q, got=%q", expected, out.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`progress(0)`, "ERROR: progress total must be positive, got 0"},
+		{`progress("10")`, "ERROR: first argument to `progress` must be INTEGER, got STRING"},
+		{`progress(10, 1)`, "ERROR: label argument to `progress` must be STRING, got INTEGER"},
+		{`progress(10).tick("1")`, "ERROR: argument to `tick` must be INTEGER, got STRING"},
+		{`spinner().done(1, 2)`, "ERROR: wrong number of arguments. got=2, want=0 or 1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: "x", 1: "y", 2: "z"}`, "{3: x, 1: y, 2: z}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b: 3, a: 2}"},
+		{`{"b": 1, "a": 2} + {"c": 3, "b": 4}`, "{b: 4, a: 2, c: 3}"},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, "true"},
+		{`len({"b": 1, "a": 2, "b": 3})`, "2"},
+	}
+	for _, tt := range tests {
+		// 多次执行, 顺序不能依赖 map 的随机遍历顺序
+		for i := 0; i < 10; i++ {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Fatalf("wrong result for %q. expected=%q, got=%q",
+					tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	}
+
+	hash := object.NewHash(0)
+	for _, name := range []string{"x", "y", "z"} {
+		hashSet(hash, name, TRUE)
+	}
+	hash.Delete((&object.String{Value: "y"}).HashKey())
+	hash.Delete((&object.String{Value: "missing"}).HashKey())
+	hashSet(hash, "y", FALSE)
+	if got := hash.Inspect(); got != "{x: true, z: true, y: false}" {
+		t.Errorf("wrong order after delete. got=%q", got)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mk-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 没有断点文件时什么也不做
+	if result := testEval(`checkpoint("a")`); result != NULL {
+		t.Fatalf("checkpoint without a file should return null. got=%s", result.Inspect())
+	}
+
+	options := DefaultOptions()
+	options.CheckpointFile = filepath.Join(dir, "job.mk.checkpoint")
+	first := `
+	let double = fn(x) { x * 2 };
+	let rows = [1, 2, {"n": 3}];
+	const meta = {"f": float(3) / float(2), "d": decimal("2.50"), "b": bytes("hi"), 1: true, "z": fn(){}()};
+	let helper = [fn() { 1 }];
+	checkpoint("loaded");
+	let total = double(rows[0] + rows[1] + rows[2].n);
+	checkpoint("processed");
+	let done = true;
+	exit(1)`
+	if result := testEvalWith(New(options), first); result.Type() != object.EXIT_OBJ {
+		t.Fatalf("expected exit. got=%s", result.Inspect())
+	}
+
+	in := New(options)
+	if err := in.LoadCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// 断点之前除了函数定义都不再执行, 否则 fail() 会报错
+	resumed := `
+	let double = fn(x) { x * 2 };
+	let rows = fail();
+	const meta = fail();
+	checkpoint("loaded");
+	let total = fail();
+	checkpoint("processed");
+	checkpoint("finished");
+	let names = vars();
+	[rows, meta, total, double(total), names.helper, names.done]`
+	expected := `[[1, 2, {n: 3}], {f: 1.5, d: 2.50, b: b"hi", 1: true, z: null}, 12, 24, null, null]`
+	if result := testEvalWith(in, resumed); result.Inspect() != expected {
+		t.Fatalf("wrong resumed result. expected=%s, got=%s", expected, result.Inspect())
+	}
+
+	data, err := ioutil.ReadFile(options.CheckpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"completed": [
+    "loaded",
+    "processed",
+    "finished"
+  ]`) {
+		t.Errorf("checkpoint file should list completed checkpoints. got=%s", data)
+	}
+
+	// 恢复的 const 仍然不能重新赋值
+	in = New(options)
+	if err := in.LoadCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	result := testEvalWith(in, `checkpoint("finished"); let meta = 1`)
+	if err, ok := result.(*object.Error); !ok || !strings.Contains(err.Message, "meta") {
+		t.Errorf("restored const should not be reassigned. got=%s", result.Inspect())
+	}
+
+	// 只有读取了断点文件的解释器从断点继续
+	in = New(options)
+	if err := in.LoadCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if result := testEvalWith(New(options), `let f = fn() { checkpoint("finished") }; 1`); result.Inspect() != "1" {
+		t.Errorf("another interpreter should not resume. got=%s", result.Inspect())
+	}
+	result = testEvalWith(in, `let f = fn() { checkpoint("finished") }; f()`)
+	expectedError := `ERROR: cannot resume: checkpoint("finished") is not a top-level statement`
+	if result.Inspect() != expectedError {
+		t.Errorf("expected %s. got=%s", expectedError, result.Inspect())
+	}
+
+	if err := in.ClearCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(options.CheckpointFile); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file should be removed. got=%v", err)
+	}
+	// 文件不存在时从头执行
+	in = New(options)
+	if err := in.LoadCheckpoint(); err != nil || in.resumeState != nil {
+		t.Errorf("missing checkpoint file should not resume. got=%v", err)
+	}
+
+	if result := testEval(`checkpoint(1)`); !strings.Contains(result.Inspect(), "checkpoint") {
+		t.Errorf("expected an argument error. got=%s", result.Inspect())
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`bigint("9223372036854775807") + 1`, "9223372036854775808"},
+		{`1 - bigint("-9223372036854775808")`, "9223372036854775809"},
+		{`bigint(2) * bigint("0xffffffffffffffff")`, "36893488147419103230"},
+		{`bigint("340282366920938463463374607431768211456") / bigint("18446744073709551616")`, "18446744073709551616"},
+		{`bigint(-7) / 2`, "-3"},
+		{`-bigint("100000000000000000000")`, "-100000000000000000000"},
+		{`bigint("1_000") == 1000`, "true"},
+		{`bigint(5) != bigint(5)`, "false"},
+		{`bigint("100000000000000000000") > 9223372036854775807`, "true"},
+		{`3 < bigint(2)`, "false"},
+		{`bigint(12.99d)`, "12"},
+		{`bigint(bigint(" 0b101 "))`, "5"},
+		{`bigint(3) + 0.25d`, "3.25"},
+		{`decimal(bigint("100000000000000000000")) / 8`, "12500000000000000000"},
+		{`int(bigint("-42"))`, "-42"},
+		{`float(bigint("100000000000000000000"))`, "1e+20"},
+		{`to_hex(bigint("0xffffffffffffffffff"))`, "ffffffffffffffffff"},
+		{`to_bin(-bigint(5))`, "-101"},
+		{`format("%d|%x|%08b", bigint("18446744073709551616"), bigint(255), bigint(5))`, "18446744073709551616|ff|00000101"},
+		{`[bigint(1)] == [bigint(1)]`, "true"},
+		{`{bigint(7): "a"}[bigint("7")]`, "a"},
+		{`{bigint(7): "a"}[7]`, "null"},
+		{`has_feature("bigint")`, "true"},
+		{`int(bigint("9223372036854775808"))`, "ERROR: integer overflow: 9223372036854775808"},
+		{`bigint(1) / 0`, "ERROR: division by zero: 1 / 0"},
+		{`bigint(1) + float(1)`, "ERROR: type mismatch: BIGINT + FLOAT"},
+		{`bigint("1.5")`, `ERROR: invalid bigint: "1.5"`},
+		{`bigint(float(1))`, "ERROR: argument to `bigint` must be STRING, INTEGER, BIGINT or DECIMAL, got FLOAT"},
+		{`bigint()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	result := testEval(`bigint(5) * 5`)
+	if result.Type() != object.BIGINT_OBJ {
+		t.Errorf("bigint arithmetic should stay BIGINT. got=%s", result.Type())
+	}
+}
+
+func TestMemoDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mk-memo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out strings.Builder
+	Stdout = &out
+	defer func() { Stdout = os.Stdout }()
+
+	square := `let sq = memo_disk(fn(x) { puts(x); x * x }, "` + dir + `"); [sq(3), sq(3), sq(4)]`
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		// 第一次运行时计算, 之后的运行(新的环境)从磁盘读取
+		{square, "[9, 9, 16]", "3\n4\n"},
+		{square, "[9, 9, 16]", ""},
+		// 出错时不缓存
+		{`memo_disk(fn(x) { puts(x); x + true }, "` + dir + `")(1)`, "ERROR: type mismatch: INTEGER + BOOLEAN", "1\n"},
+		{`memo_disk(fn(x) { puts(x); x + true }, "` + dir + `")(1)`, "ERROR: type mismatch: INTEGER + BOOLEAN", "1\n"},
+		// 函数体改变之后重新计算
+		{`let sq = memo_disk(fn(x) { puts(x); x * x + 0 }, "` + dir + `"); sq(3)`, "9", "3\n"},
+		// 参数不能序列化时不缓存
+		{`let call = memo_disk(fn(f) { f() }, "` + dir + `"); call(fn() { puts("called"); 1 }) + call(fn() { puts("called"); 1 })`, "2", "called\ncalled\n"},
+		// 结果不能序列化时不缓存
+		{`let make = memo_disk(fn(x) { puts(x); fn() { x } }, "` + dir + `"); make(1)() + make(1)()`, "2", "1\n1\n"},
+		{`memo_disk(fn(x) { x }, "` + dir + `")(bigint("123456789012345678901234567890"))`, "123456789012345678901234567890", ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 cache files. got=%v", files)
+	}
+
+	// 损坏的缓存文件重新计算
+	for _, file := range files {
+		if err := ioutil.WriteFile(file, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out.Reset()
+	if result := testEval(square); result.Inspect() != "[9, 9, 16]" {
+		t.Errorf("wrong result after corrupting the cache. got=%s", result.Inspect())
+	}
+	if out.String() != "3\n4\n" {
+		t.Errorf("corrupted cache entries should be recomputed. got=%q", out.String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`memo_disk(len, "` + dir + `")`, "ERROR: first argument to `memo_disk` must be FUNCTION, got BUILTIN"},
+		{`memo_disk(fn(x) { x }, 1)`, "ERROR: second argument to `memo_disk` must be STRING, got INTEGER"},
+		{`memo_disk(fn(x) { x }, "")`, "ERROR: cache directory of `memo_disk` must not be empty"},
+		{`memo_disk(fn(x) { x })`, "ERROR: wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLoadPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mk-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "ext.so"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions()
+	options.ModuleDir = dir
+	defer func(open func(string, string) (object.PluginExports, error)) { openPlugin = open }(openPlugin)
+	openPlugin = func(path, symbol string) (object.PluginExports, error) {
+		if path != filepath.Join(dir, "ext.so") {
+			t.Errorf("plugin path should be resolved against Options.ModuleDir. got=%s", path)
+		}
+		switch symbol {
+		case "Exports":
+			return func() (map[string]object.Object, error) {
+				return map[string]object.Object{
+					"double": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+						return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+					}},
+					"version": &object.String{Value: "1.0"},
+					"nothing": nil,
+				}, nil
+			}, nil
+		case "Broken":
+			return func() (map[string]object.Object, error) {
+				return nil, fmt.Errorf("missing config")
+			}, nil
+		default:
+			return nil, fmt.Errorf("symbol %s not found", symbol)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let ext = load_plugin("ext.so", "Exports"); ext.double(21)`, "42"},
+		{`load_plugin("ext.so", "Exports")`, "{double: builtin funciton, nothing: null, version: 1.0}"},
+		{`load_plugin("ext.so", "Exports").nothing`, "null"},
+		{`load_plugin("ext.so", "Broken")`, `ERROR: load_plugin "ext.so": missing config`},
+		{`load_plugin("ext.so", "Missing")`, `ERROR: load_plugin "ext.so": symbol Missing not found`},
+		{`load_plugin("ext.so", 1)`, "ERROR: second argument to `load_plugin` must be STRING, got INTEGER"},
+		{`load_plugin("ext.so")`, "ERROR: wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(options), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	result := testEvalWith(New(options), `load_plugin("missing.so", "Exports")`)
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.IOError {
+		t.Errorf("missing plugin file should be an IOError. got=%s", result.Inspect())
+	}
+	result = testEvalWith(New(options), `load_plugin("ext.so", "Missing")`)
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.ImportError {
+		t.Errorf("missing symbol should be an ImportError. got=%s", result.Inspect())
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }; Point(1, [2])`, "Point{x: 1, y: [2]}"},
+		{`struct Point { x, y }; Point`, "struct Point { x, y }"},
+		{`struct Point { x, y }; let p = Point(1, 2); p.x + p.y`, "3"},
+		{`struct Empty {}; Empty()`, "Empty{}"},
+		{`struct Point { x, y }; Point(1, [2]) == Point(1, [2])`, "true"},
+		{`struct Point { x, y }; Point(1, 2) != Point(1, 3)`, "true"},
+		{`struct A { x }; struct B { x }; A(1) == B(1)`, "false"},
+		{`struct A { x }; let p = A(1); struct A { x }; p == A(1)`, "false"},
+		{`struct Point { x, y }; [Point(1, 2)] == [Point(1, 2)]`, "true"},
+		{`struct Point { x, y }; let p = Point(1, 2); match (p) { Point(1, 3) => "a", Point(1, 2) => "b", _ => "c" }`, "b"},
+		{`struct Point { x, y }; struct Line { a, b }; let describe = fn(v) { match (v) { Line => "line", Point => "point", _ => "other" } }; [describe(Point(0, 0)), describe(Line(1, 2)), describe({"x": 0})]`, "[point, line, other]"},
+		{`struct Point { x, y }; match (Point) { Point => "type" }`, "type"},
+		{`struct Node { value, next }; let list = Node(1, Node(2, fn(){}())); list.next.value`, "2"},
+		{`struct Point { x, y }; inspect(Point(1, "a"))`, "Point {\n  x: 1,\n  y: \"a\"\n}"},
+		{`struct Point { x, y }; let make = fn(f) { f(3, 4) }; make(Point).y`, "4"},
+		{`let f = fn() { struct Local { v }; Local(1) }; f().v`, "1"},
+		{`has_feature("struct")`, "true"},
+		{`struct Point { x, y }; Point(1, 2).z`, "ERROR: Point has no field z"},
+		{`struct Point { x, y }; Point(1)`, "ERROR: wrong number of arguments to Point. got=1, want=2"},
+		{`struct Point { x, y }; Point(1, 2) == 1`, "ERROR: type mismatch: STRUCT == INTEGER"},
+		{`struct Point { x, y }; Point(1, 2)["x"]`, "ERROR: index operator not supported: STRUCT"},
+		{`const Point = 1; struct Point { x }`, "ERROR: cannot assign to constant Point"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	options := DefaultOptions()
+	options.Strict = true
+	result := testEvalWith(New(options), `let Point = 1; struct Point { x }`)
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.NameError {
+		t.Errorf("redeclaring a struct in strict mode should be a NameError. got=%s", result.Inspect())
+	}
+}
+
+func TestMethodCall(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let counter = {"n": 1, "next": fn(step) { self.n + step }}; counter.next(2)`, "3"},
+		{`let o = {"name": "a", "get": fn() { self }}; o.get() == o`, "true"},
+		{`let o = {"f": fn(x = self.d) { x }, "d": 5}; [o.f(), o.f(1)]`, "[5, 1]"},
+		{`let o = {"f": fn(self) { self }}; o.f(1)`, "1"},
+		{`let o = {"v": 1, "inner": {"v": 2, "get": fn() { self.v }}}; o.inner.get()`, "2"},
+		{`let o = {"v": 1, "get": fn() { self.v }, "call": fn(other) { [self.get(), other.get()] }}; o.call({"v": 2, "get": o.get})`, "[1, 2]"},
+		{`struct Counter { n, inc }; let c = Counter(1, fn() { self.n + 1 }); c.inc()`, "2"},
+		{`let lib = {"add": fn(a, b) { a + b }}; lib.add(1, 2)`, "3"},
+		{`let make = fn(v) { {"v": v, "get": fn() { self.v }} }; make(3).get()`, "3"},
+		{`let o = {"v": 7, "get": fn() { self.v }}; let twice = fn(f) { f() + f() }; twice(bind(o.get, o))`, "14"},
+		{`let get = fn() { self }; bind(get, [1])()`, "[1]"},
+		{`let o = {"v": 1, "gen": fn() { yield self.v; }}; next(o.gen())`, "1"},
+		{`has_feature("methods")`, "true"},
+		{`let o = {"get": fn() { self }}; let f = o.get; f()`, "ERROR: identifier not found: self"},
+		{`bind(len, {})`, "ERROR: first argument to `bind` must be FUNCTION, got BUILTIN"},
+		{`bind(fn() {})`, "ERROR: wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 构造描述文件中的字段
+func testDescField(name string, number int32, label descriptorpb.FieldDescriptorProto_Label,
+	kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  label.Enum(),
+		Type:   kind.Enum(),
+	}
+	if typeName != "" {
+		field.TypeName = proto.String(typeName)
+	}
+	return field
+}
+
+// 加上 5 个字节的消息头
+func testGrpcFrame(payload []byte) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestGrpcCall(t *testing.T) {
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	)
+	method := func(name string, streaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".demo.Req"),
+			OutputType:      proto.String(".demo.Req"),
+			ServerStreaming: proto.Bool(streaming),
+		}
+	}
+
+	// package demo; syntax = "proto3"; 枚举在单独的文件中, 用于检查依赖
+	colorFile := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("color.proto"),
+		Package: proto.String("demo"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("RED"), Number: proto.Int32(0)},
+				{Name: proto.String("GREEN"), Number: proto.Int32(1)},
+			},
+		}},
+	}
+	note := testDescField("note", 12, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	note.OneofIndex = proto.Int32(0)
+	note.Proto3Optional = proto.Bool(true)
+	demoFile := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("demo.proto"),
+		Package:    proto.String("demo"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"color.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Req"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testDescField("name", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				testDescField("count", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				testDescField("ids", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				testDescField("color", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".demo.Color"),
+				testDescField("tags", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".demo.Req.TagsEntry"),
+				testDescField("inner", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".demo.Req.Inner"),
+				testDescField("data", 7, optional, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+				testDescField("big", 8, optional, descriptorpb.FieldDescriptorProto_TYPE_UINT64, ""),
+				testDescField("delta", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_SINT32, ""),
+				testDescField("ratio", 10, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				testDescField("flag", 11, optional, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+				note,
+				testDescField("user_name", 13, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("Inner"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						testDescField("v", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					},
+				},
+				{
+					Name: proto.String("TagsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						testDescField("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						testDescField("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("_note")}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name:   proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{method("Echo", false), method("Fail", false), method("Watch", true)},
+		}},
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{colorFile, demoFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "mk-grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "demo.desc"), set, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultOptions()
+	options.ModuleDir = dir
+
+	// 反射接口的响应: 按文件名或者符号返回一个文件, 只实现 v1alpha
+	var reflections int32
+	reflect := func(request []byte) []byte {
+		atomic.AddInt32(&reflections, 1)
+		var file *descriptorpb.FileDescriptorProto
+		for _, f := range protoFields(request) {
+			switch {
+			case f.number == REFLECT_FILE_CONTAINING_SYMBOL && string(f.value) == "demo.Echo":
+				file = demoFile
+			case f.number == REFLECT_FILE_BY_FILENAME && string(f.value) == "color.proto":
+				file = colorFile
+			}
+		}
+		if file == nil {
+			errorResponse := protowire.AppendTag(nil, 1, protowire.VarintType)
+			errorResponse = protowire.AppendVarint(errorResponse, GRPC_NOT_FOUND)
+			return protowire.AppendBytes(protowire.AppendTag(nil, REFLECT_ERROR, protowire.BytesType), errorResponse)
+		}
+		data, _ := proto.Marshal(file)
+		files := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), data)
+		return protowire.AppendBytes(protowire.AppendTag(nil, REFLECT_FILE_DESCRIPTOR, protowire.BytesType), files)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("request should be HTTP/2 gRPC. got=%s %s", r.Proto, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		switch r.URL.Path {
+		case "/demo.Echo/Echo":
+			// 把请求中的元数据放在 name 字段中返回, 其他字段原样返回
+			if token := r.Header.Get("X-Token"); token != "" {
+				body = testGrpcFrame(protowire.AppendString(protowire.AppendTag(body[5:], 1, protowire.BytesType), token))
+			}
+			w.Write(body)
+			w.Header().Set("Grpc-Status", "0")
+		case "/demo.Echo/Fail":
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "no%20such user")
+		case "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo":
+			w.Write(testGrpcFrame(reflect(body[5:])))
+			w.Header().Set("Grpc-Status", "0")
+		default:
+			w.Header().Set("Grpc-Status", "12")
+		}
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// 通过选项使用信任测试证书的连接
+	options.GRPCTransport = server.Client().Transport
+
+	call := func(method, request string) string {
+		return fmt.Sprintf(`grpc_call(%q, %q, %s, {"descriptors": "demo.desc"})`, server.URL, method, request)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{call("demo.Echo/Echo", `{}`),
+			`{name: , count: 0, ids: [], color: RED, tags: {}, inner: null, data: b"", big: 0, delta: 0, ratio: 0.0, flag: false, note: null, user_name: }`},
+		{call("demo.Echo/Echo", `{"name": "ann", "count": -3, "ids": [1, 300, -1], "color": "GREEN", "tags": {"b": 2, "a": 1}, "inner": {"v": "x"}, "data": "hi", "big": bigint("18446744073709551615"), "delta": -2, "ratio": float("0.5"), "flag": true, "note": "", "userName": "u"}`),
+			`{name: ann, count: -3, ids: [1, 300, -1], color: GREEN, tags: {a: 1, b: 2}, inner: {v: x}, data: b"hi", big: 18446744073709551615, delta: -2, ratio: 0.5, flag: true, note: , user_name: u}`},
+		{call("/demo.Echo/Echo", `{"color": 7, "note": fn(){}()}`) + `.color`, "7"},
+		{fmt.Sprintf(`grpc_call(%q, "demo.Echo/Echo", {}, {"descriptors": "demo.desc", "metadata": {"x-token": "secret"}, "timeout": 5s}).name`, server.URL), "secret"},
+		{call("demo.Echo/Fail", `{}`), "ERROR: grpc_call demo.Echo/Fail: NOT_FOUND: no such user"},
+		{call("demo.Echo/Watch", `{}`), "ERROR: grpc_call: demo.Echo/Watch is a streaming method, only unary methods are supported"},
+		{call("demo.Echo/Nope", `{}`), "ERROR: grpc_call: unknown method demo.Echo/Nope"},
+		{call("demo.Echo/Echo", `{"nmae": 1}`), "ERROR: grpc_call demo.Echo/Echo: demo.Req has no field nmae"},
+		{call("demo.Echo/Echo", `{"count": "1"}`), "ERROR: grpc_call demo.Echo/Echo: demo.Req.count: must be INTEGER, got STRING"},
+		{call("demo.Echo/Echo", `{"count": 3000000000}`), "ERROR: grpc_call demo.Echo/Echo: demo.Req.count: 3000000000 out of range for 32-bit field"},
+		{call("demo.Echo/Echo", `{"color": "BLUE"}`), "ERROR: grpc_call demo.Echo/Echo: demo.Req.color: demo.Color has no value BLUE"},
+		{call("demo.Echo/Echo", `{"big": -1}`), "ERROR: grpc_call demo.Echo/Echo: demo.Req.big: -1 out of range"},
+		{call("demo.Echo/Echo", `[]`), "ERROR: grpc_call demo.Echo/Echo: demo.Req must be HASH, got ARRAY"},
+
+		// 没有描述文件时通过反射取得, 依赖的文件单独请求
+		{fmt.Sprintf(`grpc_call(%q, "demo.Echo/Echo", {"name": "r", "color": "GREEN"})`, server.URL),
+			`{name: r, count: 0, ids: [], color: GREEN, tags: {}, inner: null, data: b"", big: 0, delta: 0, ratio: 0.0, flag: false, note: null, user_name: }`},
+		{fmt.Sprintf(`grpc_call(%q, "demo.Echo/Echo", {}, {"timeout": 5s}).count`, server.URL), "0"},
+		{fmt.Sprintf(`grpc_call(%q, "demo.Echo/Nope", {})`, server.URL), "ERROR: grpc_call: unknown method demo.Echo/Nope"},
+		{fmt.Sprintf(`grpc_call(%q, "demo.Missing/Echo", {})`, server.URL), "ERROR: grpc_call: unknown method demo.Missing/Echo"},
+
+		{`grpc_call("localhost:1", "demo.Echo/Echo", {}, {"descriptors": 1})`, "ERROR: descriptors of `grpc_call` must be STRING, got INTEGER"},
+		{`grpc_call("localhost:1", "demo.Echo/Echo", {}, {"descriptors": "demo.desc", "timeout": 5})`, "ERROR: timeout of `grpc_call` must be DURATION, got INTEGER"},
+		{`grpc_call("localhost:1", "demo.Echo/Echo")`, "ERROR: wrong number of arguments. got=2, want=3 or 4"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(options), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 同一个解释器中每个服务只反射一次: 服务所在的文件和依赖的文件各一次
+	atomic.StoreInt32(&reflections, 0)
+	input := fmt.Sprintf(`grpc_call(%q, "demo.Echo/Echo", {}); grpc_call(%q, "demo.Echo/Echo", {"count": 2}).count`, server.URL, server.URL)
+	if result := testEvalWith(New(options), input).Inspect(); result != "2" {
+		t.Errorf("wrong result for %q. got=%s", input, result)
+	}
+	if n := atomic.LoadInt32(&reflections); n != 2 {
+		t.Errorf("expected 2 reflection requests, got %d", n)
+	}
+
+	// 不同的解释器同时调用, 共享描述文件的缓存
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf(`grpc_call(%q, "demo.Echo/Echo", {"count": %d}, {"descriptors": "demo.desc"}).count`, server.URL, i)
+			results[i] = testEvalWith(New(options), input).Inspect()
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result != fmt.Sprint(i) {
+			t.Errorf("concurrent grpc_call %d returned %s", i, result)
+		}
+	}
+
+	for _, input := range []string{
+		`grpc_call("localhost:1", "demo.Echo/Echo", {}, {"descriptors": "missing.desc"})`,
+		// 没有描述文件时连接失败
+		`grpc_call("localhost:1", "demo.Echo/Echo", {})`,
+	} {
+		result := testEvalWith(New(options), input)
+		if err, ok := result.(*object.Error); !ok || err.Kind != object.IOError {
+			t.Errorf("%s should be an IOError. got=%s", input, result.Inspect())
+		}
+	}
+}
+
+func TestGrpcTimeout(t *testing.T) {
+	tests := []struct {
+		timeout  time.Duration
+		expected string
+	}{
+		{0, "0n"},
+		{-time.Second, "0n"},
+		{time.Nanosecond, "1n"},
+		{99999999 * time.Nanosecond, "99999999n"},
+		{100 * time.Millisecond, "100000u"},
+		{100*time.Millisecond + time.Nanosecond, "100001u"},
+		{5 * time.Second, "5000000u"},
+		{100 * time.Second, "100000m"},
+		{30 * time.Hour, "108000S"},
+		{time.Duration(math.MaxInt64), "2562048H"},
+	}
+	for _, tt := range tests {
+		if got := grpcTimeout(tt.timeout); got != tt.expected {
+			t.Errorf("grpcTimeout(%s) = %q, want %q", tt.timeout, got, tt.expected)
+		}
+	}
+}
+
+func TestIterables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[...[1, 2], ...{"b": 1, "a": 2}, ...(1..<3)]`, "[1, 2, b, a, 1, 2]"},
+		{`[..."aé中"]`, "[a, é, 中]"},
+		{`[...""]`, "[]"},
+		{`let g = fn() { yield 1; yield 2 }; [0, ...g(), 3]`, "[0, 1, 2, 3]"},
+		{`let g = fn() { yield 1; yield 2 }; let it = g(); next(it); [...it]`, "[2]"},
+		{`let add = fn(a, b) { a + b }; add(..."ab")`, "ab"},
+		{`let g = fn() { yield* {"x": 1}; yield* "hi" }; take(g(), 5)`, "[x, h, i]"},
+		{`take([1, 2, 3], 2)`, "[1, 2]"},
+		{`take(1..1000000, 3)`, "[1, 2, 3]"},
+		{`take("hello", 0)`, "[]"},
+		{`take({"a": 1}, 5)`, "[a]"},
+		{`let h = {"a": 1}; let a = [...h]; [a, [...h]]`, "[[a], [a]]"},
+		{`let g = fn() { yield 1; undefined_name }; [...g()]`, "ERROR: identifier not found: undefined_name"},
+		{`take(1, 2)`, "ERROR: first argument to `take` must be ARRAY, HASH, STRING, RANGE or GENERATOR, got INTEGER"},
+		{`[...true]`, "ERROR: cannot spread BOOLEAN, want ARRAY, HASH, STRING, RANGE or GENERATOR"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 每次 Iter 都从头开始
+	array := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	for i := 0; i < 2; i++ {
+		it := array.Iter()
+		if value, ok := it.Next(); !ok || value.Inspect() != "1" {
+			t.Errorf("Iter should start from the first element. got=%v, %v", value, ok)
+		}
+		if _, ok := it.Next(); ok {
+			t.Errorf("iterator should be exhausted after the last element")
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	now := start
+	timeNow = func() time.Time { return now }
+	// 不真正等待, 直接把时钟拨到唤醒的时间
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		now = now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- now
+		return ch
+	}
+	defer func() {
+		timeNow = time.Now
+		timeAfter = time.After
+		jobs = map[int64]*job{}
+	}()
+
+	var errOut strings.Builder
+	Stderr = &errOut
+	defer func() { Stderr = os.Stderr }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`schedule("* * *", fn() {})`, `ERROR: cron: expected 5 fields, got 3 in "* * *"`},
+		{`schedule("0 0 30 2 *", fn() {})`, `ERROR: cron: "0 0 30 2 *" never fires`},
+		{`schedule("* * * * *", 1)`, "ERROR: argument to `schedule` must be FUNCTION, got INTEGER"},
+		{`unschedule(schedule("* * * * *", fn() {}))`, "true"},
+		{`unschedule(12345)`, "false"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+	if HasScheduledJobs() {
+		t.Fatalf("expected no scheduled jobs")
+	}
+
+	// 第一次执行出错后继续运行, 第二次执行时退出
+	input := `
+schedule("*/5 * * * *", fn() {
+	if (now_minute() == 15) { exit(3) } else { 1 + true }
+});
+`
+	builtins["now_minute"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: int64(now.Minute())}
+	}}
+	defer delete(builtins, "now_minute")
+
+	testEval(input)
+	result := RunScheduler(make(chan struct{}))
+
+	exit, ok := result.(*object.Exit)
+	if !ok || exit.Code != 3 {
+		t.Fatalf("expected exit(3), got %s", result.Inspect())
+	}
+	if got := now.Format("15:04"); got != "10:15" {
+		t.Errorf("wrong stop time. expected=10:15, got=%s", got)
+	}
+	if !strings.Contains(errOut.String(), "ERROR: type mismatch: INTEGER + BOOLEAN") {
+		t.Errorf("expected job error on stderr, got %q", errOut.String())
+	}
+}
+
+func TestRunForeverAndShutdown(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		now = now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- now
+		return ch
+	}
+	defer func() {
+		timeNow = time.Now
+		timeAfter = time.After
+		jobs = map[int64]*job{}
+		exitHandlers = nil
+	}()
+
+	// 记录调用顺序
+	calls := []string{}
+	builtins["record"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		calls = append(calls, args[0].Inspect())
+		return NULL
+	}}
+	defer delete(builtins, "record")
+
+	input := `
+on_exit(fn() { record("exit 1") });
+on_exit(fn() { record("exit 2") });
+schedule("*/5 * * * *", fn() { record("tick") });
+schedule("20 * * * *", fn() { shutdown() });
+run_forever();
+record("done");
+`
+	evaluated := testEval(input)
+	if evaluated != NULL {
+		t.Fatalf("expected null, got %s", evaluated.Inspect())
+	}
+
+	expected := "tick,tick,tick,exit 2,exit 1,done"
+	if got := strings.Join(calls, ","); got != expected {
+		t.Errorf("wrong calls. expected=%q, got=%q", expected, got)
+	}
+	if HasScheduledJobs() {
+		t.Errorf("expected jobs to be cancelled by shutdown()")
+	}
+
+	// 没有任务时等待中断
+	stop := make(chan struct{})
+	close(stop)
+	Interrupt = stop
+	defer func() { Interrupt = nil }()
+
+	calls = nil
+	testEval(`on_exit(fn() { record("bye") }); run_forever(); record("after")`)
+	if got := strings.Join(calls, ","); got != "bye,after" {
+		t.Errorf("wrong calls after interrupt. got=%q", got)
+	}
+
+	evaluated = testEval(`on_exit(1)`)
+	if evaluated.Inspect() != "ERROR: argument to `on_exit` must be FUNCTION, got INTEGER" {
+		t.Errorf("wrong error. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestCustomOperators(t *testing.T) {
+	if err := parser.RegisterOperator("**", parser.PREFIX, parser.ASSOC_RIGHT); err != nil {
+		t.Fatalf("RegisterOperator error: %s", err)
+	}
+	options := DefaultOptions()
+	options.RegisterOperator("**", func(left, right object.Object) object.Object {
+		l, lok := left.(*object.Integer)
+		r, rok := right.(*object.Integer)
+		if !lok || !rok {
+			return newError("unsupported operand types for **: %s and %s", left.Type(), right.Type())
+		}
+		result := int64(1)
+		for i := int64(0); i < r.Value; i++ {
+			result *= l.Value
+		}
+		return &object.Integer{Value: result}
+	})
+	// 替换内置运算符, 条件中的比较也使用注册的求值函数
+	inverted := options
+	inverted.RegisterOperator("<", func(left, right object.Object) object.Object {
+		return nativeBoolToBooleanObject(left.(*object.Integer).Value > right.(*object.Integer).Value)
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ** 3 ** 2", "512"},
+		{"2 * 3 ** 2", "18"},
+		{"1 - 2 - 3", "-4"},
+		{"10 - 2 + 3", "11"},
+		{`"a" ** 2`, "ERROR: unsupported operand types for **: STRING and INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(options), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 注册只对使用这些选项的解释器有效
+	if result := testEval("2 ** 3"); result.Inspect() != "ERROR: unknown operator: INTEGER ** INTEGER" {
+		t.Errorf("operator should not be registered for default options. got=%s", result.Inspect())
+	}
+	if result := testEvalWith(New(inverted), "if (2 < 1) { 2 ** 2 } else { 0 }"); result.Inspect() != "4" {
+		t.Errorf("condition should use the registered operator. got=%s", result.Inspect())
+	}
+	if result := testEvalWith(New(options), "2 < 1"); result.Inspect() != "false" {
+		t.Errorf("registering on a copy should not change the original options. got=%s", result.Inspect())
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw "boom"; 1 } catch (e) { e.message }`, "boom"},
+		{`try { throw 42; } catch (e) { e.value + 1 }`, "43"},
+		{`try { throw [1, 2]; } catch (e) { e.message }`, "[1, 2]"},
+		{`try { throw "x"; } catch (e) { e.kind }`, "UserError"},
+		{`try { 1 + true } catch (e) { e.kind + ": " + e.message }`, "TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{`try { 1 / 0 } catch (e: ArithmeticError) { e.message }`, "division by zero: 1 / 0"},
+		{`try { 1 + true } catch (e) { e.value }`, "null"},
+		{"try {\n  throw \"x\";\n} catch (e) { [e.line, e.column] }", "[2, 3]"},
+		{`try { foo } catch (e: TypeError) { "type" } catch (e: NameError) { "name" }`, "name"},
+		{`try { foo } catch (e: TypeError) { "type" } catch (e) { "any" }`, "any"},
+		{`try { foo } catch (e: TypeError) { "type" }`, "ERROR: identifier not found: foo"},
+		{`try { throw {"kind": "IOError", "message": "disk"}; } catch (e: IOError) { e.message }`, "disk"},
+		{`try { try { throw "inner"; } catch (e) { throw e; } } catch (e) { e.message }`, "inner"},
+		{`throw "uncaught";`, "ERROR: uncaught"},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, "1"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, "2"},
+		{`try { throw "a"; } catch (e) { throw "b"; } finally { 3 }`, "ERROR: b"},
+		{`try { throw "a"; } finally { 3 }`, "ERROR: a"},
+		{`try { 1 } finally { throw "f"; }`, "ERROR: f"},
+		{`try { exit(3) } catch (e) { 1 }`, "exit(3)"},
+		{`let e = 1; try { throw "x"; } catch (e) { 2 }; e`, "1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTryDoesNotCatchFatal(t *testing.T) {
+	builtins["fatal"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return newFatalError(object.InternalError, "broken")
+	}}
+	defer delete(builtins, "fatal")
+
+	evaluated := testEval(`try { fatal() } catch (e) { 1 } finally { 2 }`)
+	if evaluated.Inspect() != "FATAL: broken" {
+		t.Errorf("fatal error should not be caught. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestPipeExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3] |> len`, "3"},
+		{`let double = fn(x) { x * 2 }; 3 |> double |> double`, "12"},
+		{`let add = fn(a, b) { a + b }; 1 |> add(2)`, "3"},
+		{`"mk" |> upper`, "MK"},
+		{`[1, 2] |> push(3) |> rest`, "[2, 3]"},
+		{`1 |> 2`, "ERROR: not a function INTEGER"},
+		// 右边是调用时 x 作为第一个参数, 否则调用右边的结果
+		{`let add = fn(a) { fn(b) { a + b } }; 1 |> (2 |> add)`, "3"},
+		{`let c = {"n": 1, "add": fn(x) { self.n + x }}; 2 |> c.add`, "3"},
+		{`let f = fn(...xs) { xs }; [2, 3] |> f(1, ...[4])`, "[[2, 3], 1, 4]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mk-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"math.mk":      `loaded(); let add = fn(a, b) { a + b }; let _secret = 1; let pi = 3;`,
+		"lib/twice.mk": `let m = import("../math.mk"); let twice = fn(x) { m.add(x, x) };`,
+		"a.mk":         `let b = import("b.mk");`,
+		"b.mk":         `let a = import("a.mk");`,
+		"broken.mk":    `let = 1;`,
+		"fails.mk":     `let x = 1 + true;`,
+		"slow.mk":      `let x = 1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9 + 10;`,
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := DefaultOptions()
+	options.ModuleDir = dir
+
+	var loads int32
+	builtins["loaded"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		atomic.AddInt32(&loads, 1)
+		return NULL
+	}}
+	defer delete(builtins, "loaded")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = import("math.mk"); m.add(1, 2)`, "3"},
+		{`import("math.mk").pi`, "3"},
+		{`import("math.mk")._secret`, "null"},
+		{`import("lib/twice.mk").twice(4)`, "8"},
+		{`import("missing.mk")`, "ERROR: import \"missing.mk\": open " + filepath.Join(dir, "missing.mk") + ": no such file or directory"},
+		{`import("broken.mk")`, "ERROR: import \"broken.mk\": line 1, column 5: expected next token to be IDENT, got = instead"},
+		{`import("fails.mk")`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`import(1)`, "ERROR: argument to `import` must be STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(options), tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEvalWith(New(options), `import("a.mk")`)
+	cycle, ok := evaluated.(*object.Error)
+	if !ok || cycle.Kind != object.ImportError || !strings.HasPrefix(cycle.Message, "import cycle: ") {
+		t.Errorf("expected import cycle error. got=%s", evaluated.Inspect())
+	}
+
+	// 同一个解释器中模块只执行一次, 不同的解释器各自加载
+	atomic.StoreInt32(&loads, 0)
+	in := New(options)
+	evaluated = testEvalWith(in, `let a = import("math.mk"); let b = import("math.mk"); a == b`)
+	testEvalWith(in, `import("math.mk")`)
+	if evaluated != TRUE || atomic.LoadInt32(&loads) != 1 {
+		t.Errorf("module should be evaluated once per interpreter. got %s, %d loads", evaluated.Inspect(), loads)
+	}
+	testEvalWith(New(options), `import("math.mk")`)
+	if atomic.LoadInt32(&loads) != 2 {
+		t.Errorf("module should be evaluated again in another interpreter. got %d loads", loads)
+	}
+	if len(in.importStack) != 0 {
+		t.Errorf("import stack not empty after import. got=%v", in.importStack)
+	}
+
+	// 同时在不同的解释器中导入, 不会误报循环导入
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := testEvalWith(New(options), `import("lib/twice.mk").twice(import("math.mk").pi)`).Inspect(); got != "6" {
+				t.Errorf("wrong result of concurrent import. got=%s", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 模块在调用 import 的解释器中执行, 计入同一个步数限制
+	evaluated = testEvalWith(New(Options{MaxSteps: 10, ModuleDir: dir}), `import("slow.mk")`)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "step limit exceeded: 10" {
+		t.Errorf("expected step limit in module. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestStringLiteralInterning(t *testing.T) {
+	p := parser.New(lexer.New(`"a"; "b"`))
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	// 缓存在语法树节点上, 同一个字面量每次求值都得到同一个对象
+	a1 := Eval(program.Statements[0], env)
+	a2 := Eval(program.Statements[0], env)
+	b := Eval(program.Statements[1], env)
+	if a1 != a2 {
+		t.Errorf("evaluating a string literal again should return the same object")
+	}
+	if a1 == b {
+		t.Errorf("different string literals should not share one object")
+	}
+
+	// 拼接得到的字符串不受影响
+	evaluated := testEval(`let s = "a"; let t = s + "b"; [s, t, "a" + "b"]`)
+	if evaluated.Inspect() != `[a, ab, ab]` {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
+
+// 模板风格的脚本: 大量重复求值相同的字符串字面量
+func BenchmarkStringLiterals(b *testing.B) {
+	input := `
+let render = fn(n, acc) {
+    if (n == 0) {
+        acc
+    } else {
+        render(n - 1, acc + "<li class=" + "item" + ">" + "</li>")
+    }
+};
+render(200, "")
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+func TestEnvEscapes(t *testing.T) {
+	tests := []struct {
+		input   string
+		escapes bool
+	}{
+		{`fn(a, b) { let c = a + b; if (c > 1) { [c, {"k": c}] } else { c } }`, false},
+		{`fn(n) { match (n) { 1 => "one", _ => try { n } catch (e) { 0 } } }`, false},
+		{`fn(a) { fn() { a } }`, true},
+		{`fn(a) { let f = fn(x) { x }; f(a) }`, true},
+		{`fn(a, f = fn(x) { x }) { f(a) }`, true},
+		{`fn(a) { [1, 2] |> push(fn() { a }) }`, true},
+		{`fn(a) { breakpoint(); a }`, true},
+		{`fn(a) { [len(a), a |> str, upper("x")] }`, false},
+		// 可能是需要环境的内置函数的调用
+		{`let v = vars; fn(a) { v() }`, true},
+		{`fn(a) { let v = vars; v() }`, true},
+		{`fn(a, g) { g(a) }`, true},
+		{`fn(a, g) { a |> g }`, true},
+		{`fn(o) { o.get() }`, true},
+		{`fn(a) { [len][0](a) }`, true},
+	}
+	for _, tt := range tests {
+		fn, ok := testEval(tt.input).(*object.Function)
+		if !ok {
+			t.Fatalf("%q is not a function", tt.input)
+		}
+		if fn.Pooled == tt.escapes {
+			t.Errorf("wrong escape result for %q. expected=%t", tt.input, tt.escapes)
+		}
+	}
+
+	// 分析结果保存在函数字面量上, 不在全局的表中
+	program := parser.New(lexer.New(`fn(a) { a }`)).ParseProgram()
+	literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	Eval(program, object.NewEnvironment())
+	if literal.EnvEscapes != ESCAPE_NO {
+		t.Errorf("escape result should be stored on the literal. got=%d", literal.EnvEscapes)
+	}
+}
+
+func TestPooledEnvironments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 递归调用时每一层的环境互不影响
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`, "610"},
+		{`let f = fn(a, b = a * 2) { [a, b] }; [f(1), f(2, 3), f(4)]`, "[[1, 2], [2, 3], [4, 8]]"},
+		// 返回的闭包引用的环境不能被复用
+		{`let adder = fn(n) { fn(x) { x + n } }; let a = adder(1); let b = adder(10); [a(1), b(1)]`, "[2, 11]"},
+		// 不逃逸的函数中的局部变量不会出现在下一次调用中
+		{`let f = fn(first) { if (first) { let v = 1; } v }; f(true); f(false)`, "ERROR: identifier not found: v"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 调用密集的脚本
+func BenchmarkFunctionCalls(b *testing.B) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(18)
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+// 条件的快速路径和普通求值的结果相同
+func TestConditionFastPath(t *testing.T) {
+	conditions := []string{
+		"true", "false", "!true", "!!1", "!null",
+		"1 < 2", "2 < 1", "1 > 2", "1 == 1", "1 != 1",
+		"-1 < 0", "(1 + 2) == 3", "len([1, 2]) > 1",
+		`"a" == "a"`, `"a" != "b"`, "true == true", "true != false",
+		"!(1 > 2)", "[1][0] == 1", "null",
+		"1 < true", `"a" < "b"`, "foo == 1", "1 == foo",
+	}
+
+	for _, cond := range conditions {
+		expected := testEval(cond)
+		if !isError(expected) {
+			expected = nativeBoolToBooleanObject(isTruthy(expected))
+		}
+
+		for _, input := range []string{
+			"if (" + cond + ") { true } else { false }",
+			"(" + cond + ") ? true : false",
+		} {
+			evaluated := testEval(input)
+			if evaluated.Inspect() != expected.Inspect() {
+				t.Errorf("wrong result for %q. expected=%q, got=%q",
+					input, expected.Inspect(), evaluated.Inspect())
+			}
+		}
+	}
+}
+
+// 条件判断密集的脚本
+func BenchmarkIfCondition(b *testing.B) {
+	input := `
+let count = fn(n, acc) {
+    if (n == 0) {
+        acc
+    } else {
+        count(n - 1, n > 100 ? acc + 1 : acc)
+    }
+};
+count(500, 0)
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+func TestTolerantMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   []string
+	}{
+		{`let a = 1 + true; let b = 2; [a, b]`, "[null, 2]",
+			[]string{"1:9 type mismatch: INTEGER + BOOLEAN"}},
+		{`let h = {"a": 1}; [foo, h.b, 5.x, -"s"]`, "[null, null, null, null]",
+			[]string{"1:20 identifier not found: foo", "1:30 dot access not supported: INTEGER", "1:35 unknown operator: -STRING"}},
+		{`let f = fn(x) { x }; f()`, "null",
+			[]string{"1:22 wrong number of arguments. got=0, want=1"}},
+		{`if (1 < "a") { 1 } else { 2 }`, "2",
+			[]string{"1:5 type mismatch: INTEGER < STRING"}},
+		// 依赖出错的值的表达式接着出错
+		{`let x = y; x + 1`, "null",
+			[]string{"1:9 identifier not found: y", "1:12 type mismatch: NULL + INTEGER"}},
+		// try 部分中的错误仍然交给 catch
+		{`try { 1 + true } catch (e) { e.kind }`, "TypeError", []string{}},
+		{`throw "boom"; 1`, "ERROR: boom", []string{}},
+	}
+
+	for _, tt := range tests {
+		options := DefaultOptions()
+		options.Tolerant = true
+		in := New(options)
+		evaluated := testEvalWith(in, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+
+		errs := []string{}
+		for _, err := range in.TakeToleratedErrors() {
+			errs = append(errs, fmt.Sprintf("%d:%d %s", err.Pos.Line, err.Pos.Column, err.Message))
+		}
+		if strings.Join(errs, "\n") != strings.Join(tt.errors, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.errors, errs)
+		}
+	}
+}
+
+// map 字面量中重复的 key 后面的值覆盖前面的
+func TestDuplicateHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1, "a": 2}["a"]`, "2"},
+		{`let h = {1: "x", 2: "y", 1: "z"}; [h[1], len(h)]`, "[z, 2]"},
+		{`let k = "a"; {k: 1, "a": 2, k: 3}["a"]`, "3"},
+	}
+	for _, tt := range tests {
+		// 多次执行, 结果不能依赖 map 的遍历顺序
+		for i := 0; i < 20; i++ {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Fatalf("wrong result for %q. expected=%q, got=%q",
+					tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+// 缓存的 HashKey 和 hash/fnv 的结果相同
+func TestStringHashKey(t *testing.T) {
+	for _, value := range []string{"", "a", "name", "键", strings.Repeat("x", 100)} {
+		h := fnv.New64a()
+		h.Write([]byte(value))
+		expected := object.HashKey{Type: object.STRING_OBJ, Value: h.Sum64(), Text: value}
+
+		s := &object.String{Value: value}
+		if s.HashKey() != expected || s.HashKey() != expected {
+			t.Errorf("wrong hash key for %q. expected=%v, got=%v", value, expected, s.HashKey())
+		}
+	}
+}
+
+// 共享的字符串在不同的 goroutine 中第一次计算 HashKey, 结果都相同(go test -race 检查读写)
+func TestStringHashKeyConcurrent(t *testing.T) {
+	for _, value := range []string{"a", "name", "键"} {
+		s := &object.String{Value: value}
+		keys := make([]object.HashKey, 8)
+		var wg sync.WaitGroup
+		for i := range keys {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				keys[i] = s.HashKey()
+			}(i)
+		}
+		wg.Wait()
+		for _, key := range keys {
+			if key != keys[0] || key != s.HashKey() {
+				t.Errorf("inconsistent hash keys for %q: %v", value, keys)
+				break
+			}
+		}
+	}
+}
+
+// 64 位 hash 相同的不同 key 不会互相覆盖
+func TestHashKeyCollision(t *testing.T) {
+	keys := []object.Object{
+		&object.String{Value: "a"},
+		&object.String{Value: "b"},
+		&object.Bytes{Value: []byte("a")},
+		&object.Bytes{Value: []byte("b")},
+		&object.Decimal{Value: big.NewInt(10), Scale: 1},
+		&object.Decimal{Value: big.NewInt(2), Scale: 0},
+	}
+
+	for i := 0; i < len(keys); i += 2 {
+		a := keys[i].(object.Hashable).HashKey()
+		b := keys[i+1].(object.Hashable).HashKey()
+		// 模拟 hash 冲突
+		b.Value = a.Value
+
+		hash := object.NewHash(2)
+		hash.Set(a, object.HashPair{Key: keys[i], Value: &object.Integer{Value: 1}})
+		hash.Set(b, object.HashPair{Key: keys[i+1], Value: &object.Integer{Value: 2}})
+		if hash.Len() != 2 {
+			t.Fatalf("colliding %s keys should not overwrite each other. got=%s", keys[i].Type(), hash.Inspect())
+		}
+		if pair, ok := hash.Get(a); !ok || pair.Key != keys[i] {
+			t.Errorf("wrong pair for %s. got=%v", keys[i].Inspect(), pair)
+		}
+		if pair, ok := hash.Get(b); !ok || pair.Key != keys[i+1] {
+			t.Errorf("wrong pair for %s. got=%v", keys[i+1].Inspect(), pair)
+		}
+	}
+
+	// 相等的值仍然是同一个 key
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{decimal("1.0"): 1, decimal("1.00"): 2}`, "{1.00: 2}"},
+		{`{bytes("hi"): 1, bytes("6869", "hex"): 2}`, `{b"hi": 2}`},
+		{`let k = "a" + "b"; {"ab": 1, k: 2}`, "{ab: 2}"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// map 查找密集的脚本: 字符串 key 的下标和 . 访问
+func BenchmarkHashStringKeys(b *testing.B) {
+	input := `
+let config = {"name": "mk", "version": 1, "debug": false, "retries": 3, "timeout": 30};
+let sum = fn(n, acc) {
+    if (n == 0) {
+        acc
+    } else {
+        sum(n - 1, acc + config["version"] + config.retries + config["timeout"] + len(config.name))
+    }
+};
+sum(300, 0)
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
 	}
 }
@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"mk/object"
+)
+
+// 事件循环和退出流程
+//
+//	run_forever()  运行事件循环直到调用 shutdown() 或者收到中断信号,
+//	               没有定时任务时也不会返回
+//	shutdown()     取消所有定时任务, 按注册的相反顺序执行 on_exit 注册的函数,
+//	               并让 run_forever() 返回
+//	on_exit(fn)    注册退出时执行的函数
+//
+// 脚本正常结束时宿主也应该调用 Shutdown(), 保证 on_exit 注册的函数被执行
+func init() {
+	builtins["run_forever"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			result := runEventLoop(stateInterpreter(state), Interrupt, true)
+			if isAbrupt(result) {
+				return result
+			}
+			return Shutdown()
+		},
+	}
+	builtins["shutdown"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			return Shutdown()
+		},
+	}
+	builtins["on_exit"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if !isCallable(args[0]) {
+				return newError("argument to `on_exit` must be FUNCTION, got %s",
+					args[0].Type())
+			}
+			exitHandlers = append(exitHandlers, args[0])
+			return NULL
+		},
+	}
+}
+
+// 中断信号, 由宿主设置, 关闭时 run_forever() 返回
+// 为nil时只能通过 shutdown() 结束
+var Interrupt <-chan struct{}
+
+var (
+	exitHandlers      []object.Object // on_exit 注册的函数
+	shutdownRequested bool            // 调用过 shutdown(), 事件循环应当结束
+)
+
+// 事件循环: 等待并执行到期的任务, 直到没有任务或者 stop 被关闭
+// 任务返回的普通错误输出到 Stderr 后继续运行;
+// 致命错误和 exit() 会结束循环并作为结果返回
+func RunScheduler(stop <-chan struct{}) object.Object {
+	in := New(DefaultOptions())
+	return safely(in, func() object.Object { return runEventLoop(in, stop, false) })
+}
+
+// forever 为 true 时没有任务也不返回, 直到 shutdown() 或者 stop 被关闭
+// 在解释器 in 的 EvalContext 中时, 被取消也会返回; 任务在注册它的函数所属的解释器中执行
+func runEventLoop(in *Interpreter, stop <-chan struct{}, forever bool) object.Object {
+	shutdownRequested = false
+	for !shutdownRequested && (len(jobs) > 0 || forever) {
+		// 没有任务, 只能等待中断
+		if len(jobs) == 0 {
+			select {
+			case <-stop:
+				return NULL
+			case <-in.cancelled:
+				return in.checkCancelled()
+			}
+		}
+
+		due := dueJobs()
+		wake := due[0].next
+
+		select {
+		case <-stop:
+			return NULL
+		case <-in.cancelled:
+			return in.checkCancelled()
+		case <-timeAfter(wake.Sub(timeNow())):
+		}
+
+		now := timeNow()
+		if now.Before(wake) {
+			now = wake
+		}
+
+		for _, j := range due {
+			if j.next.After(now) {
+				continue
+			}
+			// 可能已经被前面的任务取消
+			if _, ok := jobs[j.id]; !ok {
+				continue
+			}
+
+			j.next = j.spec.Next(now)
+			result := applyFunction(ownerOf(j.fn), j.fn, []object.Object{})
+
+			switch result := result.(type) {
+			case *object.Exit:
+				return result
+			case *object.Error:
+				if !result.Recoverable() {
+					return result
+				}
+				fmt.Fprintf(Stderr, "scheduled job %d: %s\n", j.id, result.Inspect())
+			}
+		}
+	}
+	return NULL
+}
+
+// 结束事件循环: 取消所有定时任务, 按注册的相反顺序执行 on_exit 注册的函数
+// 每个函数只执行一次; 所有函数都会执行, 返回第一个错误或者 exit()
+// 最后结束所有没有关闭的 coproc 子进程
+func Shutdown() object.Object {
+	shutdownRequested = true
+	jobs = map[int64]*job{}
+
+	var first object.Object = NULL
+	for len(exitHandlers) > 0 {
+		fn := exitHandlers[len(exitHandlers)-1]
+		exitHandlers = exitHandlers[:len(exitHandlers)-1]
+
+		in := ownerOf(fn)
+		result := safely(in, func() object.Object { return applyFunction(in, fn, []object.Object{}) })
+		if isAbrupt(result) && first == NULL {
+			first = result
+		}
+	}
+
+	killCoprocs()
+	return first
+}
@@ -0,0 +1,50 @@
+package evaluator
+
+import (
+	"os"
+
+	"mk/object"
+)
+
+// expand_env(s [, vars]) 展开字符串中的 $NAME 和 ${NAME}, 规则和 os.ExpandEnv 相同
+// 传入 vars 时从该map中取值(不再读取环境变量), 未定义的变量展开为空字符串
+//
+//	expand_env("Hello $USER at ${HOME}")
+//	expand_env("${name}:${port}", {"name": "db", "port": 5432})
+func init() {
+	builtins["expand_env"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			s, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `expand_env` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			if len(args) == 1 {
+				return &object.String{Value: os.ExpandEnv(s.Value)}
+			}
+
+			vars, ok := args[1].(*object.Hash)
+			if !ok {
+				return newError("argument to `expand_env` must be HASH, got %s",
+					args[1].Type())
+			}
+
+			return &object.String{Value: os.Expand(s.Value, func(name string) string {
+				value := hashGet(vars, name)
+				if value == nil {
+					return ""
+				}
+				if str, ok := value.(*object.String); ok {
+					return str.Value
+				}
+				return value.Inspect()
+			})}
+		},
+	}
+}
@@ -0,0 +1,25 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 宿主提供的对象(object.External)的方法
+// x.name 返回绑定了 x 的内置函数, x.name(args) 即调用该方法
+// 方法返回 nil 时为 null
+func externalMethod(ext *object.External, name string) object.Object {
+	method, ok := ext.Methods[name]
+	if !ok {
+		return newKindError(object.NameError, "unknown method %s for %s", name, ext.Name)
+	}
+
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			result := method(ext, args...)
+			if result == nil {
+				return NULL
+			}
+			return result
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 浮点数
+// 构造: float(1), float("1.5"), float("1e-3"), float("inf"), float("nan"), float(12.50d)
+// 浮点数和整数运算时整数先转换成浮点数, 结果为浮点数; 和小数(DECIMAL)混合运算是类型错误,
+// 需要先用 float(d) 或者 decimal(f) 显式转换, 避免不知不觉地丢失精度
+// 运算按 IEEE 754: 除以0得到 Inf, -Inf 或 NaN 而不是错误, NaN 和任何值(包括自己)都不相等
+//
+//	int(x)             转换为整数: 浮点数和小数向0截断, 也可以是大整数, 字符串按十进制解析;
+//	                   NaN, Inf 和超出范围的值报 ArithmeticError
+//	is_nan(x)          是否为 NaN
+//	is_inf(x [, sign]) 是否为无穷大, sign > 0 时只判断 Inf, sign < 0 时只判断 -Inf
+//	round(f, places)   舍入到 places 位小数(按十进制的写法舍入, 2.675 得到 2.68), 舍入方式同小数
+//
+// 例如:
+//
+//	float(3) / 2                 // 1.5
+//	float("0.1") + float("0.2")  // 0.30000000000000004
+//	round(float("2.675"), 2)     // 2.68
+//	1 / float(0)                 // Inf
+//	int(float("-2.7"))           // -2
+func init() {
+	builtins["float"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Float:
+				return arg
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+			case *object.BigInt:
+				f, _ := new(big.Float).SetInt(arg.Value).Float64()
+				return &object.Float{Value: f}
+			case *object.Decimal:
+				f, _ := strconv.ParseFloat(arg.Inspect(), 64)
+				return &object.Float{Value: f}
+			case *object.String:
+				f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil && !isRangeError(err) {
+					return newError("invalid float: %q", arg.Value)
+				}
+				// 超出范围时 ParseFloat 返回 ±Inf 或者 0, 例如 "1e400" 为 Inf
+				return &object.Float{Value: f}
+			default:
+				return newError("argument to `float` must be STRING, INTEGER, BIGINT, FLOAT or DECIMAL, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["int"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Float:
+				return floatToInteger(arg.Value)
+			case *object.Decimal:
+				value := roundDecimal(arg, 0, ROUND_DOWN).Value
+				if !value.IsInt64() {
+					return newKindError(object.ArithmeticError, "integer overflow: %s", arg.Inspect())
+				}
+				return &object.Integer{Value: value.Int64()}
+			case *object.BigInt:
+				if !arg.Value.IsInt64() {
+					return newKindError(object.ArithmeticError, "integer overflow: %s", arg.Inspect())
+				}
+				return &object.Integer{Value: arg.Value.Int64()}
+			case *object.String:
+				n, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if isRangeError(err) {
+					return newKindError(object.ArithmeticError, "integer overflow: %q", arg.Value)
+				}
+				if err != nil {
+					return newError("invalid integer: %q", arg.Value)
+				}
+				return &object.Integer{Value: n}
+			default:
+				return newError("argument to `int` must be STRING, INTEGER, BIGINT, FLOAT or DECIMAL, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["is_nan"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			f, ok := args[0].(*object.Float)
+			return nativeBoolToBooleanObject(ok && math.IsNaN(f.Value))
+		},
+	}
+
+	builtins["is_inf"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			sign := 0
+			if len(args) == 2 {
+				n, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("second argument to `is_inf` must be INTEGER, got %s",
+						args[1].Type())
+				}
+				switch {
+				case n.Value > 0:
+					sign = 1
+				case n.Value < 0:
+					sign = -1
+				}
+			}
+
+			f, ok := args[0].(*object.Float)
+			return nativeBoolToBooleanObject(ok && math.IsInf(f.Value, sign))
+		},
+	}
+}
+
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// 向0截断, 不能表示为整数的值报错
+func floatToInteger(f float64) object.Object {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return newKindError(object.ArithmeticError, "cannot convert %s to INTEGER",
+			(&object.Float{Value: f}).Inspect())
+	}
+	t := math.Trunc(f)
+	// 2^63 本身已经超出 int64 的范围
+	if t < math.MinInt64 || t >= math.MaxInt64 {
+		return newKindError(object.ArithmeticError, "integer overflow: %s",
+			(&object.Float{Value: f}).Inspect())
+	}
+	return &object.Integer{Value: int64(t)}
+}
+
+// 按十进制的写法舍入, 例如 2.675 的最短写法为 "2.675", 舍入为 2.68
+func roundFloat(f *object.Float, places int, mode string) object.Object {
+	if math.IsNaN(f.Value) || math.IsInf(f.Value, 0) {
+		return f
+	}
+	d, _ := object.ParseDecimal(strconv.FormatFloat(f.Value, 'f', -1, 64))
+	rounded, _ := strconv.ParseFloat(roundDecimal(d, places, mode).Inspect(), 64)
+	return &object.Float{Value: rounded}
+}
+
+// 浮点数和浮点数, 或者浮点数和整数的中缀表达式
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, rightVal := toFloat(left), toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// 可以参与浮点数运算的值
+func isFloatOperand(obj object.Object) bool {
+	return obj.Type() == object.FLOAT_OBJ || obj.Type() == object.INTEGER_OBJ
+}
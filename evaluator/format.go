@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 整数的进制转换和格式化输出
+//
+//	to_hex(n) / to_bin(n) / to_oct(n)  转为16/2/8进制字符串, 不带前缀, n 为整数或者大整数
+//	format(f, args...)                 按格式串格式化, 返回字符串
+//	printf(f, args...)                 按格式串格式化并输出到标准输出
+//
+// 格式串支持的动词:
+//
+//	%d 十进制  %x %X 十六进制  %o 八进制  %b 二进制
+//	%f 小数形式  %e 指数形式  %g 较短的一种(参数为浮点数或者整数)
+//	%s 字符串(不带引号)  %v 值的默认表示  %% 百分号
+//
+// 动词前可以带 Go 的 flag, 宽度和精度, 例如 "%08b", "%#x", "%-5d", "%.2f", "%10.3e"
+func init() {
+	builtins["to_hex"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return formatInteger("to_hex", 16, args)
+	}}
+	builtins["to_bin"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return formatInteger("to_bin", 2, args)
+	}}
+	builtins["to_oct"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return formatInteger("to_oct", 8, args)
+	}}
+	builtins["format"] = &object.Builtin{Fn: builtinFormat}
+	builtins["printf"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		result := builtinFormat(args...)
+		if isAbrupt(result) {
+			return result
+		}
+		fmt.Fprint(Stdout, result.(*object.String).Value)
+		return NULL
+	}}
+}
+
+func formatInteger(name string, base int, args []object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch n := args[0].(type) {
+	case *object.Integer:
+		return &object.String{Value: strconv.FormatInt(n.Value, base)}
+	case *object.BigInt:
+		return &object.String{Value: n.Value.Text(base)}
+	default:
+		return newError("argument to `%s` must be INTEGER or BIGINT, got %s",
+			name, args[0].Type())
+	}
+}
+
+func builtinFormat(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want=1 or more",
+			len(args))
+	}
+
+	f, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `format` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	var out strings.Builder
+	values := args[1:]
+	next := 0
+
+	for i := 0; i < len(f.Value); i++ {
+		ch := f.Value[i]
+		if ch != '%' {
+			out.WriteByte(ch)
+			continue
+		}
+
+		// flag, 宽度和精度: %[-+# 0]*[0-9]*(.[0-9]*)?
+		j := i + 1
+		for j < len(f.Value) && strings.IndexByte("-+# 0123456789.", f.Value[j]) >= 0 {
+			j++
+		}
+		if j >= len(f.Value) {
+			return newError("format: missing verb at end of %q", f.Value)
+		}
+
+		verb := f.Value[j]
+		spec := f.Value[i:j]
+		i = j
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if next >= len(values) {
+			return newError("format: missing argument for %%%c", verb)
+		}
+		value := values[next]
+		next++
+
+		switch verb {
+		case 'd', 'x', 'X', 'o', 'b':
+			switch n := value.(type) {
+			case *object.Integer:
+				out.WriteString(fmt.Sprintf(spec+string(verb), n.Value))
+			case *object.BigInt:
+				out.WriteString(fmt.Sprintf(spec+string(verb), n.Value))
+			default:
+				return newError("format: %%%c wants INTEGER or BIGINT, got %s", verb, value.Type())
+			}
+		case 'f', 'e', 'g':
+			if !isFloatOperand(value) {
+				return newError("format: %%%c wants FLOAT or INTEGER, got %s", verb, value.Type())
+			}
+			out.WriteString(fmt.Sprintf(spec+string(verb), toFloat(value)))
+		case 's', 'v':
+			s := value.Inspect()
+			if str, ok := value.(*object.String); ok && verb == 'v' {
+				s = strconv.Quote(str.Value)
+			}
+			out.WriteString(fmt.Sprintf(spec+"s", s))
+		default:
+			return newError("format: unknown verb %%%c", verb)
+		}
+	}
+
+	if next < len(values) {
+		return newError("format: too many arguments. got=%d, want=%d",
+			len(values), next)
+	}
+	return &object.String{Value: out.String()}
+}
@@ -0,0 +1,329 @@
+package evaluator
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 生成器
+// 函数体中(不包括其中的函数字面量)有 yield 语句的函数是生成器函数, 调用时不执行函数体,
+// 而是返回一个生成器; 每次取值时从上次停下的地方继续执行到下一个 yield, 函数执行完(或者 return)时结束
+//
+// yield* 依次交出另一个生成器(或者数组, 区间等可迭代对象)的所有值, 递归的生成器可以表示无限序列;
+// 每一层 yield* 都是一个生成器, 取第 n 个值要经过 n 层, 不适合很长的序列
+//
+//	next(g [, default])  下一个值, 已经结束时返回 default(默认为 null)
+//	take(g, n)           最多取 n 个值组成数组, g 也可以是数组, 区间等其他可迭代对象(见 object.Iterable)
+//
+// 例如:
+//
+//	let naturals = fn(n) { yield n; yield* naturals(n + 1) };
+//	take(naturals(1), 3)   // [1, 2, 3]
+//	let count = fn(n) { yield n; yield n + 1; yield n + 2 };
+//	let g = count(10);
+//	next(g)        // 10
+//	take(g, 5)     // [11, 12]
+//	next(g, -1)    // -1
+//
+// 函数体在单独的 goroutine 中执行, 但是同一时刻只有取值的一方或者生成器一方在执行:
+// 取值时把控制交给生成器, 执行到 yield 时再交回来
+//
+// 开始执行但还没有结束的生成器记录在解释器上(宿主回调中创建的记录在函数所属的解释器上),
+// 宿主用完解释器之后调用 Interpreter.Close 结束它们的 goroutine; 之后再取值时生成器已经结束.
+// 生成器通常被外层环境中的变量引用, 而等待中的 goroutine 又引用着这个环境, 所以不能依靠垃圾回收结束它们;
+// 没有被任何变量引用的生成器被回收时会提前结束, 不用等到 Close
+func init() {
+	builtins["next"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			g, ok := args[0].(*object.Generator)
+			if !ok {
+				return newError("first argument to `next` must be GENERATOR, got %s",
+					args[0].Type())
+			}
+
+			value, ok := g.Next()
+			if !ok {
+				if len(args) == 2 {
+					return args[1]
+				}
+				return NULL
+			}
+			return value
+		},
+	}
+
+	builtins["take"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			it, ok := iterOf(args[0])
+			if !ok {
+				return newError("first argument to `take` must be %s, got %s",
+					ITERABLE_TYPES, args[0].Type())
+			}
+			n, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("second argument to `take` must be INTEGER, got %s",
+					args[1].Type())
+			}
+
+			elements := []object.Object{}
+			if n.Value <= 0 {
+				return &object.Array{Elements: elements}
+			}
+			// 结果在返回之后计入内存限制, 取值的过程中超过限制时提前停止
+			in := stateInterpreter(state)
+			var exceeded *object.Error
+			if err := eachValue(in, it, func(value object.Object) bool {
+				elements = append(elements, value)
+				if exceeded = in.checkMemory(arraySize(int64(len(elements)))); exceeded != nil {
+					return false
+				}
+				return int64(len(elements)) < n.Value
+			}); err != nil {
+				return err
+			}
+			if exceeded != nil {
+				return exceeded
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+}
+
+// ast.FunctionLiteral.Yields 的取值
+const (
+	YIELDS_UNKNOWN = 0
+	YIELDS_NO      = 1
+	YIELDS_YES     = 2
+)
+
+// 函数体中(不包括其中的函数字面量)是否有 yield 语句
+// 结果保存在函数字面量上, 每个字面量只分析一次; 并发求值时最多重复分析几次, 同 functionEscapes
+func functionYields(fl *ast.FunctionLiteral) bool {
+	switch atomic.LoadInt32(&fl.Yields) {
+	case YIELDS_NO:
+		return false
+	case YIELDS_YES:
+		return true
+	}
+
+	yields := false
+	ast.Inspect(fl.Body, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.YieldStatement:
+			yields = true
+		case *ast.FunctionLiteral:
+			// 函数字面量中的 yield 属于那个函数
+			return false
+		}
+		return !yields
+	})
+	result := int32(YIELDS_NO)
+	if yields {
+		result = YIELDS_YES
+	}
+	atomic.StoreInt32(&fl.Yields, result)
+	return yields
+}
+
+type generator struct {
+	fn  *object.Function
+	env *object.Environment
+
+	resume chan struct{}      // 取值的一方让生成器继续执行
+	values chan object.Object // 生成器交出的值, 函数体执行完时关闭
+	stop   chan struct{}      // 生成器被结束时关闭, 结束等待中的 goroutine
+	once   sync.Once          // 只关闭一次 stop
+
+	started  bool
+	running  bool
+	finished bool
+}
+
+func newGenerator(fn *object.Function, env *object.Environment) *object.Generator {
+	g := &generator{
+		fn:     fn,
+		env:    env,
+		resume: make(chan struct{}),
+		values: make(chan object.Object),
+		stop:   make(chan struct{}),
+	}
+	obj := &object.Generator{Name: fn.Name, Next: g.next}
+	// 没有被引用的生成器被回收时提前结束它的 goroutine; goroutine 只引用 g, 不会让 obj 一直可达
+	runtime.SetFinalizer(obj, func(*object.Generator) { g.close() })
+	return obj
+}
+
+// 结束生成器, 等待中的 goroutine 不再执行后面的代码(包括 finally)
+func (g *generator) close() {
+	g.once.Do(func() { close(g.stop) })
+}
+
+// 解释器中开始执行但还没有结束的生成器, fork 出来的解释器和原来的解释器共用, 见 Interpreter.Close
+type generatorSet struct {
+	mu      sync.Mutex
+	live    map[*generator]struct{}
+	closed  bool
+	running sync.WaitGroup // 还没有退出的 goroutine
+}
+
+// 记录开始执行的生成器, 已经 Close 时返回 false
+func (s *generatorSet) add(g *generator) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.live == nil {
+		s.live = map[*generator]struct{}{}
+	}
+	s.live[g] = struct{}{}
+	s.running.Add(1)
+	return true
+}
+
+func (s *generatorSet) remove(g *generator) {
+	s.mu.Lock()
+	delete(s.live, g)
+	s.mu.Unlock()
+	s.running.Done()
+}
+
+// 结束解释器中所有还没有结束的生成器, 之后开始执行的生成器立即结束
+// 包括在这个解释器中的函数作为宿主回调(CallFunction)执行时创建的生成器;
+// 宿主在解释器和回调都执行完之后调用, 返回时生成器的 goroutine 都已经退出
+func (in *Interpreter) Close() {
+	s := in.generators
+	s.mu.Lock()
+	s.closed = true
+	live := s.live
+	s.live = nil
+	s.mu.Unlock()
+
+	for g := range live {
+		g.close()
+	}
+	s.running.Wait()
+}
+
+// 执行到下一个 yield, 函数体中的错误作为值返回
+func (g *generator) next() (object.Object, bool) {
+	if g.finished {
+		return nil, false
+	}
+	if g.running {
+		return newError("generator is already running"), true
+	}
+
+	// 生成器在创建它的解释器中执行, 执行期间改变的状态在交回控制之后恢复
+	in := interpreterOf(g.env)
+	prev, frames, depth, tries := in.generator, len(in.callStack), in.callDepth, in.tryDepth
+	in.generator = g
+	g.running = true
+
+	if !g.started {
+		g.started = true
+		if in.generators.add(g) {
+			go g.run(in.generators)
+		} else {
+			close(g.values)
+		}
+	} else {
+		select {
+		case g.resume <- struct{}{}:
+		case <-g.stop:
+		}
+	}
+	// 被结束的生成器的 goroutine 退出时关闭 values
+	value, ok := <-g.values
+
+	g.running = false
+	in.generator = prev
+	in.callStack, in.callDepth, in.tryDepth = in.callStack[:frames], depth, tries
+
+	if !ok {
+		g.finished = true
+		return nil, false
+	}
+	if isAbrupt(value) {
+		g.finished = true
+	}
+	return value, true
+}
+
+// 生成器的 goroutine, 结束时从 set 中移除
+func (g *generator) run(set *generatorSet) {
+	defer set.remove(g)
+	defer close(g.values)
+
+	result := safely(interpreterOf(g.env), func() object.Object {
+		return evalFunctionBody(g.fn.Body, g.env)
+	})
+	if err, ok := result.(*object.Error); ok {
+		select {
+		case g.values <- err:
+		case <-g.stop:
+		}
+	}
+}
+
+// 执行 yield 语句
+func evalYieldStatement(node *ast.YieldStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	g := interpreterOf(env).generator
+	if g == nil {
+		return newError("yield outside generator function")
+	}
+	if node.Delegate {
+		return yieldAll(g, val)
+	}
+	g.yield(val)
+	return NULL
+}
+
+// yield*: 依次交出可迭代对象(生成器, 数组, 区间等)中的所有值
+func yieldAll(g *generator, val object.Object) object.Object {
+	it, ok := iterOf(val)
+	if !ok {
+		return newError("cannot yield* %s, want %s", val.Type(), ITERABLE_TYPES)
+	}
+	if err := eachValue(interpreterOf(g.env), it, func(value object.Object) bool {
+		g.yield(value)
+		return true
+	}); err != nil {
+		return err
+	}
+	return NULL
+}
+
+// 交出一个值, 等待下一次取值
+func (g *generator) yield(val object.Object) {
+	select {
+	case g.values <- val:
+	case <-g.stop:
+		runtime.Goexit()
+	}
+	select {
+	case <-g.resume:
+	case <-g.stop:
+		// 不再被引用的生成器直接结束, 不执行后面的代码(包括 finally)
+		runtime.Goexit()
+	}
+}
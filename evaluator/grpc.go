@@ -0,0 +1,474 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"mk/object"
+)
+
+// 调用 gRPC 服务的一元(unary)方法, 用于在脚本中调用内部的微服务
+//
+//	grpc_call(target, method, request [, options])
+//
+// target 为 "host:port" 或者 "https://host:port"(TLS), "http://host:port" 为明文的 HTTP/2(h2c)
+// method 为 "pkg.Service/Method", request 为请求消息对应的map, 返回响应消息对应的map(对应规则见 protobuf.go)
+// options:
+//
+//	descriptors  protoc --descriptor_set_out --include_imports 生成的描述文件, 相对路径和 import 一样;
+//	             没有时通过服务的反射接口(grpc.reflection.v1 或 v1alpha)取得, 同一个解释器中每个服务只取一次
+//	metadata     map, 作为请求头发送的元数据, 值为字符串
+//	timeout      时长, 作为 grpc-timeout 发送, 超时之后放弃请求(包括反射的请求)
+//
+// 服务返回的状态不是 OK 时报 IOError, 消息中包括状态名和 grpc-message; 不支持流式方法和压缩
+// 例如:
+//
+//	let user = grpc_call("localhost:50051", "users.UserService/Get", {"id": 42}, {"timeout": 5s});
+//	user.name
+func init() {
+	builtins["grpc_call"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 3 && len(args) != 4 {
+				return newError("wrong number of arguments. got=%d, want=3 or 4",
+					len(args))
+			}
+
+			target, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `grpc_call` must be STRING, got %s",
+					args[0].Type())
+			}
+			method, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `grpc_call` must be STRING, got %s",
+					args[1].Type())
+			}
+			options := newHash()
+			if len(args) == 4 {
+				if options, ok = args[3].(*object.Hash); !ok {
+					return newError("fourth argument to `grpc_call` must be HASH, got %s",
+						args[3].Type())
+				}
+			}
+			return grpcCall(stateInterpreter(state), target.Value, strings.TrimPrefix(method.Value, "/"), args[2], options)
+		},
+	}
+}
+
+// grpc-status 对应的名字
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+const (
+	GRPC_NOT_FOUND     = 5
+	GRPC_UNIMPLEMENTED = 12
+)
+
+// 服务返回的不是 OK 的状态
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s *grpcStatus) Error() string {
+	name := fmt.Sprintf("status %d", s.code)
+	if s.code >= 0 && s.code < len(grpcCodes) {
+		name = grpcCodes[s.code]
+	}
+	return name + ": " + s.message
+}
+
+// 按协议复用的连接, 不同的解释器可能同时使用
+var (
+	grpcTransportsMu sync.Mutex
+	grpcTransports   = map[string]http.RoundTripper{}
+)
+
+func grpcCall(in *Interpreter, target, method string, request object.Object, options *object.Hash) object.Object {
+	header := http.Header{}
+	if metadata := hashGet(options, "metadata"); metadata != nil {
+		hash, ok := metadata.(*object.Hash)
+		if !ok {
+			return newError("metadata of `grpc_call` must be HASH, got %s", metadata.Type())
+		}
+		for _, pair := range hash.Ordered() {
+			key, ok := pair.Key.(*object.String)
+			value, ok2 := pair.Value.(*object.String)
+			if !ok || !ok2 {
+				return newError("metadata of `grpc_call` must map STRING to STRING")
+			}
+			header.Add(key.Value, value.Value)
+		}
+	}
+
+	ctx, cancel := grpcContext(in)
+	defer cancel()
+	if timeout := hashGet(options, "timeout"); timeout != nil {
+		d, ok := timeout.(*object.Duration)
+		if !ok {
+			return newError("timeout of `grpc_call` must be DURATION, got %s", timeout.Type())
+		}
+		ctx, cancel = context.WithTimeout(ctx, d.Value)
+		defer cancel()
+		header.Set("Grpc-Timeout", grpcTimeout(d.Value))
+	}
+
+	var files *protoregistry.Files
+	if path := hashGet(options, "descriptors"); path != nil {
+		s, ok := path.(*object.String)
+		if !ok {
+			return newError("descriptors of `grpc_call` must be STRING, got %s", path.Type())
+		}
+		resolved, err := resolveModule(in, s.Value)
+		if err != nil {
+			return newKindError(object.IOError, "grpc_call %s: %s", method, err)
+		}
+		if files, err = loadDescriptorSet(resolved); err != nil {
+			return newKindError(object.IOError, "grpc_call %s: %s", method, err)
+		}
+	} else {
+		var err error
+		if files, err = in.reflectService(ctx, target, method); err != nil {
+			if status, ok := err.(*grpcStatus); ok && status.code == GRPC_NOT_FOUND {
+				return newError("grpc_call: unknown method %s", method)
+			}
+			return newKindError(object.IOError, "grpc_call %s: server reflection: %s", method, err)
+		}
+	}
+
+	rpc, ok := findMethod(files, method)
+	if !ok {
+		return newError("grpc_call: unknown method %s", method)
+	}
+	if rpc.IsStreamingClient() || rpc.IsStreamingServer() {
+		return newError("grpc_call: %s is a streaming method, only unary methods are supported", method)
+	}
+	message, err := toProtoMessage(rpc.Input(), request)
+	if err != nil {
+		return newError("grpc_call %s: %s", method, err)
+	}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return newError("grpc_call %s: %s", method, err)
+	}
+
+	response, err := grpcInvoke(ctx, in.GRPCTransport, target, method, header, payload)
+	if err != nil {
+		return newKindError(object.IOError, "grpc_call %s: %s", method, err)
+	}
+	result := dynamicpb.NewMessage(rpc.Output())
+	if err := proto.Unmarshal(response, result); err != nil {
+		return newKindError(object.IOError, "grpc_call %s: invalid response: %s", method, err)
+	}
+	return fromProtoMessage(result)
+}
+
+// grpc-timeout 的值: 最多 8 位数字加上单位, 向上取整, 从小到大选择能放下的单位
+func grpcTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Nanosecond, "n"}, {time.Microsecond, "u"}, {time.Millisecond, "m"},
+		{time.Second, "S"}, {time.Minute, "M"}, {time.Hour, "H"},
+	}
+	for _, u := range units {
+		n := (d-1)/u.unit + 1
+		if n < 100000000 {
+			return fmt.Sprintf("%d%s", n, u.name)
+		}
+	}
+	// time.Duration 最多约 292 年, 不会到这里
+	return "99999999H"
+}
+
+// 通过服务的反射接口取得 method 所在的服务的描述, 按 target 和服务名缓存在解释器上
+func (in *Interpreter) reflectService(ctx context.Context, target, method string) (*protoregistry.Files, error) {
+	service := method
+	if i := strings.LastIndex(method, "/"); i >= 0 {
+		service = method[:i]
+	}
+	key := target + " " + service
+	if files, ok := in.reflected[key]; ok {
+		return files, nil
+	}
+
+	protos := map[string]*descriptorpb.FileDescriptorProto{}
+	fetch := func(field protowire.Number, name string) error {
+		files, err := grpcReflect(ctx, in.GRPCTransport, target, field, name)
+		if err != nil {
+			return err
+		}
+		for _, data := range files {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, file); err != nil {
+				return err
+			}
+			protos[file.GetName()] = file
+		}
+		return nil
+	}
+
+	// 服务所在的文件, 然后补上服务没有一起返回的依赖
+	if err := fetch(REFLECT_FILE_CONTAINING_SYMBOL, service); err != nil {
+		return nil, err
+	}
+	for {
+		missing := ""
+		for _, file := range protos {
+			for _, dependency := range file.GetDependency() {
+				if _, ok := protos[dependency]; !ok {
+					missing = dependency
+				}
+			}
+		}
+		if missing == "" {
+			break
+		}
+		if err := fetch(REFLECT_FILE_BY_FILENAME, missing); err != nil {
+			return nil, err
+		}
+		if _, ok := protos[missing]; !ok {
+			return nil, fmt.Errorf("server did not return %s", missing)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range protos {
+		set.File = append(set.File, file)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	if in.reflected == nil {
+		in.reflected = map[string]*protoregistry.Files{}
+	}
+	in.reflected[key] = files
+	return files, nil
+}
+
+// 反射接口(grpc/reflection/v1/reflection.proto)中用到的字段
+const (
+	REFLECT_FILE_BY_FILENAME       = 3 // ServerReflectionRequest.file_by_filename
+	REFLECT_FILE_CONTAINING_SYMBOL = 4 // ServerReflectionRequest.file_containing_symbol
+	REFLECT_FILE_DESCRIPTOR        = 4 // ServerReflectionResponse.file_descriptor_response
+	REFLECT_ERROR                  = 7 // ServerReflectionResponse.error_response
+)
+
+// 发送一个反射请求, 返回其中的 FileDescriptorProto
+// 反射接口是双向流, 这里每个请求单独调用一次, 请求发送完就结束; 服务没有 v1 时改用 v1alpha, 两者的消息相同
+func grpcReflect(ctx context.Context, transport http.RoundTripper, target string, field protowire.Number, name string) ([][]byte, error) {
+	request := protowire.AppendTag(nil, field, protowire.BytesType)
+	request = protowire.AppendString(request, name)
+
+	var response []byte
+	var err error
+	for _, service := range []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"} {
+		response, err = grpcInvoke(ctx, transport, target, service+"/ServerReflectionInfo", http.Header{}, request)
+		if status, ok := err.(*grpcStatus); !ok || status.code != GRPC_UNIMPLEMENTED {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files [][]byte
+	for _, f := range protoFields(response) {
+		switch f.number {
+		case REFLECT_FILE_DESCRIPTOR:
+			// FileDescriptorResponse: repeated bytes file_descriptor_proto = 1
+			for _, file := range protoFields(f.value) {
+				if file.number == 1 {
+					files = append(files, file.value)
+				}
+			}
+		case REFLECT_ERROR:
+			// ErrorResponse: int32 error_code = 1; string error_message = 2
+			status := &grpcStatus{code: GRPC_NOT_FOUND}
+			for _, e := range protoFields(f.value) {
+				switch e.number {
+				case 1:
+					status.code = int(e.varint)
+				case 2:
+					status.message = string(e.value)
+				}
+			}
+			return nil, status
+		}
+	}
+	if files == nil {
+		return nil, fmt.Errorf("unexpected response for %s", name)
+	}
+	return files, nil
+}
+
+// 消息中的一个字段, 只用于解析反射接口的响应
+type protoField struct {
+	number protowire.Number
+	varint uint64
+	value  []byte
+}
+
+// 按顺序列出消息中的字段, 不合法的部分被忽略
+func protoFields(data []byte) []protoField {
+	var fields []protoField
+	for len(data) > 0 {
+		number, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			break
+		}
+		data = data[n:]
+		field := protoField{number: number}
+		switch typ {
+		case protowire.VarintType:
+			field.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			field.value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(number, typ, data)
+		}
+		if n < 0 {
+			break
+		}
+		data = data[n:]
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// 在回调或者 EvalContext 中时, 被取消后同时取消请求
+func grpcContext(in *Interpreter) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if done := in.cancelled; done != nil {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// 发送一个请求消息, 返回响应消息; transport 为 nil 时按协议使用共享的连接
+func grpcInvoke(ctx context.Context, transport http.RoundTripper, target, method string, header http.Header, payload []byte) ([]byte, error) {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		if transport, err = grpcTransport(u.Scheme); err != nil {
+			return nil, err
+		}
+	}
+
+	// 消息前面是 1 个字节的压缩标志和 4 个字节的长度
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	req, err := http.NewRequest("POST", u.Scheme+"://"+u.Host+"/"+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header = header
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+
+	// 出错时服务可能只返回头部, 没有 trailer
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, fmt.Errorf("response without grpc-status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc-status %q", status)
+	}
+	if code != 0 {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return nil, &grpcStatus{code: code, message: message}
+	}
+
+	if len(body) < 5 {
+		return nil, fmt.Errorf("response without message")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("compressed responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(length) != uint64(len(body)-5) {
+		return nil, fmt.Errorf("expected exactly one response message")
+	}
+	return body[5:], nil
+}
+
+func grpcTransport(scheme string) (http.RoundTripper, error) {
+	grpcTransportsMu.Lock()
+	defer grpcTransportsMu.Unlock()
+	if transport, ok := grpcTransports[scheme]; ok {
+		return transport, nil
+	}
+
+	var transport http.RoundTripper
+	switch scheme {
+	case "https":
+		transport = &http.Transport{ForceAttemptHTTP2: true}
+	case "http":
+		// 明文的 HTTP/2(h2c)
+		t := &http.Transport{Protocols: new(http.Protocols)}
+		t.Protocols.SetUnencryptedHTTP2(true)
+		transport = t
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", scheme)
+	}
+	grpcTransports[scheme] = transport
+	return transport, nil
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// 执行的钩子(Options.EnterHook 和 Options.TraceHook), 用于性能分析, 调试器和解释脚本执行过程的工具
+// 宿主设置之后, 这个解释器中每个语法树节点执行之前以节点和当前环境调用 EnterHook,
+// 执行之后再加上结果调用 TraceHook; 两者都是可选的, 都没有设置时没有额外的开销
+// 例如统计每种节点执行的次数:
+//
+//	counts := map[string]int{}
+//	options := evaluator.DefaultOptions()
+//	options.TraceHook = func(node ast.Node, env *object.Environment, result object.Object) {
+//		counts[fmt.Sprintf("%T", node)]++
+//	}
+//	evaluator.New(options).Eval(program, env)
+//
+// 钩子中不能修改 env 和 result, 但是可以保留它们: 有钩子的解释器中函数的运行时环境不放回池中(见 escape.go);
+// if 和三元表达式的条件也经过钩子(见 condition.go). 钩子中的 panic 和执行中的 panic 一样转换为 InternalError
+// CallFunction 的回调使用相同的选项, 同样调用钩子; 回调可以并发执行, 这时钩子由宿主负责同步
+
+// 是否设置了执行的钩子
+func (in *Interpreter) hooked() bool {
+	return in.EnterHook != nil || in.TraceHook != nil
+}
+
+func evalHooked(in *Interpreter, node ast.Node, env *object.Environment) object.Object {
+	// 程序节点的钩子也在 safely 中调用
+	if _, ok := node.(*ast.Program); ok {
+		return safely(in, func() object.Object { return callHooks(in, node, env) })
+	}
+	return callHooks(in, node, env)
+}
+
+func callHooks(in *Interpreter, node ast.Node, env *object.Environment) object.Object {
+	if in.EnterHook != nil {
+		in.EnterHook(node, env)
+	}
+	result := eval(node, env)
+	if in.TraceHook != nil {
+		in.TraceHook(node, env, result)
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+
+	"mk/object"
+)
+
+// 国际化字符串操作
+// 大小写和排序规则使用 golang.org/x/text/cases 和 golang.org/x/text/collate(CLDR), 按 rune 处理而不是按 byte 处理:
+//
+//	lower(s [, locale])   转小写, 例如 locale 为 "tr"/"az" 时使用土耳其语/阿塞拜疆语规则
+//	upper(s [, locale])   转大写
+//	casefold(s)                   完整大小写折叠, 用于不区分大小写的比较
+//	collate(a, b [, locale])      按 locale 的排序规则比较, 返回 -1, 0, 1
+//	collate_sort(arr [, locale])  按 collate 的顺序排序字符串数组, 返回新数组
+//
+// locale 为 BCP 47 语言标签("sv", "tr-TR", 也可以写成 "sv_SE"), 没有给出或者不认识时使用根规则;
+// collate 逐级比较基本字母, 重音和大小写, 前一级相同时才比较下一级, 小写在前, 例如:
+//
+//	collate("é", "f")        // -1, 重音只在基本字母相同时才有影响
+//	collate("ä", "z", "sv")  // 1, 瑞典语中 "ä" 排在 "z" 后面
+func init() {
+	builtins["lower"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return caseMapping("lower", args, cases.Lower)
+	}}
+	builtins["upper"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return caseMapping("upper", args, cases.Upper)
+	}}
+	builtins["casefold"] = &object.Builtin{Fn: builtinCasefold}
+	builtins["collate"] = &object.Builtin{Fn: builtinCollate}
+	builtins["collate_sort"] = &object.Builtin{Fn: builtinCollateSort}
+}
+
+// 大小写转换
+func caseMapping(name string, args []object.Object,
+	mapping func(language.Tag, ...cases.Option) cases.Caser) object.Object {
+
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `%s` must be STRING, got %s",
+			name, args[0].Type())
+	}
+
+	tag, errObj := localeArg(name, args, 1)
+	if errObj != nil {
+		return errObj
+	}
+	return &object.String{Value: mapping(tag).String(s.Value)}
+}
+
+// 可选的 locale 参数, 没有给出时为根规则 language.Und
+func localeArg(name string, args []object.Object, n int) (language.Tag, object.Object) {
+	if len(args) <= n {
+		return language.Und, nil
+	}
+	locale, ok := args[n].(*object.String)
+	if !ok {
+		return language.Und, newError("argument to `%s` must be STRING, got %s",
+			name, args[n].Type())
+	}
+	// 不认识的标签 language.Make 返回 language.Und
+	return language.Make(strings.Replace(locale.Value, "_", "-", -1)), nil
+}
+
+func builtinCasefold(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `casefold` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	return &object.String{Value: cases.Fold().String(s.Value)}
+}
+
+// x/text 中没有自己的排序规则的语言(CLDR 中 nb 继承 no, x/text 没有 no), 使用字母表相同的语言
+var collationAliases = map[string]language.Tag{
+	"nb": language.Make("nn"),
+	"no": language.Make("nn"),
+}
+
+func newCollator(tag language.Tag) *collate.Collator {
+	base, _ := tag.Base()
+	if alias, ok := collationAliases[base.String()]; ok {
+		tag = alias
+	}
+	return collate.New(tag)
+}
+
+func builtinCollate(args ...object.Object) object.Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3",
+			len(args))
+	}
+
+	a, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `collate` must be STRING, got %s",
+			args[0].Type())
+	}
+	b, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `collate` must be STRING, got %s",
+			args[1].Type())
+	}
+
+	tag, errObj := localeArg("collate", args, 2)
+	if errObj != nil {
+		return errObj
+	}
+
+	// Collator 不能并发使用, 每次调用新建一个
+	return &object.Integer{Value: int64(newCollator(tag).CompareString(a.Value, b.Value))}
+}
+
+func builtinCollateSort(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `collate_sort` must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	tag, errObj := localeArg("collate_sort", args, 1)
+	if errObj != nil {
+		return errObj
+	}
+
+	// 每个元素只计算一次排序键
+	type keyed struct {
+		element object.Object
+		key     []byte
+	}
+	c := newCollator(tag)
+	var buf collate.Buffer
+	items := make([]keyed, len(arr.Elements))
+	for i, e := range arr.Elements {
+		s, ok := e.(*object.String)
+		if !ok {
+			return newError("elements of `collate_sort` must be STRING, got %s",
+				e.Type())
+		}
+		items[i] = keyed{element: e, key: c.KeyFromString(&buf, s.Value)}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return bytes.Compare(items[i].key, items[j].key) < 0
+	})
+
+	elements := make([]object.Object, len(items))
+	for i, item := range items {
+		elements[i] = item.element
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"mk/lexer"
+	"mk/object"
+	"mk/parser"
+)
+
+// 一个已加载(或者正在加载)的模块
+type module struct {
+	exports *object.Hash // 模块导出的名字
+	loading bool         // 正在执行模块的顶层代码
+}
+
+// 导入模块: import(path)
+// 在独立的环境中执行模块文件, 返回模块顶层定义的名字(以'_'开头的除外)组成的map
+// 模块在调用 import 的解释器中执行, 使用相同的选项和限制
+// 已加载的模块缓存在解释器上(Interpreter.modules, key 为模块文件的绝对路径): 同一个解释器中同一个模块只执行一次,
+// 之后的 import 直接返回缓存的结果; 不同的解释器(包括 CallFunction 的回调)各自加载, 不共享模块中的状态
+// 例如:
+//
+//	let math = import("lib/math.mk");
+//	math.add(1, 2);
+func init() {
+	builtins["import"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			path, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `import` must be STRING, got %s",
+					args[0].Type())
+			}
+			return importModule(stateInterpreter(state), path.Value)
+		},
+	}
+}
+
+func importModule(in *Interpreter, path string) object.Object {
+	resolved, err := resolveModule(in, path)
+	if err != nil {
+		return newKindError(object.IOError, "import %q: %s", path, err)
+	}
+
+	if mod, ok := in.modules[resolved]; ok {
+		if mod.loading {
+			return newKindError(object.ImportError, "import cycle: %s",
+				strings.Join(append(append([]string{}, in.importStack...), resolved), " -> "))
+		}
+		return mod.exports
+	}
+
+	source, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return newKindError(object.IOError, "import %q: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newKindError(object.ImportError, "import %q: %s", path,
+			strings.Join(p.Errors(), "; "))
+	}
+
+	if in.modules == nil {
+		in.modules = map[string]*module{}
+	}
+	mod := &module{loading: true}
+	in.modules[resolved] = mod
+	in.importStack = append(in.importStack, resolved)
+	defer func() {
+		in.importStack = in.importStack[:len(in.importStack)-1]
+	}()
+
+	env := object.NewEnvironment()
+	if result := in.Eval(program, env); isAbrupt(result) {
+		// 加载失败的模块不缓存, 下次 import 时重新加载
+		delete(in.modules, resolved)
+		return result
+	}
+
+	mod.exports = newHash()
+	for _, name := range env.Names() {
+		if !strings.HasPrefix(name, "_") {
+			value, _ := env.Get(name)
+			hashSet(mod.exports, name, value)
+		}
+	}
+	mod.loading = false
+
+	return mod.exports
+}
+
+// 解析模块的绝对路径
+// 相对路径相对于解释器 in 正在加载的模块所在目录, 在主脚本中相对于 Options.ModuleDir
+func resolveModule(in *Interpreter, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		dir := in.ModuleDir
+		if len(in.importStack) != 0 {
+			dir = filepath.Dir(in.importStack[len(in.importStack)-1])
+		}
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Abs(path)
+}
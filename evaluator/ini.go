@@ -0,0 +1,195 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// ini 和 Java properties 配置文件的解析
+//
+//	ini_decode(s)         [section] 下的 key = value 放在以节名为 key 的 map 中,
+//	                      第一个节之前的 key = value 放在最外层; 以 ; 或 # 开头的行是注释,
+//	                      值两边的双引号会被去掉, 重复的节合并, 重复的 key 以后面的为准
+//	properties_decode(s)  key=value, key: value 或者 key value, 以 # 或 ! 开头的行是注释,
+//	                      行尾的 \ 表示下一行是续行, 支持 \t \n \r \f \\ \uXXXX 等转义
+//
+// 所有的值都是字符串, 例如:
+//
+//	let conf = ini_decode("name = mk\n[server]\nport = 8080");
+//	conf.server.port    // "8080"
+func init() {
+	builtins["ini_decode"] = &object.Builtin{Fn: builtinIniDecode}
+	builtins["properties_decode"] = &object.Builtin{Fn: builtinPropertiesDecode}
+}
+
+func builtinIniDecode(args ...object.Object) object.Object {
+	s, err := configArg("ini_decode", args)
+	if err != nil {
+		return err
+	}
+
+	result := newHash()
+	section := result
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return newError("ini: line %d: unterminated section header %q", i+1, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return newError("ini: line %d: empty section name", i+1)
+			}
+			// 重复的节合并到已有的 map 中
+			if existing, ok := hashGet(result, name).(*object.Hash); ok {
+				section = existing
+				continue
+			}
+			section = newHash()
+			hashSet(result, name, section)
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return newError("ini: line %d: expected key = value, got %q", i+1, line)
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		hashSet(section, key, &object.String{Value: value})
+	}
+	return result
+}
+
+func builtinPropertiesDecode(args ...object.Object) object.Object {
+	s, err := configArg("properties_decode", args)
+	if err != nil {
+		return err
+	}
+
+	result := newHash()
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// 续行: 行尾有奇数个 \ 时把下一行(去掉开头的空白)接上
+		for continues(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if continues(line) {
+			line = line[:len(line)-1]
+		}
+
+		key, value, ok := splitProperty(line)
+		if !ok {
+			return newError("properties: line %d: invalid escape in %q", lineno, line)
+		}
+		hashSet(result, key, &object.String{Value: value})
+	}
+	return result
+}
+
+// 唯一的参数为字符串
+func configArg(name string, args []object.Object) (string, *object.Error) {
+	if len(args) != 1 {
+		return "", newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	return s.Value, nil
+}
+
+// 行尾是否有奇数个 \ (偶数个时是转义的 \ 本身)
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// 按第一个没有转义的 =, : 或空白分开 key 和 value, 并处理转义
+func splitProperty(line string) (string, string, bool) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' || line[i] == '\f' {
+			end = i
+			break
+		}
+	}
+
+	// 分隔符两边可以有空白, 空白之后还可以有一个 = 或 :
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	key, ok := unescapeProperty(line[:end])
+	if !ok {
+		return "", "", false
+	}
+	value, ok := unescapeProperty(rest)
+	if !ok {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+func unescapeProperty(s string) (string, bool) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, true
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", false
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", false
+			}
+			out.WriteRune(rune(r))
+			i += 4
+		default:
+			// 其他字符前的 \ 直接去掉, 例如 \= \: \\ \#
+			out.WriteByte(s[i])
+		}
+	}
+	return out.String(), true
+}
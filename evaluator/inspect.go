@@ -0,0 +1,160 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 脚本的标准输出(puts, printf)
+// 宿主可以替换为其他输出
+var Stdout io.Writer = os.Stdout
+
+// 脚本的标准错误输出
+// 宿主可以替换为其他输出
+var Stderr io.Writer = os.Stderr
+
+// 调试输出
+//
+//	inspect(x)  返回 x 的格式化表示: 字符串带引号, 数组, map和结构体缩进展开,
+//	            map按key排序, 结构体按字段顺序, null/函数等带类型标记
+//	dump(x...)  把 inspect 的结果输出到标准错误
+//
+// puts 用于面向用户的输出, inspect/dump 用于调试
+func init() {
+	builtins["inspect"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return &object.String{Value: inspect(args[0])}
+		},
+	}
+	builtins["dump"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(Stderr, inspect(arg))
+			}
+			return NULL
+		},
+	}
+}
+
+// 每一层的缩进
+const INSPECT_INDENT = "  "
+
+func inspect(obj object.Object) string {
+	var out strings.Builder
+	writeInspect(&out, obj, "")
+	return out.String()
+}
+
+func writeInspect(out *strings.Builder, obj object.Object, indent string) {
+	switch obj := obj.(type) {
+	case *object.String:
+		out.WriteString(strconv.Quote(obj.Value))
+
+	case *object.Integer, *object.Float, *object.Bytes, *object.Boolean, *object.Range:
+		out.WriteString(obj.Inspect())
+
+	case *object.Null:
+		out.WriteString("<null>")
+
+	case *object.Function:
+		name := obj.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Fprintf(out, "<function %s/%d>", name, len(obj.Parameters))
+
+	case *object.Builtin:
+		out.WriteString("<builtin>")
+
+	case *object.Generator:
+		name := obj.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Fprintf(out, "<generator %s>", name)
+
+	case *object.Error:
+		fmt.Fprintf(out, "<error %s: %s>", obj.Kind, strconv.Quote(obj.Message))
+
+	case *object.Array:
+		if len(obj.Elements) == 0 {
+			out.WriteString("[]")
+			return
+		}
+
+		out.WriteString("[\n")
+		for i, el := range obj.Elements {
+			out.WriteString(indent + INSPECT_INDENT)
+			writeInspect(out, el, indent+INSPECT_INDENT)
+			if i < len(obj.Elements)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "]")
+
+	case *object.Hash:
+		if obj.Len() == 0 {
+			out.WriteString("{}")
+			return
+		}
+
+		// 按格式化之后的key排序, 保证输出稳定
+		type entry struct {
+			key   string
+			value object.Object
+		}
+		entries := make([]entry, 0, obj.Len())
+		for _, pair := range obj.Ordered() {
+			entries = append(entries, entry{key: inspect(pair.Key), value: pair.Value})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+
+		out.WriteString("{\n")
+		for i, e := range entries {
+			out.WriteString(indent + INSPECT_INDENT + e.key + ": ")
+			writeInspect(out, e.value, indent+INSPECT_INDENT)
+			if i < len(entries)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+
+	case *object.StructType:
+		fmt.Fprintf(out, "<struct %s/%d>", obj.Name, len(obj.Fields))
+
+	// 结构体按字段的声明顺序展开
+	case *object.Struct:
+		if len(obj.Values) == 0 {
+			out.WriteString(obj.Def.Name + " {}")
+			return
+		}
+
+		out.WriteString(obj.Def.Name + " {\n")
+		for i, value := range obj.Values {
+			out.WriteString(indent + INSPECT_INDENT + obj.Def.Fields[i] + ": ")
+			writeInspect(out, value, indent+INSPECT_INDENT)
+			if i < len(obj.Values)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+
+	default:
+		fmt.Fprintf(out, "<%s %s>", strings.ToLower(string(obj.Type())), obj.Inspect())
+	}
+}
@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 解释器: 一次执行的选项和运行状态
+//
+// 执行时创建的环境都属于同一个解释器(见 object.Environment.State), 函数调用时被调用的函数也在调用方的解释器中执行;
+// 运行状态(调用栈, 资源计数, 已加载的模块, 监视函数, 断点进度, 容错模式记录的错误)和选项(包括钩子和自定义运算符)都在解释器上,
+// 宿主可以在不同的 goroutine 中用不同的解释器同时执行:
+//
+//	in := evaluator.New(evaluator.DefaultOptions())
+//	defer in.Close()
+//	result := in.Eval(program, object.NewEnvironment())
+//
+// 以下是整个进程共用的, 不属于某个解释器:
+//   - 宿主在执行之前设置的全局配置: Stdout, Stderr, Stdin, Color, Debugger, Interrupt, TolerantKinds,
+//     object.VerboseInspect 以及 parser.RegisterOperator 注册的语法, 有解释器在执行时不能修改
+//   - 事件循环: schedule, on_exit, run_forever 和 shutdown(见 eventloop.go), 只应该由一个宿主 goroutine 使用
+//   - 内部的缓存: 时区, gRPC 连接, protobuf 描述文件和子进程列表, 有锁保护, 不同的解释器可以同时使用
+//
+// 宿主用完解释器之后调用 Close 结束其中还没有执行完的生成器(见 generator.go);
+// 直接调用 Eval 时使用环境所属的解释器, 没有时按 DefaultOptions() 新建一个;
+// 同一个解释器同一时刻只能有一个 goroutine 在其中执行
+type Interpreter struct {
+	Options
+
+	cancelled  <-chan struct{} // EvalContext 或者 CallFunction 的 ctx.Done(), 不在其中时为nil
+	ticks      int             // 执行的节点数, 用于定期检查 cancelled
+	steps      int64           // 已经执行的步数, 见 budget.go
+	allocated  int64           // 已经分配的字节数, 见 budget.go
+	callStack  []frame         // 当前正在执行中的调用
+	callDepth  int             // 当前用户定义函数的调用深度
+	tryDepth   int             // 正在执行的 try 部分的层数
+	panicked   *panicRecord    // 正在展开的 panic, 见 recover.go
+	generator  *generator      // 正在执行的生成器, yield 语句把值交给它, 见 generator.go
+	generators *generatorSet   // 开始执行但还没有结束的生成器, 由 Close 结束
+	tolerated  []*object.Error // 容错模式下记录的错误, 见 tolerant.go
+
+	modules     map[string]*module // 已加载的模块, 见 import.go
+	importStack []string           // 正在加载的模块路径, 用于解析嵌套 import 的相对路径和报告循环导入
+
+	watchers map[string][]WatchFunc // 按变量名保存的监视函数, 同一名字按注册顺序调用, 见 watch.go
+	watching bool                   // 正在执行监视函数
+
+	checkpointsDone []string         // 已经完成的断点名, 包括恢复之前完成的, 见 checkpoint.go
+	resumeState     *checkpointState // LoadCheckpoint 读取的断点, 第一次执行顶层程序时使用
+
+	reflected map[string]*protoregistry.Files // grpc_call 通过反射取得的服务描述, 见 grpc.go
+}
+
+// 解释器的选项, 宿主通常从 DefaultOptions() 开始修改
+type Options struct {
+	// 用户定义函数的最大调用深度(包括内置函数中调用的函数), 超过时返回可以捕获的 ResourceError,
+	// 避免无限递归耗尽 Go 的栈导致进程崩溃; 为0时不限制
+	MaxCallDepth int
+
+	// 最多执行的语法树节点数, 超过时返回不可恢复的 ResourceError; 为0时不限制, 见 budget.go
+	MaxSteps int64
+
+	// 字符串, 字节串, 数组和 map 最多分配的字节数(近似值), 超过时返回 ResourceError; 为0时不限制, 见 budget.go
+	MaxMemory int64
+
+	// 严格模式: 在同一个作用域中再次用 let, const 或 struct 声明同一个名字(包括函数参数),
+	// 以及函数字面量中重复的参数名是 NameError, 避免拼写错误或者复制粘贴悄悄覆盖已有的变量;
+	// 在内层代码块中遮盖外层的变量不受影响
+	Strict bool
+
+	// 下标规则: NegativeIndex 为 true 时负数下标从末尾开始计数, a[-1] 为最后一个元素;
+	// StrictIndex 为 true 时下标越界返回 IndexError, 否则返回 null. 对 null 取下标或成员时同样处理, 见 access.go
+	NegativeIndex bool
+	StrictIndex   bool
+
+	// 执行的钩子, 每个语法树节点执行之前和之后调用, 都为 nil 时没有额外的开销, 见 hooks.go
+	EnterHook func(node ast.Node, env *object.Environment)
+	TraceHook func(node ast.Node, env *object.Environment, result object.Object)
+
+	// 容错模式: 类型错误, 未定义的标识符和下标错误记录在解释器上并以 null 代替, 脚本继续执行, 见 tolerant.go
+	Tolerant bool
+
+	// 宿主注册的中缀运算符的求值函数, 通过 RegisterOperator 修改, 执行期间只读, 见 operators.go
+	Operators map[string]OperatorFunc
+
+	// 主脚本所在的目录, 主脚本中 import 和 load_plugin 的相对路径相对于这个目录解析; 为空时相对于当前工作目录, 见 import.go
+	ModuleDir string
+
+	// checkpoint() 保存的断点文件的路径, 为空时 checkpoint() 不保存, 见 checkpoint.go
+	CheckpointFile string
+
+	// grpc_call 发送请求使用的连接, 为 nil 时按协议使用进程内共享的连接, 见 grpc.go
+	GRPCTransport http.RoundTripper
+}
+
+// 默认选项
+func DefaultOptions() Options {
+	return Options{MaxCallDepth: 10000, NegativeIndex: true}
+}
+
+// 新建解释器
+func New(options Options) *Interpreter {
+	return &Interpreter{Options: options, generators: &generatorSet{}}
+}
+
+// 在这个解释器中执行 node, env 以及其中新建的环境都属于这个解释器
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	env.SetState(in)
+	return Eval(node, env)
+}
+
+// 选项相同, 运行状态全新的解释器, 用于宿主回调
+// 其中开始执行的生成器记录在原来的解释器上, 由原来的解释器的 Close 结束
+func (in *Interpreter) fork() *Interpreter {
+	child := New(in.Options)
+	child.generators = in.generators
+	return child
+}
+
+// 环境所属的解释器, 没有时新建一个并设置到 env 上
+// env 为 nil(内置函数作为回调调用)时返回一个不属于任何环境的解释器
+func interpreterOf(env *object.Environment) *Interpreter {
+	if env == nil {
+		return New(DefaultOptions())
+	}
+	if in, ok := env.State().(*Interpreter); ok {
+		return in
+	}
+	in := New(DefaultOptions())
+	env.SetState(in)
+	return in
+}
+
+// StateFn 内置函数收到的调用方解释器
+func stateInterpreter(state object.State) *Interpreter {
+	if in, ok := state.(*Interpreter); ok {
+		return in
+	}
+	return New(DefaultOptions())
+}
+
+// 内置函数中调用回调函数时使用的解释器: 用户定义函数所属的解释器
+// 用于没有调用方状态的地方(例如定时任务和 on_exit 函数)
+func ownerOf(fn object.Object) *Interpreter {
+	if fn, ok := fn.(*object.Function); ok {
+		return interpreterOf(fn.Env)
+	}
+	return New(DefaultOptions())
+}
@@ -0,0 +1,37 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 可迭代的类型, 用于错误信息
+const ITERABLE_TYPES = "ARRAY, HASH, STRING, RANGE or GENERATOR"
+
+// obj 的迭代器, 不可迭代时 ok 为 false
+func iterOf(obj object.Object) (object.Iterator, bool) {
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return nil, false
+	}
+	return iterable.Iter(), true
+}
+
+// 依次取出迭代器中的值交给 fn, fn 返回 false 时停止
+// 取到错误(生成器中出错)或者解释器 in 被取消时停止并返回该错误, 否则返回 nil
+func eachValue(in *Interpreter, it object.Iterator, fn func(value object.Object) bool) object.Object {
+	for {
+		if err := in.checkCancelled(); err != nil {
+			return err
+		}
+		value, ok := it.Next()
+		if !ok {
+			return nil
+		}
+		if isAbrupt(value) {
+			return value
+		}
+		if !fn(value) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 状态机
+// machine(spec) 根据声明式的map构造状态机:
+//
+//	let m = machine({
+//	    "initial": "idle",
+//	    "transitions": {
+//	        "idle": {"start": "running"},
+//	        "running": {"stop": "idle"}
+//	    },
+//	    "handlers": {"running": fn(from, event) { puts(from); }}
+//	});
+//	fire(m, "start"); // "running"
+//	state(m);         // "running"
+//
+// handlers 可选, 进入对应状态时以 (上一个状态, 事件名) 调用
+func init() {
+	builtins["machine"] = &object.Builtin{Fn: builtinMachine}
+	builtins["fire"] = &object.Builtin{StateFn: builtinFire}
+	builtins["state"] = &object.Builtin{Fn: builtinState}
+}
+
+func builtinMachine(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	spec, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `machine` must be HASH, got %s",
+			args[0].Type())
+	}
+
+	// 初始状态
+	initial, ok := hashGet(spec, "initial").(*object.String)
+	if !ok {
+		return newError("machine spec must have a STRING `initial` state")
+	}
+
+	m := &object.Machine{
+		Current:     initial.Value,
+		Transitions: make(map[string]map[string]string),
+		Handlers:    make(map[string]object.Object),
+	}
+
+	// 状态迁移表: 状态 -> {事件: 目标状态}
+	transitions, ok := hashGet(spec, "transitions").(*object.Hash)
+	if !ok {
+		return newError("machine spec must have a HASH `transitions`")
+	}
+	for _, pair := range transitions.Ordered() {
+		from, ok := pair.Key.(*object.String)
+		if !ok {
+			return newError("machine state must be STRING, got %s",
+				pair.Key.Type())
+		}
+		events, ok := pair.Value.(*object.Hash)
+		if !ok {
+			return newError("transitions of state %q must be HASH, got %s",
+				from.Value, pair.Value.Type())
+		}
+
+		m.Transitions[from.Value] = make(map[string]string)
+		for _, ev := range events.Ordered() {
+			name, ok := ev.Key.(*object.String)
+			if !ok {
+				return newError("machine event must be STRING, got %s",
+					ev.Key.Type())
+			}
+			to, ok := ev.Value.(*object.String)
+			if !ok {
+				return newError("target of event %q must be STRING, got %s",
+					name.Value, ev.Value.Type())
+			}
+			m.Transitions[from.Value][name.Value] = to.Value
+		}
+	}
+
+	// 状态进入时的回调(可选)
+	if handlers := hashGet(spec, "handlers"); handlers != nil {
+		hash, ok := handlers.(*object.Hash)
+		if !ok {
+			return newError("machine `handlers` must be HASH, got %s",
+				handlers.Type())
+		}
+		for _, pair := range hash.Ordered() {
+			name, ok := pair.Key.(*object.String)
+			if !ok {
+				return newError("machine state must be STRING, got %s",
+					pair.Key.Type())
+			}
+			if !isCallable(pair.Value) {
+				return newError("handler of state %q must be FUNCTION, got %s",
+					name.Value, pair.Value.Type())
+			}
+			m.Handlers[name.Value] = pair.Value
+		}
+	}
+
+	return m
+}
+
+// 触发事件, 返回迁移后的状态
+func builtinFire(state object.State, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	m, ok := args[0].(*object.Machine)
+	if !ok {
+		return newError("argument to `fire` must be MACHINE, got %s",
+			args[0].Type())
+	}
+
+	event, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `fire` must be STRING, got %s",
+			args[1].Type())
+	}
+
+	to, ok := m.Transitions[m.Current][event.Value]
+	if !ok {
+		return newError("no transition for event %q in state %q",
+			event.Value, m.Current)
+	}
+
+	from := m.Current
+	m.Current = to
+
+	if handler, ok := m.Handlers[to]; ok {
+		result := applyFunction(stateInterpreter(state), handler, []object.Object{
+			&object.String{Value: from},
+			event,
+		})
+		if isAbrupt(result) {
+			return result
+		}
+	}
+
+	return &object.String{Value: m.Current}
+}
+
+// 查看当前状态
+func builtinState(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	m, ok := args[0].(*object.Machine)
+	if !ok {
+		return newError("argument to `state` must be MACHINE, got %s",
+			args[0].Type())
+	}
+
+	return &object.String{Value: m.Current}
+}
@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"mk/ast"
+	"mk/object"
+)
+
+// 保存在磁盘上的函数结果缓存, 多次运行同一个数据处理脚本时跳过重复的计算
+//
+//	memo_disk(fn, cache_dir)  返回和 fn 参数相同的函数, 结果按参数缓存在 cache_dir 中
+//
+// 缓存的 key 为函数源码和序列化之后的参数的 SHA-256, 每个结果保存为 cache_dir/<key>.json,
+// 所以修改了函数体之后旧的结果不再使用; 闭包捕获的变量不参与计算, fn 的结果应该只依赖参数
+// 参数或者结果不能序列化(见 serialize)时直接调用 fn, 不缓存; fn 出错时也不缓存
+//
+// 例如:
+//
+//	let parse = memo_disk(fn(path, day) { ... }, ".cache/parse");
+//	parse("logs", "2024-01-02")    // 第一次运行时计算, 之后的运行从 .cache/parse 中读取
+func init() {
+	builtins["memo_disk"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			fn, ok := args[0].(*object.Function)
+			if !ok {
+				return newError("first argument to `memo_disk` must be FUNCTION, got %s",
+					args[0].Type())
+			}
+			dir, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `memo_disk` must be STRING, got %s",
+					args[1].Type())
+			}
+			if dir.Value == "" {
+				return newError("cache directory of `memo_disk` must not be empty")
+			}
+			return &object.Builtin{Fn: memoizeOnDisk(fn, dir.Value)}
+		},
+	}
+}
+
+func memoizeOnDisk(fn *object.Function, dir string) object.BuiltinFunction {
+	source := (&ast.FunctionLiteral{
+		Parameters: fn.Parameters,
+		Defaults:   fn.Defaults,
+		Rest:       fn.Rest,
+		Body:       fn.Body,
+	}).String()
+
+	return func(args ...object.Object) object.Object {
+		key, ok := memoKey(source, args)
+		if !ok {
+			return applyFunction(ownerOf(fn), fn, args)
+		}
+		path := filepath.Join(dir, key+".json")
+
+		// 缓存文件损坏时重新计算并覆盖
+		if data, err := ioutil.ReadFile(path); err == nil {
+			var cached serialized
+			if json.Unmarshal(data, &cached) == nil {
+				if result, err := deserialize(cached); err == nil {
+					return result
+				}
+			}
+		}
+
+		result := applyFunction(ownerOf(fn), fn, args)
+		if isAbrupt(result) {
+			return result
+		}
+		encoded, ok := serialize(result)
+		if !ok {
+			return result
+		}
+		if err := writeMemo(path, encoded); err != nil {
+			return newError("could not write memo_disk cache: %s", err)
+		}
+		return result
+	}
+}
+
+// 函数源码和参数的 SHA-256, 参数不能序列化时返回 false
+func memoKey(source string, args []object.Object) (string, bool) {
+	encoded := make([]serialized, len(args))
+	for i, arg := range args {
+		value, ok := serialize(arg)
+		if !ok {
+			return "", false
+		}
+		encoded[i] = value
+	}
+
+	data, err := json.Marshal(struct {
+		Fn   string       `json:"fn"`
+		Args []serialized `json:"args"`
+	}{source, encoded})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// 先写入临时文件再改名, 并发运行的脚本不会读到写了一半的结果
+func writeMemo(path string, value serialized) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".memo-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// 方法调用
+//
+//	obj.method(args)   obj 为 map 或者结构体实例, method 为用户定义函数时, 函数体中 self 为 obj
+//	bind(fn, obj)      返回和 fn 参数相同的函数, 调用时 self 为 obj
+//
+// self 不是参数, 参数个数不变, 所以 import(...) 返回的模块中的函数照常调用;
+// 函数有名为 self 的参数时参数优先. 先取出再调用(let f = obj.method; f())不绑定 self, 需要用 bind
+//
+// 例如:
+//
+//	let counter = {"n": 1, "next": fn(step) { self.n + step }};
+//	counter.next(2)                      // 3
+//	let twice = fn(f) { f(f(0)) };
+//	twice(bind(counter.next, counter))   // 2, 即 (0 + 1) + 1
+func init() {
+	builtins["bind"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			fn, ok := args[0].(*object.Function)
+			if !ok {
+				return newError("first argument to `bind` must be FUNCTION, got %s",
+					args[0].Type())
+			}
+			self := args[1]
+			return &object.Builtin{StateFn: func(state object.State, args ...object.Object) object.Object {
+				return applyMethod(stateInterpreter(state), fn, self, args)
+			}}
+		},
+	}
+}
+
+// 方法中接收者的名字
+const SELF = "self"
+
+// 解析被调用的表达式, 为 obj.method 并且 obj 为 map 或者结构体实例时同时返回接收者
+// 接收者只求值一次
+func evalCallee(node ast.Expression, env *object.Environment) (object.Object, object.Object) {
+	dot, ok := node.(*ast.DotExpression)
+	if !ok {
+		return Eval(node, env), nil
+	}
+
+	left := Eval(dot.Left, env)
+	if isAbrupt(left) {
+		return left, nil
+	}
+	function := evalDotExpression(dot, left, env)
+	if _, ok := function.(*object.Function); !ok {
+		return function, nil
+	}
+	switch left.(type) {
+	case *object.Hash, *object.Struct:
+		return function, left
+	default:
+		return function, nil
+	}
+}
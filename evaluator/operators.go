@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 中缀运算符的求值函数
+type OperatorFunc func(left, right object.Object) object.Object
+
+// 在选项中注册中缀运算符的求值函数, 只对之后用这些选项新建的解释器有效;
+// 运算符的解析通过 parser.RegisterOperator 注册. 也可以用来替换内置运算符的求值
+//
+//	options := evaluator.DefaultOptions()
+//	options.RegisterOperator("**", func(left, right object.Object) object.Object { ... })
+//	in := evaluator.New(options)
+//
+// 每次注册都复制一份 Operators, 已经新建的解释器(以及复制了选项的其他 Options)不受影响;
+// fn 为 nil 时取消注册
+func (o *Options) RegisterOperator(symbol string, fn OperatorFunc) {
+	operators := make(map[string]OperatorFunc, len(o.Operators)+1)
+	for s, f := range o.Operators {
+		operators[s] = f
+	}
+	if fn == nil {
+		delete(operators, symbol)
+	} else {
+		operators[symbol] = fn
+	}
+	o.Operators = operators
+}
+
+// 是否注册了运算符的求值函数
+func (o *Options) HasOperator(symbol string) bool {
+	_, ok := o.Operators[symbol]
+	return ok
+}
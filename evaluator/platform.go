@@ -0,0 +1,90 @@
+package evaluator
+
+import (
+	"runtime"
+
+	"mk/object"
+)
+
+// 解释器版本
+const VERSION = "0.1.0"
+
+// 执行方式: 直接遍历语法树执行
+const BACKEND = "tree-walking"
+
+// 语言支持的特性, has_feature(name) 查询
+// 新增特性时在这里登记, 脚本可以据此兼容不同版本的解释器
+var features = map[string]bool{
+	"pipe":             true, // x |> f
+	"import":           true, // import(path)
+	"match":            true, // match (x) { ... }
+	"try":              true, // try { } catch (e: Kind) { }
+	"ternary":          true, // c ? a : b
+	"range":            true, // 1..10, 1..<10
+	"spread":           true, // f(...args), [...a]
+	"default_params":   true, // fn(x = 1) { }
+	"custom_operators": true, // 宿主通过 Options.RegisterOperator 注册的运算符
+	"decimal":          true, // 12.50d, decimal("12.50")
+	"duration":         true, // 1h30m, 500ms, 时间 ± 时长
+	"generators":       true, // yield, yield*
+	"float":            true, // float(x), IEEE 754 浮点数运算
+	"bigint":           true, // bigint(x), 任意精度的整数运算
+	"struct":           true, // struct Point { x, y }
+	"methods":          true, // obj.method(), 函数体中 self 为 obj
+}
+
+// platform()         返回 {os, arch, mk_version, backend}
+// has_builtin(name)  是否有该内置函数
+// has_feature(name)  是否支持该语言特性, 不认识的特性返回 false
+func init() {
+	builtins["platform"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			hash := newHash()
+			hashSet(hash, "os", &object.String{Value: runtime.GOOS})
+			hashSet(hash, "arch", &object.String{Value: runtime.GOARCH})
+			hashSet(hash, "mk_version", &object.String{Value: VERSION})
+			hashSet(hash, "backend", &object.String{Value: BACKEND})
+			return hash
+		},
+	}
+
+	builtins["has_builtin"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			name, err := nameArgument("has_builtin", args)
+			if err != nil {
+				return err
+			}
+			_, ok := builtins[name]
+			return nativeBoolToBooleanObject(ok)
+		},
+	}
+
+	builtins["has_feature"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			name, err := nameArgument("has_feature", args)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(features[name])
+		},
+	}
+}
+
+// 只有一个字符串参数的内置函数
+func nameArgument(builtin string, args []object.Object) (string, *object.Error) {
+	if len(args) != 1 {
+		return "", newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s",
+			builtin, args[0].Type())
+	}
+	return s.Value, nil
+}
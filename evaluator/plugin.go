@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"os"
+	"sort"
+
+	"mk/object"
+)
+
+// 加载 Go 插件: load_plugin(path, symbol)
+// 调用插件导出的 symbol 函数(ABI 见 object.PluginExports), 返回其导出的名字组成的map
+// 相对路径和 import 一样相对于当前脚本所在目录; 同一个插件只打开一次, 但每次加载都重新调用 symbol
+// 例如:
+//
+//	let ext = load_plugin("ext/double.so", "Exports");
+//	ext.double(21);    // 42
+func init() {
+	builtins["load_plugin"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			path, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `load_plugin` must be STRING, got %s",
+					args[0].Type())
+			}
+			symbol, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `load_plugin` must be STRING, got %s",
+					args[1].Type())
+			}
+			return loadPlugin(stateInterpreter(state), path.Value, symbol.Value)
+		},
+	}
+}
+
+// 打开插件并查找导出函数, 按平台实现(plugin_unix.go, plugin_other.go), 测试时替换
+var openPlugin = openGoPlugin
+
+func loadPlugin(in *Interpreter, path, symbol string) object.Object {
+	resolved, err := resolveModule(in, path)
+	if err == nil {
+		_, err = os.Stat(resolved)
+	}
+	if err != nil {
+		return newKindError(object.IOError, "load_plugin %q: %s", path, err)
+	}
+
+	exportsFn, err := openPlugin(resolved, symbol)
+	if err != nil {
+		return newKindError(object.ImportError, "load_plugin %q: %s", path, err)
+	}
+	exports, err := exportsFn()
+	if err != nil {
+		return newKindError(object.ImportError, "load_plugin %q: %s", path, err)
+	}
+
+	// 按名字排序, 结果不依赖 Go map 的遍历顺序
+	names := make([]string, 0, len(exports))
+	for name := range exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := newHash()
+	for _, name := range names {
+		value := exports[name]
+		if value == nil {
+			value = NULL
+		}
+		hashSet(hash, name, value)
+	}
+	return hash
+}
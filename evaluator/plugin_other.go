@@ -0,0 +1,14 @@
+//go:build !cgo || (!darwin && !freebsd && !linux)
+// +build !cgo !darwin,!freebsd,!linux
+
+package evaluator
+
+import (
+	"errors"
+
+	"mk/object"
+)
+
+func openGoPlugin(path, symbol string) (object.PluginExports, error) {
+	return nil, errors.New("plugins are not supported on this platform")
+}
@@ -0,0 +1,33 @@
+//go:build cgo && (darwin || freebsd || linux)
+// +build cgo
+// +build darwin freebsd linux
+
+package evaluator
+
+import (
+	"fmt"
+	"plugin"
+
+	"mk/object"
+)
+
+func openGoPlugin(path, symbol string) (object.PluginExports, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	switch fn := sym.(type) {
+	case object.PluginExports:
+		return fn, nil
+	// 导出的是这个类型的变量时得到指针
+	case *object.PluginExports:
+		return *fn, nil
+	default:
+		return nil, fmt.Errorf("symbol %s is %T, want func() (map[string]object.Object, error)", symbol, sym)
+	}
+}
@@ -0,0 +1,222 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"mk/object"
+)
+
+// 进度条和等待动画, 输出到标准错误, 标准错误不是终端时什么也不输出, 不影响重定向的输出
+//
+//	progress(total [, label])  返回 {tick, done}: tick(n) 前进 n 步(默认为1, 不超过 total),
+//	                           done() 填满进度条并换行; done 之后 tick 不再输出
+//	spinner([label])           返回 {tick, done}: tick() 转动一格, done([message]) 清除这一行,
+//	                           给出 message 时输出 message 并换行
+//
+// 例如:
+//
+//	let bar = progress(len(files), "copying");
+//	let copy = fn(f) { ...; bar.tick() };
+//	...
+//	bar.done();
+//
+// 输出形如 "copying [##########----------]  50% 5/10", 宽度按终端的列数调整
+func init() {
+	builtins["progress"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			total, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("first argument to `progress` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			if total.Value <= 0 {
+				return newError("progress total must be positive, got %d", total.Value)
+			}
+			label, err := labelArgument("progress", args[1:])
+			if err != nil {
+				return err
+			}
+			return newProgressBar(total.Value, label)
+		},
+	}
+
+	builtins["spinner"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			label, err := labelArgument("spinner", args)
+			if err != nil {
+				return err
+			}
+			return newSpinner(label)
+		},
+	}
+}
+
+// 进度条的最大宽度(不包括标签和百分比)
+const PROGRESS_BAR_WIDTH = 40
+
+// 等待动画的每一帧
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// 是否输出进度, 测试时替换
+var progressEnabled = func() bool { return isTerminal(Stderr) }
+
+// 可选的标签参数
+func labelArgument(name string, args []object.Object) (string, *object.Error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("label argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	return s.Value, nil
+}
+
+// 可选的步数参数, 默认为1
+func stepArgument(args []object.Object) (int64, *object.Error) {
+	if len(args) > 1 {
+		return 0, newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return 0, newError("argument to `tick` must be INTEGER, got %s", args[0].Type())
+	}
+	return n.Value, nil
+}
+
+func newProgressBar(total int64, label string) *object.Hash {
+	var current int64
+	finished := false
+	last := ""
+
+	// 内容没有变化时不重新输出, 避免频繁的 tick 拖慢脚本
+	render := func() {
+		line := renderProgress(label, current, total, terminalWidth())
+		if line != last {
+			fmt.Fprint(Stderr, "\r"+line)
+			last = line
+		}
+	}
+
+	tick := func(args ...object.Object) object.Object {
+		n, err := stepArgument(args)
+		if err != nil {
+			return err
+		}
+		if finished || !progressEnabled() {
+			return NULL
+		}
+		current += n
+		if current > total {
+			current = total
+		}
+		if current < 0 {
+			current = 0
+		}
+		render()
+		return NULL
+	}
+
+	done := func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0",
+				len(args))
+		}
+		if finished || !progressEnabled() {
+			return NULL
+		}
+		finished = true
+		current = total
+		render()
+		fmt.Fprintln(Stderr)
+		return NULL
+	}
+
+	hash := newHash()
+	hashSet(hash, "tick", &object.Builtin{Fn: tick})
+	hashSet(hash, "done", &object.Builtin{Fn: done})
+	return hash
+}
+
+// 一行进度, 进度条的宽度不超过 PROGRESS_BAR_WIDTH, 并且整行不超过终端的宽度
+func renderProgress(label string, current, total int64, width int) string {
+	percent := current * 100 / total
+	suffix := fmt.Sprintf(" %3d%% %d/%d", percent, current, total)
+	prefix := ""
+	if label != "" {
+		prefix = label + " "
+	}
+
+	barWidth := width - len([]rune(prefix)) - len(suffix) - 3
+	if barWidth > PROGRESS_BAR_WIDTH {
+		barWidth = PROGRESS_BAR_WIDTH
+	}
+	if barWidth < 1 {
+		return prefix + strings.TrimLeft(suffix, " ")
+	}
+
+	filled := int(current * int64(barWidth) / total)
+	return prefix + "[" + strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled) + "]" + suffix
+}
+
+func newSpinner(label string) *object.Hash {
+	frame := 0
+	finished := false
+
+	tick := func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0",
+				len(args))
+		}
+		if finished || !progressEnabled() {
+			return NULL
+		}
+		line := spinnerFrames[frame%len(spinnerFrames)]
+		if label != "" {
+			line += " " + label
+		}
+		fmt.Fprint(Stderr, "\r"+line)
+		frame++
+		return NULL
+	}
+
+	done := func(args ...object.Object) object.Object {
+		if len(args) > 1 {
+			return newError("wrong number of arguments. got=%d, want=0 or 1",
+				len(args))
+		}
+		message, err := labelArgument("done", args)
+		if err != nil {
+			return err
+		}
+		if finished || !progressEnabled() {
+			return NULL
+		}
+		finished = true
+		// 清除这一行
+		fmt.Fprint(Stderr, "\r\x1b[K")
+		if message != "" {
+			fmt.Fprintln(Stderr, message)
+		}
+		return NULL
+	}
+
+	hash := newHash()
+	hashSet(hash, "tick", &object.Builtin{Fn: tick})
+	hashSet(hash, "done", &object.Builtin{Fn: done})
+	return hash
+}
@@ -0,0 +1,358 @@
+package evaluator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"mk/object"
+)
+
+// protobuf 编解码, 供 grpc_call 使用
+// 消息的结构来自 protoc --descriptor_set_out=api.desc --include_imports 生成的描述文件(FileDescriptorSet)
+// 或者服务的反射接口(见 grpc.go), 不需要生成代码; 编解码使用 google.golang.org/protobuf 的动态消息(dynamicpb)
+//
+// map 和消息之间的对应:
+//   - 字段名为 .proto 中的名字, 编码时也可以用 json 名字(lowerCamelCase)
+//   - 整数类字段为 INTEGER, 超出 int64 的 uint64/fixed64 解码为 BIGINT; float/double 为 FLOAT
+//   - bytes 字段解码为 BYTES, 编码时也接受 STRING; 枚举解码为名字, 编码时接受名字或者整数
+//   - repeated 字段为数组, map 字段为 map(解码时按 key 排序), 消息字段为嵌套的 map
+//   - 解码时没有出现的字段为默认值(0, "", false, [], {}); 有 presence 的字段(消息, oneof,
+//     proto2 和 proto3 的 optional)没有出现时为 null
+//   - 编码时值为 null 的字段不发送, 不认识的字段名是错误; 解码时跳过不认识的字段
+
+// 已经读取的描述文件, key 为绝对路径, 不同的解释器可能同时使用
+var (
+	protoFilesMu sync.Mutex
+	protoFiles   = map[string]*protoregistry.Files{}
+)
+
+// 读取描述文件, 同一个文件只解析一次
+func loadDescriptorSet(path string) (*protoregistry.Files, error) {
+	protoFilesMu.Lock()
+	defer protoFilesMu.Unlock()
+	if files, ok := protoFiles[path]; ok {
+		return files, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %s", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %s", path, err)
+	}
+	protoFiles[path] = files
+	return files, nil
+}
+
+// "pkg.Service/Method" 对应的方法
+func findMethod(files *protoregistry.Files, method string) (protoreflect.MethodDescriptor, bool) {
+	i := strings.LastIndex(method, "/")
+	if i < 0 {
+		return nil, false
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(method[:i]))
+	if err != nil {
+		return nil, false
+	}
+	service, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, false
+	}
+	m := service.Methods().ByName(protoreflect.Name(method[i+1:]))
+	return m, m != nil
+}
+
+// 把 map 转换为 md 类型的消息
+func toProtoMessage(md protoreflect.MessageDescriptor, obj object.Object) (*dynamicpb.Message, error) {
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return nil, fmt.Errorf("%s must be HASH, got %s", md.FullName(), obj.Type())
+	}
+
+	message := dynamicpb.NewMessage(md)
+	for _, pair := range hash.Ordered() {
+		key, ok := pair.Key.(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("field names of %s must be STRING, got %s", md.FullName(), pair.Key.Type())
+		}
+		fd := md.Fields().ByName(protoreflect.Name(key.Value))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(key.Value)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("%s has no field %s", md.FullName(), key.Value)
+		}
+		if pair.Value == NULL {
+			continue
+		}
+		if err := setProtoField(message, fd, pair.Value); err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", md.FullName(), fd.Name(), err)
+		}
+	}
+	return message, nil
+}
+
+func setProtoField(message *dynamicpb.Message, fd protoreflect.FieldDescriptor, value object.Object) error {
+	switch {
+	case fd.IsMap():
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return fmt.Errorf("must be HASH, got %s", value.Type())
+		}
+		m := message.Mutable(fd).Map()
+		for _, pair := range hash.Ordered() {
+			k, err := toProtoValue(fd.MapKey(), pair.Key)
+			if err != nil {
+				return err
+			}
+			// 值为 null 时为默认值
+			v := m.NewValue()
+			if fd.MapValue().Message() == nil {
+				v = fd.MapValue().Default()
+			}
+			if pair.Value != NULL {
+				if v, err = toProtoValue(fd.MapValue(), pair.Value); err != nil {
+					return err
+				}
+			}
+			m.Set(k.MapKey(), v)
+		}
+
+	case fd.IsList():
+		array, ok := value.(*object.Array)
+		if !ok {
+			return fmt.Errorf("must be ARRAY, got %s", value.Type())
+		}
+		list := message.Mutable(fd).List()
+		for _, element := range array.Elements {
+			v, err := toProtoValue(fd, element)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+
+	default:
+		v, err := toProtoValue(fd, value)
+		if err != nil {
+			return err
+		}
+		message.Set(fd, v)
+	}
+	return nil
+}
+
+// 转换一个值, repeated 字段为其中的一个元素
+func toProtoValue(fd protoreflect.FieldDescriptor, value object.Object) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		var f float64
+		switch value := value.(type) {
+		case *object.Float:
+			f = value.Value
+		case *object.Integer:
+			f = float64(value.Value)
+		default:
+			return protoreflect.Value{}, fmt.Errorf("must be FLOAT, got %s", value.Type())
+		}
+		if fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+
+	case protoreflect.BoolKind:
+		b, ok := value.(*object.Boolean)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("must be BOOLEAN, got %s", value.Type())
+		}
+		return protoreflect.ValueOfBool(b.Value), nil
+
+	case protoreflect.StringKind:
+		s, ok := value.(*object.String)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("must be STRING, got %s", value.Type())
+		}
+		return protoreflect.ValueOfString(s.Value), nil
+
+	case protoreflect.BytesKind:
+		switch value := value.(type) {
+		case *object.Bytes:
+			return protoreflect.ValueOfBytes(value.Value), nil
+		case *object.String:
+			return protoreflect.ValueOfBytes([]byte(value.Value)), nil
+		default:
+			return protoreflect.Value{}, fmt.Errorf("must be BYTES or STRING, got %s", value.Type())
+		}
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		message, err := toProtoMessage(fd.Message(), value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfMessage(message), nil
+
+	case protoreflect.EnumKind:
+		switch value := value.(type) {
+		case *object.String:
+			v := fd.Enum().Values().ByName(protoreflect.Name(value.Value))
+			if v == nil {
+				return protoreflect.Value{}, fmt.Errorf("%s has no value %s", fd.Enum().FullName(), value.Value)
+			}
+			return protoreflect.ValueOfEnum(v.Number()), nil
+		case *object.Integer:
+			if value.Value < math.MinInt32 || value.Value > math.MaxInt32 {
+				return protoreflect.Value{}, fmt.Errorf("%d out of range for enum", value.Value)
+			}
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(value.Value)), nil
+		default:
+			return protoreflect.Value{}, fmt.Errorf("must be STRING or INTEGER, got %s", value.Type())
+		}
+	}
+
+	return toProtoInteger(fd, value)
+}
+
+// 整数类字段
+func toProtoInteger(fd protoreflect.FieldDescriptor, value object.Object) (protoreflect.Value, error) {
+	kind := fd.Kind()
+	unsigned := kind == protoreflect.Uint64Kind || kind == protoreflect.Fixed64Kind
+	var v int64
+	switch value := value.(type) {
+	case *object.Integer:
+		v = value.Value
+	case *object.BigInt:
+		// 只有 uint64 需要超出 int64 的值
+		if !unsigned || !value.Value.IsUint64() {
+			return protoreflect.Value{}, fmt.Errorf("%s out of range", value.Value)
+		}
+		return protoreflect.ValueOfUint64(value.Value.Uint64()), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("must be INTEGER, got %s", value.Type())
+	}
+
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return protoreflect.Value{}, fmt.Errorf("%d out of range for 32-bit field", v)
+		}
+		return protoreflect.ValueOfInt32(int32(v)), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if v < 0 || v > math.MaxUint32 {
+			return protoreflect.Value{}, fmt.Errorf("%d out of range for 32-bit field", v)
+		}
+		return protoreflect.ValueOfUint32(uint32(v)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if v < 0 {
+			return protoreflect.Value{}, fmt.Errorf("%d out of range", v)
+		}
+		return protoreflect.ValueOfUint64(uint64(v)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(v), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", kind)
+}
+
+// 把消息转换为 map, 字段按定义的顺序
+func fromProtoMessage(message protoreflect.Message) object.Object {
+	hash := newHash()
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		hashSet(hash, string(fd.Name()), fromProtoField(message, fd))
+	}
+	return hash
+}
+
+func fromProtoField(message protoreflect.Message, fd protoreflect.FieldDescriptor) object.Object {
+	switch {
+	case fd.IsMap():
+		// map 字段的顺序不固定, 按 key 排序
+		m := message.Get(fd).Map()
+		keys := make([]protoreflect.MapKey, 0, m.Len())
+		m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		sort.Slice(keys, func(i, j int) bool { return lessMapKey(keys[i], keys[j]) })
+		hash := newHash()
+		for _, k := range keys {
+			key := fromProtoValue(fd.MapKey(), k.Value())
+			hash.Set(key.(object.Hashable).HashKey(),
+				object.HashPair{Key: key, Value: fromProtoValue(fd.MapValue(), m.Get(k))})
+		}
+		return hash
+
+	case fd.IsList():
+		list := message.Get(fd).List()
+		elements := make([]object.Object, list.Len())
+		for i := range elements {
+			elements[i] = fromProtoValue(fd, list.Get(i))
+		}
+		return &object.Array{Elements: elements}
+
+	case fd.HasPresence() && !message.Has(fd):
+		return NULL
+	}
+	return fromProtoValue(fd, message.Get(fd))
+}
+
+// map 的 key 只能是整数, 布尔值或者字符串
+func lessMapKey(a, b protoreflect.MapKey) bool {
+	switch a.Interface().(type) {
+	case bool:
+		return !a.Bool() && b.Bool()
+	case string:
+		return a.String() < b.String()
+	case int32, int64:
+		return a.Int() < b.Int()
+	default:
+		return a.Uint() < b.Uint()
+	}
+}
+
+// 转换一个值, repeated 字段为其中的一个元素
+func fromProtoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) object.Object {
+	switch fd.Kind() {
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		return &object.Float{Value: v.Float()}
+	case protoreflect.BoolKind:
+		return nativeBoolToBooleanObject(v.Bool())
+	case protoreflect.StringKind:
+		return &object.String{Value: v.String()}
+	case protoreflect.BytesKind:
+		return &object.Bytes{Value: append([]byte{}, v.Bytes()...)}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return fromProtoMessage(v.Message())
+	case protoreflect.EnumKind:
+		// 不认识的值保留为整数; 有别名(allow_alias)时为第一个名字
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return &object.String{Value: string(value.Name())}
+		}
+		return &object.Integer{Value: int64(v.Enum())}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &object.Integer{Value: int64(v.Uint())}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if v.Uint() > math.MaxInt64 {
+			return &object.BigInt{Value: new(big.Int).SetUint64(v.Uint())}
+		}
+		return &object.Integer{Value: int64(v.Uint())}
+	}
+	return &object.Integer{Value: v.Int()}
+}
@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+
+	"mk/object"
+)
+
+// 转义, 拼接 HTML, shell 命令和 JSON 时使用, 避免注入
+//
+//	html_escape(s)    转义 < > & ' " 为实体, 结果可以放在 HTML 文本和带引号的属性值中
+//	html_unescape(s)  把实体(包括 &#39; &#x27; 等数字实体)还原为字符
+//	shell_quote(s)    加上单引号作为 POSIX shell 的一个参数, 只有安全字符时原样返回;
+//	                  参数为字符串数组时分别处理后用空格连接
+//	json_escape(s)    转义为 JSON 字符串的内容(不带两边的双引号), < > & 也被转义为 \u003c 等
+//
+// 例如:
+//
+//	html_escape("<b>Tom & Jerry</b>")   // "&lt;b&gt;Tom &amp; Jerry&lt;/b&gt;"
+//	shell_quote(["ls", "-l", "my file"]) // "ls -l 'my file'"
+//	shell_quote("it's")                  // 'it'\''s'
+func init() {
+	builtins["html_escape"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			s, err := configArg("html_escape", args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: html.EscapeString(s)}
+		},
+	}
+
+	builtins["html_unescape"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			s, err := configArg("html_unescape", args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: html.UnescapeString(s)}
+		},
+	}
+
+	builtins["shell_quote"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.String{Value: shellQuote(arg.Value)}
+			case *object.Array:
+				words := make([]string, len(arg.Elements))
+				for i, el := range arg.Elements {
+					s, ok := el.(*object.String)
+					if !ok {
+						return newError("elements of array argument to `shell_quote` must be STRING, got %s",
+							el.Type())
+					}
+					words[i] = shellQuote(s.Value)
+				}
+				return &object.String{Value: strings.Join(words, " ")}
+			default:
+				return newError("argument to `shell_quote` must be STRING or ARRAY, got %s",
+					args[0].Type())
+			}
+		},
+	}
+
+	builtins["json_escape"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			s, err := configArg("json_escape", args)
+			if err != nil {
+				return err
+			}
+			// 字符串的编码不会失败
+			b, _ := json.Marshal(s)
+			return &object.String{Value: string(b[1 : len(b)-1])}
+		},
+	}
+}
+
+// 在 shell 中不需要引号的字符
+func shellSafe(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.ContainsRune("@%+=:,./_-", c)
+}
+
+// 单引号中除了单引号本身都没有特殊含义, 单引号本身先结束引号, 转义后再开始新的引号
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(c rune) bool { return !shellSafe(c) }) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"mk/object"
+)
+
+// 执行中的 panic 转换为不可恢复的 InternalError, 保证脚本不会让宿主进程崩溃
+// 错误信息包含 panic 的值和发生 panic 的 Go 代码位置, Stack 为 panic 时的调用栈
+// 执行程序, 定时任务和 on_exit 函数的入口都经过这里, panic 时恢复解释器 in 的调用深度
+func safely(in *Interpreter, f func() object.Object) (result object.Object) {
+	frames, depth, tries := len(in.callStack), in.callDepth, in.tryDepth
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		if in.panicked == nil {
+			recordPanic(in)
+		}
+		err := newFatalError(object.InternalError, "internal error: %v", r)
+		if site := in.panicked.site; site != "" {
+			err.Message += " (at " + site + ")"
+		}
+		err.Stack = in.panicked.stack
+		in.panicked = nil
+
+		// 展开过程中没有恢复的解释器状态
+		in.callStack = in.callStack[:frames]
+		in.callDepth = depth
+		in.tryDepth = tries
+		result = err
+	}()
+
+	return f()
+}
+
+// 发生 panic 时的位置和调用栈, 由最内层的调用帧记录在解释器上(Interpreter.panicked)
+// 外层调用帧重新 panic 之后就找不到原来的位置了
+type panicRecord struct {
+	site  string
+	stack []object.StackFrame
+}
+
+// 代替 popFrame 在调用帧的 defer 中调用: 正在 panic 时记录位置和调用栈, 然后继续 panic
+func popFrameOrRecordPanic(in *Interpreter) {
+	if r := recover(); r != nil {
+		if in.panicked == nil {
+			recordPanic(in)
+		}
+		popFrame(in)
+		panic(r)
+	}
+	popFrame(in)
+}
+
+func recordPanic(in *Interpreter) {
+	in.panicked = &panicRecord{site: goPanicSite()}
+	if len(in.callStack) != 0 {
+		err := &object.Error{}
+		attachStack(in, err)
+		in.panicked.stack = err.Stack
+	}
+}
+
+// 发生 panic 的 Go 代码位置: runtime.gopanic 之后第一个不属于 runtime 的调用
+// 只保留文件所在目录和文件名, 例如 evaluator/evaluator.go:123
+func goPanicSite() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	afterPanic := false
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, "runtime.") {
+			if frame.Function == "runtime.gopanic" {
+				afterPanic = true
+			}
+		} else if afterPanic {
+			dir, file := filepath.Split(frame.File)
+			return fmt.Sprintf("%s:%d", filepath.Join(filepath.Base(dir), file), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"sort"
+	"time"
+
+	"mk/cron"
+	"mk/object"
+)
+
+// 定时任务
+//
+//	schedule(spec, fn)  按 cron 表达式定时调用 fn(), 返回任务id
+//	unschedule(id)      取消任务, 任务存在时返回 true
+//
+// 脚本执行完之后, 只要还有任务, mk run 就会继续运行事件循环(见 eventloop.go)
+func init() {
+	builtins["schedule"] = &object.Builtin{Fn: builtinSchedule}
+	builtins["unschedule"] = &object.Builtin{Fn: builtinUnschedule}
+}
+
+type job struct {
+	id   int64
+	spec *cron.Schedule
+	fn   object.Object
+	next time.Time // 下次执行的时间
+}
+
+// 已注册的任务
+var (
+	jobs      = map[int64]*job{}
+	nextJobID int64
+)
+
+// 事件循环使用的时钟, 测试时可以替换
+var (
+	timeNow   = time.Now
+	timeAfter = time.After
+)
+
+func builtinSchedule(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	spec, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `schedule` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return newError("argument to `schedule` must be FUNCTION, got %s",
+			args[1].Type())
+	}
+
+	s, err := cron.Parse(spec.Value)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	next := s.Next(timeNow())
+	if next.IsZero() {
+		return newError("cron: %q never fires", spec.Value)
+	}
+
+	nextJobID++
+	jobs[nextJobID] = &job{id: nextJobID, spec: s, fn: args[1], next: next}
+	return &object.Integer{Value: nextJobID}
+}
+
+func builtinUnschedule(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	id, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `unschedule` must be INTEGER, got %s",
+			args[0].Type())
+	}
+
+	if _, ok := jobs[id.Value]; !ok {
+		return FALSE
+	}
+	delete(jobs, id.Value)
+	return TRUE
+}
+
+// 是否还有等待执行的任务
+func HasScheduledJobs() bool {
+	return len(jobs) > 0
+}
+
+// 按下次执行的时间排序的任务列表
+func dueJobs() []*job {
+	list := make([]*job, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].next.Equal(list[b].next) {
+			return list[a].id < list[b].id
+		}
+		return list[a].next.Before(list[b].next)
+	})
+	return list
+}
@@ -0,0 +1,447 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 语义化版本(https://semver.org)
+//
+//	semver_parse(s)           解析为 {major, minor, patch, prerelease, build}, 可以带前缀 v,
+//	                          prerelease 和 build 为 "-" 和 "+" 之后的字符串, 没有时为 ""
+//	semver_cmp(a, b)          按版本优先级比较, 返回 -1, 0 或 1; build 不参与比较,
+//	                          有 prerelease 的版本低于对应的正式版本
+//	semver_satisfies(v, r)    v 是否满足范围 r, 范围的写法和 npm 相同:
+//	                          ^1.2 ~1.2.3 >=1.0.0 <2 =1.2.3 1.2.x * 以及空格(并且), ||(或者);
+//	                          有 prerelease 的版本只匹配同一个 major.minor.patch 上带 prerelease 的比较
+//
+// 例如:
+//
+//	semver_cmp("1.10.0", "1.9.3")              // 1
+//	semver_cmp("1.0.0-alpha", "1.0.0")         // -1
+//	semver_satisfies("1.4.2", "^1.2")          // true
+//	semver_satisfies("2.0.0", ">=1.0 <2 || 3") // false
+func init() {
+	builtins["semver_parse"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			v, err := semverArgument("semver_parse", args[0])
+			if err != nil {
+				return err
+			}
+
+			hash := newHash()
+			hashSet(hash, "major", &object.Integer{Value: v.major})
+			hashSet(hash, "minor", &object.Integer{Value: v.minor})
+			hashSet(hash, "patch", &object.Integer{Value: v.patch})
+			hashSet(hash, "prerelease", &object.String{Value: strings.Join(v.prerelease, ".")})
+			hashSet(hash, "build", &object.String{Value: v.build})
+			return hash
+		},
+	}
+
+	builtins["semver_cmp"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			a, err := semverArgument("semver_cmp", args[0])
+			if err != nil {
+				return err
+			}
+			b, err := semverArgument("semver_cmp", args[1])
+			if err != nil {
+				return err
+			}
+			return &object.Integer{Value: int64(a.cmp(b))}
+		},
+	}
+
+	builtins["semver_satisfies"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			v, err := semverArgument("semver_satisfies", args[0])
+			if err != nil {
+				return err
+			}
+			r, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `semver_satisfies` must be STRING, got %s",
+					args[1].Type())
+			}
+			sets, ok := parseSemverRange(r.Value)
+			if !ok {
+				return newError("invalid semver range: %q", r.Value)
+			}
+
+			for _, set := range sets {
+				if set.matches(v) {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+	}
+}
+
+type semver struct {
+	major, minor, patch int64
+	prerelease          []string
+	build               string
+}
+
+func semverArgument(name string, arg object.Object) (*semver, *object.Error) {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+	}
+	v, ok := parseSemver(s.Value)
+	if !ok {
+		return nil, newError("invalid semver: %q", s.Value)
+	}
+	return v, nil
+}
+
+// 解析完整的版本号 major.minor.patch[-prerelease][+build], 可以带前缀 v
+func parseSemver(s string) (*semver, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	v := &semver{}
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.build = s[i+1:]
+		if !validIdentifiers(v.build, false) {
+			return nil, false
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		pre := s[i+1:]
+		if !validIdentifiers(pre, true) {
+			return nil, false
+		}
+		v.prerelease = strings.Split(pre, ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	numbers := []*int64{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, ok := semverNumber(part)
+		if !ok {
+			return nil, false
+		}
+		*numbers[i] = n
+	}
+	return v, true
+}
+
+// 版本号中的数字: 非负整数, 不能有多余的前导0
+func semverNumber(s string) (int64, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// 用 . 分开的标识符, 只能包含字母, 数字和 -; prerelease 中的数字标识符不能有前导0
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		if prerelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// 按优先级比较, 返回 -1, 0 或 1
+func (v *semver) cmp(other *semver) int {
+	if c := cmpInt(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := cmpInt(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := cmpInt(v.patch, other.patch); c != 0 {
+		return c
+	}
+
+	// 没有 prerelease 的版本更高
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	// 逐个比较标识符: 数字按数值比较并且低于非数字的, 非数字按字符串比较; 前面都相同时较短的更低
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		aNum, bNum := isNumeric(a), isNumeric(b)
+		switch {
+		case aNum && bNum:
+			x, _ := strconv.ParseUint(a, 10, 64)
+			y, _ := strconv.ParseUint(b, 10, 64)
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		case a != b:
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return cmpInt(int64(len(v.prerelease)), int64(len(other.prerelease)))
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// 范围中的一个比较, 例如 >=1.2.0
+type semverComparator struct {
+	op string // =, <, >, <=, >=
+	v  *semver
+}
+
+func (c semverComparator) matches(v *semver) bool {
+	n := v.cmp(c.v)
+	switch c.op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	default:
+		return n == 0
+	}
+}
+
+// 用空格分开的比较, 需要同时满足
+type semverComparatorSet []semverComparator
+
+func (set semverComparatorSet) matches(v *semver) bool {
+	for _, c := range set {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	if len(v.prerelease) == 0 {
+		return true
+	}
+
+	// 有 prerelease 的版本只有在某个比较的版本号相同并且也带 prerelease 时才可能满足,
+	// 例如 >=1.2.3-beta 包含 1.2.3-rc.1, 但是不包含 1.3.0-alpha
+	for _, c := range set {
+		if len(c.v.prerelease) > 0 &&
+			c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析范围, 返回用 || 分开的每一组比较
+func parseSemverRange(s string) ([]semverComparatorSet, bool) {
+	sets := []semverComparatorSet{}
+	for _, part := range strings.Split(s, "||") {
+		set := semverComparatorSet{}
+		fields := strings.Fields(part)
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// 运算符和版本号之间可以有空格, 例如 ">= 1.2"
+			if strings.Trim(field, "<>=~^") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			comparators, ok := parseSemverComparator(field)
+			if !ok {
+				return nil, false
+			}
+			set = append(set, comparators...)
+		}
+		sets = append(sets, set)
+	}
+	return sets, true
+}
+
+// 部分版本号, 例如 1, 1.2, 1.2.x, 1.2.3-beta; 省略或者为 x, X, * 的部分是通配
+type partialSemver struct {
+	v     *semver
+	parts int // 给出的部分个数, 0 到 3
+}
+
+func parsePartialSemver(s string) (partialSemver, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return partialSemver{v: &semver{}}, true
+	}
+
+	pre := ""
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		pre, s = s[i:], s[:i]
+	}
+
+	numbers := []int64{0, 0, 0}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return partialSemver{}, false
+	}
+	parts := 0
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			continue
+		}
+		// 通配之后不能再有数字, 例如 1.x.3
+		n, ok := semverNumber(field)
+		if !ok || parts != i {
+			return partialSemver{}, false
+		}
+		numbers[i] = n
+		parts++
+	}
+
+	if pre != "" && parts < 3 {
+		return partialSemver{}, false
+	}
+	v, ok := parseSemver(strconv.FormatInt(numbers[0], 10) + "." +
+		strconv.FormatInt(numbers[1], 10) + "." + strconv.FormatInt(numbers[2], 10) + pre)
+	if !ok {
+		return partialSemver{}, false
+	}
+	return partialSemver{v: v, parts: parts}, true
+}
+
+// 把一个范围项展开为比较, 例如 ^1.2 为 >=1.2.0 <2.0.0-0
+func parseSemverComparator(s string) ([]semverComparator, bool) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op, s = prefix, s[len(prefix):]
+			break
+		}
+	}
+
+	p, ok := parsePartialSemver(s)
+	if !ok {
+		return nil, false
+	}
+	v := p.v
+
+	// 上界用 -0 表示, 使 <2.0.0-0 也不包含 2.0.0 的 prerelease
+	upper := func(major, minor, patch int64) semverComparator {
+		return semverComparator{op: "<", v: &semver{major: major, minor: minor, patch: patch, prerelease: []string{"0"}}}
+	}
+	lower := semverComparator{op: ">=", v: v}
+
+	// 通配的部分决定的上界
+	next := func() semverComparator {
+		if p.parts == 1 {
+			return upper(v.major+1, 0, 0)
+		}
+		return upper(v.major, v.minor+1, 0)
+	}
+
+	switch op {
+	case "^":
+		// 不改变最左边的非0部分
+		switch {
+		case v.major > 0 || p.parts <= 1:
+			return []semverComparator{lower, upper(v.major+1, 0, 0)}, true
+		case v.minor > 0 || p.parts == 2:
+			return []semverComparator{lower, upper(0, v.minor+1, 0)}, true
+		default:
+			return []semverComparator{lower, upper(0, 0, v.patch+1)}, true
+		}
+	case "~":
+		// 给出了 minor 时只允许 patch 变化, 否则允许 minor 变化
+		if p.parts <= 1 {
+			return []semverComparator{lower, upper(v.major+1, 0, 0)}, true
+		}
+		return []semverComparator{lower, upper(v.major, v.minor+1, 0)}, true
+	}
+
+	if p.parts == 0 {
+		// *, >=*: 任何版本; <*, >*: 没有版本
+		if op == "<" || op == ">" {
+			return []semverComparator{upper(0, 0, 0)}, true
+		}
+		return []semverComparator{}, true
+	}
+	if p.parts == 3 {
+		if op == "" {
+			op = "="
+		}
+		return []semverComparator{{op: op, v: v}}, true
+	}
+
+	switch op {
+	case "", "=":
+		return []semverComparator{lower, next()}, true
+	case ">=":
+		return []semverComparator{lower}, true
+	case ">":
+		// >1.2 即 >=1.3.0
+		n := next()
+		return []semverComparator{{op: ">=", v: &semver{major: n.v.major, minor: n.v.minor}}}, true
+	case "<":
+		return []semverComparator{{op: "<", v: &semver{major: v.major, minor: v.minor, prerelease: []string{"0"}}}}, true
+	default: // "<="
+		return []semverComparator{next()}, true
+	}
+}
@@ -0,0 +1,136 @@
+package evaluator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"mk/object"
+)
+
+// 序列化的值, 用于 checkpoint() 和 memo_disk() 把对象保存到文件(编码为 JSON)
+// Type 为对象的类型, 标量的值保存在 Value 中, 数组的元素保存在 Items 中, map 的 key 和 value 交替保存在 Items 中
+type serialized struct {
+	Type  object.ObjectType `json:"type"`
+	Value string            `json:"value,omitempty"`
+	Items []serialized      `json:"items,omitempty"`
+}
+
+// 可以序列化的值: 整数, 大整数, 浮点数, 小数, 字符串, 布尔值, null, 字节串, 以及由这些值组成的数组和 map
+// 其他的值(函数, 模块等)返回 false
+func serialize(obj object.Object) (serialized, bool) {
+	value := serialized{Type: obj.Type()}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		value.Value = strconv.FormatInt(obj.Value, 10)
+	case *object.Float:
+		value.Value = strconv.FormatFloat(obj.Value, 'g', -1, 64)
+	case *object.Decimal:
+		value.Value = obj.Inspect()
+	case *object.BigInt:
+		value.Value = obj.Inspect()
+	case *object.String:
+		value.Value = obj.Value
+	case *object.Boolean:
+		value.Value = strconv.FormatBool(obj.Value)
+	case *object.Null:
+	case *object.Bytes:
+		value.Value = base64.StdEncoding.EncodeToString(obj.Value)
+	case *object.Array:
+		for _, el := range obj.Elements {
+			item, ok := serialize(el)
+			if !ok {
+				return value, false
+			}
+			value.Items = append(value.Items, item)
+		}
+	case *object.Hash:
+		for _, pair := range obj.Ordered() {
+			key, ok := serialize(pair.Key)
+			if !ok {
+				return value, false
+			}
+			item, ok := serialize(pair.Value)
+			if !ok {
+				return value, false
+			}
+			value.Items = append(value.Items, key, item)
+		}
+	default:
+		return value, false
+	}
+	return value, true
+}
+
+// serialize 的逆过程
+func deserialize(value serialized) (object.Object, error) {
+	switch value.Type {
+	case object.INTEGER_OBJ:
+		n, err := strconv.ParseInt(value.Value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: n}, nil
+	case object.FLOAT_OBJ:
+		f, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Float{Value: f}, nil
+	case object.DECIMAL_OBJ:
+		d, ok := object.ParseDecimal(value.Value)
+		if !ok {
+			return nil, fmt.Errorf("invalid decimal: %q", value.Value)
+		}
+		return d, nil
+	case object.BIGINT_OBJ:
+		n, ok := new(big.Int).SetString(value.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid bigint: %q", value.Value)
+		}
+		return &object.BigInt{Value: n}, nil
+	case object.STRING_OBJ:
+		return &object.String{Value: value.Value}, nil
+	case object.BOOLEAN_OBJ:
+		return nativeBoolToBooleanObject(value.Value == "true"), nil
+	case object.NULL_OBJ:
+		return NULL, nil
+	case object.BYTES_OBJ:
+		b, err := base64.StdEncoding.DecodeString(value.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Bytes{Value: b}, nil
+	case object.ARRAY_OBJ:
+		elements := make([]object.Object, len(value.Items))
+		for i, item := range value.Items {
+			el, err := deserialize(item)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case object.HASH_OBJ:
+		hash := object.NewHash(len(value.Items) / 2)
+		for i := 0; i+1 < len(value.Items); i += 2 {
+			key, err := deserialize(value.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			item, err := deserialize(value.Items[i+1])
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashable.HashKey(), object.HashPair{Key: key, Value: item})
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("unknown type: %s", value.Type)
+	}
+}
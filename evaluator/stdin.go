@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"mk/object"
+)
+
+// 脚本的标准输入
+// 宿主可以替换为其他输入源
+var Stdin io.Reader = os.Stdin
+
+// lines() 读取标准输入剩余的所有行, 返回字符串数组(不包含换行符)
+func init() {
+	builtins["lines"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			elements := []object.Object{}
+			reader := bufio.NewReader(Stdin)
+			for {
+				line, err := reader.ReadString('\n')
+				if line != "" {
+					line = strings.TrimSuffix(line, "\n")
+					line = strings.TrimSuffix(line, "\r")
+					elements = append(elements, &object.String{Value: line})
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return newKindError(object.IOError, "read stdin: %s", err)
+				}
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// 结构体
+// struct 语句声明结构体类型, 按字段的顺序调用类型构造实例; 字段通过 . 访问, 不能修改
+// 同一类型并且字段都相等的实例相等(==); match 的分支为结构体类型时匹配该类型的所有实例
+// 例如:
+//
+//	struct Point { x, y }
+//	let p = Point(1, 2);
+//	p.x                  // 1
+//	p == Point(1, 2)     // true
+//	match (p) { Point => "point", _ => "other" }
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	name := node.Name.Value
+	if env.IsConst(name) {
+		return newError("cannot assign to constant %s", name)
+	}
+	if interpreterOf(env).Strict && env.Has(name) {
+		return newKindError(object.NameError, "%s is already declared in this scope", name)
+	}
+
+	def := &object.StructType{Name: name, Fields: make([]string, len(node.Fields))}
+	for i, field := range node.Fields {
+		def.Fields[i] = field.Value
+	}
+	return env.Set(name, def)
+}
+
+// 调用结构体类型, 构造实例
+func newStruct(in *Interpreter, def *object.StructType, args []object.Object) object.Object {
+	if len(args) != len(def.Fields) {
+		return newError("wrong number of arguments to %s. got=%d, want=%d",
+			def.Name, len(args), len(def.Fields))
+	}
+	if err := in.allocate(arraySize(int64(len(args)))); err != nil {
+		return err
+	}
+	return &object.Struct{Def: def, Values: append([]object.Object{}, args...)}
+}
+
+// 字段访问: s.name
+func structField(s *object.Struct, name string) object.Object {
+	value, ok := s.Get(name)
+	if !ok {
+		return newKindError(object.NameError, "%s has no field %s", s.Def.Name, name)
+	}
+	return value
+}
+
+// 同一类型并且字段都相等
+func structsEqual(left, right *object.Struct) bool {
+	if left.Def != right.Def {
+		return false
+	}
+	for i := range left.Values {
+		if !objectsEqual(left.Values[i], right.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// match 的分支: pattern 为结构体类型时, subject 是否为该类型的实例
+func matchesStructType(subject, pattern object.Object) bool {
+	def, ok := pattern.(*object.StructType)
+	if !ok {
+		return false
+	}
+	s, ok := subject.(*object.Struct)
+	return ok && s.Def == def
+}
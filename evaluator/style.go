@@ -0,0 +1,196 @@
+package evaluator
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 终端输出的颜色和样式
+//
+//	style(s, styles)      用 ANSI 转义序列给 s 加上样式, styles 为样式名或者样式名的数组,
+//	                      例如 "bold", ["bold", "red"], ["white", "bg_blue"]; 不输出颜色时原样返回 s
+//	terminal_width()      标准输出所在终端的列数, 不是终端时为环境变量 COLUMNS, 都没有时为 80
+//	is_tty([stream])      stream ("stdout", "stderr", "stdin", 默认为 "stdout") 是否连接到终端
+//
+// 样式名: bold dim italic underline blink reverse strike,
+// 前景色 black red green yellow blue magenta cyan white 以及加上 bright_ 前缀的亮色,
+// 背景色为前景色加上 bg_ 前缀, 例如 bg_red, bg_bright_red
+//
+// 例如:
+//
+//	puts(style("FAIL", ["bold", "red"]) + " " + name)
+//	puts("-" * terminal_width())
+const (
+	COLOR_AUTO   = "auto"   // 标准输出是终端并且没有设置 NO_COLOR 时输出颜色
+	COLOR_ALWAYS = "always" // 总是输出颜色
+	COLOR_NEVER  = "never"  // 不输出颜色, 命令行的 --no-color
+)
+
+// 是否输出颜色, 宿主设置
+var Color = COLOR_AUTO
+
+// 终端宽度的默认值
+const DEFAULT_TERMINAL_WIDTH = 80
+
+// 样式名 -> SGR 参数
+var styleCodes = map[string]int{
+	"bold":      1,
+	"dim":       2,
+	"italic":    3,
+	"underline": 4,
+	"blink":     5,
+	"reverse":   7,
+	"strike":    9,
+}
+
+// 颜色名 -> 前景色的 SGR 参数, 亮色 +60, 背景色 +10
+var colorCodes = map[string]int{
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+}
+
+func init() {
+	builtins["style"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			s, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `style` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			var names []object.Object
+			switch arg := args[1].(type) {
+			case *object.String:
+				names = []object.Object{arg}
+			case *object.Array:
+				names = arg.Elements
+			default:
+				return newError("second argument to `style` must be STRING or ARRAY, got %s",
+					args[1].Type())
+			}
+
+			codes := make([]string, 0, len(names))
+			for _, name := range names {
+				str, ok := name.(*object.String)
+				if !ok {
+					return newError("style names must be STRING, got %s", name.Type())
+				}
+				code, ok := styleCode(str.Value)
+				if !ok {
+					return newError("unknown style: %q", str.Value)
+				}
+				codes = append(codes, strconv.Itoa(code))
+			}
+
+			if len(codes) == 0 || !colorEnabled() {
+				return s
+			}
+			return &object.String{Value: "\x1b[" + strings.Join(codes, ";") + "m" + s.Value + "\x1b[0m"}
+		},
+	}
+
+	builtins["terminal_width"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			return &object.Integer{Value: int64(terminalWidth())}
+		},
+	}
+
+	builtins["is_tty"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			stream := "stdout"
+			if len(args) == 1 {
+				s, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `is_tty` must be STRING, got %s",
+						args[0].Type())
+				}
+				stream = s.Value
+			}
+
+			switch stream {
+			case "stdout":
+				return nativeBoolToBooleanObject(isTerminal(Stdout))
+			case "stderr":
+				return nativeBoolToBooleanObject(isTerminal(Stderr))
+			case "stdin":
+				return nativeBoolToBooleanObject(isTerminal(os.Stdin))
+			default:
+				return newError("unknown stream: %q, want stdout, stderr or stdin", stream)
+			}
+		},
+	}
+}
+
+// 样式名对应的 SGR 参数
+func styleCode(name string) (int, bool) {
+	if code, ok := styleCodes[name]; ok {
+		return code, true
+	}
+
+	offset := 0
+	if strings.HasPrefix(name, "bg_") {
+		offset, name = 10, name[len("bg_"):]
+	}
+	if strings.HasPrefix(name, "bright_") {
+		offset, name = offset+60, name[len("bright_"):]
+	}
+	code, ok := colorCodes[name]
+	return code + offset, ok
+}
+
+// 按 Color 的设置判断是否输出颜色, 见 https://no-color.org
+func colorEnabled() bool {
+	switch Color {
+	case COLOR_ALWAYS:
+		return true
+	case COLOR_NEVER:
+		return false
+	default:
+		return os.Getenv("NO_COLOR") == "" && isTerminal(Stdout)
+	}
+}
+
+// 是否为连接到终端的文件
+func isTerminal(w interface{}) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func terminalWidth() int {
+	if f, ok := Stdout.(*os.File); ok && isTerminal(f) {
+		if width, ok := terminalSize(f); ok {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return DEFAULT_TERMINAL_WIDTH
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package evaluator
+
+import "os"
+
+// 其他平台不查询终端, 使用 COLUMNS 或者默认宽度
+func terminalSize(f *os.File) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,198 @@
+package evaluator
+
+import (
+	"strings"
+	"sync"
+	"time"
+	// 内嵌时区数据库, 没有安装 zoneinfo 的容器中也能使用时区名
+	_ "time/tzdata"
+
+	"mk/object"
+)
+
+// 时区
+//
+//	parse_time(s, zone)  解析时间字符串, 返回 TIME; 字符串末尾可以带时区名,
+//	                     例如 "2024-01-01 10:00:00 Asia/Shanghai";
+//	                     字符串中没有时区时使用 zone, 不给出 zone 时为本地时区
+//	time_in(t, zone)     同一时刻在另一个时区中的时间, t 为 TIME 或者 parse_time 可以解析的字符串
+//	tz_offset(t)         t 所在时区相对 UTC 的偏移, 单位为秒(东为正)
+//
+// 例如:
+//
+//	let t = parse_time("2024-01-01 10:00:00", "UTC");
+//	time_in(t, "Asia/Shanghai")               // 2024-01-01 18:00:00 +08:00 CST
+//	tz_offset(time_in(t, "America/New_York")) // -18000
+func init() {
+	builtins["parse_time"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			s, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `parse_time` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			loc := time.Local
+			if len(args) == 2 {
+				zone, err := zoneArgument("parse_time", args[1])
+				if err != nil {
+					return err
+				}
+				loc = zone
+			}
+			return parseTime(s.Value, loc)
+		},
+	}
+
+	builtins["time_in"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			t, err := timeArgument("time_in", args[0])
+			if err != nil {
+				return err
+			}
+			loc, err := zoneArgument("time_in", args[1])
+			if err != nil {
+				return err
+			}
+			return &object.Time{Value: t.Value.In(loc)}
+		},
+	}
+
+	builtins["tz_offset"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			t, err := timeArgument("tz_offset", args[0])
+			if err != nil {
+				return err
+			}
+			_, offset := t.Value.Zone()
+			return &object.Integer{Value: int64(offset)}
+		},
+	}
+}
+
+// parse_time 可以解析的格式, 依次尝试
+var timeLayouts = []string{
+	object.TIME_LAYOUT,
+	"2006-01-02 15:04:05 -07:00",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// 已经加载的时区, 不同的解释器可能同时使用
+var (
+	locationsMu sync.Mutex
+	locations   = map[string]*time.Location{}
+)
+
+func loadLocation(name string) (*time.Location, bool) {
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc, true
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	locations[name] = loc
+	return loc, true
+}
+
+// 解析时间字符串, 字符串中没有时区时使用 loc
+func parseTime(s string, loc *time.Location) object.Object {
+	s = strings.TrimSpace(s)
+
+	// 末尾的时区名, 例如 "2024-01-01 10:00:00 Asia/Shanghai"
+	// 前面的部分带有偏移(-07:00)时以偏移为准
+	if i := strings.LastIndex(s, " "); i >= 0 {
+		if zone, ok := loadLocation(s[i+1:]); ok {
+			if t, ok := parseTimeLayouts(s[:i], zone); ok {
+				return &object.Time{Value: t}
+			}
+		}
+	}
+
+	if t, ok := parseTimeLayouts(s, loc); ok {
+		return &object.Time{Value: t}
+	}
+	return newError("invalid time: %q", s)
+}
+
+func parseTimeLayouts(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 时间参数: TIME, 或者 parse_time 可以解析的字符串(没有时区时为本地时区)
+func timeArgument(name string, arg object.Object) (*object.Time, *object.Error) {
+	switch arg := arg.(type) {
+	case *object.Time:
+		return arg, nil
+	case *object.String:
+		t := parseTime(arg.Value, time.Local)
+		if err, ok := t.(*object.Error); ok {
+			return nil, err
+		}
+		return t.(*object.Time), nil
+	default:
+		return nil, newError("argument to `%s` must be TIME or STRING, got %s", name, arg.Type())
+	}
+}
+
+// 时区参数: IANA 时区名, 例如 "Asia/Shanghai", "UTC", "Local"
+func zoneArgument(name string, arg object.Object) (*time.Location, *object.Error) {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return nil, newError("time zone argument to `%s` must be STRING, got %s", name, arg.Type())
+	}
+	loc, ok := loadLocation(s.Value)
+	if !ok {
+		return nil, newError("unknown time zone: %q", s.Value)
+	}
+	return loc, nil
+}
+
+// 时间的比较, 比较的是时刻, 与所在的时区无关; 两个时间相减得到时长
+func evalTimeInfixExpression(operator string, left, right *object.Time) object.Object {
+	switch operator {
+	case "-":
+		// 超出范围时 Sub 返回最大或者最小的时长
+		d := left.Value.Sub(right.Value)
+		if !right.Value.Add(d).Equal(left.Value) {
+			return durationOverflow("%s - %s", left.Inspect(), right.Inspect())
+		}
+		return newDuration(d)
+	case "==":
+		return nativeBoolToBooleanObject(left.Value.Equal(right.Value))
+	case "!=":
+		return nativeBoolToBooleanObject(!left.Value.Equal(right.Value))
+	case "<":
+		return nativeBoolToBooleanObject(left.Value.Before(right.Value))
+	case ">":
+		return nativeBoolToBooleanObject(left.Value.After(right.Value))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
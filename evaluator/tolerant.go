@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// 容错模式(Options.Tolerant), 用于 lint 和数据处理等不希望在第一个错误就停止的场景
+// 表达式产生 TolerantKinds 中类别的错误时, 在解释器上记录该错误并以 null 作为表达式的值继续执行
+// 依赖出错的值的表达式可能接着出错, 这些错误也会被记录
+// try 部分中的错误不受影响, 仍然可以被 catch 捕获; 致命错误和 exit() 不受影响
+
+// 容错模式下被替换为 null 的错误类别
+var TolerantKinds = []object.ErrorKind{
+	object.TypeError,
+	object.NameError,
+	object.IndexError,
+}
+
+// 返回并清空这个解释器在容错模式下记录的错误, 按发生的顺序排列
+func (in *Interpreter) TakeToleratedErrors() []*object.Error {
+	errs := in.tolerated
+	in.tolerated = nil
+	if errs == nil {
+		errs = []*object.Error{}
+	}
+	return errs
+}
+
+// 容错模式下把可以容忍的错误替换为 null
+// 错误没有位置时使用产生错误的节点的位置
+func tolerate(env *object.Environment, result object.Object, node ast.Node) object.Object {
+	in := interpreterOf(env)
+	if !in.Tolerant || in.tryDepth > 0 {
+		return result
+	}
+
+	err, ok := result.(*object.Error)
+	if !ok || !err.Recoverable() || !tolerable(err.Kind) {
+		return result
+	}
+
+	if err.Pos.Line == 0 {
+		err.Pos = node.Pos()
+	}
+	in.tolerated = append(in.tolerated, err)
+	return NULL
+}
+
+func tolerable(kind object.ErrorKind) bool {
+	for _, k := range TolerantKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
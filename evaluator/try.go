@@ -0,0 +1,150 @@
+package evaluator
+
+import (
+	"mk/ast"
+	"mk/object"
+)
+
+// 执行 throw 语句, 产生一个 UserError
+//
+//	throw "message";              message 为该字符串
+//	throw 42;                     message 为值的 Inspect(), value 为该值
+//	throw e;                      重新抛出 catch 到的错误, 保留原来的 kind
+//	throw {"kind": "IOError", "message": "..."}   抛出指定类型的错误
+//
+// 致命错误和 exit() 不会被捕获
+func evalThrowStatement(node *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	err := &object.Error{Kind: object.UserError, Value: val, Pos: node.Token.Pos}
+
+	switch val := val.(type) {
+	case *object.String:
+		err.Message = val.Value
+
+	case *object.Hash:
+		msg, ok := hashGet(val, "message").(*object.String)
+		if !ok {
+			err.Message = val.Inspect()
+			break
+		}
+		err.Message = msg.Value
+		if kind, ok := hashGet(val, "kind").(*object.String); ok {
+			err.Kind = object.ErrorKind(kind.Value)
+		}
+		if value := hashGet(val, "value"); value != nil {
+			err.Value = value
+		}
+
+	default:
+		err.Message = val.Inspect()
+	}
+
+	return err
+}
+
+// 执行 try 表达式
+// 值为 try 部分或者执行的 catch 部分最后一个表达式的值;
+// finally 部分总会执行, 其中的错误或者 return 会覆盖前面的结果
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	// try 部分的错误交给 catch 处理, 不受容错模式影响
+	in := interpreterOf(env)
+	in.tryDepth++
+	result := Eval(node.Block, env)
+	in.tryDepth--
+
+	if err, ok := result.(*object.Error); ok && err.Recoverable() {
+		for _, clause := range node.Catches {
+			if clause.Kind != nil && clause.Kind.Value != string(err.Kind) {
+				continue
+			}
+
+			// catch 的变量只在 catch 部分可见
+			catchEnv := object.NewEnclosedEnvironment(env)
+			catchEnv.Set(clause.Param.Value, errorToHash(err))
+			result = Eval(clause.Body, catchEnv)
+			break
+		}
+	}
+
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		if isAbrupt(final) || (final != nil && final.Type() == object.RETURN_VALUE_OBJ) {
+			return final
+		}
+	}
+
+	return result
+}
+
+// catch 到的错误: {"message", "kind", "value", "line", "column"}
+// value 为 throw 抛出的值, 内置错误为null; line/column 为 throw 的位置, 内置错误为产生错误的表达式的位置
+func errorToHash(err *object.Error) *object.Hash {
+	hash := newHash()
+	hash.IsError = true
+	hashSet(hash, "message", &object.String{Value: err.Message})
+	hashSet(hash, "kind", &object.String{Value: string(err.Kind)})
+
+	var value object.Object = NULL
+	if err.Value != nil {
+		value = err.Value
+	}
+	hashSet(hash, "value", value)
+	hashSet(hash, "line", &object.Integer{Value: int64(err.Pos.Line)})
+	hashSet(hash, "column", &object.Integer{Value: int64(err.Pos.Column)})
+	return hash
+}
+
+// 在脚本中构造和检查错误值
+//
+//	error(kind, message [, value])  构造和 catch 到的错误相同的 map, 可以直接 throw,
+//	                                 kind 可以是内置的类别(例如 "IndexError")或者自定义的类别
+//	is_error(x)                     x 是否为 error() 构造或者 catch 到的错误值,
+//	                                 形状相同的普通 map 不算
+//
+// 例如:
+//
+//	let check = fn(n) { if (n < 0) { throw error("RangeError", "negative", n) } n };
+//	try { check(-1) } catch (e: RangeError) { e.value }   // -1
+func init() {
+	builtins["error"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 2 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+
+			kind, ok := args[0].(*object.String)
+			if !ok || kind.Value == "" {
+				return newError("first argument to `error` must be a non-empty STRING, got %s",
+					args[0].Inspect())
+			}
+			msg, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `error` must be STRING, got %s",
+					args[1].Type())
+			}
+
+			err := &object.Error{Kind: object.ErrorKind(kind.Value), Message: msg.Value}
+			if len(args) == 3 {
+				err.Value = args[2]
+			}
+			return errorToHash(err)
+		},
+	}
+
+	builtins["is_error"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			hash, ok := args[0].(*object.Hash)
+			return nativeBoolToBooleanObject(ok && hash.IsError)
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package evaluator
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"mk/object"
+)
+
+// Unicode 规范化和字素簇(grapheme cluster)操作
+//
+//	normalize(s, form)              规范化, form 为 "NFC" 或 "NFD"
+//	grapheme_len(s)                 字素簇个数, "é" 和 "👍🏽" 都算一个
+//	graphemes(s)                    按字素簇拆分为字符串数组
+//	grapheme_slice(s, start [, end]) 按字素簇切片, 下标规则和 s[start:end] 相同
+//
+// 规范化使用 golang.org/x/text/unicode/norm;
+// 字素簇只处理组合字符, ZWJ 序列, 肤色修饰符, 国旗(区域指示符对) 以及 "\r\n"
+func init() {
+	builtins["normalize"] = &object.Builtin{Fn: builtinNormalize}
+	builtins["grapheme_len"] = &object.Builtin{Fn: builtinGraphemeLen}
+	builtins["graphemes"] = &object.Builtin{Fn: builtinGraphemes}
+	builtins["grapheme_slice"] = &object.Builtin{StateFn: builtinGraphemeSlice}
+}
+
+func builtinNormalize(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `normalize` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	form, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `normalize` must be STRING, got %s",
+			args[1].Type())
+	}
+
+	switch strings.ToUpper(form.Value) {
+	case "NFC":
+		return &object.String{Value: norm.NFC.String(s.Value)}
+	case "NFD":
+		return &object.String{Value: norm.NFD.String(s.Value)}
+	default:
+		return newError("unsupported normalization form: %q, want NFC or NFD",
+			form.Value)
+	}
+}
+
+func builtinGraphemeLen(args ...object.Object) object.Object {
+	s, err := graphemeArg("grapheme_len", 1, args)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(len(graphemes(s)))}
+}
+
+func builtinGraphemes(args ...object.Object) object.Object {
+	s, err := graphemeArg("graphemes", 1, args)
+	if err != nil {
+		return err
+	}
+
+	clusters := graphemes(s)
+	elements := make([]object.Object, len(clusters))
+	for i, c := range clusters {
+		elements[i] = &object.String{Value: c}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func builtinGraphemeSlice(state object.State, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3",
+			len(args))
+	}
+
+	s, err := graphemeArg("grapheme_slice", len(args), args)
+	if err != nil {
+		return err
+	}
+
+	clusters := graphemes(s)
+	length := int64(len(clusters))
+
+	bounds := []int64{0, length}
+	for i, arg := range args[1:] {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("argument to `grapheme_slice` must be INTEGER, got %s",
+				arg.Type())
+		}
+		bounds[i] = stateInterpreter(state).clampSliceBound(integer.Value, length)
+	}
+
+	start, end := bounds[0], bounds[1]
+	if start > end {
+		start = end
+	}
+	return &object.String{Value: strings.Join(clusters[start:end], "")}
+}
+
+// 检查参数个数和第一个参数的类型
+func graphemeArg(name string, want int, args []object.Object) (string, object.Object) {
+	if len(args) != want {
+		return "", newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s",
+			name, args[0].Type())
+	}
+	return s.Value, nil
+}
+
+// 按字素簇拆分字符串
+func graphemes(s string) []string {
+	clusters := []string{}
+	start := 0
+	var prev rune = -1
+	regional := 0
+
+	for i, r := range s {
+		if prev >= 0 && !graphemeBreak(prev, r, regional) {
+			if isRegionalIndicator(r) {
+				regional++
+			}
+			prev = r
+			continue
+		}
+
+		if i > start {
+			clusters = append(clusters, s[start:i])
+		}
+		start = i
+		prev = r
+		regional = 0
+		if isRegionalIndicator(r) {
+			regional = 1
+		}
+	}
+
+	if start < len(s) {
+		clusters = append(clusters, s[start:])
+	}
+	return clusters
+}
+
+// 判断 prev 和 r 之间是否是字素簇的边界
+// regional 为当前字素簇中区域指示符的个数
+func graphemeBreak(prev, r rune, regional int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case isControl(prev) || isControl(r):
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return false
+	case r == zeroWidthJoiner || prev == zeroWidthJoiner:
+		return false
+	case r >= 0x1F3FB && r <= 0x1F3FF: // 肤色修饰符
+		return false
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		// 国旗由两个区域指示符组成
+		return regional%2 == 0
+	default:
+		return true
+	}
+}
+
+const zeroWidthJoiner = 0x200D
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isControl(r rune) bool {
+	return unicode.IsControl(r)
+}
@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 查看当前环境中定义的名字
+//
+//	vars()      当前作用域中的变量, 返回 name → value 的 map
+//	vars(true)  同时包括所有外层作用域, 内层的变量遮盖外层的同名变量
+//
+// 内置函数不在环境中, 不会出现在结果里; map 中内层作用域的变量在前, 同一作用域中按名字排序, 例如在 REPL 中:
+//
+//	>> let x = 1; let f = fn() { let y = 2; [vars(), vars(true)] }; f()
+//	[{y: 2}, {y: 2, f: fn f() { ... 2 statements ... }, x: 1}]
+func init() {
+	builtins["vars"] = &object.Builtin{
+		EnvFn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			all := false
+			if len(args) == 1 {
+				b, ok := args[0].(*object.Boolean)
+				if !ok {
+					return newError("argument to `vars` must be BOOLEAN, got %s",
+						args[0].Type())
+				}
+				all = b.Value
+			}
+
+			if env == nil {
+				return newError("`vars` must be called directly, not as a callback")
+			}
+
+			result := newHash()
+			for ; env != nil; env = env.Outer() {
+				for _, name := range env.Names() {
+					// 内层已经有同名变量时跳过外层的
+					if hashGet(result, name) != nil {
+						continue
+					}
+					value, _ := env.Get(name)
+					hashSet(result, name, value)
+				}
+				if !all {
+					break
+				}
+			}
+			return result
+		},
+	}
+}
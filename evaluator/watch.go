@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"mk/object"
+)
+
+// 变量监视
+// watch(name, fn(old, new)) 在任何作用域中给名为 name 的变量赋值(let, const, 函数参数)之后调用 fn
+// old 为赋值之前可以访问到的值, 没有时为 null; unwatch(name) 移除该名字的所有监视函数
+// 监视函数出错时赋值所在的语句返回该错误; 监视函数执行期间的赋值不会再触发监视
+// 监视函数保存在调用 watch 的解释器上, 只对这个解释器中的赋值生效(见 object.SetHook)
+// 例如:
+//
+//	watch("count", fn(old, new) { puts("count: " + inspect(old) + " -> " + inspect(new)) });
+//	let count = 1;
+//	let count = count + 1;
+func init() {
+	builtins["watch"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			name, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `watch` must be STRING, got %s",
+					args[0].Type())
+			}
+			if !isCallable(args[1]) {
+				return newError("argument to `watch` must be FUNCTION, got %s",
+					args[1].Type())
+			}
+
+			fn := args[1]
+			stateInterpreter(state).Watch(name.Value, func(old, val object.Object) object.Object {
+				return applyFunction(ownerOf(fn), fn, []object.Object{old, val})
+			})
+			return NULL
+		},
+	}
+
+	builtins["unwatch"] = &object.Builtin{
+		StateFn: func(state object.State, args ...object.Object) object.Object {
+			name, err := nameArgument("unwatch", args)
+			if err != nil {
+				return err
+			}
+			stateInterpreter(state).Unwatch(name)
+			return NULL
+		},
+	}
+}
+
+// 监视函数, 返回错误时中止赋值所在的语句, 其他返回值被忽略
+type WatchFunc func(old, val object.Object) object.Object
+
+// 监视这个解释器中名为 name 的变量, REPL 的 :watch 命令也通过它实现
+func (in *Interpreter) Watch(name string, fn WatchFunc) {
+	if in.watchers == nil {
+		in.watchers = map[string][]WatchFunc{}
+	}
+	in.watchers[name] = append(in.watchers[name], fn)
+}
+
+// 移除名为 name 的变量的所有监视函数
+func (in *Interpreter) Unwatch(name string) {
+	delete(in.watchers, name)
+}
+
+// 实现 object.SetHook: 名为 name 的变量有监视函数并且不在监视函数中
+// 没有监视任何变量时只多一次 map 查找, 不影响赋值的性能
+func (in *Interpreter) Watches(name string) bool {
+	return len(in.watchers[name]) != 0 && !in.watching
+}
+
+// 实现 object.SetHook: 赋值之后依次调用监视函数
+func (in *Interpreter) OnSet(name string, old, val object.Object) object.Object {
+	if old == nil {
+		old = NULL
+	}
+
+	in.watching = true
+	defer func() { in.watching = false }()
+
+	// 复制一份, 防止监视函数在调用过程中修改监视列表
+	fns := append([]WatchFunc(nil), in.watchers[name]...)
+	for _, fn := range fns {
+		if result := fn(old, val); isAbrupt(result) {
+			return result
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package evaluator
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"mk/object"
+)
+
+// XML 的解析和简单的路径查询
+//
+//	xml_decode(s)        解析为根元素, 每个元素是 {tag, attrs, children, text} 的 map:
+//	                     attrs 为属性的 map, children 为子元素的数组,
+//	                     text 为元素直接包含的文本(去掉两边的空白); 命名空间前缀被忽略
+//	xml_find(doc, path)  按路径查找, 返回所有匹配的元素的数组:
+//	                     路径用 / 分开, 第一段匹配根元素, * 匹配任意元素,
+//	                     最后一段为 @name 时返回属性值, 为 text() 时返回文本
+//
+// 例如:
+//
+//	let doc = xml_decode("<a><b id='1'>x</b><b id='2'>y</b></a>");
+//	xml_find(doc, "a/b/@id")     // ["1", "2"]
+//	xml_find(doc, "a/b/text()")  // ["x", "y"]
+func init() {
+	builtins["xml_decode"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			s, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `xml_decode` must be STRING, got %s",
+					args[0].Type())
+			}
+			return decodeXML(s.Value)
+		},
+	}
+
+	builtins["xml_find"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			doc, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("first argument to `xml_find` must be HASH, got %s",
+					args[0].Type())
+			}
+			path, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `xml_find` must be STRING, got %s",
+					args[1].Type())
+			}
+
+			steps := strings.Split(strings.Trim(path.Value, "/"), "/")
+			for _, step := range steps {
+				if step == "" {
+					return newError("xml_find: empty step in path %q", path.Value)
+				}
+			}
+			return &object.Array{Elements: findXML([]object.Object{doc}, steps)}
+		},
+	}
+}
+
+// 解析过程中还没有结束的元素
+type xmlElement struct {
+	hash     *object.Hash
+	children []object.Object
+	text     strings.Builder
+}
+
+func (e *xmlElement) finish() *object.Hash {
+	hashSet(e.hash, "children", &object.Array{Elements: e.children})
+	hashSet(e.hash, "text", &object.String{Value: strings.TrimSpace(e.text.String())})
+	return e.hash
+}
+
+func decodeXML(s string) object.Object {
+	decoder := xml.NewDecoder(strings.NewReader(s))
+
+	var root *object.Hash
+	stack := []*xmlElement{}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return newError("xml: %s", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return newError("xml: more than one root element")
+			}
+			hash := newHash()
+			hashSet(hash, "tag", &object.String{Value: tok.Name.Local})
+			attrs := newHash()
+			for _, attr := range tok.Attr {
+				hashSet(attrs, attr.Name.Local, &object.String{Value: attr.Value})
+			}
+			hashSet(hash, "attrs", attrs)
+			stack = append(stack, &xmlElement{hash: hash, children: []object.Object{}})
+
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			hash := e.finish()
+			if len(stack) == 0 {
+				root = hash
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, hash)
+			}
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		}
+	}
+
+	if root == nil {
+		return newError("xml: no root element")
+	}
+	return root
+}
+
+// 从 nodes 开始依次匹配路径中的每一段
+func findXML(nodes []object.Object, steps []string) []object.Object {
+	for i, step := range steps {
+		last := i == len(steps)-1
+		matched := []object.Object{}
+
+		for _, node := range nodes {
+			element, ok := node.(*object.Hash)
+			if !ok {
+				continue
+			}
+
+			switch {
+			case last && strings.HasPrefix(step, "@"):
+				if attrs, ok := hashGet(element, "attrs").(*object.Hash); ok {
+					if value := hashGet(attrs, step[1:]); value != nil {
+						matched = append(matched, value)
+					}
+				}
+			case last && step == "text()":
+				if text := hashGet(element, "text"); text != nil {
+					matched = append(matched, text)
+				}
+			case i == 0:
+				// 第一段匹配根元素本身
+				if xmlTagMatches(element, step) {
+					matched = append(matched, element)
+				}
+			default:
+				children, _ := hashGet(element, "children").(*object.Array)
+				if children == nil {
+					continue
+				}
+				for _, child := range children.Elements {
+					if child, ok := child.(*object.Hash); ok && xmlTagMatches(child, step) {
+						matched = append(matched, child)
+					}
+				}
+			}
+		}
+		nodes = matched
+	}
+	return nodes
+}
+
+func xmlTagMatches(element *object.Hash, step string) bool {
+	tag, ok := hashGet(element, "tag").(*object.String)
+	return ok && (step == "*" || tag.Value == step)
+}
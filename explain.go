@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"mk/lexer"
+	"mk/parser"
+)
+
+// 解释语法
+// mk explain [--spec=standard|legacy] precedence   输出运算符优先级表
+// mk explain [--spec=standard|legacy] "<code>"     输出加上全部括号后的代码, 用于检查代码是怎样解析的
+// 代码以 '-' 开头时需要在前面加上 --, 例如 mk explain -- "-1 + 2"
+//
+//	$ mk explain "1 + 2 * 3 == 7"
+//	((1 + (2 * 3)) == 7)
+func explain(args []string) int {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	specName := flags.String("spec", "standard", "language spec: standard or legacy")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	args = flags.Args()
+
+	spec, ok := parser.LookupSpec(*specName)
+	if len(args) == 0 || !ok {
+		fmt.Fprintln(os.Stderr, `usage: mk explain [--spec=standard|legacy] precedence | mk explain "<code>"`)
+		return EXIT_USAGE
+	}
+	parser.DefaultSpec = spec
+
+	if len(args) == 1 && args[0] == "precedence" {
+		printPrecedence(os.Stdout)
+		return EXIT_OK
+	}
+
+	source := strings.Join(args, " ")
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errors := p.DetailedErrors(); len(errors) != 0 {
+		for _, err := range errors {
+			fmt.Fprintln(os.Stderr, "parser error: "+err.Format(source))
+		}
+		return EXIT_PARSE
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Println(stmt.String())
+	}
+	return EXIT_OK
+}
+
+// 运算符在优先级表中的写法
+var operatorDisplay = map[string]string{
+	"?": "? :",
+	"(": "f(x)",
+	"[": "a[i]",
+	".": "a.b",
+}
+
+// 按优先级从低到高输出运算符, 同一优先级的运算符在同一行
+// 前缀运算符不在 parser.Operators() 中, 单独作为 PREFIX 一行
+func printPrecedence(out io.Writer) {
+	type level struct {
+		precedence int
+		symbols    []string
+		assoc      string
+	}
+
+	levels := []*level{}
+	addSymbol := func(precedence int, symbol, assoc string) {
+		if len(levels) == 0 || levels[len(levels)-1].precedence != precedence {
+			levels = append(levels, &level{precedence: precedence, assoc: assoc})
+		}
+		l := levels[len(levels)-1]
+		l.symbols = append(l.symbols, symbol)
+	}
+
+	prefixDone := false
+	for _, op := range parser.Operators() {
+		if op.Precedence > parser.PREFIX && !prefixDone {
+			addSymbol(parser.PREFIX, "-x", "")
+			addSymbol(parser.PREFIX, "!x", "")
+			prefixDone = true
+		}
+
+		symbol := op.Symbol
+		if display, ok := operatorDisplay[symbol]; ok {
+			symbol = display
+		}
+		if op.Custom {
+			symbol += " (custom)"
+		}
+		addSymbol(op.Precedence, symbol, op.Associativity.String())
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tNAME\tOPERATORS\tASSOCIATIVITY")
+	for _, l := range levels {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", l.precedence, parser.PrecedenceName(l.precedence),
+			strings.Join(l.symbols, "  "), l.assoc)
+	}
+	w.Flush()
+}
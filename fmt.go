@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"mk/format"
+)
+
+// 格式化源码
+// mk fmt [-l] [-w] [file ...]
+// 没有给出文件时格式化标准输入, 结果写到标准输出
+//
+//	-l 只列出格式不规范的文件
+//	-w 把结果写回文件
+func mkfmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "usage: mk fmt [-l] [-w] <file ...>: -w needs a file")
+			return EXIT_USAGE
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+		return formatFile("<stdin>", src, *list, false)
+	}
+
+	code := EXIT_OK
+	for _, name := range flags.Args() {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = EXIT_USAGE
+			continue
+		}
+		if c := formatFile(name, src, *list, *write); c != EXIT_OK {
+			code = c
+		}
+	}
+	return code
+}
+
+// 格式化一个文件, 返回退出码
+func formatFile(name string, src []byte, list, write bool) int {
+	res, err := format.Source(src)
+	if err != nil {
+		if syntaxErr, ok := err.(*format.SyntaxError); ok {
+			for _, e := range syntaxErr.Errors {
+				fmt.Fprintln(os.Stderr, name+": parser error: "+e.Format(string(src)))
+			}
+			return EXIT_PARSE
+		}
+		fmt.Fprintln(os.Stderr, name+": "+err.Error())
+		return EXIT_RUNTIME
+	}
+
+	changed := !bytes.Equal(src, res)
+	if list && changed {
+		fmt.Println(name)
+	}
+
+	if write {
+		if changed {
+			if err := ioutil.WriteFile(name, res, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return EXIT_RUNTIME
+			}
+		}
+	} else if !list {
+		os.Stdout.Write(res)
+	}
+	return EXIT_OK
+}
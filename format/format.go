@@ -0,0 +1,407 @@
+// format 把语法树转换成规范格式的源码
+//
+// 输出保证可以重新解析, 并且得到相同的语法树(除了 token 的位置):
+//
+//	parse(format.Node(parse(src))) 和 parse(src) 相同
+//
+// 因此可以用于 mk fix, 宏以及代码生成等需要改写源码的场景
+// 缩进为4个空格, 只在需要时才加括号, 语句都以 ';' 结束(代码块的最后一个表达式除外),
+// map 字面量保持源码中键值对的顺序, 语句之间的空行最多保留一行
+// 字符串字面量中不能包含 '"' (词法分析不支持转义)
+// mk 没有注释, 所以格式化不会丢失源码中的信息
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mk/ast"
+	"mk/lexer"
+	"mk/parser"
+)
+
+// 源码有语法错误
+type SyntaxError struct {
+	Errors []*parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e.Errors[0], len(e.Errors)-1)
+}
+
+// 格式化源码, 有语法错误时返回 *SyntaxError
+// 结果以换行结束
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &SyntaxError{Errors: p.DetailedErrors()}
+	}
+
+	if len(program.Statements) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(Node(program) + "\n"), nil
+}
+
+// 缩进
+const INDENT = "    "
+
+// 单行代码块的最大长度, 超过时分多行输出
+const MAX_INLINE_BLOCK = 60
+
+// 把语法树转换成源码
+func Node(node ast.Node) string {
+	p := &printer{precedences: make(map[string]parser.OperatorInfo)}
+	for _, op := range parser.Operators() {
+		p.precedences[op.Symbol] = op
+	}
+	p.node(node)
+	return p.buf.String()
+}
+
+type printer struct {
+	buf         strings.Builder
+	indent      int
+	precedences map[string]parser.OperatorInfo
+}
+
+func (p *printer) write(s ...string) {
+	for _, str := range s {
+		p.buf.WriteString(str)
+	}
+}
+
+func (p *printer) newline() {
+	p.write("\n", strings.Repeat(INDENT, p.indent))
+}
+
+func (p *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, stmt := range node.Statements {
+			if i > 0 {
+				p.write("\n")
+				if blankLineBetween(node.Statements[i-1], stmt) {
+					p.write("\n")
+				}
+			}
+			p.statement(stmt, true)
+		}
+	case *ast.BlockStatement:
+		p.block(node)
+	case ast.Statement:
+		p.statement(node, true)
+	case ast.Expression:
+		p.expression(node)
+	}
+}
+
+// 输出语句, semicolon 为 false 时表达式语句后面不加 ';'
+func (p *printer) statement(stmt ast.Statement, semicolon bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write(stmt.Token.Literal, " ", stmt.Name.Value, " = ")
+		p.expression(stmt.Value)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.write(";")
+	case *ast.StructStatement:
+		p.write(stmt.String())
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value)
+		p.write(";")
+	case *ast.YieldStatement:
+		p.write("yield")
+		if stmt.Delegate {
+			p.write("*")
+		}
+		p.write(" ")
+		p.expression(stmt.Value)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		if semicolon {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// 输出代码块
+// 只有一条短的表达式语句时输出在一行: { x + 1 }
+// 块中最后一条表达式语句作为块的值, 后面不加 ';'
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+
+	if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok && len(block.Statements) == 1 {
+		inline := &printer{precedences: p.precedences}
+		inline.expression(stmt.Expression)
+		s := inline.buf.String()
+		if len(s) <= MAX_INLINE_BLOCK && !strings.Contains(s, "\n") {
+			p.write("{ ", s, " }")
+			return
+		}
+	}
+
+	p.write("{")
+	p.indent++
+	for i, stmt := range block.Statements {
+		if i > 0 && blankLineBetween(block.Statements[i-1], stmt) {
+			p.write("\n")
+		}
+		p.newline()
+		p.statement(stmt, i != len(block.Statements)-1)
+	}
+	p.indent--
+	p.newline()
+	p.write("}")
+}
+
+// 源码中两条语句之间是否有空行
+// 没有位置信息的语句(程序构造的语法树)之间没有空行
+func blankLineBetween(prev, next ast.Statement) bool {
+	end, pos := prev.End(), next.Pos()
+	return end.Line != 0 && pos.Line > end.Line+1
+}
+
+// 运算符的优先级, 不是运算符的表达式(字面量, 标识符等)优先级最高
+func (p *printer) precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return p.precedences[exp.Operator].Precedence
+	case *ast.PipeExpression:
+		return parser.PIPE
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.TernaryExpression:
+		return parser.TERNARY
+	case *ast.RangeExpression:
+		return parser.RANGE
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.SliceExpression, *ast.DotExpression:
+		return parser.INDEX
+	}
+	return parser.INDEX + 1
+}
+
+// 输出子表达式, 优先级低于 min 时加括号
+func (p *printer) operand(exp ast.Expression, min int) {
+	if p.precedence(exp) < min {
+		p.write("(")
+		p.expression(exp)
+		p.write(")")
+		return
+	}
+	p.expression(exp)
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		p.write(strconv.FormatInt(exp.Value, 10))
+
+	case *ast.DecimalLiteral:
+		p.write(exp.Value, "d")
+
+	case *ast.DurationLiteral:
+		p.write(exp.Value)
+
+	case *ast.StringLiteral:
+		p.write(`"`, exp.Value, `"`)
+
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.operand(exp.Right, parser.PREFIX)
+
+	// 左结合时右边同一优先级的要加括号: a - (b - c)
+	// 右结合时左边同一优先级的要加括号: (a ** b) ** c
+	case *ast.InfixExpression:
+		op := p.precedences[exp.Operator]
+		left, right := op.Precedence, op.Precedence
+		if op.Associativity == parser.ASSOC_RIGHT {
+			left++
+		} else {
+			right++
+		}
+		p.operand(exp.Left, left)
+		p.write(" ", exp.Operator, " ")
+		p.operand(exp.Right, right)
+
+	// 管道是左结合的: x |> f |> g
+	case *ast.PipeExpression:
+		p.operand(exp.Left, parser.PIPE)
+		p.write(" |> ")
+		p.operand(exp.Right, parser.PIPE+1)
+
+	case *ast.TernaryExpression:
+		p.operand(exp.Condition, parser.TERNARY+1)
+		p.write(" ? ")
+		p.expression(exp.Consequence)
+		p.write(" : ")
+		p.expression(exp.Alternative)
+
+	case *ast.RangeExpression:
+		p.operand(exp.Start, parser.RANGE+1)
+		if exp.Exclusive {
+			p.write("..<")
+		} else {
+			p.write("..")
+		}
+		p.operand(exp.Stop, parser.RANGE+1)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		for _, c := range exp.Catches {
+			p.write(" catch (", c.Param.Value)
+			if c.Kind != nil {
+				p.write(": ", c.Kind.Value)
+			}
+			p.write(") ")
+			p.block(c.Body)
+		}
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+			if def, ok := exp.Defaults[param.Value]; ok {
+				p.write(" = ")
+				p.expression(def)
+			}
+		}
+		if exp.Rest != nil {
+			if len(exp.Parameters) > 0 {
+				p.write(", ")
+			}
+			p.write("...", exp.Rest.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+
+	case *ast.CallExpression:
+		p.operand(exp.Function, parser.CALL)
+		p.write("(")
+		p.list(exp.Arguments)
+		p.write(")")
+
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.operand(exp.Value, parser.PREFIX)
+
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(exp.Elements)
+		p.write("]")
+
+	case *ast.IndexExpression:
+		p.operand(exp.Left, parser.CALL)
+		p.write("[")
+		p.expression(exp.Index)
+		p.write("]")
+
+	case *ast.SliceExpression:
+		p.operand(exp.Left, parser.CALL)
+		p.write("[")
+		if exp.Start != nil {
+			p.expression(exp.Start)
+		}
+		p.write(":")
+		if exp.Stop != nil {
+			p.expression(exp.Stop)
+		}
+		p.write("]")
+
+	case *ast.DotExpression:
+		p.operand(exp.Left, parser.CALL)
+		p.write(".", exp.Name.Value)
+
+	case *ast.HashLiteral:
+		p.hash(exp)
+
+	case *ast.MatchExpression:
+		p.write("match (")
+		p.expression(exp.Subject)
+		p.write(") {")
+		p.indent++
+		for i, arm := range exp.Arms {
+			p.newline()
+			if arm.Pattern == nil {
+				p.write("_")
+			} else {
+				p.expression(arm.Pattern)
+			}
+			p.write(" => ")
+			p.expression(arm.Body)
+			if i != len(exp.Arms)-1 {
+				p.write(",")
+			}
+		}
+		p.indent--
+		p.newline()
+		p.write("}")
+	}
+}
+
+// 逗号分隔的表达式列表
+func (p *printer) list(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(exp)
+	}
+}
+
+// map 字面量保持键值对在源码中的顺序, 重复的 key 后面的覆盖前面的
+func (p *printer) hash(hash *ast.HashLiteral) {
+	p.write("{")
+	for i, pair := range hash.Pairs {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(pair.Key)
+		p.write(": ")
+		p.expression(pair.Value)
+	}
+	p.write("}")
+}
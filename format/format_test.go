@@ -0,0 +1,149 @@
+package format
+
+import (
+	"testing"
+
+	"mk/ast"
+	"mk/ast/build"
+	"mk/lexer"
+	"mk/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestNode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;"},
+		{"a+b*c", "a + b * c;"},
+		{"(a+b)*c", "(a + b) * c;"},
+		{"a-(b-c)", "a - (b - c);"},
+		{"(a-b)-c", "a - b - c;"},
+		{"-(a+b)", "-(a + b);"},
+		{"(-a)[0]", "(-a)[0];"},
+		{"!-a", "!-a;"},
+		{"(a?b:c)?d:e", "(a ? b : c) ? d : e;"},
+		{"a?b:c?d:e", "a ? b : c ? d : e;"},
+		{"(1+2)..<n*2", "1 + 2..<n * 2;"},
+		{"x |> f(1)", "x |> f(1);"},
+		{"x|>f|>g(1)", "x |> f |> g(1);"},
+		{"x |> (y |> f)", "x |> (y |> f);"},
+		{"(x |> f)(1)", "(x |> f)(1);"},
+		{"x |> (a ? f : g)", "x |> (a ? f : g);"},
+		{`{"b": 2, "a": [1, ...xs], "b": 3}`, `{"b": 2, "a": [1, ...xs], "b": 3};`},
+		{"a[1:][:2].b(c)", "a[1:][:2].b(c);"},
+		{"let f = fn(a, b = 1, ...rest) { return a; }", "let f = fn(a, b = 1, ...rest) {\n    return a;\n};"},
+		{"fn(x) { x * 2 }", "fn(x) { x * 2 };"},
+		{"if (x < 1) { let y = x; y } else { 0 }", "if (x < 1) {\n    let y = x;\n    y\n} else { 0 };"},
+		{`try { f() } catch (e: TypeError) { 1 } finally { 2 }`, "try { f() } catch (e: TypeError) { 1 } finally { 2 };"},
+		{`match (x) { 1 => "one", _ => "many" }`, "match (x) {\n    1 => \"one\",\n    _ => \"many\"\n};"},
+		{"throw \"x\"; return 1", "throw \"x\";\nreturn 1;"},
+	}
+
+	for _, tt := range tests {
+		got := Node(parse(t, tt.input))
+		if got != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// 输出重新解析后得到相同的语法树, 并且再次格式化的结果不变
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let a = 1 + 2 + 3 * 4 * (5 + 6);",
+		"let map = fn(arr, f) { let iter = fn(arr, acc) { if (len(arr) == 0) { return acc; } else { return iter(rest(arr), push(acc, f(first(arr)))); } }; return iter(arr, []); };",
+		"a - (b - c) - -d",
+		"a == (b == c)",
+		"(1..3)[0]",
+		"let total = 12.50d * 3d - 0.05d;",
+		"let timeout = 1h30m + 500ms * 2;",
+		"let nat = fn(n) { yield n; yield* nat(n + 1); };",
+		"a ? (b ? c : d) : e",
+		"fn(x) { x }(1)(2)",
+		"f(...[1, 2], a.b[c:d])",
+		"const c = {1: {\"k\": fn() {}}, \"k\": 2, 1: 3};",
+		"try { throw {\"message\": \"m\"}; } catch (e) { e.message }",
+		"if (a) { if (b) { c } } else { match (d) { [1] => 2, _ => { 1: 2 } } }",
+		"struct Point { x, y }; struct Empty {} let p = Point(1, 2).x;",
+		"let n = [1, 2, 3] |> push(4) |> rest |> len == 3;",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		formatted := Node(program)
+		reparsed := parse(t, formatted)
+
+		if reparsed.String() != program.String() {
+			t.Errorf("round trip changed %q.\nformatted=%q\nexpected=%q\ngot=%q",
+				input, formatted, program.String(), reparsed.String())
+		}
+		if again := Node(reparsed); again != formatted {
+			t.Errorf("format not stable for %q.\nfirst=%q\nsecond=%q", input, formatted, again)
+		}
+	}
+}
+
+// 程序构造的语法树不需要括号信息
+func TestBuiltNodes(t *testing.T) {
+	node := build.Infix(build.Infix(build.Int(1), "+", build.Int(2)), "*",
+		build.Prefix("-", build.Infix(build.Ident("a"), "-", build.Ident("b"))))
+
+	if got := Node(node); got != "(1 + 2) * -(a - b)" {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let f=fn(x){\n\nlet y=x*2;\n\n\n  y+1};\n\n\nf(1)\nputs(\"a\")",
+			"let f = fn(x) {\n    let y = x * 2;\n\n    y + 1\n};\n\nf(1);\nputs(\"a\");\n"},
+		{"let a = 1; let b = 2;\nlet c = 3;", "let a = 1;\nlet b = 2;\nlet c = 3;\n"},
+		{"1|>add(2)", "1 |> add(2);\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.input, err)
+		}
+		if string(got) != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+
+		// 已经格式化的源码不变
+		again, err := Source(got)
+		if err != nil || string(again) != string(got) {
+			t.Errorf("format not stable for %q. got=%q, err=%v", tt.input, again, err)
+		}
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	_, err := Source([]byte("let = 1;\nlet x 2;"))
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected *SyntaxError, got %T (%v)", err, err)
+	}
+	if len(syntaxErr.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(syntaxErr.Errors))
+	}
+
+	expected := "line 1, column 5: expected next token to be IDENT, got = instead (and 1 more errors)"
+	if err.Error() != expected {
+		t.Errorf("wrong message. expected=%q, got=%q", expected, err.Error())
+	}
+}
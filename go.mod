@@ -1,3 +1,8 @@
 module mk
 
-go 1.13
+go 1.24
+
+require (
+	golang.org/x/text v0.21.0
+	google.golang.org/protobuf v1.36.12
+)
@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"mk/token"
 )
 
@@ -9,6 +11,8 @@ type Lexer struct {
 	readPosition int    //next character position
 	ch           byte   //current character
 	input        string //byte slice of input string
+	line         int    //line of current character, starts at 1
+	column       int    //column of current character, starts at 1
 }
 
 func New(input string) *Lexer {
@@ -18,6 +22,13 @@ func New(input string) *Lexer {
 }
 
 func (l *Lexer) readChar() {
+	// 换行之后行号加一, 列号从头开始
+	if l.ch == '\n' || l.line == 0 {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	if l.readPosition >= len(l.input) {
 		l.ch = byte(0)
 	} else {
@@ -36,20 +47,51 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// 往后查看第 n+1 个字符
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPosition+n >= len(l.input) {
+		return byte(0)
+	}
+	return l.input[l.readPosition+n]
+}
+
+// 当前位置开始的自定义运算符
+func (l *Lexer) matchOperator() (string, bool) {
+	if l.position >= len(l.input) {
+		return "", false
+	}
+	return token.MatchOperator(l.input[l.position:])
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
 
+	// 记录token开始的位置
+	pos := token.Position{Line: l.line, Column: l.column}
+
+	// 自定义运算符优先于内置的token
+	if symbol, ok := l.matchOperator(); ok {
+		for i := 0; i < len(symbol); i++ {
+			l.readChar()
+		}
+		return token.Token{Type: token.TokenType(symbol), Literal: symbol, Pos: pos}
+	}
+
 	switch l.ch {
 
-	// 以'='开头的可能是 '=' 或者 '=='
-	// 这两都是合法的token, 需要再往后探索一个字符
+	// 以'='开头的可能是 '=', '==' 或者 '=>'
+	// 这几个都是合法的token, 需要再往后探索一个字符
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -96,6 +138,35 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = l.readString()
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+
+	// '...' 用于剩余参数和展开, '..' 和 '..<' 用于区间, '.' 用于访问map成员
+	// '.' 后面紧跟数字的(例如 1.3)暂不支持
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' && l.peekCharAt(1) == '<' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.RANGE_LT, Literal: "..<"}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.RANGE, Literal: ".."}
+		} else if isDigit(l.peekChar()) {
+			tok = newToken(token.ILLEGAL, l.ch)
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 
 	// 结束
 	case byte(0):
@@ -106,16 +177,18 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
@@ -146,12 +219,75 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // 读取数字
-func (l *Lexer) readNumber() string {
+// 后面跟着小数部分和后缀 d 的(例如 12.50d, 12d)是小数字面量
+// 后面跟着时间单位的(例如 500ms, 1h30m)是时长字面量
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return string(l.input[position:l.position])
+
+	tokenType := token.TokenType(token.INT)
+	n := l.decimalSuffixLength()
+	if n > 0 {
+		tokenType = token.DECIMAL
+	} else if n = l.durationSuffixLength(); n > 0 {
+		tokenType = token.DURATION
+	}
+	for i := 0; i < n; i++ {
+		l.readChar()
+	}
+	return string(l.input[position:l.position]), tokenType
+}
+
+// 时长字面量的单位, 较长的在前面
+var durationUnits = []string{"ms", "h", "m", "s"}
+
+// 当前位置开始的时长单位以及后续的 "数字+单位" 的长度(例如 1h30m 中的 "h30m")
+// 后面紧跟着字母或数字时不是时长字面量, 返回0, 例如 2max, 1h30
+func (l *Lexer) durationSuffixLength() int {
+	i := l.position
+	for {
+		unit := ""
+		for _, u := range durationUnits {
+			if strings.HasPrefix(l.input[i:], u) {
+				unit = u
+				break
+			}
+		}
+		if unit == "" {
+			return 0
+		}
+		i += len(unit)
+
+		if i < len(l.input) && isDigit(l.input[i]) {
+			for i < len(l.input) && isDigit(l.input[i]) {
+				i++
+			}
+			continue
+		}
+		if i < len(l.input) && isLetter(l.input[i]) {
+			return 0
+		}
+		return i - l.position
+	}
+}
+
+// 当前位置开始的小数部分和后缀 d 的长度(例如 12.50d 中的 ".50d")
+// 没有后缀 d 时不是小数字面量, 返回0; 1..10 中的 ".." 不受影响
+func (l *Lexer) decimalSuffixLength() int {
+	i := l.position
+	if i+1 < len(l.input) && l.input[i] == '.' && isDigit(l.input[i+1]) {
+		i++
+		for i < len(l.input) && isDigit(l.input[i]) {
+			i++
+		}
+	}
+	if i < len(l.input) && l.input[i] == 'd' &&
+		(i+1 == len(l.input) || !isLetter(l.input[i+1]) && !isDigit(l.input[i+1])) {
+		return i + 1 - l.position
+	}
+	return 0
 }
 
 // 是否为数字
@@ -7,7 +7,7 @@ import (
 )
 
 func TestNextToken(t *testing.T) {
-	input := `let five = 5;9==9;  10==10;`
+	input := `let five = 5;9==9;  10==10; match (x) { _ => 1 } ...a 1..2 1..<n a.b`
 	tests := []struct {
 		expectedType    token.TokenType
 		expectedLiteral string
@@ -25,6 +25,27 @@ func TestNextToken(t *testing.T) {
 		{token.EQ, "=="},
 		{token.INT, "10"},
 		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "2"},
+		{token.INT, "1"},
+		{token.RANGE_LT, "..<"},
+		{token.IDENT, "n"},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
 	}
 
 	l := New(input)
@@ -41,3 +62,129 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  x + \"a\nb\";\nfoo"
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a\nb", 2, 7},
+		{";", 3, 3},
+		{"foo", 4, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong, expected=%d:%d, got=%d:%d", i,
+				tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+// 检查关键字列表和词法分析器一致
+func TestKeywords(t *testing.T) {
+	keywords := token.Keywords()
+	if len(keywords) == 0 {
+		t.Fatalf("token.Keywords() is empty")
+	}
+
+	for _, word := range keywords {
+		if !token.IsKeyword(word) {
+			t.Errorf("token.IsKeyword(%q) is false", word)
+		}
+
+		tok := New(word).NextToken()
+		if tok.Type == token.IDENT || tok.Literal != word {
+			t.Errorf("keyword %q lexed as %s(%q)", word, tok.Type, tok.Literal)
+		}
+	}
+
+	for _, name := range []string{"foo", "lets", "_", "Let"} {
+		if token.IsKeyword(name) {
+			t.Errorf("token.IsKeyword(%q) is true", name)
+		}
+	}
+}
+
+func TestDecimalLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"12.50d", []token.Token{{Type: token.DECIMAL, Literal: "12.50d"}}},
+		{"12d + 1", []token.Token{{Type: token.DECIMAL, Literal: "12d"},
+			{Type: token.PLUS, Literal: "+"}, {Type: token.INT, Literal: "1"}}},
+		{"1..3", []token.Token{{Type: token.INT, Literal: "1"},
+			{Type: token.RANGE, Literal: ".."}, {Type: token.INT, Literal: "3"}}},
+		// 没有后缀 d 的不是小数字面量
+		{"12.5", []token.Token{{Type: token.INT, Literal: "12"},
+			{Type: token.ILLEGAL, Literal: "."}, {Type: token.INT, Literal: "5"}}},
+		{"12do", []token.Token{{Type: token.INT, Literal: "12"}, {Type: token.IDENT, Literal: "do"}}},
+		{"1.5d2", []token.Token{{Type: token.INT, Literal: "1"},
+			{Type: token.ILLEGAL, Literal: "."}, {Type: token.INT, Literal: "5"}, {Type: token.IDENT, Literal: "d"},
+			{Type: token.INT, Literal: "2"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q token[%d] wrong. expected=%s(%q), got=%s(%q)",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q: expected EOF, got=%s(%q)", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestDurationLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"500ms", []token.Token{{Type: token.DURATION, Literal: "500ms"}}},
+		{"1h30m + 2s", []token.Token{{Type: token.DURATION, Literal: "1h30m"},
+			{Type: token.PLUS, Literal: "+"}, {Type: token.DURATION, Literal: "2s"}}},
+		{"1h2m3s4ms", []token.Token{{Type: token.DURATION, Literal: "1h2m3s4ms"}}},
+		{"5m)", []token.Token{{Type: token.DURATION, Literal: "5m"}, {Type: token.RPAREN, Literal: ")"}}},
+		// 后面紧跟着字母或数字时不是时长字面量
+		{"2max", []token.Token{{Type: token.INT, Literal: "2"}, {Type: token.IDENT, Literal: "max"}}},
+		{"1h30", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.IDENT, Literal: "h"},
+			{Type: token.INT, Literal: "30"}}},
+		{"3d", []token.Token{{Type: token.DECIMAL, Literal: "3d"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q token[%d] wrong. expected=%s(%q), got=%s(%q)",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q: expected EOF, got=%s(%q)", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
 
@@ -9,6 +11,41 @@ import (
 )
 
 func main() {
+	// mk run file.mk
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(run(os.Args[2:]))
+	}
+
+	// mk scan -e 'expr' file
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		os.Exit(scan(os.Args[2:]))
+	}
+
+	// mk fmt [-l] [-w] file.mk
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(mkfmt(os.Args[2:]))
+	}
+
+	// mk explain precedence | mk explain "code"
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		os.Exit(explain(os.Args[2:]))
+	}
+
+	// mk repl [--json-rpc]
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		os.Exit(startRepl(os.Args[2:]))
+	}
+
+	// mk -e 'code'
+	if len(os.Args) > 1 && os.Args[1] == "-e" {
+		os.Exit(runExpression(os.Args[2:]))
+	}
+
+	os.Exit(interactive())
+}
+
+// 交互式 REPL, 返回退出码
+func interactive() int {
 	user, err := user.Current()
 
 	if err != nil {
@@ -18,5 +55,55 @@ func main() {
 	fmt.Printf("Hello %s! This is the MK programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
 
-	repl.Start(os.Stdin, os.Stdout)
+	return repl.Start(os.Stdin, os.Stdout)
+}
+
+// mk repl [--json-rpc | --script transcript.txt [--update]]
+// --json-rpc 时通过标准输入输出和编辑器交换 JSON-RPC 消息, 见 repl.ServeJSONRPC
+// --script 时回放 REPL 的会话记录并和记录比较, 不同时退出码为1; --update 用回放的结果更新记录
+func startRepl(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	jsonRPC := flags.Bool("json-rpc", false, "serve editors over JSON-RPC on stdin/stdout")
+	script := flags.String("script", "", "replay a REPL transcript and compare the output")
+	update := flags.Bool("update", false, "with --script, rewrite the transcript with the replayed output")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 ||
+		(*jsonRPC && *script != "") || (*update && *script == "") {
+		fmt.Fprintln(os.Stderr, "usage: mk repl [--json-rpc | --script transcript.txt [--update]]")
+		return EXIT_USAGE
+	}
+
+	if *script != "" {
+		return replayTranscript(*script, *update)
+	}
+	if !*jsonRPC {
+		return interactive()
+	}
+	if err := repl.ServeJSONRPC(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_RUNTIME
+	}
+	return EXIT_OK
+}
+
+// 回放会话记录, 见 repl.RunTranscript
+func replayTranscript(path string, update bool) int {
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_USAGE
+	}
+
+	got := repl.RunTranscript(string(expected))
+	if update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_RUNTIME
+		}
+		return EXIT_OK
+	}
+	if err := repl.CompareTranscript(string(expected), got); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		return EXIT_RUNTIME
+	}
+	return EXIT_OK
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 设置了这个环境变量时测试程序作为 mk 运行, 见 runMk
+const MK_TEST_MAIN = "MK_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(MK_TEST_MAIN) == "1" {
+		os.Args = append([]string{"mk"}, os.Args[1:]...)
+		main()
+		os.Exit(EXIT_OK)
+	}
+	os.Exit(m.Run())
+}
+
+// 以 args 为命令行参数在子进程中运行 mk, stdin 为标准输入
+// 返回标准输出, 标准错误和退出码
+func runMk(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), MK_TEST_MAIN+"=1", "NO_COLOR=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	code := EXIT_OK
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running mk %s: %s", strings.Join(args, " "), err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+// 把 source 写入临时目录中的 name, 返回文件路径
+func writeScript(t *testing.T, name, source string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "mk-main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		source   string
+		args     []string
+		expected int
+	}{
+		{`let x = 1 + 2;`, nil, EXIT_OK},
+		{`1 + true`, nil, EXIT_RUNTIME},
+		{`throw "boom"`, nil, EXIT_RUNTIME},
+		{`let = 1;`, nil, EXIT_PARSE},
+		{`let f = fn(n) { f(n + 1) }; f(0)`, []string{"--max-depth=10"}, EXIT_RESOURCE},
+		{`let x = 1 + 2 + 3;`, []string{"--max-steps=2"}, EXIT_RESOURCE},
+		{`"ab" * 10000`, []string{"--max-memory=100"}, EXIT_RESOURCE},
+		{`exit(5)`, nil, 5},
+		{`exit(0); 1 + true`, nil, EXIT_OK},
+		{`let f = fn() { exit(7) }; [1, f()]`, nil, 7},
+		// exit() 不会被 try 捕获
+		{`try { exit(6) } catch (e) { 1 }`, nil, 6},
+		{`on_exit(fn() { exit(8) })`, nil, 8},
+		{`1`, []string{"--max-depth=-1"}, EXIT_USAGE},
+	}
+	for _, tt := range tests {
+		path := writeScript(t, "script.mk", tt.source)
+		args := append(append([]string{"run"}, tt.args...), path)
+		if _, stderr, code := runMk(t, "", args...); code != tt.expected {
+			t.Errorf("wrong exit code for %q %v. expected=%d, got=%d\nstderr: %s",
+				tt.source, tt.args, tt.expected, code, stderr)
+		}
+	}
+
+	// 其他入口的退出码
+	commands := []struct {
+		stdin    string
+		args     []string
+		expected int
+	}{
+		{"", []string{"-e", "exit(4)"}, 4},
+		{"", []string{"-e", "1 +"}, EXIT_PARSE},
+		{"", []string{"-e"}, EXIT_USAGE},
+		{"", []string{"run", "missing.mk"}, EXIT_USAGE},
+		{"", []string{"run"}, EXIT_USAGE},
+		{"exit(9)", []string{"run", "-"}, 9},
+		// REPL 返回 exit(n) 的退出码, 输入结束时为0
+		{"1 + 1\nexit(3)\n2\n", []string{"repl"}, 3},
+		{"1 + 1\n", []string{"repl"}, EXIT_OK},
+		{"", []string{"repl", "--bogus"}, EXIT_USAGE},
+	}
+	for _, tt := range commands {
+		if _, stderr, code := runMk(t, tt.stdin, tt.args...); code != tt.expected {
+			t.Errorf("wrong exit code for mk %v. expected=%d, got=%d\nstderr: %s",
+				tt.args, tt.expected, code, stderr)
+		}
+	}
+}
+
+// --output=json 时标准输出只有一个 JSON 文档, 脚本的输出在 stdout 字段中
+func TestJSONOutput(t *testing.T) {
+	path := writeScript(t, "script.mk", `puts("hello"); puts(1 + 1); 3`)
+	stdout, stderr, code := runMk(t, "", "run", "--output=json", path)
+	if code != EXIT_OK {
+		t.Fatalf("wrong exit code. expected=%d, got=%d\nstderr: %s", EXIT_OK, code, stderr)
+	}
+
+	var report struct {
+		Result int    `json:"result"`
+		Stdout string `json:"stdout"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("stdout is not a single JSON document: %s\n%s", err, stdout)
+	}
+	if report.Result != 3 || report.Stdout != "hello\n2\n" {
+		t.Errorf("wrong report. got=%+v", report)
+	}
+
+	// 文本模式下照常输出到标准输出
+	if stdout, _, _ := runMk(t, "", "run", path); stdout != "hello\n2\n" {
+		t.Errorf("wrong text output. got=%q", stdout)
+	}
+}
@@ -0,0 +1,18 @@
+package object
+
+import "math/big"
+
+// 任意精度的整数, 由 bigint(x) 构造, 运算不会像 INTEGER 一样在 64 位溢出
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+
+// 十进制写法, 例如 340282366920938463463374607431768211456
+func (b *BigInt) Inspect() string { return b.Value.String() }
+
+func (b *BigInt) HashKey() HashKey {
+	text := b.Value.String()
+	return HashKey{Type: b.Type(), Value: hashString(text), Text: text}
+}
@@ -0,0 +1,42 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 字节串, 保存任意的二进制数据
+// 和 String 不同, 不要求是合法的 UTF-8, 下标和长度都按字节计算
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+
+// 可打印的 ASCII 字符原样输出, 其他字节为 \xNN, 例如 b"GIF89a\x01\x00"
+func (b *Bytes) Inspect() string {
+	var out strings.Builder
+	out.WriteString(`b"`)
+	for _, c := range b.Value {
+		switch {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			out.WriteByte(c)
+		default:
+			out.WriteString(`\x`)
+			if c < 0x10 {
+				out.WriteByte('0')
+			}
+			out.WriteString(strconv.FormatUint(uint64(c), 16))
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+func (b *Bytes) HashKey() HashKey {
+	text := string(b.Value)
+	return HashKey{Type: b.Type(), Value: hashString(text), Text: text}
+}
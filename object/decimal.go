@@ -0,0 +1,103 @@
+package object
+
+import (
+	"math/big"
+	"strings"
+)
+
+// 任意精度的十进制小数, 用于金额等不能有误差的计算
+// 值为 Value × 10^-Scale, 例如 12.50 为 Value=1250, Scale=2
+// Scale 记录小数位数, 所以 12.5 和 12.50 的显示不同, 但是比较和作为 map 的 key 时相等
+type Decimal struct {
+	Value *big.Int
+	Scale int
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+// 按小数位数输出, 例如 12.50, -0.05, 3
+func (d *Decimal) Inspect() string {
+	digits := new(big.Int).Abs(d.Value).String()
+	sign := ""
+	if d.Value.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", -d.Scale)
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - d.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// 去掉小数部分末尾的0之后计算, 相等的小数有相同的 key
+func (d *Decimal) HashKey() HashKey {
+	text := d.Normalize().Inspect()
+	return HashKey{Type: d.Type(), Value: hashString(text), Text: text}
+}
+
+// 去掉小数部分末尾的0, 例如 12.50 变为 12.5
+func (d *Decimal) Normalize() *Decimal {
+	value, scale := new(big.Int).Set(d.Value), d.Scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > 0 && value.Sign() != 0 {
+		q, m := new(big.Int).QuoRem(value, ten, r)
+		if m.Sign() != 0 {
+			break
+		}
+		value, scale = q, scale-1
+	}
+	if value.Sign() == 0 {
+		scale = 0
+	}
+	return &Decimal{Value: value, Scale: scale}
+}
+
+// 转换成 scale 位小数, scale 不能小于 d.Scale
+func (d *Decimal) Rescale(scale int) *big.Int {
+	if scale == d.Scale {
+		return d.Value
+	}
+	return new(big.Int).Mul(d.Value, Pow10(scale-d.Scale))
+}
+
+// 比较大小, 返回 -1, 0 或 1
+func (d *Decimal) Cmp(other *Decimal) int {
+	scale := d.Scale
+	if other.Scale > scale {
+		scale = other.Scale
+	}
+	return d.Rescale(scale).Cmp(other.Rescale(scale))
+}
+
+// 解析十进制小数, 例如 "12.50", "-3", "+0.001"; 不支持指数
+func ParseDecimal(s string) (*Decimal, bool) {
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+		if fracPart == "" {
+			return nil, false
+		}
+	}
+	if intPart == "" || strings.Trim(intPart+fracPart, "0123456789") != "" {
+		return nil, false
+	}
+
+	value, ok := new(big.Int).SetString(sign+intPart+fracPart, 10)
+	if !ok {
+		return nil, false
+	}
+	return &Decimal{Value: value, Scale: len(fracPart)}, true
+}
+
+// 10 的 n 次方
+func Pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
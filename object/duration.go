@@ -0,0 +1,72 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时长, 精度为毫秒
+// 两个时间相减得到时长, 时间加减时长得到新的时间
+type Duration struct {
+	Value time.Duration
+}
+
+func (d *Duration) Type() ObjectType { return DURATION_OBJ }
+
+// 和字面量的写法相同, 例如 1h30m, 500ms, 0s
+func (d *Duration) Inspect() string {
+	return formatDuration(d.Value, "")
+}
+
+// 只保留最大的两个单位并用空格分开, 例如 2h 3m, 45s, 1s 500ms
+func (d *Duration) Humanize() string {
+	return formatDuration(d.Value, " ")
+}
+
+func (d *Duration) HashKey() HashKey {
+	return HashKey{Type: d.Type(), Value: uint64(d.Value)}
+}
+
+// 时长的单位, 从大到小
+var durationUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// sep 为空时输出所有不为0的单位, 否则只输出最大的两个单位
+func formatDuration(value time.Duration, sep string) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	parts := []string{}
+	first := -1 // 第一个不为0的单位
+	for i, unit := range durationUnits {
+		// 简略输出时只看最大的单位和它的下一个单位, 例如 2h0m5s 输出 2h
+		if sep != "" && first >= 0 && i > first+1 {
+			break
+		}
+
+		n := value / unit.size
+		value -= n * unit.size
+		if n == 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		parts = append(parts, strconv.FormatInt(int64(n), 10)+unit.name)
+	}
+	if len(parts) == 0 {
+		return "0s"
+	}
+	return sign + strings.Join(parts, sep)
+}
@@ -1,12 +1,20 @@
 package object
 
-import ()
+import (
+	"sort"
+)
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool // 用 const 声明的名字
+	outer  *Environment
+	state  State // 所属的解释器, 内层环境继承外层的
 }
 
+// 执行状态(解释器), 由 evaluator 定义和使用, object 包只负责保存和传递
+// 每次执行各自有一份, 同一次执行中创建的环境共享同一份, 见 evaluator.Interpreter
+type State interface{}
+
 // 一个环境就是一个map
 // 用于一个key 和 一个 object 进行关联
 func NewEnvironment() *Environment {
@@ -20,6 +28,7 @@ func NewEnvironment() *Environment {
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.state = outer.state
 	return env
 }
 
@@ -32,8 +41,85 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// 变量赋值的钩子, 由环境所属的执行状态实现, 用于实现 watch
+// Watches(name) 为 true 时 Set 在赋值之后调用 OnSet, old 为赋值之前可以访问到的值(包括外层环境), 没有时为 nil;
+// OnSet 返回非 nil 时作为 Set 的返回值, 用于把监视函数的错误交给赋值语句
+type SetHook interface {
+	Watches(name string) bool
+	OnSet(name string, old, val Object) Object
+}
+
 // set
 func (e *Environment) Set(name string, val Object) Object {
+	hook, ok := e.state.(SetHook)
+	if !ok || !hook.Watches(name) {
+		e.store[name] = val
+		return val
+	}
+
+	old, _ := e.Get(name)
 	e.store[name] = val
+	if result := hook.OnSet(name, old, val); result != nil {
+		return result
+	}
 	return val
 }
+
+// 设置不可再赋值的名字
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+// 名字是否在当前环境中声明过(不查找外层环境)
+func (e *Environment) Has(name string) bool {
+	_, ok := e.store[name]
+	return ok
+}
+
+// 名字是否在当前环境中被声明为 const
+// 不查找外层环境: 内层环境中可以用同名变量遮盖外层的 const
+func (e *Environment) IsConst(name string) bool {
+	return e.consts[name]
+}
+
+// 当前环境中的所有名字(不包括外层环境), 按名字排序
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 外层环境, 最外层时为 nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// 所属的解释器, 没有设置过时为 nil
+func (e *Environment) State() State {
+	return e.state
+}
+
+// 设置所属的解释器, 之后在其中新建的内层环境同样属于它
+func (e *Environment) SetState(state State) {
+	e.state = state
+}
+
+// 清空环境, 以 outer 为外层环境重新使用
+func (e *Environment) Reset(outer *Environment) {
+	for name := range e.store {
+		delete(e.store, name)
+	}
+	e.consts = nil
+	e.outer = outer
+	e.state = nil
+	if outer != nil {
+		e.state = outer.state
+	}
+}
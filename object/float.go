@@ -0,0 +1,44 @@
+package object
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 64位浮点数, 按 IEEE 754 运算: 除以0得到 Inf 或 NaN, NaN 和任何值(包括自己)都不相等
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// 能精确还原该值的最短写法, 整数值带 .0 以便和整数区分, 例如 0.1, 2.0, 1e+21, Inf, -Inf, NaN
+func (f *Float) Inspect() string {
+	switch {
+	case math.IsNaN(f.Value):
+		return "NaN"
+	case math.IsInf(f.Value, 1):
+		return "Inf"
+	case math.IsInf(f.Value, -1):
+		return "-Inf"
+	}
+
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// 0 和 -0 相等, 所以有相同的 key; 所有的 NaN 也使用同一个 key
+func (f *Float) HashKey() HashKey {
+	v := f.Value
+	switch {
+	case v == 0:
+		v = 0
+	case math.IsNaN(v):
+		v = math.NaN()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(v)}
+}
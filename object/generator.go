@@ -0,0 +1,16 @@
+package object
+
+// 生成器: 调用含有 yield 的函数得到, 每次 Next 执行到下一个 yield
+// 具体的执行方式由 evaluator 提供
+type Generator struct {
+	Name string                // 函数名, 匿名函数为空
+	Next func() (Object, bool) // 下一个值, 函数执行完之后 ok 为 false
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string {
+	if g.Name == "" {
+		return "generator <anonymous>"
+	}
+	return "generator " + g.Name
+}
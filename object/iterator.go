@@ -0,0 +1,88 @@
+package object
+
+import "unicode/utf8"
+
+// 迭代协议
+// 展开(...x), yield* 和 take 等依次取值的地方都通过 Iterable 取值, 不再对每种类型分别处理
+//
+//	数组      依次为每个元素
+//	map       依次为每个 key, 顺序和插入的顺序相同
+//	字符串    依次为每个字符(Unicode 码点)组成的字符串
+//	区间      依次为每个整数
+//	生成器    依次为每个交出的值, 取过的值不会再取到
+//
+// 除了生成器之外, 每次 Iter 都从头开始, 并且迭代的是调用 Iter 时的内容
+
+// 可以依次取值的对象
+type Iterable interface {
+	Iter() Iterator
+}
+
+// 迭代器, 没有更多的值时 ok 为 false
+// 生成器中出错时取到的值为 *Error, 由取值的一方处理
+type Iterator interface {
+	Next() (Object, bool)
+}
+
+// 提前知道元素个数的可迭代对象, 取值的一方可以在取值之前检查内存限制
+// 区间实现了它, 见 Range.Len
+type Sized interface {
+	Iterable
+	Len() int64
+}
+
+// 用函数实现的迭代器
+type IteratorFunc func() (Object, bool)
+
+func (f IteratorFunc) Next() (Object, bool) { return f() }
+
+func (ao *Array) Iter() Iterator {
+	elements, i := ao.Elements, 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(elements) {
+			return nil, false
+		}
+		i++
+		return elements[i-1], true
+	})
+}
+
+func (h *Hash) Iter() Iterator {
+	pairs, i := h.Ordered(), 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(pairs) {
+			return nil, false
+		}
+		i++
+		return pairs[i-1].Key, true
+	})
+}
+
+func (s *String) Iter() Iterator {
+	value := s.Value
+	return IteratorFunc(func() (Object, bool) {
+		if value == "" {
+			return nil, false
+		}
+		_, size := utf8.DecodeRuneInString(value)
+		c := value[:size]
+		value = value[size:]
+		return &String{Value: c}, true
+	})
+}
+
+func (r *Range) Iter() Iterator {
+	i := int64(0)
+	return IteratorFunc(func() (Object, bool) {
+		n, ok := r.At(i)
+		if !ok {
+			return nil, false
+		}
+		i++
+		return &Integer{Value: n}, true
+	})
+}
+
+func (g *Generator) Iter() Iterator {
+	return IteratorFunc(g.Next)
+}
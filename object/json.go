@@ -0,0 +1,105 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// 把对象转换为可以用 encoding/json 编码的 Go 值
+// integer -> number, decimal, bigint -> number(保留全部位数), string -> string, boolean -> bool, null -> null,
+// array -> array, hash -> object (按插入顺序输出, 非字符串的key使用 Inspect() 的结果), struct -> object(按字段顺序),
+// 其他类型(函数等)使用 Inspect() 的结果
+func ToJSONValue(obj Object) interface{} {
+	switch obj := obj.(type) {
+
+	case nil:
+		return nil
+
+	case *Null:
+		return nil
+
+	case *Integer:
+		return obj.Value
+
+	case *Decimal:
+		return json.Number(obj.Inspect())
+
+	case *BigInt:
+		return json.Number(obj.Inspect())
+
+	case *Boolean:
+		return obj.Value
+
+	case *String:
+		return obj.Value
+
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = ToJSONValue(e)
+		}
+		return elements
+
+	case *Struct:
+		fields := jsonObject{index: make(map[string]int, len(obj.Values))}
+		for i, value := range obj.Values {
+			fields.set(obj.Def.Fields[i], ToJSONValue(value))
+		}
+		return fields
+
+	case *Hash:
+		fields := jsonObject{index: make(map[string]int, obj.Len())}
+		for _, pair := range obj.Ordered() {
+			key := pair.Key.Inspect()
+			if s, ok := pair.Key.(*String); ok {
+				key = s.Value
+			}
+			fields.set(key, ToJSONValue(pair.Value))
+		}
+		return fields
+
+	default:
+		return obj.Inspect()
+	}
+}
+
+// 按插入顺序编码的 JSON 对象
+// 不同的 key 转换之后可能相同(例如 1 和 "1"), 这时后面的值覆盖前面的
+type jsonObject struct {
+	keys   []string
+	values []interface{}
+	index  map[string]int
+}
+
+func (o *jsonObject) set(key string, value interface{}) {
+	if i, ok := o.index[key]; ok {
+		o.values[i] = value
+		return
+	}
+	o.index[key] = len(o.keys)
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Write(k)
+		out.WriteByte(':')
+		out.Write(v)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
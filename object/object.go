@@ -3,10 +3,11 @@ package object
 import (
 	"bytes"
 	"fmt"
-	"hash/fnv"
 	"strings"
+	"sync/atomic"
 
 	"mk/ast"
+	"mk/token"
 )
 
 const (
@@ -20,6 +21,19 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"      // buildin function
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	MACHINE_OBJ      = "MACHINE"     // 状态机
+	EXIT_OBJ         = "EXIT"        // exit(n)
+	RANGE_OBJ        = "RANGE"       // 区间
+	EXTERNAL_OBJ     = "EXTERNAL"    // 宿主提供的 Go 值
+	DECIMAL_OBJ      = "DECIMAL"     // 小数
+	TIME_OBJ         = "TIME"        // 带时区的时间
+	DURATION_OBJ     = "DURATION"    // 时长
+	GENERATOR_OBJ    = "GENERATOR"   // 生成器
+	FLOAT_OBJ        = "FLOAT"       // 浮点数
+	BYTES_OBJ        = "BYTES"       // 字节串
+	BIGINT_OBJ       = "BIGINT"      // 任意精度的整数
+	STRUCT_TYPE_OBJ  = "STRUCT_TYPE" // 结构体类型
+	STRUCT_OBJ       = "STRUCT"      // 结构体实例
 )
 
 type ObjectType string
@@ -77,21 +91,104 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// 错误类别
+type ErrorKind string
+
+const (
+	TypeError   ErrorKind = "TypeError"   // 类型不匹配, 不支持的操作, 参数错误
+	NameError   ErrorKind = "NameError"   // 标识符未定义
+	IndexError  ErrorKind = "IndexError"  // 下标/key 不可用
+	IOError     ErrorKind = "IOError"     // 读写文件, 网络等错误
+	UserError   ErrorKind = "UserError"   // 脚本主动抛出的错误
+	ImportError ErrorKind = "ImportError" // 模块有语法错误或者循环导入
+
+	ArithmeticError ErrorKind = "ArithmeticError" // 除以0等算术错误
+
+	InternalError ErrorKind = "InternalError" // 解释器内部错误
+	ResourceError ErrorKind = "ResourceError" // 超出资源限制
+)
+
 // 错误类型
+// Fatal 为 true 的错误不可恢复(内部状态错误, 宿主要求不可恢复的资源限制等),
+// 脚本中的错误处理不能捕获, 只能一直上抛到宿主
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Fatal   bool
+	Value   Object         // throw 抛出的值, 其他错误为nil
+	Pos     token.Position // throw 的位置, 其他错误为产生错误的表达式的位置(由 evaluator.Eval 记录)
+	Stack   []StackFrame   // 出错时的调用栈, 最内层的调用在前; 不是在函数中出错时为空
+}
+
+// 调用栈中的一帧
+type StackFrame struct {
+	Name string         // 函数名, 匿名函数为 <anonymous>
+	Pos  token.Position // 调用处的位置
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Fatal {
+		return "FATAL: " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// 是否可以被脚本捕获
+func (e *Error) Recoverable() bool { return !e.Fatal }
+
+// 实现 error 接口, 方便宿主把执行结果作为 Go 的错误返回
+func (e *Error) Error() string { return e.Inspect() }
+
+// 调用栈, 每一帧一行(缩进4个空格), 最内层的调用在前; 没有调用栈时为空字符串
+// 连续相同的帧(递归)只输出一次, 后面注明重复的次数
+//
+//	at inner (line 2, column 5)
+//	at outer (line 5, column 1)
+//	... repeated 99 more times
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+	for i := 0; i < len(e.Stack); i++ {
+		f := e.Stack[i]
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "    at %s (line %d, column %d)", f.Name, f.Pos.Line, f.Pos.Column)
+
+		repeated := 0
+		for i+1 < len(e.Stack) && e.Stack[i+1] == f {
+			repeated++
+			i++
+		}
+		if repeated > 0 {
+			fmt.Fprintf(&out, "\n    ... repeated %d more times", repeated)
+		}
+	}
+	return out.String()
+}
+
+// 退出
+// 由 exit(n) 产生, 和错误一样一直上抛到最外层, 由宿主决定如何退出
+type Exit struct {
+	Code int64
+}
+
+func (e *Exit) Type() ObjectType { return EXIT_OBJ }
+func (e *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", e.Code) }
+func (e *Exit) Error() string    { return e.Inspect() }
 
 // 函数类型
 // 因为该语音支持闭包
 // 所以需要带上函数定义时的环境
 type Function struct {
-	Parameters []*ast.Identifier   //语法树里面的变量
-	Body       *ast.BlockStatement //语法树里面的方法体
-	Env        *Environment        //函数定义时的环境
+	Name       string                    //通过 let 绑定时的名字, 匿名函数为空
+	Parameters []*ast.Identifier         //语法树里面的变量
+	Defaults   map[string]ast.Expression //参数默认值
+	Rest       *ast.Identifier           //剩余参数
+	Body       *ast.BlockStatement       //语法树里面的方法体
+	Env        *Environment              //函数定义时的环境
+	Pooled     bool                      //调用结束后运行时环境可以放回池中, 见 evaluator/escape.go
+	Generator  bool                      //函数体中有 yield, 调用时返回生成器, 见 evaluator/generator.go
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -100,12 +197,36 @@ func (f *Function) Inspect() string {
 	params := []string{}
 
 	for _, p := range f.Parameters {
-		params = append(params, p.String())
+		if def, ok := f.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
+
+	// 默认只输出签名, 避免大的闭包刷屏
+	if !VerboseInspect {
+		switch n := len(f.Body.Statements); n {
+		case 0:
+			out.WriteString(") { }")
+		case 1:
+			out.WriteString(") { ... 1 statement ... }")
+		default:
+			out.WriteString(fmt.Sprintf(") { ... %d statements ... }", n))
+		}
+		return out.String()
+	}
+
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -113,24 +234,57 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// 为 true 时 Function.Inspect 输出完整的函数体
+var VerboseInspect = false
+
 // 字符串
+// 字符串是不可变的, HashKey 第一次计算之后缓存在 hash 中
+// 同一个字符串可能在不同的 goroutine 中同时使用(例如共享的模块和字面量), hash 只用原子操作读写;
+// 为0时还没有计算, 计算结果恰好为0时每次重新计算, 结果仍然正确
 type String struct {
+	hash uint64 // 放在第一个字段, 保证 32 位平台上原子操作需要的 8 字节对齐
+
 	Value string
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	hash := atomic.LoadUint64(&s.hash)
+	if hash == 0 {
+		hash = hashString(s.Value)
+		atomic.StoreUint64(&s.hash, hash)
+	}
+	return HashKey{Type: STRING_OBJ, Value: hash, Text: s.Value}
+}
+
+// FNV-1a, 和 hash/fnv 的 New64a 结果相同, 但是不需要分配内存
+func hashString(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
 }
 
 // 内置函数
+// EnvFn 用于需要访问调用处环境的内置函数(例如 breakpoint)
+// 非调用表达式直接调用(例如作为回调)时 env 为 nil
+// StateFn 用于需要调用方的执行状态的内置函数(例如检查内存限制, 调用回调函数),
+// 作为回调调用时同样可以取得, 见 State
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn      BuiltinFunction
+	EnvFn   EnvBuiltinFunction
+	StateFn StateBuiltinFunction
 }
 type BuiltinFunction func(args ...Object) Object
+type EnvBuiltinFunction func(env *Environment, args ...Object) Object
+type StateBuiltinFunction func(state State, args ...Object) Object
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin funciton" }
@@ -153,10 +307,50 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// 区间
+// 不会生成所有元素, 下标访问和长度都是直接计算的
+// 结束值小于开始值时为空区间
+type Range struct {
+	Start     int64
+	End       int64
+	Exclusive bool // 是否不包含结束值
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Exclusive {
+		return fmt.Sprintf("%d..<%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
+
+// 区间中元素的个数
+func (r *Range) Len() int64 {
+	n := r.End - r.Start
+	if !r.Exclusive {
+		n++
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// 第i个元素, 越界时ok为false
+func (r *Range) At(i int64) (int64, bool) {
+	if i < 0 || i >= r.Len() {
+		return 0, false
+	}
+	return r.Start + i, true
+}
+
 // 用于Hash.Pairs中的key
+// 字符串, 字节串和小数的 Value 只是 64 位的 hash, 不同的值可能相同,
+// 所以同时在 Text 中保存原始的内容, 比较 key 时 Text 也要相等, 冲突的 key 不会互相覆盖
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
+	Text  string
 }
 
 // 单个的 k - v 对
@@ -166,8 +360,58 @@ type HashPair struct {
 }
 
 // map 类型
+// 按插入的顺序遍历: Keys 记录 key 第一次插入的顺序, 覆盖已有的 key 时位置不变
+// 修改时使用 Set 和 Delete, 不要直接修改 Pairs, 否则 Keys 和 Pairs 会不一致
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+
+	// 由 error() 构造或者 catch 到的错误值, 脚本中的 map 字面量不能设置, 见 is_error
+	IsError bool
+}
+
+// 新建一个空map, size 为预计的元素个数
+func NewHash(size int) *Hash {
+	return &Hash{
+		Pairs: make(map[HashKey]HashPair, size),
+		Keys:  make([]HashKey, 0, size),
+	}
+}
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	pair, ok := h.Pairs[key]
+	return pair, ok
+}
+
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Delete(key HashKey) {
+	if _, ok := h.Pairs[key]; !ok {
+		return
+	}
+	delete(h.Pairs, key)
+	for i, k := range h.Keys {
+		if k == key {
+			h.Keys = append(h.Keys[:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (h *Hash) Len() int { return len(h.Keys) }
+
+// 按插入顺序返回所有的 k - v 对
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -175,7 +419,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	pairs := []string{}
 
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Ordered() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -185,3 +429,41 @@ func (h *Hash) Inspect() string {
 	out.WriteString("}")
 	return out.String()
 }
+
+// 有限状态机
+// 由 machine(spec) 构造, fire(m, event) 驱动状态迁移
+type Machine struct {
+	Current     string                       // 当前状态
+	Transitions map[string]map[string]string // 状态 -> 事件 -> 目标状态
+	Handlers    map[string]Object            // 进入某状态时调用的函数
+}
+
+func (m *Machine) Type() ObjectType { return MACHINE_OBJ }
+func (m *Machine) Inspect() string  { return "machine(" + m.Current + ")" }
+
+// 宿主提供的 Go 值
+// 脚本不能直接访问 Value, 只能通过 x.method(args) 调用 Methods 中的方法
+// 宿主把它放到环境中交给脚本, 例如:
+//
+//	env.Set("log", &object.External{
+//		Name:  "Logger",
+//		Value: logger,
+//		Methods: map[string]object.ExternalMethod{
+//			"info": func(self *object.External, args ...object.Object) object.Object {
+//				self.Value.(*log.Logger).Println(args[0].Inspect())
+//				return nil
+//			},
+//		},
+//	})
+type External struct {
+	Name    string                    // 显示的类型名
+	Value   interface{}               // 宿主的 Go 值
+	Methods map[string]ExternalMethod // 方法名 -> 实现
+}
+
+// External 的方法, self 为被调用的对象
+// 返回 nil 时脚本中得到 null
+type ExternalMethod func(self *External, args ...Object) Object
+
+func (e *External) Type() ObjectType { return EXTERNAL_OBJ }
+func (e *External) Inspect() string  { return "external(" + e.Name + ")" }
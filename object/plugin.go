@@ -0,0 +1,27 @@
+package object
+
+// 插件的 ABI
+//
+// 插件是用 go build -buildmode=plugin 编译的 Go 包(package main), 导出一个 PluginExports 类型的函数,
+// 脚本通过 load_plugin(path, symbol) 加载, symbol 为这个函数的名字:
+//
+//	package main
+//
+//	import "mk/object"
+//
+//	func Exports() (map[string]object.Object, error) {
+//		return map[string]object.Object{
+//			"double": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+//				n := args[0].(*object.Integer)
+//				return &object.Integer{Value: n.Value * 2}
+//			}},
+//			"version": &object.String{Value: "1.0"},
+//		}, nil
+//	}
+//
+// 返回的 map 为名字 -> 值, 通常是 *Builtin 和 *External, 在脚本中得到以这些名字为 key 的 map;
+// 返回 error 时 load_plugin 报 ImportError
+//
+// 插件和 mk 必须用同一版本的 Go, 同样的构建参数和同一份 object 包编译, 否则加载失败;
+// Go 的 plugin 包只支持 Linux, macOS 和 FreeBSD, 并且需要 cgo
+type PluginExports = func() (map[string]Object, error)
@@ -0,0 +1,57 @@
+package object
+
+import (
+	"strings"
+)
+
+// 结构体类型, 由 struct Name { field, ... } 声明
+// 作为函数调用时按字段的顺序传入参数, 构造该类型的实例
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	if len(st.Fields) == 0 {
+		return "struct " + st.Name + " { }"
+	}
+	return "struct " + st.Name + " { " + strings.Join(st.Fields, ", ") + " }"
+}
+
+// 字段的下标, 没有该字段时返回 -1
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 结构体实例, Values 和 Def.Fields 一一对应
+// 字段不能修改, 也不能增加新的字段
+type Struct struct {
+	Def    *StructType
+	Values []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+
+// 类型名加上按声明顺序排列的字段, 例如 Point{x: 1, y: 2}
+func (s *Struct) Inspect() string {
+	fields := make([]string, len(s.Values))
+	for i, value := range s.Values {
+		fields[i] = s.Def.Fields[i] + ": " + value.Inspect()
+	}
+	return s.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// 取得字段的值
+func (s *Struct) Get(name string) (Object, bool) {
+	i := s.Def.FieldIndex(name)
+	if i < 0 {
+		return nil, false
+	}
+	return s.Values[i], true
+}
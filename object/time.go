@@ -0,0 +1,17 @@
+package object
+
+import "time"
+
+// 时间点, 带有所在的时区
+// 同一时刻在不同时区中显示不同, 但是比较时相等
+type Time struct {
+	Value time.Time
+}
+
+// 显示时使用的格式, 也可以被 parse_time 解析
+const TIME_LAYOUT = "2006-01-02 15:04:05 -07:00 MST"
+
+func (t *Time) Type() ObjectType { return TIME_OBJ }
+
+// 例如 2024-01-01 18:00:00 +08:00 CST
+func (t *Time) Inspect() string { return t.Value.Format(TIME_LAYOUT) }
@@ -0,0 +1,164 @@
+// optimizer 在解析之后, 执行之前改写语法树
+// 每个优化步骤(Pass)自底向上改写表达式, 改写前后程序的结果(包括错误)必须相同
+//
+//	program := parser.New(lexer.New(src)).ParseProgram()
+//	program = optimizer.Optimize(program, options)
+//	evaluator.New(options).Eval(program, env)
+package optimizer
+
+import (
+	"mk/ast"
+	"mk/evaluator"
+)
+
+// 一个优化步骤
+// Rewrite 对每个表达式调用一次, 调用时子表达式已经改写完, 返回值替换原来的表达式;
+// options 为执行这个程序的解释器的选项, 例如宿主注册的运算符(Options.Operators)不能按内置运算符改写
+type Pass struct {
+	Name    string
+	Rewrite func(exp ast.Expression, options *evaluator.Options) ast.Expression
+}
+
+// 默认的优化步骤, 按顺序执行
+var DefaultPasses = []Pass{
+	ConstantFolding,
+	DeadBranches,
+	Algebraic,
+}
+
+// 依次执行各个优化步骤, 不给出时执行 DefaultPasses
+// options 为之后执行这个程序使用的选项; 直接修改传入的语法树
+func Optimize(program *ast.Program, options evaluator.Options, passes ...Pass) *ast.Program {
+	if len(passes) == 0 {
+		passes = DefaultPasses
+	}
+	for _, pass := range passes {
+		rewrite := pass.Rewrite
+		f := func(exp ast.Expression) ast.Expression { return rewrite(exp, &options) }
+		for _, stmt := range program.Statements {
+			rewriteStatement(stmt, f)
+		}
+	}
+	return program
+}
+
+func rewriteStatement(stmt ast.Statement, f func(ast.Expression) ast.Expression) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = rewrite(stmt.Value, f)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = rewrite(stmt.ReturnValue, f)
+	case *ast.ThrowStatement:
+		stmt.Value = rewrite(stmt.Value, f)
+	case *ast.YieldStatement:
+		stmt.Value = rewrite(stmt.Value, f)
+	case *ast.ExpressionStatement:
+		stmt.Expression = rewrite(stmt.Expression, f)
+	case *ast.BlockStatement:
+		rewriteBlock(stmt, f)
+	}
+}
+
+func rewriteBlock(block *ast.BlockStatement, f func(ast.Expression) ast.Expression) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		rewriteStatement(stmt, f)
+	}
+}
+
+func rewriteList(list []ast.Expression, f func(ast.Expression) ast.Expression) {
+	for i, exp := range list {
+		list[i] = rewrite(exp, f)
+	}
+}
+
+// 先改写子表达式, 再改写表达式本身
+func rewrite(exp ast.Expression, f func(ast.Expression) ast.Expression) ast.Expression {
+	if exp == nil {
+		return nil
+	}
+
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		exp.Right = rewrite(exp.Right, f)
+
+	case *ast.InfixExpression:
+		exp.Left = rewrite(exp.Left, f)
+		exp.Right = rewrite(exp.Right, f)
+
+	case *ast.IfExpression:
+		exp.Condition = rewrite(exp.Condition, f)
+		rewriteBlock(exp.Consequence, f)
+		rewriteBlock(exp.Alternative, f)
+
+	case *ast.TryExpression:
+		rewriteBlock(exp.Block, f)
+		for _, c := range exp.Catches {
+			rewriteBlock(c.Body, f)
+		}
+		rewriteBlock(exp.Finally, f)
+
+	case *ast.TernaryExpression:
+		exp.Condition = rewrite(exp.Condition, f)
+		exp.Consequence = rewrite(exp.Consequence, f)
+		exp.Alternative = rewrite(exp.Alternative, f)
+
+	case *ast.FunctionLiteral:
+		for name, def := range exp.Defaults {
+			exp.Defaults[name] = rewrite(def, f)
+		}
+		rewriteBlock(exp.Body, f)
+
+	case *ast.CallExpression:
+		exp.Function = rewrite(exp.Function, f)
+		rewriteList(exp.Arguments, f)
+
+	// 右边改写成调用时意义会改变(x |> f(a) 把 x 作为 f 的第一个参数), 这时保留原来的右边
+	case *ast.PipeExpression:
+		exp.Left = rewrite(exp.Left, f)
+		_, wasCall := exp.Right.(*ast.CallExpression)
+		right := rewrite(exp.Right, f)
+		if _, isCall := right.(*ast.CallExpression); isCall == wasCall {
+			exp.Right = right
+		}
+
+	case *ast.RangeExpression:
+		exp.Start = rewrite(exp.Start, f)
+		exp.Stop = rewrite(exp.Stop, f)
+
+	case *ast.SpreadExpression:
+		exp.Value = rewrite(exp.Value, f)
+
+	case *ast.ArrayLiteral:
+		rewriteList(exp.Elements, f)
+
+	case *ast.IndexExpression:
+		exp.Left = rewrite(exp.Left, f)
+		exp.Index = rewrite(exp.Index, f)
+
+	case *ast.SliceExpression:
+		exp.Left = rewrite(exp.Left, f)
+		exp.Start = rewrite(exp.Start, f)
+		exp.Stop = rewrite(exp.Stop, f)
+
+	case *ast.DotExpression:
+		exp.Left = rewrite(exp.Left, f)
+
+	case *ast.HashLiteral:
+		for i := range exp.Pairs {
+			exp.Pairs[i].Key = rewrite(exp.Pairs[i].Key, f)
+			exp.Pairs[i].Value = rewrite(exp.Pairs[i].Value, f)
+		}
+
+	case *ast.MatchExpression:
+		exp.Subject = rewrite(exp.Subject, f)
+		for _, arm := range exp.Arms {
+			arm.Pattern = rewrite(arm.Pattern, f)
+			arm.Body = rewrite(arm.Body, f)
+		}
+	}
+
+	return f(exp)
+}
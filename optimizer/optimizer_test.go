@@ -0,0 +1,140 @@
+package optimizer
+
+import (
+	"testing"
+
+	"mk/ast"
+	"mk/evaluator"
+	"mk/format"
+	"mk/lexer"
+	"mk/object"
+	"mk/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7;"},
+		{"let a = (10 - 4) / 2 == 3;", "let a = true;"},
+		{`"a" + "b" + c`, `"ab" + c;`},
+		{"!true", "false;"},
+		{"-(2 + 3) * x", "-5 * x;"},
+		{"1 + true", "1 + true;"},
+		{`1 / 0`, "1 / 0;"},
+		{`"ab" * 3`, `"ababab";`},
+		// 结果太大的不折叠, 留到执行时记录内存用量
+		{`"ab" * 100000`, `"ab" * 100000;`},
+		{"if (1 < 2) { a } else { b }", "if (true) { a };"},
+		{"if (1 > 2) { a } else { b }", "if (true) { b };"},
+		{"if (false) { a }", "if (false) {};"},
+		{"if (x) { 1 + 1 }", "if (x) { 2 };"},
+		{"true ? a : b", "a;"},
+		{"\"s\" ? a : b", "a;"},
+		{"!!(a < b)", "a < b;"},
+		{"(a == b) == true", "a == b;"},
+		{"(a == b) == false", "!(a == b);"},
+		{"(1 / 0) + 0", "1 / 0;"},
+		{"1 * -(1 / 0)", "-(1 / 0);"},
+		// 类型不确定的不化简, 避免去掉执行时的错误
+		{"a + 0", "a + 0;"},
+		{"(a - b) + 0", "a - b + 0;"},
+		{"1 * -a", "1 * -a;"},
+		{"(1h - 30m) + 0", "1h - 30m + 0;"},
+		{"!!a", "!!a;"},
+		{"a * 1", "a * 1;"},
+		{"let f = fn(x = 2 * 3) { [x + 0, {1 + 1: 2 - 1}[2]] }", "let f = fn(x = 6) { [x + 0, {2: 1}[2]] };"},
+		{"1 + 1 |> f(2 * 3)", "2 |> f(6);"},
+		// 化简成调用会改变管道的意义, 保留原来的右边
+		{"x |> (true ? f(1) : g)", "x |> (true ? f(1) : g);"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), evaluator.DefaultOptions())
+		if got := format.Node(program); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// 优化前后的执行结果相同
+func TestOptimizePreservesResults(t *testing.T) {
+	inputs := []string{
+		"let a = 5; (a - 2) * 1 + 0",
+		"let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(10)",
+		`let s = "x"; s + "y" + "z"`,
+		"let a = 1; a + true",
+		"let a = \"s\"; -a + 0",
+		"let b = 3; !!(b > 2) == true",
+		"if (2 > 1) { 10 } else { 20 }",
+		"if (2 < 1) { 10 }",
+		"len([1, 2, 3]) * 1",
+		"try { 1 + true } catch (e) { e.message }",
+		// 不是整数的操作数
+		"(1h - 30m) + 0",
+		"-(1h) + 0",
+		"1 * -(2h)",
+		"let f = fn(a) { fn(b) { [a, b] } }; 1 |> (true ? f(2) : f)",
+		"let d = 90m; (d - 30m) / 1",
+		"(1.50d - 0.5d) + 0",
+		"-(2.5d) * 1",
+	}
+
+	for _, input := range inputs {
+		expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		optimized := evaluator.Eval(Optimize(parse(t, input), evaluator.DefaultOptions()), object.NewEnvironment())
+		if optimized.Inspect() != expected.Inspect() {
+			t.Errorf("result changed for %q. expected=%q, got=%q",
+				input, expected.Inspect(), optimized.Inspect())
+		}
+	}
+}
+
+// 可以只执行指定的步骤, 也可以自定义步骤
+func TestCustomPasses(t *testing.T) {
+	program := Optimize(parse(t, "if (1 < 2) { a } else { b }"), evaluator.DefaultOptions(), ConstantFolding)
+	if got := format.Node(program); got != "if (true) { a } else { b };" {
+		t.Errorf("wrong result. got=%q", got)
+	}
+
+	rename := Pass{
+		Name: "rename",
+		Rewrite: func(exp ast.Expression, options *evaluator.Options) ast.Expression {
+			if ident, ok := exp.(*ast.Identifier); ok && ident.Value == "a" {
+				ident.Value = "b"
+			}
+			return exp
+		},
+	}
+	program = Optimize(parse(t, "a + f(a)"), evaluator.DefaultOptions(), rename)
+	if got := format.Node(program); got != "b + f(b);" {
+		t.Errorf("wrong result. got=%q", got)
+	}
+}
+
+func TestFoldingSkipsCustomOperators(t *testing.T) {
+	options := evaluator.DefaultOptions()
+	options.RegisterOperator("==", func(left, right object.Object) object.Object {
+		return evaluator.TRUE
+	})
+
+	program := Optimize(parse(t, "1 == 2; (1 + 2 == 3) == true"), options)
+	if got := format.Node(program); got != "1 == 2;\n3 == 3 == true;" {
+		t.Errorf("custom operator should not be folded. got=%q", got)
+	}
+	// 没有注册运算符的选项照常折叠
+	program = Optimize(parse(t, "1 == 2"), evaluator.DefaultOptions())
+	if got := format.Node(program); got != "false;" {
+		t.Errorf("built-in operator should be folded. got=%q", got)
+	}
+}
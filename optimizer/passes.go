@@ -0,0 +1,225 @@
+package optimizer
+
+import (
+	"mk/ast"
+	"mk/ast/build"
+	"mk/evaluator"
+	"mk/object"
+	"mk/token"
+)
+
+// 常量折叠
+// 两边都是字面量的运算直接用 evaluator 算出结果, 替换为字面量: 1 + 2 * 3 => 7, "a" + "b" => "ab"
+// 运算出错时不折叠, 错误留到执行时报告; 宿主注册了求值函数的运算符不折叠
+// 结果超过 MAX_FOLDED_SIZE 字节的不折叠, 留到执行时按解释器的内存限制(--max-memory)记录
+var ConstantFolding = Pass{
+	Name: "constant-folding",
+	Rewrite: func(exp ast.Expression, options *evaluator.Options) ast.Expression {
+		switch e := exp.(type) {
+		case *ast.PrefixExpression:
+			if !isLiteral(e.Right) {
+				return exp
+			}
+		case *ast.InfixExpression:
+			if !isLiteral(e.Left) || !isLiteral(e.Right) || options.HasOperator(e.Operator) {
+				return exp
+			}
+		default:
+			return exp
+		}
+
+		folded := literal(evalConstant(exp))
+		if folded == nil {
+			return exp
+		}
+		setPos(folded, exp.Pos())
+		return folded
+	},
+}
+
+// 删除不会执行的分支
+// if 的条件为字面量时只保留会执行的代码块: if (true) { a } else { b } => if (true) { a }
+// 三元表达式的条件为字面量时替换为会执行的一边: true ? a : b => a
+var DeadBranches = Pass{
+	Name: "dead-branches",
+	Rewrite: func(exp ast.Expression, options *evaluator.Options) ast.Expression {
+		switch e := exp.(type) {
+		case *ast.IfExpression:
+			truthy, ok := constantTruthiness(e.Condition)
+			if !ok {
+				return exp
+			}
+			if truthy {
+				e.Alternative = nil
+				return exp
+			}
+			if e.Alternative == nil {
+				// 条件为假并且没有 else, 值为 null, 不会执行代码块
+				e.Consequence = &ast.BlockStatement{Token: e.Consequence.Token, Statements: []ast.Statement{}}
+				return exp
+			}
+			e.Condition = trueAt(e.Condition.Pos())
+			e.Consequence, e.Alternative = e.Alternative, nil
+			return exp
+
+		case *ast.TernaryExpression:
+			truthy, ok := constantTruthiness(e.Condition)
+			if !ok {
+				return exp
+			}
+			if truthy {
+				return e.Consequence
+			}
+			return e.Alternative
+		}
+		return exp
+	},
+}
+
+// 代数化简, 只用于结果类型确定的表达式, 保证不会去掉执行时的错误:
+//
+//	!!b, b == true, b != false => b      (b 为比较或者 '!' 的结果)
+//	b == false, b != true      => !b
+//	n + 0, 0 + n, n - 0, n * 1, 1 * n, n / 1 => n   (n 为只由整数字面量组成的运算, 见 isInteger)
+var Algebraic = Pass{
+	Name: "algebraic",
+	Rewrite: func(exp ast.Expression, options *evaluator.Options) ast.Expression {
+		switch e := exp.(type) {
+		case *ast.PrefixExpression:
+			if inner, ok := e.Right.(*ast.PrefixExpression); ok && e.Operator == "!" &&
+				inner.Operator == "!" && isBoolean(inner.Right, options) {
+				return inner.Right
+			}
+
+		case *ast.InfixExpression:
+			if options.HasOperator(e.Operator) {
+				return exp
+			}
+			if b, ok := e.Right.(*ast.Boolean); ok && isBoolean(e.Left, options) {
+				switch {
+				case e.Operator == "==" && b.Value, e.Operator == "!=" && !b.Value:
+					return e.Left
+				case e.Operator == "==" && !b.Value, e.Operator == "!=" && b.Value:
+					not := build.Prefix("!", e.Left)
+					not.Token.Pos = e.Pos()
+					return not
+				}
+			}
+			switch {
+			case isInteger(e.Left, options) && isIntValue(e.Right, 0) && (e.Operator == "+" || e.Operator == "-"):
+				return e.Left
+			case isInteger(e.Left, options) && isIntValue(e.Right, 1) && (e.Operator == "*" || e.Operator == "/"):
+				return e.Left
+			case isInteger(e.Right, options) && isIntValue(e.Left, 0) && e.Operator == "+":
+				return e.Right
+			case isInteger(e.Right, options) && isIntValue(e.Left, 1) && e.Operator == "*":
+				return e.Right
+			}
+		}
+		return exp
+	},
+}
+
+// 常量折叠的结果最多分配的字节数(近似值, 同 evaluator.Options.MaxMemory)
+const MAX_FOLDED_SIZE = 4096
+
+// 在新的解释器中执行常量表达式, 不受容错模式(Options.Tolerant)影响
+// 结果为错误(例如整数除以0, 超过 MAX_FOLDED_SIZE)的由 literal() 拒绝, 留到执行时报错; 执行时 panic 的同样不折叠
+func evalConstant(exp ast.Expression) (result object.Object) {
+	defer func() {
+		if recover() != nil {
+			result = nil
+		}
+	}()
+
+	options := evaluator.DefaultOptions()
+	options.MaxMemory = MAX_FOLDED_SIZE
+	return evaluator.New(options).Eval(exp, object.NewEnvironment())
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// 把执行结果转换成字面量, 不能转换时返回nil
+func literal(obj object.Object) ast.Expression {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return build.Int(obj.Value)
+	case *object.String:
+		return build.Str(obj.Value)
+	case *object.Boolean:
+		return build.Bool(obj.Value)
+	}
+	return nil
+}
+
+func setPos(exp ast.Expression, pos token.Position) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		exp.Token.Pos = pos
+	case *ast.StringLiteral:
+		exp.Token.Pos = pos
+	case *ast.Boolean:
+		exp.Token.Pos = pos
+	}
+}
+
+func trueAt(pos token.Position) *ast.Boolean {
+	b := build.Bool(true)
+	b.Token.Pos = pos
+	return b
+}
+
+// 字面量条件的真假, 和 isTruthy 相同: 只有 false 为假
+func constantTruthiness(exp ast.Expression) (truthy bool, ok bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// 结果一定是布尔值(或者错误)的表达式
+func isBoolean(exp ast.Expression, options *evaluator.Options) bool {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		return exp.Operator == "!"
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "<", ">", "==", "!=":
+			return !options.HasOperator(exp.Operator)
+		}
+	}
+	return false
+}
+
+// 结果一定是整数(或者错误)的表达式: 整数字面量, 以及只由整数字面量经过 '-' 和四则运算得到的表达式
+// 只看运算符不能确定类型, 例如时长和时间也支持 '-': (1h - 30m) + 0 是类型错误, 不能化简为 1h - 30m
+func isInteger(exp ast.Expression, options *evaluator.Options) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return exp.Operator == "-" && isInteger(exp.Right, options)
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "+", "-", "*", "/":
+			return !options.HasOperator(exp.Operator) && isInteger(exp.Left, options) && isInteger(exp.Right, options)
+		}
+	}
+	return false
+}
+
+func isIntValue(exp ast.Expression, value int64) bool {
+	lit, ok := exp.(*ast.IntegerLiteral)
+	return ok && lit.Value == value
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"mk/token"
+)
+
+// 语法错误
+// Errors() 返回的字符串只包含位置和错误信息,
+// Format 可以额外输出出错的源码行, 指向出错位置的 '^' 以及修改建议
+type Error struct {
+	Pos     token.Position
+	Message string
+	Hint    string // 修改建议, 可以为空
+}
+
+// 带位置的错误信息, 和 Errors() 中的字符串相同
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+// 输出带源码片段的错误信息, source 为解析的完整源码
+//
+//	line 1, column 12: no prefix parse function for ] found
+//	  let a = [1, ];
+//	              ^
+//	hint: unexpected ']' - did you forget an element after the comma?
+func (e *Error) Format(source string) string {
+	var out strings.Builder
+	out.WriteString(e.Error())
+
+	lines := strings.Split(source, "\n")
+	if e.Pos.Line >= 1 && e.Pos.Line <= len(lines) {
+		line := strings.TrimRight(lines[e.Pos.Line-1], "\r")
+
+		// '^' 前面的空白和源码对齐, tab 保持为 tab
+		col := e.Pos.Column - 1
+		if col > len(line) {
+			col = len(line)
+		}
+		if col < 0 {
+			col = 0
+		}
+		padding := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, line[:col])
+
+		out.WriteString("\n  " + line)
+		out.WriteString("\n  " + padding + "^")
+	}
+
+	if e.Hint != "" {
+		out.WriteString("\nhint: " + e.Hint)
+	}
+	return out.String()
+}
+
+// 出错的token在源码中的写法
+func describe(tok token.Token) string {
+	switch tok.Type {
+	case token.EOF:
+		return "end of input"
+	case token.IDENT, token.INT:
+		return tok.Literal
+	case token.STRING:
+		return fmt.Sprintf("%q", tok.Literal)
+	default:
+		return "'" + tok.Literal + "'"
+	}
+}
+
+// 没有前缀解析函数的token(即表达式不能以该token开头)时的建议
+// prev 为出错token的前一个token
+func prefixHint(prev, tok token.Token) string {
+	what := describe(tok)
+
+	switch tok.Type {
+	case token.EOF:
+		return "unexpected end of input - is an expression or a closing bracket missing?"
+	case token.RBRACKET, token.RPAREN, token.RBRACE:
+		if prev.Type == token.COMMA {
+			return fmt.Sprintf("unexpected %s - did you forget an element after the comma?", what)
+		}
+		return fmt.Sprintf("unexpected %s - an expression is missing before it, or the bracket is unmatched", what)
+	case token.COMMA:
+		return "unexpected ',' - did you forget an element before the comma?"
+	case token.SEMICOLON:
+		return "unexpected ';' - an expression is missing here"
+	case token.ASSIGN:
+		return "unexpected '=' - use '==' to compare, or 'let' to declare a variable"
+	case token.ILLEGAL:
+		return fmt.Sprintf("illegal character %s", what)
+	default:
+		return fmt.Sprintf("an expression cannot start with %s", what)
+	}
+}
+
+// 下一个token不是期望的类型时的建议
+func peekHint(expected token.TokenType, got token.Token) string {
+	what := describe(got)
+
+	switch expected {
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		return fmt.Sprintf("missing '%s' before %s", expected, what)
+	case token.IDENT:
+		return fmt.Sprintf("expected a name, found %s", what)
+	case token.ASSIGN:
+		return fmt.Sprintf("expected '=' after the name, found %s", what)
+	default:
+		return fmt.Sprintf("expected '%s', found %s", expected, what)
+	}
+}
@@ -2,18 +2,27 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"mk/ast"
+	"mk/debuglog"
 	"mk/lexer"
 	"mk/token"
 )
 
+// 解析过程的调试日志, MK_DEBUG=parse 打开, 见 debuglog
+var parseLog = debuglog.New("parse")
+
 const (
 	_           int = iota
 	LOWEST          // 执行最低有限级(即左绑定和右绑定能力最弱)
+	TERNARY         // a ? b : c
 	EQUALS          // ==
 	LESSGREATER     // > or <
+	PIPE            // x |> f
+	RANGE           // 1..10
 	SUM             // +
 	PRODUCT         // *
 	PREFIX          // -X or !X
@@ -21,17 +30,213 @@ const (
 	INDEX           // array[index]
 )
 
+// 优先级的名字, 用于 mk explain 等工具输出
+var precedenceNames = []string{
+	LOWEST:      "LOWEST",
+	TERNARY:     "TERNARY",
+	EQUALS:      "EQUALS",
+	LESSGREATER: "LESSGREATER",
+	PIPE:        "PIPE",
+	RANGE:       "RANGE",
+	SUM:         "SUM",
+	PRODUCT:     "PRODUCT",
+	PREFIX:      "PREFIX",
+	CALL:        "CALL",
+	INDEX:       "INDEX",
+}
+
+// 优先级的名字, 不认识的优先级返回数字
+func PrecedenceName(precedence int) string {
+	if precedence > 0 && precedence < len(precedenceNames) {
+		return precedenceNames[precedence]
+	}
+	return strconv.Itoa(precedence)
+}
+
 var precedences = map[token.TokenType]int{
+	token.QUESTION: TERNARY,
+	token.PIPE:     PIPE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.RANGE:    RANGE,
+	token.RANGE_LT: RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// 结合性
+type Associativity int
+
+const (
+	ASSOC_LEFT  Associativity = iota // 左结合: a - b - c 为 (a - b) - c
+	ASSOC_RIGHT                      // 右结合: a ** b ** c 为 a ** (b ** c)
+	ASSOC_NONE                       // 不能连续使用: a..b..c 为语法错误
+)
+
+func (a Associativity) String() string {
+	switch a {
+	case ASSOC_RIGHT:
+		return "right"
+	case ASSOC_NONE:
+		return "none"
+	default:
+		return "left"
+	}
+}
+
+// 中缀运算符的结合性, 不在表中的为左结合
+// 三元表达式和区间的结合性由各自的解析函数实现, 这里只作为说明
+var associativities = map[token.TokenType]Associativity{
+	token.QUESTION: ASSOC_RIGHT,
+	token.RANGE:    ASSOC_NONE,
+	token.RANGE_LT: ASSOC_NONE,
+	token.PIPE:     ASSOC_LEFT,
+	token.EQ:       ASSOC_LEFT,
+	token.NOT_EQ:   ASSOC_LEFT,
+	token.LT:       ASSOC_LEFT,
+	token.GT:       ASSOC_LEFT,
+	token.PLUS:     ASSOC_LEFT,
+	token.MINUS:    ASSOC_LEFT,
+	token.SLASH:    ASSOC_LEFT,
+	token.ASTERISK: ASSOC_LEFT,
+}
+
+// 语法规范
+// 目前只影响运算符的结合性, 旧版本的脚本可以用 SPEC_LEGACY 解析
+type Spec int
+
+const (
+	SPEC_STANDARD Spec = iota // 标准: 算术运算符都是左结合
+	SPEC_LEGACY               // 兼容旧版本: '+' 为右结合, a + b - c 为 a + (b - c)
+)
+
+// 新建 Parser 时使用的语法规范
+var DefaultSpec = SPEC_STANDARD
+
+func (s Spec) String() string {
+	if s == SPEC_LEGACY {
+		return "legacy"
+	}
+	return "standard"
+}
+
+// 按名字查找语法规范, 用于命令行参数
+func LookupSpec(name string) (Spec, bool) {
+	switch name {
+	case "standard":
+		return SPEC_STANDARD, true
+	case "legacy":
+		return SPEC_LEGACY, true
+	}
+	return SPEC_STANDARD, false
+}
+
+// 运算符在该语法规范下的结合性
+func (s Spec) associativity(tt token.TokenType) Associativity {
+	if s == SPEC_LEGACY && tt == token.PLUS {
+		return ASSOC_RIGHT
+	}
+	return associativities[tt]
+}
+
+// 中缀运算符(包括调用, 下标和成员访问)的信息, 供高亮, 补全, 格式化等工具使用
+type OperatorInfo struct {
+	Symbol        string
+	Precedence    int
+	Associativity Associativity
+	Custom        bool // 是否为宿主注册的运算符
+}
+
+// 所有中缀运算符, 按优先级从低到高排列, 同一优先级按符号排列
+// 结合性为 DefaultSpec 下的结合性
+func Operators() []OperatorInfo {
+	ops := make([]OperatorInfo, 0, len(precedences))
+	for tt, precedence := range precedences {
+		ops = append(ops, OperatorInfo{
+			Symbol:        string(tt),
+			Precedence:    precedence,
+			Associativity: DefaultSpec.associativity(tt),
+			Custom:        isCustomOperator(tt),
+		})
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Precedence != ops[j].Precedence {
+			return ops[i].Precedence < ops[j].Precedence
+		}
+		return ops[i].Symbol < ops[j].Symbol
+	})
+	return ops
+}
+
+// 宿主注册的自定义中缀运算符
+var customOperators = []token.TokenType{}
+
+// 组成自定义运算符的字符
+const OPERATOR_CHARS = "!#$%&*+-./:<=>?@^|~"
+
+// 注册自定义中缀运算符, 需要在创建 Parser 之前调用
+// 运算符的求值通过 evaluator.Options.RegisterOperator 注册
+//
+//	parser.RegisterOperator("**", parser.PREFIX, parser.ASSOC_RIGHT)
+func RegisterOperator(symbol string, precedence int, assoc Associativity) error {
+	if symbol == "" || strings.Trim(symbol, OPERATOR_CHARS) != "" {
+		return fmt.Errorf("invalid operator %q: must consist of %s", symbol, OPERATOR_CHARS)
+	}
+	if precedence <= LOWEST || precedence > PREFIX {
+		return fmt.Errorf("invalid precedence %d for operator %q: must be between LOWEST and PREFIX",
+			precedence, symbol)
+	}
+
+	tt := token.TokenType(symbol)
+	if !isCustomOperator(tt) {
+		// 不能覆盖内置的token
+		l := lexer.New(symbol)
+		if tok := l.NextToken(); tok.Type != token.ILLEGAL && l.NextToken().Type == token.EOF {
+			return fmt.Errorf("operator %q is already defined", symbol)
+		}
+
+		token.RegisterOperator(symbol)
+		customOperators = append(customOperators, tt)
+	}
+
+	precedences[tt] = precedence
+	associativities[tt] = assoc
+	return nil
+}
+
+func isCustomOperator(tt token.TokenType) bool {
+	for _, op := range customOperators {
+		if op == tt {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析时的限制, 防止恶意输入在执行之前就耗尽宿主的内存或者栈
+// 为0表示不限制
+type Limits struct {
+	MaxDepth        int // 表达式的最大嵌套深度
+	MaxStringLength int // 字符串字面量的最大字节数
+	MaxElements     int // 数组字面量元素/调用参数的最大个数
+	MaxHashPairs    int // map字面量键值对的最大个数
+	MaxErrors       int // 最多报告的错误个数, 超过时放弃解析剩余的输入
+}
+
+// 默认的解析限制
+var DefaultLimits = Limits{
+	MaxDepth:        1000,
+	MaxStringLength: 1 << 20,
+	MaxElements:     1 << 20,
+	MaxHashPairs:    1 << 20,
+	MaxErrors:       100,
 }
 
 type (
@@ -40,14 +245,32 @@ type (
 )
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l       *lexer.Lexer
+	errors  []string
+	details []*Error // 和 errors 一一对应
+
+	warnings []*Error // 不影响解析结果的问题, 例如map字面量中重复的key
 
+	// 出错之后到恢复之前为true, 期间不再记录错误, 避免一个错误引起一连串的错误
+	panicking bool
+
+	braces     int // 已经读到的未闭合的 '{' 个数
+	blockLevel int // 当前所在代码块开始时的 braces
+
+	limits Limits
+	spec   Spec
+	depth  int  // 当前表达式的嵌套深度
+	abort  bool // 超出嵌套深度或者错误太多, 放弃解析剩余的输入
+
+	prevToken token.Token
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// 字符串字面量池, 相同的字面量共用一个字符串
+	interned map[string]string
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -60,14 +283,19 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:        l,
+		errors:   []string{},
+		limits:   DefaultLimits,
+		spec:     DefaultSpec,
+		interned: make(map[string]string),
 	}
 
 	// 注册前缀表达式的解析函数
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)         //标识符
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)       //数值
+	p.registerPrefix(token.DECIMAL, p.parseDecimalLiteral)   //小数
+	p.registerPrefix(token.DURATION, p.parseDurationLiteral) //时长
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)    //!
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)   //-(取负)
 	p.registerPrefix(token.TRUE, p.parseBoolean)             //true
@@ -78,19 +306,30 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)     //字符串
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)    //数组
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)     //match
+	p.registerPrefix(token.ELLIPSIS, p.parseSpreadExpression) //...(展开)
+	p.registerPrefix(token.TRY, p.parseTryExpression)         //try
 
 	// 注册中缀表达式的解析函数
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
-	p.registerInfix(token.PLUS, p.parseInfixExpression)     //'+'
-	p.registerInfix(token.MINUS, p.parseInfixExpression)    //'-'(减)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)    //'/'(除)
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression) //'*'
-	p.registerInfix(token.EQ, p.parseInfixExpression)       //'='
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)   //'!='
-	p.registerInfix(token.LT, p.parseInfixExpression)       //'<'
-	p.registerInfix(token.GT, p.parseInfixExpression)       //'>'
-	p.registerInfix(token.LPAREN, p.parseCallExpression)    //'('
-	p.registerInfix(token.LBRACKET, p.parseIndexExpression) //数组下标表达式
+	p.registerInfix(token.PLUS, p.parseInfixExpression)       //'+'
+	p.registerInfix(token.MINUS, p.parseInfixExpression)      //'-'(减)
+	p.registerInfix(token.SLASH, p.parseInfixExpression)      //'/'(除)
+	p.registerInfix(token.ASTERISK, p.parseInfixExpression)   //'*'
+	p.registerInfix(token.EQ, p.parseInfixExpression)         //'='
+	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)     //'!='
+	p.registerInfix(token.LT, p.parseInfixExpression)         //'<'
+	p.registerInfix(token.GT, p.parseInfixExpression)         //'>'
+	p.registerInfix(token.LPAREN, p.parseCallExpression)      //'('
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)   //数组下标表达式
+	p.registerInfix(token.QUESTION, p.parseTernaryExpression) //'?'(三元表达式)
+	p.registerInfix(token.DOT, p.parseDotExpression)          //'.'(成员访问)
+	p.registerInfix(token.RANGE, p.parseRangeExpression)      //'..'(区间)
+	p.registerInfix(token.RANGE_LT, p.parseRangeExpression)   //'..<'(不包含结束值的区间)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)        //'|>'(管道)
+	for _, tt := range customOperators {
+		p.registerInfix(tt, p.parseInfixExpression) //自定义运算符
+	}
 
 	// 初始化:
 	// 执行两遍nextToken()
@@ -100,8 +339,32 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// 设置解析限制, 需要在 ParseProgram 之前调用
+func (p *Parser) SetLimits(limits Limits) {
+	p.limits = limits
+}
+
+// 设置语法规范, 需要在 ParseProgram 之前调用
+func (p *Parser) SetSpec(spec Spec) {
+	p.spec = spec
+}
+
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braces++
+	case token.RBRACE:
+		p.braces--
+	}
+
+	// 放弃解析时不再读取输入, 让所有解析函数尽快结束
+	if p.abort {
+		p.peekToken = token.Token{Type: token.EOF, Pos: p.curToken.Pos}
+		return
+	}
 	p.peekToken = p.l.NextToken()
 }
 
@@ -111,25 +374,114 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
+		errCount := len(p.errors)
 		stmt := p.parseStatement()
 
-		if stmt != nil {
+		// 出错时跳到下一条语句继续解析, 一次报告所有的语法错误
+		if len(p.errors) > errCount {
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+			if parseLog.Enabled(debuglog.TRACE) {
+				pos := stmt.Pos()
+				parseLog.Trace("statement", "pos", fmt.Sprintf("%d:%d", pos.Line, pos.Column),
+					"node", fmt.Sprintf("%T", stmt), "stmt", stmt.String())
+			}
 		}
 		p.nextToken()
 	}
+
+	if parseLog.Enabled(debuglog.DEBUG) {
+		parseLog.Debug("program", "statements", len(program.Statements),
+			"errors", len(p.errors), "warnings", len(p.warnings))
+	}
 	return program
 }
 
+// 出错后的恢复: 跳过当前语句剩余的token
+// 停在 ';' 上, 或者停在 '}' / EOF / let / const / return 的前一个token上,
+// 当前语句中没有闭合的 {...} 整体跳过
+func (p *Parser) synchronize() {
+	defer func() { p.panicking = false }()
+
+	for {
+		if p.braces <= p.blockLevel {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.CONST, token.RETURN:
+				return
+			}
+		}
+		if p.peekTokenIs(token.EOF) {
+			return
+		}
+
+		p.nextToken()
+	}
+}
+
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// 带源码位置和修改建议的错误列表
+func (p *Parser) DetailedErrors() []*Error {
+	return p.details
+}
+
+// 警告列表, 警告不影响解析结果
+func (p *Parser) Warnings() []*Error {
+	return p.warnings
+}
+
+// 记录一个警告
+func (p *Parser) warnAt(pos token.Position, format string, args ...interface{}) *Error {
+	warning := &Error{Pos: pos, Message: fmt.Sprintf(format, args...)}
+	p.warnings = append(p.warnings, warning)
+	return warning
+}
+
+// 记录一个语法错误, 带上出错的位置
+// 处于出错恢复中时不记录, 返回nil
+func (p *Parser) errorAt(pos token.Position, format string, args ...interface{}) *Error {
+	if p.panicking || p.abort {
+		return nil
+	}
+	p.panicking = true
+
+	err := &Error{Pos: pos, Message: fmt.Sprintf(format, args...)}
+	if parseLog.Enabled(debuglog.DEBUG) {
+		parseLog.Debug("error", "pos", fmt.Sprintf("%d:%d", pos.Line, pos.Column),
+			"message", err.Message, "token", p.curToken.Literal)
+	}
+	p.details = append(p.details, err)
+	p.errors = append(p.errors, err.Error())
+
+	if max := p.limits.MaxErrors; max > 0 && len(p.errors) == max {
+		tooMany := &Error{Pos: pos, Message: "too many errors"}
+		p.details = append(p.details, tooMany)
+		p.errors = append(p.errors, tooMany.Error())
+		p.stop()
+	}
+	return err
+}
+
+// 放弃解析剩余的输入
+// 之后当前token和下一个token都为EOF, 所有解析函数都会尽快结束
+func (p *Parser) stop() {
+	p.abort = true
+	p.curToken = token.Token{Type: token.EOF, Pos: p.curToken.Pos}
+	p.peekToken = p.curToken
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t,
+	err := p.errorAt(p.peekToken.Pos, "expected next token to be %s, got %s instead", t,
 		p.peekToken.Type)
-
-	p.errors = append(p.errors, msg)
+	if err != nil {
+		err.Hint = peekHint(t, p.peekToken)
+	}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -140,16 +492,23 @@ func (p *Parser) parseIdentifier() ast.Expression {
 // 再调用解析具体语句类型的方法
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 // 解析let类型语句
+// const 语句和 let 语句的解析方式相同, 只是Token不同
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -171,8 +530,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// 以最低优先级解析表达式
 	stmt.Value = p.parseExpression(LOWEST)
 
-	// 直到分号结束
-	for !p.curTokenIs(token.SEMICOLON) {
+	// 直到分号结束, 没有分号时停在 '}' 或者 EOF 之前
+	for !p.curTokenIs(token.SEMICOLON) &&
+		!p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
 		p.nextToken()
 	}
 
@@ -188,8 +548,87 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// 以最低优先级解析表达式
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	// 直到分号结束
-	for !p.curTokenIs(token.SEMICOLON) {
+	// 直到分号结束, 没有分号时停在 '}' 或者 EOF 之前
+	for !p.curTokenIs(token.SEMICOLON) &&
+		!p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 解析throw语句, 和return语句相同
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	// 直到分号结束, 没有分号时停在 '}' 或者 EOF 之前
+	for !p.curTokenIs(token.SEMICOLON) &&
+		!p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 解析struct语句: struct Name { field, field, ... }
+// 字段列表可以为空, 最后一个字段后面可以有逗号
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken, Fields: []*ast.Identifier{}}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			p.errorAt(field.Token.Pos, "duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+	stmt.Rbrace = p.curToken.Pos
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析yield语句, 和return语句相同; yield 后面紧跟 '*' 时为 yield*
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		stmt.Delegate = true
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	// 直到分号结束, 没有分号时停在 '}' 或者 EOF 之前
+	for !p.curTokenIs(token.SEMICOLON) &&
+		!p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
 		p.nextToken()
 	}
 
@@ -212,6 +651,17 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 // 解析表达式
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.limits.MaxDepth > 0 && p.depth > p.limits.MaxDepth {
+		err := p.errorAt(p.curToken.Pos, "expression nested too deeply: limit %d", p.limits.MaxDepth)
+		if err != nil {
+			err.Hint = "the input is nested deeper than the parser allows, see parser.Limits"
+		}
+		p.stop()
+		return nil
+	}
 
 	prefix := p.prefixParseFns[p.curToken.Type]
 
@@ -242,8 +692,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -251,6 +700,16 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// 解析小数字面量, 数值在执行时转换
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	return &ast.DecimalLiteral{Token: p.curToken, Value: strings.TrimSuffix(p.curToken.Literal, "d")}
+}
+
+// 解析时长字面量, 数值在执行时转换
+func (p *Parser) parseDurationLiteral() ast.Expression {
+	return &ast.DurationLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 // 解析中缀类型表达式
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
@@ -262,11 +721,11 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	precedence := p.curPrecedence()
 	p.nextToken()
 
-	if expression.Operator == "+" {
-		expression.Right = p.parseExpression(precedence - 1)
-	} else {
-		expression.Right = p.parseExpression(precedence)
+	// 右结合时降低右边的优先级, 让右边同级的运算符先结合
+	if p.spec.associativity(expression.Token.Type) == ASSOC_RIGHT {
+		precedence--
 	}
+	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
@@ -303,8 +762,10 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	err := p.errorAt(p.curToken.Pos, "no prefix parse function for %s found", t)
+	if err != nil {
+		err.Hint = prefixHint(p.prevToken, p.curToken)
+	}
 }
 
 // 检查当前token的类型是否匹配
@@ -387,22 +848,131 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// 解析 try 表达式
+// try { ... } catch (e) { ... } finally { ... }
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	for p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		clause := p.parseCatchClause()
+		if clause == nil {
+			return nil
+		}
+		expression.Catches = append(expression.Catches, clause)
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if len(expression.Catches) == 0 && expression.Finally == nil {
+		err := p.errorAt(expression.Token.Pos, "try without catch or finally")
+		if err != nil {
+			err.Hint = "add a 'catch (e) { ... }' or 'finally { ... }' block"
+		}
+		return nil
+	}
+
+	return expression
+}
+
+// 解析 catch 分支: catch (e) { ... } 或者 catch (e: TypeError) { ... }
+func (p *Parser) parseCatchClause() *ast.CatchClause {
+	clause := &ast.CatchClause{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	clause.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		clause.Kind = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	clause.Body = p.parseBlockStatement()
+
+	return clause
+}
+
+// 检查 'a ? b : c' 类型表达式
+// 三元表达式是右结合的: a ? b : c ? d : e 等价于 a ? b : (c ? d : e)
+func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression {
+	// '?' 类型token
+	expression := &ast.TernaryExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	// 期望':'
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+
+	// 以低一级的优先级解析, 使后面的 '?' 继续绑定到右边
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	// ELSE 类型token
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	// 出错恢复时以该代码块为边界
+	outerLevel := p.blockLevel
+	p.blockLevel = p.braces
+	defer func() { p.blockLevel = outerLevel }()
+
 	p.nextToken()
 
 	// 检查是否遇到 '}'
 	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			err := p.errorAt(p.curToken.Pos, "expected next token to be }, got EOF instead")
+			if err != nil {
+				err.Hint = fmt.Sprintf("missing '}' to close the block opened at line %d, column %d",
+					block.Token.Pos.Line, block.Token.Pos.Column)
+			}
+			return block
+		}
+
+		errCount := len(p.errors)
 		stmt := p.parseStatement()
 
-		if stmt != nil {
+		if len(p.errors) > errCount {
+			p.synchronize()
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 
 	return block
 }
@@ -418,7 +988,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	// 解析函数参数
-	lit.Parameters = p.parseFunctionParameters()
+	p.parseFunctionParameters(lit)
 
 	// 期望 '{'
 	if !p.expectPeek(token.LBRACE) {
@@ -431,41 +1001,86 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 }
 
 // 解析函数参数
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// 参数可以带默认值: fn(x, y = 1), 带默认值的参数必须在最后
+// 最后一个参数可以是剩余参数: fn(x, ...rest), rest 为多余参数组成的数组
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
 	// 参数列表就是逗号间隔的标识符列表
-	identifiers := []*ast.Identifier{}
+	lit.Parameters = []*ast.Identifier{}
+	lit.Defaults = make(map[string]ast.Expression)
 
 	// 期望'('
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
 	p.nextToken()
 
 	// 解析标识符
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	if !p.parseFunctionParameter(lit) {
+		return false
+	}
 
 	// 循环解析其他标识符
 	for p.peekTokenIs(token.COMMA) {
+		// 剩余参数必须是最后一个参数
+		if lit.Rest != nil {
+			p.errorAt(lit.Rest.Token.Pos, "rest parameter ...%s must be the last parameter",
+				lit.Rest.Value)
+			return false
+		}
+
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		if !p.parseFunctionParameter(lit) {
+			return false
+		}
 	}
 
 	// 期望 ')' 结束
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+	return p.expectPeek(token.RPAREN)
+}
+
+// 解析单个参数: x, x = 1 或者 ...rest
+func (p *Parser) parseFunctionParameter(lit *ast.FunctionLiteral) bool {
+	if p.curTokenIs(token.ELLIPSIS) {
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return true
+	}
+
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	lit.Parameters = append(lit.Parameters, ident)
+	return p.parseParameterDefault(ident, lit.Defaults)
+}
+
+// 解析参数默认值 '= expr'
+// 前面的参数有默认值而当前参数没有时报错
+func (p *Parser) parseParameterDefault(ident *ast.Identifier,
+	defaults map[string]ast.Expression) bool {
+
+	if !p.peekTokenIs(token.ASSIGN) {
+		if len(defaults) > 0 {
+			p.errorAt(ident.Token.Pos, "parameter %s without default value follows parameter with default value",
+				ident.Value)
+			return false
+		}
+		return true
 	}
 
-	return identifiers
+	p.nextToken()
+	p.nextToken()
+
+	defaults[ident.Value] = p.parseExpression(LOWEST)
+	return true
 }
 
 // 解析函数调用
 // 例如: fn(x, y) { return x + y;} (1, 2);
-//       或者使用之前定义好的参数: add(1, 2);
+//
+//	或者使用之前定义好的参数: add(1, 2);
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// 函数调用标识符 '('
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
@@ -474,10 +1089,25 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// 函数参数为表达式列表
 	// 例如: add(1+2, 3+4);
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken.Pos
 
 	return exp
 }
 
+// 解析管道 'x |> f(a, b)', 执行时等价于调用 f(x, a, b), 见 ast.PipeExpression
+// 右边不是调用时等价于 f(x), 例如: xs |> sum
+// 管道是左结合的: x |> f |> g 等价于 g(f(x))
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	pipe := &ast.PipeExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	pipe.Right = p.parseExpression(PIPE)
+	if pipe.Right == nil {
+		return nil
+	}
+	return pipe
+}
+
 // 解析函数调用参数
 func (p *Parser) parseCallArguments() []ast.Expression {
 	// 参数列表就是表达式列表
@@ -507,15 +1137,42 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	return args
 }
 
+// 解析展开表达式 '...arr'
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	expression := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(PREFIX)
+
+	return expression
+}
+
 // 解析字符串字面量
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	if max := p.limits.MaxStringLength; max > 0 && len(p.curToken.Literal) > max {
+		p.errorAt(p.curToken.Pos, "string literal too long: %d bytes, limit %d",
+			len(p.curToken.Literal), max)
+		return nil
+	}
+	return &ast.StringLiteral{Token: p.curToken, Value: p.intern(p.curToken.Literal)}
+}
+
+// 返回字符串池中的字符串
+// 第一次出现时复制一份, 不再引用整个源码
+func (p *Parser) intern(s string) string {
+	if interned, ok := p.interned[s]; ok {
+		return interned
+	}
+	interned := string([]byte(s))
+	p.interned[interned] = interned
+	return interned
 }
 
 // 解析数组字面量
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken.Pos
 	return array
 }
 
@@ -536,6 +1193,11 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 	// 每读到一个','代表数组里面的一个表达式
 	for p.peekTokenIs(token.COMMA) {
+		if max := p.limits.MaxElements; max > 0 && len(list) >= max {
+			p.errorAt(p.peekToken.Pos, "too many elements in list: limit %d", max)
+			return nil
+		}
+
 		p.nextToken()
 		p.nextToken()
 		list = append(list, p.parseExpression(LOWEST))
@@ -549,32 +1211,114 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 }
 
 // 解析下标
+// 带':'的为切片: a[1:3], a[:2], a[1:], a[:]
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	// left为数组/map
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
+	// a[:end]
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	p.nextToken()
 
 	// '[]'之间解析出来为下标值
 	exp.Index = p.parseExpression(LOWEST)
 
+	// a[start:end]
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
 	// 碰到']'结束
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken.Pos
 
 	return exp
 }
 
+// 解析切片的结束下标
+// 调用时当前token为':'
+func (p *Parser) parseSliceExpression(tok token.Token, left ast.Expression,
+	start ast.Expression) ast.Expression {
+
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	// a[start:]
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.Rbracket = p.curToken.Pos
+		return exp
+	}
+
+	p.nextToken()
+	exp.Stop = p.parseExpression(LOWEST)
+
+	// 碰到']'结束
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken.Pos
+
+	return exp
+}
+
+// 解析区间表达式
+// 区间不能连用: 1..2..3 是错误的
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	exp := &ast.RangeExpression{
+		Token:     p.curToken,
+		Start:     start,
+		Exclusive: p.curTokenIs(token.RANGE_LT),
+	}
+
+	p.nextToken()
+	exp.Stop = p.parseExpression(RANGE)
+
+	if p.peekTokenIs(token.RANGE) || p.peekTokenIs(token.RANGE_LT) {
+		p.errorAt(p.peekToken.Pos, "unexpected %s after range %s", p.peekToken.Literal, exp)
+		return nil
+	}
+
+	return exp
+}
+
+// 解析成员访问
+// '.' 后面必须为标识符
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	exp := &ast.DotExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
 // 解析数组字面量
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
+
+	// 字面量 key 第一次出现的位置, 用于检查重复的 key
+	seen := make(map[string]token.Position)
 
 	for !p.peekTokenIs(token.RBRACE) {
+		if max := p.limits.MaxHashPairs; max > 0 && len(hash.Pairs) >= max {
+			p.errorAt(p.peekToken.Pos, "too many pairs in hash literal: limit %d", max)
+			return nil
+		}
+
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
+		p.checkDuplicateKey(key, seen)
 
 		if !p.expectPeek(token.COLON) {
 			return nil
@@ -582,7 +1326,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -592,6 +1336,94 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken.Pos
 
 	return hash
 }
+
+// map 字面量中重复的字面量 key, 执行时后面的值覆盖前面的
+func (p *Parser) checkDuplicateKey(key ast.Expression, seen map[string]token.Position) {
+	var id, display string
+	switch key := key.(type) {
+	case *ast.StringLiteral:
+		id, display = "string:"+key.Value, `"`+key.Value+`"`
+	case *ast.IntegerLiteral:
+		id, display = "int:"+key.String(), key.String()
+	case *ast.Boolean:
+		id, display = "bool:"+key.String(), key.String()
+	default:
+		return
+	}
+
+	if prev, ok := seen[id]; ok {
+		warning := p.warnAt(key.Pos(), "duplicate key %s in hash literal, previous at line %d, column %d",
+			display, prev.Line, prev.Column)
+		warning.Hint = "the last value for a duplicate key wins"
+		return
+	}
+	seen[id] = key.Pos()
+}
+
+// 解析 match 表达式
+// match (x) { 1 => "one", _ => "other" }
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	// 期望'('
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	// 期望')'
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 期望'{'
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Arms = []*ast.MatchArm{}
+	hasDefault := false
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := &ast.MatchArm{Token: p.curToken}
+
+		// '_' 为默认分支, 且只能出现在最后
+		if hasDefault {
+			p.errorAt(p.curToken.Pos, "unreachable match arm after default arm '_'")
+			return nil
+		}
+		if p.curTokenIs(token.IDENT) && p.curToken.Literal == "_" {
+			hasDefault = true
+		} else {
+			arm.Pattern = p.parseExpression(LOWEST)
+		}
+
+		// 期望'=>'
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	// 期望'}'结束
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	expression.Rbrace = p.curToken.Pos
+
+	return expression
+}
@@ -2,10 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"mk/ast"
 	"mk/lexer"
+	"mk/token"
 )
 
 // 测试let语句解析
@@ -370,17 +372,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}{
 		{"-a * b", "((-a) * b)"},
 		{"!-a", "(!(-a))"},
-		{"a + b + c", "(a + (b + c))"},
-		{"a + b - c", "(a + (b - c))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b - c", "((a + b) - c)"},
 		{"a * b * c", "((a * b) * c)"},
 		{"a * b / c", "((a * b) / c)"},
 		{"a + b / c", "(a + (b / c))"},
-		{"a + b * c + d / e - f", "(a + ((b * c) + ((d / e) - f)))"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
 		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"a ? b : c", "(a ? b : c)"},
+		{"a == b ? c * d : -e", "((a == b) ? (c * d) : (-e))"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a ? b ? c : d : e", "(a ? (b ? c : d) : e)"},
+		{"f(a ? b : c, d)", "f((a ? b : c), d)"},
 	}
 
 	for _, tt := range tests {
@@ -564,3 +571,868 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
+
+// 检查 match 表达式解析
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) { 1 => "one", y + 1 => z, _ => 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	if len(exp.Arms) != 3 {
+		t.Fatalf("exp.Arms does not contain 3 arms. got=%d", len(exp.Arms))
+	}
+
+	testLiteralExpression(t, exp.Arms[0].Pattern, 1)
+	testInfixExpression(t, exp.Arms[1].Pattern, "y", "+", 1)
+	testLiteralExpression(t, exp.Arms[1].Body, "z")
+
+	if exp.Arms[2].Pattern != nil {
+		t.Errorf("default arm pattern is not nil. got=%s", exp.Arms[2].Pattern)
+	}
+	testLiteralExpression(t, exp.Arms[2].Body, 0)
+
+	expected := `match (x) { 1 => one, (y + 1) => z, _ => 0 }`
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q",
+			expected, program.String())
+	}
+}
+
+// 默认分支之后不能再有分支
+func TestMatchExpressionDefaultArmLast(t *testing.T) {
+	l := lexer.New(`match (x) { _ => 0, 1 => 1 }`)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors for arm after default arm")
+	}
+}
+
+// 检查函数参数默认值解析
+func TestFunctionParameterDefaults(t *testing.T) {
+	input := `fn(x, y = 1, z = x + 2) { x };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 3 {
+		t.Fatalf("length parameters wrong. want 3, got=%d\n",
+			len(function.Parameters))
+	}
+	if _, ok := function.Defaults["x"]; ok {
+		t.Errorf("parameter x should not have a default value")
+	}
+	testLiteralExpression(t, function.Defaults["y"], 1)
+	testInfixExpression(t, function.Defaults["z"], "x", "+", 2)
+
+	if function.String() != "fn(x, y = 1, z = (x + 2)) x" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+
+	l = lexer.New(`fn(x = 1, y) { x };`)
+	p = New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected error for parameter without default after default")
+	}
+}
+
+// 检查剩余参数和展开表达式解析
+func TestRestParameterAndSpreadParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(first, ...rest) { rest }", "fn(first, ...rest) rest"},
+		{"fn(...args) { args }", "fn(...args) args"},
+		{"fn(a, b = 1, ...c) { c }", "fn(a, b = 1, ...c) c"},
+		{"sum(...arr)", "sum(...arr)"},
+		{"sum(1, ...a, ...f(b))", "sum(1, ...a, ...f(b))"},
+		{"[0, ...a]", "[0, ...a]"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("fn(...rest, x) { x }")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected error for parameter after rest parameter")
+	}
+}
+
+// 检查成员访问解析
+func TestDotExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"person.name", "(person.name)"},
+		{"a.b.c", "((a.b).c)"},
+		{"a.b[0]", "((a.b)[0])"},
+		{"a[0].b", "((a[0]).b)"},
+		{"a.f(1)", "(a.f)(1)"},
+		{"-a.b * c", "((-(a.b)) * c)"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("a.1")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected error for non-identifier after '.'")
+	}
+}
+
+// 检查区间表达式解析
+func TestRangeExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..10", "(1..10)"},
+		{"1..<10", "(1..<10)"},
+		{"a + 1..b * 2", "((a + 1)..(b * 2))"},
+		{"0..<len(xs)", "(0..<len(xs))"},
+		{"1..n == r", "((1..n) == r)"},
+		{"(1..3)[0]", "((1..3)[0])"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("1..2..3")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected error for chained ranges")
+	}
+}
+
+// 检查切片表达式解析
+func TestSliceExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr[1:4]", "(arr[1:4])"},
+		{"arr[:2]", "(arr[:2])"},
+		{"s[3:]", "(s[3:])"},
+		{"s[:]", "(s[:])"},
+		{"a[i + 1:len(a) - 1]", "(a[(i + 1):(len(a) - 1)])"},
+		{"a[c ? 1 : 2:]", "(a[(c ? 1 : 2):])"},
+		{"a[1:2][0]", "((a[1:2])[0])"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+// 检查const语句解析
+func TestConstStatements(t *testing.T) {
+	l := lexer.New("const PI = 3;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false")
+	}
+	if !testLiteralExpression(t, stmt.Value, 3) {
+		return
+	}
+	if stmt.String() != "const PI = 3;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+// 检查出错后的恢复: 一次报告所有语句中的错误, 并且带有位置
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let x = ;
+let y = 5;
+let = 3;
+{1: }; 2;
+if (x { 1 }
+let z = 10;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"line 1, column 9: no prefix parse function for ; found",
+		"line 3, column 5: expected next token to be IDENT, got = instead",
+		"line 4, column 5: no prefix parse function for } found",
+		"line 5, column 7: expected next token to be ), got { instead",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d: %q",
+			len(expectedErrors), len(errors), errors)
+	}
+	for i, msg := range expectedErrors {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	expected := "let y = 5;2let z = 10;"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+// 检查缺少结束符号时不会死循环
+func TestParserUnterminatedInput(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn() { 1", "line 1, column 9: expected next token to be }, got EOF instead"},
+		{"[1, 2", "line 1, column 6: expected next token to be ], got EOF instead"},
+		{"return", "line 1, column 7: no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+// 检查带源码片段和建议的错误信息
+func TestDetailedErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let a = [1, ];",
+			"line 1, column 13: no prefix parse function for ] found\n" +
+				"  let a = [1, ];\n" +
+				"              ^\n" +
+				"hint: unexpected ']' - did you forget an element after the comma?",
+		},
+		{
+			"let x = 1;\n\tlet b = (2 + 3;",
+			"line 2, column 16: expected next token to be ), got ; instead\n" +
+				"  \tlet b = (2 + 3;\n" +
+				"  \t              ^\n" +
+				"hint: missing ')' before ';'",
+		},
+		{
+			"let = 1;",
+			"line 1, column 5: expected next token to be IDENT, got = instead\n" +
+				"  let = 1;\n" +
+				"      ^\n" +
+				"hint: expected a name, found '='",
+		},
+		{
+			"if (true) {\n1",
+			"line 2, column 2: expected next token to be }, got EOF instead\n" +
+				"  1\n" +
+				"   ^\n" +
+				"hint: missing '}' to close the block opened at line 1, column 11",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.DetailedErrors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 error for %q, got %d: %q", tt.input, len(errors), p.Errors())
+		}
+		if got := errors[0].Format(tt.input); got != tt.expected {
+			t.Errorf("wrong error for %q.\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, got)
+		}
+		if errors[0].Error() != p.Errors()[0] {
+			t.Errorf("Error() and Errors() differ. %q != %q", errors[0].Error(), p.Errors()[0])
+		}
+	}
+}
+
+// 检查解析限制
+func TestParserLimits(t *testing.T) {
+	limits := Limits{MaxDepth: 10, MaxStringLength: 5, MaxElements: 3, MaxHashPairs: 2}
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20),
+			"line 1, column 11: expression nested too deeply: limit 10"},
+		{strings.Repeat("[", 20) + strings.Repeat("]", 20),
+			"line 1, column 11: expression nested too deeply: limit 10"},
+		{strings.Repeat("fn() { ", 20) + strings.Repeat("}", 20) + "; let x = 1;",
+			"line 1, column 71: expression nested too deeply: limit 10"},
+		{`"123456"`, "line 1, column 1: string literal too long: 6 bytes, limit 5"},
+		{"[1, 2, 3, 4]", "line 1, column 9: too many elements in list: limit 3"},
+		{"f(1, 2, 3, 4)", "line 1, column 10: too many elements in list: limit 3"},
+		{`{1: 1, 2: 2, 3: 3}`, "line 1, column 14: too many pairs in hash literal: limit 2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.SetLimits(limits)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %.30q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors)
+		}
+	}
+
+	// 在限制之内
+	l := lexer.New(`[1, 2, 3]; {1: 1, 2: 2}; "12345"; ((((1))))`)
+	p := New(l)
+	p.SetLimits(limits)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+// 检查默认限制下恶意输入不会耗尽栈
+func TestDefaultLimitsDeepNesting(t *testing.T) {
+	input := strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000)
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := fmt.Sprintf("line 1, column %d: expression nested too deeply: limit %d",
+		DefaultLimits.MaxDepth+1, DefaultLimits.MaxDepth)
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. expected=%q, got=%q", expected, p.Errors())
+	}
+}
+
+// 检查自定义运算符的优先级和结合性
+func TestCustomOperators(t *testing.T) {
+	if err := RegisterOperator("**", PREFIX, ASSOC_RIGHT); err != nil {
+		t.Fatalf("RegisterOperator error: %s", err)
+	}
+	if err := RegisterOperator("<=>", EQUALS, ASSOC_LEFT); err != nil {
+		t.Fatalf("RegisterOperator error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ** b ** c", "(a ** (b ** c))"},
+		{"-a ** b", "((-a) ** b)"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a ** b * c", "((a ** b) * c)"},
+		{"a <=> b <=> c", "((a <=> b) <=> c)"},
+		{"a + b <=> c * d", "((a + b) <=> (c * d))"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a * b", "(a * b)"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		symbol     string
+		precedence int
+		expected   string
+	}{
+		{"+", SUM, `operator "+" is already defined`},
+		{"==", EQUALS, `operator "==" is already defined`},
+		{"and", SUM, `invalid operator "and": must consist of ` + OPERATOR_CHARS},
+		{"|>", SUM, `operator "|>" is already defined`},
+		{"%%", CALL, `invalid precedence 10 for operator "%%": must be between LOWEST and PREFIX`},
+	}
+	for _, tt := range errorTests {
+		err := RegisterOperator(tt.symbol, tt.precedence, ASSOC_LEFT)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.symbol, tt.expected, err)
+		}
+	}
+}
+
+// 检查各种恶意输入: 都应该很快结束, 并且只报告一个错误
+func TestPathologicalInputs(t *testing.T) {
+	n := 50000
+	tooDeep := fmt.Sprintf("expression nested too deeply: limit %d", DefaultLimits.MaxDepth)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"parens", strings.Repeat("(", n) + "1" + strings.Repeat(")", n)},
+		{"unclosed parens", strings.Repeat("(", n)},
+		{"prefix", strings.Repeat("-", n) + "1"},
+		{"bang", strings.Repeat("!", n) + "true"},
+		{"arrays", strings.Repeat("[", n) + strings.Repeat("]", n)},
+		{"hashes", strings.Repeat("{1: ", n) + "1" + strings.Repeat("}", n)},
+		{"calls", strings.Repeat("f(", n) + strings.Repeat(")", n)},
+		{"index", "a" + strings.Repeat("[a", n) + strings.Repeat("]", n)},
+		{"functions", strings.Repeat("fn() { ", n) + strings.Repeat("}", n)},
+		{"ifs", strings.Repeat("if (true) { ", n) + strings.Repeat("}", n)},
+		{"ternaries", strings.Repeat("a ? b : ", n) + "c"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.DetailedErrors()
+		if len(errors) != 1 || errors[0].Message != tooDeep {
+			t.Errorf("%s: expected one %q error, got %q", tt.name, tooDeep, p.Errors())
+		}
+	}
+}
+
+// 检查长的左结合表达式不受嵌套深度的限制
+func TestLongOperatorChain(t *testing.T) {
+	input := "1" + strings.Repeat(" + 1", 50000)
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+// 检查错误太多时放弃解析
+func TestTooManyErrors(t *testing.T) {
+	input := strings.Repeat("} ", 50000)
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != DefaultLimits.MaxErrors+1 {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d",
+			DefaultLimits.MaxErrors+1, len(errors))
+	}
+	if last := errors[len(errors)-1]; !strings.HasSuffix(last, "too many errors") {
+		t.Errorf("last error should be 'too many errors', got %q", last)
+	}
+}
+
+// 检查运算符信息和解析器一致
+func TestSpecAssociativity(t *testing.T) {
+	tests := []struct {
+		input    string
+		spec     Spec
+		expected string
+	}{
+		{"a + b - c", SPEC_STANDARD, "((a + b) - c)"},
+		{"a - b + c", SPEC_STANDARD, "((a - b) + c)"},
+		{"a + b + c", SPEC_STANDARD, "((a + b) + c)"},
+		{"a + b - c", SPEC_LEGACY, "(a + (b - c))"},
+		{"a - b + c", SPEC_LEGACY, "((a - b) + c)"},
+		{"a + b + c", SPEC_LEGACY, "(a + (b + c))"},
+		{"a + b * c + d", SPEC_LEGACY, "(a + ((b * c) + d))"},
+		{"a * b + c", SPEC_LEGACY, "((a * b) + c)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.SetSpec(tt.spec)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong parse for %q in %s spec. expected=%q, got=%q",
+				tt.input, tt.spec, tt.expected, got)
+		}
+	}
+
+	// DefaultSpec 影响新建的 Parser 和 Operators()
+	DefaultSpec = SPEC_LEGACY
+	defer func() { DefaultSpec = SPEC_STANDARD }()
+
+	program := New(lexer.New("a + b + c")).ParseProgram()
+	if got := program.String(); got != "(a + (b + c))" {
+		t.Errorf("DefaultSpec not used by New. got=%q", got)
+	}
+	for _, op := range Operators() {
+		if op.Symbol == "+" && op.Associativity != ASSOC_RIGHT {
+			t.Errorf("Operators() should report '+' as right-associative in legacy spec")
+		}
+	}
+
+	if spec, ok := LookupSpec("legacy"); !ok || spec != SPEC_LEGACY {
+		t.Errorf("LookupSpec(legacy) wrong. got=%s, %t", spec, ok)
+	}
+	if _, ok := LookupSpec("strict"); ok {
+		t.Errorf("LookupSpec should reject unknown spec")
+	}
+}
+
+func TestOperatorsMetadata(t *testing.T) {
+	ops := Operators()
+
+	for precedence, name := range map[int]string{LOWEST: "LOWEST", PIPE: "PIPE", INDEX: "INDEX", 99: "99"} {
+		if got := PrecedenceName(precedence); got != name {
+			t.Errorf("wrong name for precedence %d. expected=%q, got=%q", precedence, name, got)
+		}
+	}
+
+	found := map[string]OperatorInfo{}
+	for i, op := range ops {
+		found[op.Symbol] = op
+
+		if i > 0 && ops[i-1].Precedence > op.Precedence {
+			t.Errorf("operators not sorted by precedence at %q", op.Symbol)
+		}
+
+		// 每个运算符都是一个完整的token
+		l := lexer.New(op.Symbol)
+		if tok := l.NextToken(); string(tok.Type) != op.Symbol {
+			t.Errorf("operator %q lexed as %s", op.Symbol, tok.Type)
+		}
+	}
+
+	tests := []struct {
+		symbol        string
+		precedence    int
+		associativity string
+	}{
+		{"+", SUM, "left"},
+		{"*", PRODUCT, "left"},
+		{"==", EQUALS, "left"},
+		{"?", TERNARY, "right"},
+		{"..", RANGE, "none"},
+		{"|>", PIPE, "left"},
+		{"(", CALL, "left"},
+	}
+	for _, tt := range tests {
+		op, ok := found[tt.symbol]
+		if !ok {
+			t.Errorf("operator %q not found", tt.symbol)
+			continue
+		}
+		if op.Precedence != tt.precedence || op.Associativity.String() != tt.associativity {
+			t.Errorf("wrong info for %q. got=%+v", tt.symbol, op)
+		}
+		if op.Custom {
+			t.Errorf("builtin operator %q marked as custom", tt.symbol)
+		}
+	}
+}
+
+// 检查 try/catch/finally 和 throw 的解析
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x } catch (e) { y }`, "try x catch (e) y"},
+		{`try { x } catch (e: TypeError) { y } catch (e) { z }`, "try x catch (e: TypeError) y catch (e) z"},
+		{`try { x } finally { y }`, "try x finally y"},
+		{`let r = try { x } catch (e) { y } finally { z };`, "let r = try x catch (e) y finally z;"},
+		{`throw "boom";`, `throw boom;`},
+		{`throw a + 1`, `throw (a + 1);`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x }`, "line 1, column 1: try without catch or finally"},
+		{`try { x } catch { y }`, "line 1, column 17: expected next token to be (, got { instead"},
+		{`try { x } catch (e: 1) { y }`, "line 1, column 21: expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestStructStatementParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }`, "struct Point { x, y }"},
+		{`struct Point { x, y, }; Point(1, 2)`, "struct Point { x, y }Point(1, 2)"},
+		{`struct Empty {}`, "struct Empty { }"},
+		{"struct Row {\n  id,\n  name\n}\nlet r = Row(1, 2);", "struct Row { id, name }let r = Row(1, 2);"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New(`struct Point { x, y }`)).ParseProgram()
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "Point" || len(stmt.Fields) != 2 || stmt.Fields[1].Value != "y" {
+		t.Errorf("wrong struct statement. got=%s", stmt.String())
+	}
+	if end := stmt.End(); end.Line != 1 || end.Column != 22 {
+		t.Errorf("wrong end position. got=%d:%d", end.Line, end.Column)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct { x }`, "line 1, column 8: expected next token to be IDENT, got { instead"},
+		{`struct P { x y }`, "line 1, column 14: expected next token to be ,, got IDENT instead"},
+		{`struct P { x, 1 }`, "line 1, column 15: expected next token to be IDENT, got INT instead"},
+		{`struct P { x, y, x }`, "line 1, column 18: duplicate field x in struct P"},
+	}
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestPipeExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x |> f", "(x |> f)"},
+		{"x |> f(a, b)", "(x |> f(a, b))"},
+		{"data |> filter(isEven) |> map(double) |> sum", "(((data |> filter(isEven)) |> map(double)) |> sum)"},
+		{"1 + 2 |> f", "((1 + 2) |> f)"},
+		{"x |> f == y", "((x |> f) == y)"},
+		{"x |> h.g(1)", "(x |> (h.g)(1))"},
+		{"1..3 |> sum", "((1..3) |> sum)"},
+		{"x |> fn(a) { a }", "(x |> fn(a) a)"},
+		{"let r = [1, 2] |> len;", "let r = ([1, 2] |> len);"},
+		{"x |> (y |> f)", "(x |> (y |> f))"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+// 检查节点在源码中的范围
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, "two")[0];
+x |> f;
+match (x) { 1 => [1, 2], _ => {"k": v.w} }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	index := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	call := index.Left.(*ast.CallExpression)
+	pipe := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.PipeExpression)
+	match := program.Statements[3].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		name     string
+		node     ast.Node
+		pos, end token.Position
+	}{
+		{"let", let, token.Position{Line: 1, Column: 1}, token.Position{Line: 3, Column: 2}},
+		{"fn", fn, token.Position{Line: 1, Column: 11}, token.Position{Line: 3, Column: 2}},
+		{"infix", body, token.Position{Line: 2, Column: 3}, token.Position{Line: 2, Column: 8}},
+		{"string", call.Arguments[1], token.Position{Line: 4, Column: 8}, token.Position{Line: 4, Column: 13}},
+		{"call", call, token.Position{Line: 4, Column: 1}, token.Position{Line: 4, Column: 14}},
+		{"index", index, token.Position{Line: 4, Column: 1}, token.Position{Line: 4, Column: 17}},
+		{"pipe", pipe, token.Position{Line: 5, Column: 1}, token.Position{Line: 5, Column: 7}},
+		{"match", match, token.Position{Line: 6, Column: 1}, token.Position{Line: 6, Column: 43}},
+		{"array", match.Arms[0].Body, token.Position{Line: 6, Column: 18}, token.Position{Line: 6, Column: 24}},
+		{"hash", match.Arms[1].Body, token.Position{Line: 6, Column: 31}, token.Position{Line: 6, Column: 41}},
+		{"program", program, token.Position{Line: 1, Column: 1}, token.Position{Line: 6, Column: 43}},
+	}
+
+	for _, tt := range tests {
+		if tt.node.Pos() != tt.pos || tt.node.End() != tt.end {
+			t.Errorf("wrong range for %s. expected=%v-%v, got=%v-%v",
+				tt.name, tt.pos, tt.end, tt.node.Pos(), tt.node.End())
+		}
+	}
+}
+
+// 键值对按源码中的顺序保存, String() 的输出是确定的
+func TestHashLiteralPairOrder(t *testing.T) {
+	input := `{"z": 1, 2: "b", x + 1: y, "a": [1], "z": 3}`
+	expected := []string{`z:1`, `2:b`, `(x + 1):y`, `a:[1]`, `z:3`}
+
+	for i := 0; i < 20; i++ {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+		}
+		for j, pair := range hash.Pairs {
+			if got := pair.Key.String() + ":" + pair.Value.String(); got != expected[j] {
+				t.Errorf("pair %d wrong. expected=%q, got=%q", j, expected[j], got)
+			}
+		}
+		if got := hash.String(); got != `{z:1, 2:b, (x + 1):y, a:[1], z:3}` {
+			t.Errorf("hash.String() wrong. got=%q", got)
+		}
+	}
+}
+
+func TestDuplicateHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`{"a": 1, "b": 2}`, []string{}},
+		{`{"a": 1, "a": 2}`, []string{`line 1, column 10: duplicate key "a" in hash literal, previous at line 1, column 2`}},
+		{"{1: 1, \"1\": 2, true: 3,\n 1: 4, true: 5}", []string{
+			"line 2, column 2: duplicate key 1 in hash literal, previous at line 1, column 2",
+			"line 2, column 8: duplicate key true in hash literal, previous at line 1, column 16",
+		}},
+		// 只检查字面量 key
+		{`{a: 1, a: 2, 1 + 1: 3, 2: 4}`, []string{}},
+		{`[{"a": 1}, {"a": 2}]`, []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := []string{}
+		for _, w := range p.Warnings() {
+			warnings = append(warnings, w.Error())
+		}
+		if strings.Join(warnings, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong warnings for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, warnings)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"mk/object"
+)
+
+// 浏览模式的提示符
+const BROWSE_PROMPT = "(browse) "
+
+// 展开的数组和map每次显示的元素个数
+const BROWSE_PAGE_SIZE = 20
+
+// :browse expr 以树的形式查看 expr 的值, 用于查看 json 解码之后的大对象
+// 数组和map前面有编号, 输入编号展开或者折叠, 元素较多时每次只显示 BROWSE_PAGE_SIZE 个,
+// 输入 m编号 显示更多; 输入 q 或者 EOF 时退出
+//
+//	>> :browse {"name": "mk", "tags": ["a", "b"]}
+//	[1]- {2 keys}
+//	  name: "mk"
+//	  [2]+ tags: [2 items]
+//	(browse) 2
+func (s *session) browseCommand(line string, env *object.Environment) bool {
+	out := s.out
+	if line != ":browse" && !strings.HasPrefix(line, ":browse ") {
+		return false
+	}
+	source := strings.TrimSpace(strings.TrimPrefix(line, ":browse"))
+	if source == "" {
+		io.WriteString(out, "usage: :browse <expr>\n")
+		return true
+	}
+
+	value := s.evaluate(source, env)
+	if value == nil || s.exited {
+		return true
+	}
+	if err, ok := value.(*object.Error); ok {
+		io.WriteString(out, err.Inspect()+"\n")
+		return true
+	}
+
+	// 不是数组或者map时没有什么可以浏览的
+	if browseChildren("$", value) == nil {
+		io.WriteString(out, browseValue(value)+"\n")
+		return true
+	}
+
+	b := &browser{
+		root:     value,
+		expanded: map[string]bool{"$": true},
+		shown:    map[string]int{},
+	}
+	b.render(out)
+	for !s.exited {
+		io.WriteString(out, BROWSE_PROMPT)
+		if !s.scanner.Scan() {
+			return true
+		}
+
+		cmd := strings.TrimSpace(s.scanner.Text())
+		switch {
+		case cmd == "q" || cmd == ":q":
+			return true
+		case cmd == "" || cmd == "?":
+			io.WriteString(out, "N: expand or collapse node N, mN: show more of node N, q: quit\n")
+			continue
+		}
+
+		more := strings.HasPrefix(cmd, "m")
+		n, err := strconv.Atoi(strings.TrimPrefix(cmd, "m"))
+		path, ok := b.nodes[n]
+		if err != nil || !ok {
+			fmt.Fprintf(out, "no node %s\n", strings.TrimPrefix(cmd, "m"))
+			continue
+		}
+
+		if more {
+			// 折叠的节点先展开显示第一页
+			if b.expanded[path] {
+				b.shown[path] = b.limit(path) + BROWSE_PAGE_SIZE
+			}
+			b.expanded[path] = true
+		} else {
+			b.expanded[path] = !b.expanded[path]
+		}
+		b.render(out)
+	}
+	return true
+}
+
+// 浏览的状态, 按路径(例如 $.tags[0])记录每个节点是否展开以及显示的元素个数
+type browser struct {
+	root     object.Object
+	expanded map[string]bool
+	shown    map[string]int
+	nodes    map[int]string // 上一次输出的编号 -> 路径
+}
+
+func (b *browser) limit(path string) int {
+	if n, ok := b.shown[path]; ok {
+		return n
+	}
+	return BROWSE_PAGE_SIZE
+}
+
+func (b *browser) render(out io.Writer) {
+	b.nodes = map[int]string{}
+	b.renderNode(out, "$", "", b.root, "")
+}
+
+// 输出一个节点, 展开的数组和map接着输出其中的元素
+func (b *browser) renderNode(out io.Writer, path, label string, value object.Object, indent string) {
+	children := browseChildren(path, value)
+	if children == nil {
+		io.WriteString(out, indent+label+browseValue(value)+"\n")
+		return
+	}
+
+	id := len(b.nodes) + 1
+	b.nodes[id] = path
+	marker := "+"
+	if b.expanded[path] {
+		marker = "-"
+	}
+	fmt.Fprintf(out, "%s[%d]%s %s%s\n", indent, id, marker, label, browseSummary(value))
+	if !b.expanded[path] {
+		return
+	}
+
+	limit := b.limit(path)
+	for i, child := range children {
+		if i == limit {
+			fmt.Fprintf(out, "%s  ... %d more, type m%d to show more\n", indent, len(children)-limit, id)
+			break
+		}
+		b.renderNode(out, child.path, child.label, child.value, indent+"  ")
+	}
+}
+
+type browseChild struct {
+	path  string
+	label string
+	value object.Object
+}
+
+// 数组和map的元素, 其他值返回 nil
+func browseChildren(path string, value object.Object) []browseChild {
+	switch value := value.(type) {
+	case *object.Array:
+		children := make([]browseChild, len(value.Elements))
+		for i, el := range value.Elements {
+			children[i] = browseChild{
+				path:  fmt.Sprintf("%s[%d]", path, i),
+				label: fmt.Sprintf("%d: ", i),
+				value: el,
+			}
+		}
+		return children
+	case *object.Hash:
+		children := make([]browseChild, 0, value.Len())
+		for _, pair := range value.Ordered() {
+			key := pair.Key.Inspect()
+			if _, ok := pair.Key.(*object.String); !ok {
+				key = "(" + key + ")"
+			}
+			children = append(children, browseChild{
+				path:  path + "." + key,
+				label: key + ": ",
+				value: pair.Value,
+			})
+		}
+		return children
+	default:
+		return nil
+	}
+}
+
+func browseSummary(value object.Object) string {
+	switch value := value.(type) {
+	case *object.Array:
+		return plural(len(value.Elements), "item", "[", "]")
+	case *object.Hash:
+		return plural(value.Len(), "key", "{", "}")
+	default:
+		return value.Inspect()
+	}
+}
+
+func plural(n int, noun, open, close string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%s%d %s%s", open, n, noun, close)
+}
+
+// 叶子节点的值, 字符串带引号以便区分 "1" 和 1
+func browseValue(value object.Object) string {
+	if s, ok := value.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return value.Inspect()
+}
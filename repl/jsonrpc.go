@@ -0,0 +1,233 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"mk/evaluator"
+	"mk/lexer"
+	"mk/object"
+	"mk/parser"
+)
+
+// 编辑器使用的执行协议(mk repl --json-rpc)
+// 标准输入每行一个 JSON-RPC 2.0 请求, 标准输出每行一个响应, 所有代码块共用一个环境
+//
+//	eval      {"code": "..."}  执行一个代码块, 返回 evalResult
+//	reset     无参数            丢弃之前定义的所有变量
+//	shutdown  无参数            响应之后结束
+//
+// 例如:
+//
+//	--> {"jsonrpc": "2.0", "id": 1, "method": "eval", "params": {"code": "puts(1); 1 + 1"}}
+//	<-- {"jsonrpc": "2.0", "id": 1, "result": {"ok": true, "value": "2", "type": "INTEGER", "stdout": "1\n", ...}}
+//
+// 没有 id 的请求为通知, 不返回响应
+func ServeJSONRPC(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	encoder := json.NewEncoder(out)
+	env := newEnvironment()
+	defer func() { closeEnvironment(env) }()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			resp, stop := handleRPC(line, &env)
+			if resp != nil {
+				if err := encoder.Encode(resp); err != nil {
+					return err
+				}
+			}
+			if stop {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// JSON-RPC 2.0 的错误码
+const (
+	RPC_PARSE_ERROR      = -32700
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// 处理一个请求, 返回响应(通知为nil)以及是否结束
+func handleRPC(line []byte, env **object.Environment) (*rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return rpcFailure(nil, RPC_PARSE_ERROR, "parse error: "+err.Error()), false
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, RPC_INVALID_REQUEST, "invalid request"), false
+	}
+
+	var resp *rpcResponse
+	stop := false
+
+	switch req.Method {
+	case "eval":
+		var params struct {
+			Code *string `json:"code"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Code == nil {
+			resp = rpcFailure(req.ID, RPC_INVALID_PARAMS, `invalid params: want {"code": string}`)
+			break
+		}
+		resp = rpcSuccess(req.ID, evalCell(*params.Code, *env))
+
+	case "reset":
+		closeEnvironment(*env)
+		*env = newEnvironment()
+		resp = rpcSuccess(req.ID, struct{}{})
+
+	case "shutdown":
+		resp = rpcSuccess(req.ID, struct{}{})
+		stop = true
+
+	default:
+		resp = rpcFailure(req.ID, RPC_METHOD_NOT_FOUND, "method not found: "+req.Method)
+	}
+
+	// 通知不需要响应
+	if req.ID == nil {
+		return nil, stop
+	}
+	return resp, stop
+}
+
+func rpcSuccess(id json.RawMessage, result interface{}) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: rpcID(id), Result: result}
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: rpcID(id), Error: &rpcError{Code: code, Message: message}}
+}
+
+// 无法确定 id 时响应中的 id 为 null
+func rpcID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// eval 的结果
+// value 为结果的显示形式, 出错或者没有结果时为 null;
+// stdout/stderr 为执行期间脚本的输出; diagnostics 包括语法错误, 警告和运行时错误
+type evalResult struct {
+	OK          bool         `json:"ok"`
+	Value       *string      `json:"value"`
+	Type        string       `json:"type,omitempty"`
+	Stdout      string       `json:"stdout"`
+	Stderr      string       `json:"stderr"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+	ExitCode    *int64       `json:"exit_code,omitempty"` // 代码块中调用了 exit(n)
+	Stack       []stackFrame `json:"stack,omitempty"`     // 运行时错误的调用栈
+	JSON        interface{}  `json:"json,omitempty"`      // 结果转换成的 JSON 值
+}
+
+type diagnostic struct {
+	Severity string `json:"severity"` // error 或者 warning
+	Kind     string `json:"kind"`     // ParseError, Warning 或者运行时错误的类别
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+type stackFrame struct {
+	Name   string `json:"name"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// 在 env 中执行一个代码块, 执行期间捕获脚本的输出
+func evalCell(code string, env *object.Environment) *evalResult {
+	result := &evalResult{Diagnostics: []diagnostic{}}
+
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+
+	for _, w := range p.Warnings() {
+		result.Diagnostics = append(result.Diagnostics, diagnostic{
+			Severity: "warning", Kind: "Warning", Message: w.Message,
+			Line: w.Pos.Line, Column: w.Pos.Column, Hint: w.Hint,
+		})
+	}
+	if errors := p.DetailedErrors(); len(errors) != 0 {
+		for _, err := range errors {
+			result.Diagnostics = append(result.Diagnostics, diagnostic{
+				Severity: "error", Kind: "ParseError", Message: err.Message,
+				Line: err.Pos.Line, Column: err.Pos.Column, Hint: err.Hint,
+			})
+		}
+		return result
+	}
+
+	var stdout, stderr bytes.Buffer
+	evaluated := func() object.Object {
+		savedOut, savedErr := evaluator.Stdout, evaluator.Stderr
+		evaluator.Stdout, evaluator.Stderr = &stdout, &stderr
+		// 代码块中出现 panic 时也要恢复, 否则之后进程的输出都会写入这里的缓冲区
+		defer func() { evaluator.Stdout, evaluator.Stderr = savedOut, savedErr }()
+		return evaluator.Eval(program, env)
+	}()
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		result.Diagnostics = append(result.Diagnostics, diagnostic{
+			Severity: "error", Kind: string(evaluated.Kind), Message: evaluated.Message,
+			Line: evaluated.Pos.Line, Column: evaluated.Pos.Column,
+		})
+		for _, f := range evaluated.Stack {
+			result.Stack = append(result.Stack, stackFrame{Name: f.Name, Line: f.Pos.Line, Column: f.Pos.Column})
+		}
+
+	case *object.Exit:
+		result.OK = true
+		result.ExitCode = &evaluated.Code
+
+	case nil:
+		result.OK = true
+
+	default:
+		value := evaluated.Inspect()
+		result.OK = true
+		result.Value = &value
+		result.Type = string(evaluated.Type())
+		result.JSON = object.ToJSONValue(evaluated)
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"mk/evaluator"
 	"mk/lexer"
@@ -13,42 +14,214 @@ import (
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+// 断点处的提示符
+const DEBUG_PROMPT = "(debug) "
 
-	for {
-		fmt.Printf(PROMPT)
+// 粘贴模式中每一行的提示符
+const PASTE_PROMPT = "... "
+
+// 粘贴模式的结束标记, 单独一行
+const PASTE_END = "."
+
+// 一次 REPL 会话的输入输出和状态
+type session struct {
+	in       io.Reader
+	scanner  *bufio.Scanner
+	out      io.Writer
+	exited   bool // 执行了 exit(n), 之后不再读取输入
+	exitCode int  // exit(n) 的 n, 由 Start 返回
+}
+
+func newSession(in io.Reader, out io.Writer) *session {
+	return &session{in: in, scanner: bufio.NewScanner(in), out: out}
+}
+
+// 运行 REPL 直到输入结束或者执行了 exit(n), 返回退出码(输入结束时为0), 由调用方决定是否退出进程
+func Start(in io.Reader, out io.Writer) int {
+	return newSession(in, out).run()
+}
 
-		scanned := scanner.Scan()
+func (s *session) run() int {
+	out := s.out
+	env := newEnvironment()
+	defer closeEnvironment(env)
+
+	// 挂载调试器: 执行到 breakpoint() 时进入断点处的环境
+	evaluator.Debugger = s.debug
+	defer func() { evaluator.Debugger = nil }()
+
+	for !s.exited {
+		io.WriteString(out, PROMPT)
+
+		scanned := s.scanner.Scan()
 		if !scanned {
-			return
+			return 0
 		}
 
-		line := scanner.Text()
+		line := s.scanner.Text()
 
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+		// :verbose 切换函数的完整输出
+		if line == ":verbose" {
+			object.VerboseInspect = !object.VerboseInspect
+			fmt.Fprintf(out, "verbose: %t\n", object.VerboseInspect)
+			continue
+		}
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if watchCommand(out, line, env) || s.browseCommand(line, env) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		// :paste 把多行输入作为一个程序执行
+		if line == ":paste" {
+			source, eof := s.readPaste()
+			if eof {
+				// Ctrl-D 只结束粘贴, 重新读取终端的输入
+				s.scanner = bufio.NewScanner(s.in)
+			}
+			if strings.TrimSpace(source) != "" {
+				s.evalLine(source, env)
+			}
+			continue
 		}
+
+		s.evalLine(line, env)
+	}
+	return s.exitCode
+}
+
+// 粘贴模式
+// 读取输入直到单独一行的 "." 或者 EOF(Ctrl-D), 返回读取的内容以及是否遇到了 EOF
+func (s *session) readPaste() (string, bool) {
+	scanner, out := s.scanner, s.out
+	io.WriteString(out, "paste mode, finish with a line containing only '.' or Ctrl-D\n")
+
+	lines := []string{}
+	for {
+		io.WriteString(out, PASTE_PROMPT)
+		if !scanner.Scan() {
+			return strings.Join(lines, "\n"), true
+		}
+
+		line := scanner.Text()
+		if line == PASTE_END {
+			return strings.Join(lines, "\n"), false
+		}
+		lines = append(lines, line)
+	}
+}
+
+// 断点交互
+// 在断点处的环境中执行输入, 输入 :c 或者 EOF 时继续执行脚本
+func (s *session) debug(env *object.Environment) {
+	scanner, out := s.scanner, s.out
+	io.WriteString(out, "breakpoint hit, type :c to continue\n")
+
+	for !s.exited {
+		io.WriteString(out, DEBUG_PROMPT)
+
+		if !scanner.Scan() {
+			return
+		}
+
+		line := scanner.Text()
+		if line == ":c" || line == ":continue" {
+			return
+		}
+		if watchCommand(out, line, env) || s.browseCommand(line, env) {
+			continue
+		}
+
+		s.evalLine(line, env)
+	}
+}
+
+// :watch x 在变量 x 被赋值时输出原来的值和新值, :unwatch x 取消
+// 在断点处也可以使用, 监视 env 所属的解释器中的赋值; 返回输入是否为这两个命令
+func watchCommand(out io.Writer, line string, env *object.Environment) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (fields[0] != ":watch" && fields[0] != ":unwatch") {
+		return false
+	}
+	if len(fields) != 2 {
+		fmt.Fprintf(out, "usage: %s <name>\n", fields[0])
+		return true
+	}
+
+	in, ok := env.State().(*evaluator.Interpreter)
+	if !ok {
+		in = evaluator.New(evaluator.DefaultOptions())
+		env.SetState(in)
+	}
+	name := fields[1]
+	if fields[0] == ":unwatch" {
+		in.Unwatch(name)
+		return true
+	}
+	in.Watch(name, func(old, val object.Object) object.Object {
+		fmt.Fprintf(out, "watch %s: %s -> %s\n", name, old.Inspect(), val.Inspect())
+		return nil
+	})
+	return true
+}
+
+// 新建会话的环境, 属于一个新的解释器
+func newEnvironment() *object.Environment {
+	env := object.NewEnvironment()
+	env.SetState(evaluator.New(evaluator.DefaultOptions()))
+	return env
+}
+
+// 会话结束或者重置时结束环境所属的解释器中还没有执行完的生成器
+func closeEnvironment(env *object.Environment) {
+	if in, ok := env.State().(*evaluator.Interpreter); ok {
+		in.Close()
+	}
+}
+
+// 解析并执行一行输入(粘贴模式下为多行), 输出结果
+func (s *session) evalLine(line string, env *object.Environment) {
+	out := s.out
+	evaluated := s.evaluate(line, env)
+	if evaluated != nil {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
+	if err, ok := evaluated.(*object.Error); ok && len(err.Stack) != 0 {
+		io.WriteString(out, err.StackTrace())
+		io.WriteString(out, "\n")
+	}
+}
+
+// 解析并执行输入, 有语法错误时输出错误并返回 nil
+// 执行了 exit(n) 时记录退出码, 结束 REPL(回放时结束回放)并返回 nil
+func (s *session) evaluate(source string, env *object.Environment) object.Object {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.DetailedErrors())
+		return nil
+	}
+
+	evaluated := evaluator.Eval(program, env)
+	if s.exited {
+		// 在断点处执行了 exit(n), 不再输出被中断的代码的结果
+		return nil
+	}
+	if result, ok := evaluated.(*object.Exit); ok {
+		s.exited, s.exitCode = true, int(result.Code)
+		return nil
 	}
+	return evaluated
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+func printParserErrors(out io.Writer, line string, errors []*parser.Error) {
 	io.WriteString(out, "no... there is some errors!\n")
 	io.WriteString(out, "| parser errors:\n")
 
-	for _, msg := range errors {
+	for _, err := range errors {
+		msg := strings.Replace(err.Format(line), "\n", "\n\t|  ", -1)
 		io.WriteString(out, "\t|- "+msg+"\n")
 	}
 
@@ -0,0 +1,129 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mk/evaluator"
+)
+
+// 回放 testdata 中的会话记录, 记录需要更新时执行:
+//
+//	go run . repl --script repl/testdata/<name>.txt --update
+func TestTranscripts(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no transcripts found: %v", err)
+	}
+	for _, file := range files {
+		expected, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CompareTranscript(string(expected), RunTranscript(string(expected))); err != nil {
+			t.Errorf("%s: %s", file, err)
+		}
+	}
+}
+
+func TestCompareTranscript(t *testing.T) {
+	tests := []struct {
+		expected string
+		got      string
+		err      string
+	}{
+		{">> 1\n1\n", ">> 1\n1\n>> ", ""},
+		{">> 1  \r\n1\r\n", ">> 1\n1\n", ""},
+		{">> 1\n1\n", ">> 1\n2\n>> ", "transcript differs at line 2:\n  expected: \"1\"\n  got:      \"2\""},
+		{">> 1\n1\n>> 2\n2\n", ">> 1\n1\n", "transcript differs at line 3:\n  expected: \">> 2\"\n  got:      \"\""},
+	}
+	for _, tt := range tests {
+		err := CompareTranscript(tt.expected, tt.got)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("CompareTranscript(%q, %q) wrong. expected=%q, got=%v", tt.expected, tt.got, tt.err, err)
+		}
+	}
+}
+
+func TestStartExitCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"1 + 1\n", 0},
+		{"exit(3)\n1\n", 3},
+		{"let f = fn() { exit(4) };\nf()\n", 4},
+		{"exit(0)\n", 0},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := Start(strings.NewReader(tt.input), &out); code != tt.expected {
+			t.Errorf("wrong exit code for %q. expected=%d, got=%d", tt.input, tt.expected, code)
+		}
+	}
+}
+
+// 编辑器协议: 每行一个请求, 每个有 id 的请求一行响应, 通知没有响应
+func TestServeJSONRPC(t *testing.T) {
+	tests := []struct {
+		request  string
+		response string // 通知为空
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"eval","params":{"code":"let x = 2;\nputs(x); x * 21"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":{"ok":true,"value":"42","type":"INTEGER","stdout":"2\n","stderr":"","diagnostics":[],"json":42}}`},
+		// 运行时错误带有出错的位置和调用栈
+		{`{"jsonrpc":"2.0","id":2,"method":"eval","params":{"code":"let f = fn(a) { a + true };\nf(x)"}}`,
+			`{"jsonrpc":"2.0","id":2,"result":{"ok":false,"value":null,"stdout":"","stderr":"","diagnostics":[{"severity":"error","kind":"TypeError","message":"type mismatch: INTEGER + BOOLEAN","line":1,"column":17}],"stack":[{"name":"f","line":2,"column":1}]}}`},
+		{`{"jsonrpc":"2.0","id":3,"method":"eval","params":{"code":"let = 1"}}`,
+			`{"jsonrpc":"2.0","id":3,"result":{"ok":false,"value":null,"stdout":"","stderr":"","diagnostics":[{"severity":"error","kind":"ParseError","message":"expected next token to be IDENT, got = instead","line":1,"column":5,"hint":"expected a name, found '='"}]}}`},
+		{`{"jsonrpc":"2.0","id":4,"method":"eval","params":{"code":"{\"a\": [x, 2]}"}}`,
+			`{"jsonrpc":"2.0","id":4,"result":{"ok":true,"value":"{a: [2, 2]}","type":"HASH","stdout":"","stderr":"","diagnostics":[],"json":{"a":[2,2]}}}`},
+		{`{"jsonrpc":"2.0","method":"eval","params":{"code":"puts(1)"}}`, ""},
+		{`{"jsonrpc":"2.0","id":"r","method":"reset"}`, `{"jsonrpc":"2.0","id":"r","result":{}}`},
+		{`{"jsonrpc":"2.0","id":5,"method":"eval","params":{"code":"x"}}`,
+			`{"jsonrpc":"2.0","id":5,"result":{"ok":false,"value":null,"stdout":"","stderr":"","diagnostics":[{"severity":"error","kind":"NameError","message":"identifier not found: x","line":1,"column":1}]}}`},
+		{`{"jsonrpc":"2.0","id":6,"method":"eval","params":{"code":"exit(3)"}}`,
+			`{"jsonrpc":"2.0","id":6,"result":{"ok":true,"value":null,"stdout":"","stderr":"","diagnostics":[],"exit_code":3}}`},
+		{`{"jsonrpc":"2.0","id":7,"method":"eval","params":{}}`,
+			`{"jsonrpc":"2.0","id":7,"error":{"code":-32602,"message":"invalid params: want {\"code\": string}"}}`},
+		{`{"jsonrpc":"2.0","id":8,"method":"nope"}`,
+			`{"jsonrpc":"2.0","id":8,"error":{"code":-32601,"message":"method not found: nope"}}`},
+		{`not json`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid character 'o' in literal null (expecting 'u')"}}`},
+		{`{"id":9,"method":"eval"}`,
+			`{"jsonrpc":"2.0","id":9,"error":{"code":-32600,"message":"invalid request"}}`},
+		{`{"jsonrpc":"2.0","id":10,"method":"shutdown"}`, `{"jsonrpc":"2.0","id":10,"result":{}}`},
+		// shutdown 之后的请求不再处理
+		{`{"jsonrpc":"2.0","id":11,"method":"eval","params":{"code":"1"}}`, ""},
+	}
+
+	var input bytes.Buffer
+	expected := []string{}
+	for _, tt := range tests {
+		input.WriteString(tt.request + "\n")
+		if tt.response != "" {
+			expected = append(expected, tt.response)
+		}
+	}
+
+	stdout := evaluator.Stdout
+	var out bytes.Buffer
+	if err := ServeJSONRPC(&input, &out); err != nil {
+		t.Fatalf("ServeJSONRPC returned error: %v", err)
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of responses. expected=%d, got=%d:\n%s", len(expected), len(got), out.String())
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("wrong response %d.\n  expected: %s\n  got:      %s", i, expected[i], got[i])
+		}
+	}
+	if evaluator.Stdout != stdout {
+		t.Errorf("evaluator.Stdout was not restored")
+	}
+}
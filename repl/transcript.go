@@ -0,0 +1,113 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"mk/evaluator"
+	"mk/object"
+)
+
+// REPL 会话记录的回放, 用于检查 REPL 的行为(提示符, 错误格式, 粘贴模式等)没有变化
+// 记录就是终端中看到的内容: 以提示符(">> ", "(debug) ", "... ", "(browse) ")开头的行是输入, 其余是输出
+//
+//	>> let x = 1
+//	1
+//	>> x + true
+//	ERROR: type mismatch: INTEGER + BOOLEAN
+//
+// 回放时把输入依次交给 REPL, 像终端一样回显, 得到新的记录;
+// 脚本调用 exit(n) 时输出 "exit status n" 并结束回放
+// mk repl --script transcript.txt 回放并和原来的记录比较
+func RunTranscript(transcript string) string {
+	var out bytes.Buffer
+
+	savedOut, savedErr := evaluator.Stdout, evaluator.Stderr
+	savedVerbose := object.VerboseInspect
+	evaluator.Stdout, evaluator.Stderr = &out, &out
+	defer func() {
+		evaluator.Stdout, evaluator.Stderr = savedOut, savedErr
+		object.VerboseInspect = savedVerbose
+	}()
+
+	s := newSession(&echoReader{lines: transcriptInput(transcript), out: &out}, &out)
+	code := s.run()
+	if s.exited {
+		fmt.Fprintf(&out, "exit status %d\n", code)
+	}
+	return out.String()
+}
+
+// 比较两个记录, 忽略行尾的空白以及结尾等待输入的提示符
+// 不同时返回的错误中包含第一处不同的行号和两边的内容
+func CompareTranscript(expected, got string) error {
+	want, have := transcriptLines(expected), transcriptLines(got)
+	for i := 0; i < len(want) || i < len(have); i++ {
+		var w, h string
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(have) {
+			h = have[i]
+		}
+		if i >= len(want) || i >= len(have) || w != h {
+			return fmt.Errorf("transcript differs at line %d:\n  expected: %q\n  got:      %q", i+1, w, h)
+		}
+	}
+	return nil
+}
+
+// 记录中的输入: 提示符之后的内容
+func transcriptInput(transcript string) []string {
+	input := []string{}
+	for _, line := range strings.Split(transcript, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		for _, prompt := range []string{PROMPT, DEBUG_PROMPT, PASTE_PROMPT, BROWSE_PROMPT} {
+			if strings.HasPrefix(line, prompt) {
+				input = append(input, line[len(prompt):])
+				break
+			}
+		}
+	}
+	return input
+}
+
+func transcriptLines(transcript string) []string {
+	lines := strings.Split(strings.Replace(transcript, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	for len(lines) > 0 {
+		last := lines[len(lines)-1]
+		if last != "" && last != strings.TrimSpace(PROMPT) {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// 每次读取返回一行输入, 同时像终端一样回显到 out
+// REPL 只在需要下一行时才读取, 所以回显出现在提示符之后
+type echoReader struct {
+	lines   []string
+	out     io.Writer
+	pending []byte
+}
+
+func (r *echoReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if len(r.lines) == 0 {
+			return 0, io.EOF
+		}
+		line := r.lines[0] + "\n"
+		r.lines = r.lines[1:]
+		io.WriteString(r.out, line)
+		r.pending = []byte(line)
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"mk/evaluator"
+	"mk/lexer"
+	"mk/object"
+	"mk/optimizer"
+	"mk/parser"
+)
+
+// 退出码
+// 脚本中调用 exit(n) 时以 n 退出
+const (
+	EXIT_OK       = 0  // 成功
+	EXIT_RUNTIME  = 1  // 运行时错误
+	EXIT_PARSE    = 2  // 语法错误
+	EXIT_RESOURCE = 3  // 超出资源限制
+	EXIT_USAGE    = 64 // 命令行参数错误
+)
+
+// 一次执行的结果
+type execution struct {
+	result      object.Object   // 执行结果, 有语法错误时为nil
+	source      string          // 源码, 用于输出出错的源码行
+	parseErrors []*parser.Error // 语法错误
+	tolerated   []*object.Error // 容错模式下记录的运行时错误
+	stdout      string          // --output=json 时捕获的脚本输出
+	warnings    []string        // 警告
+	parseTime   time.Duration   // 解析耗时
+	evalTime    time.Duration   // 执行耗时
+}
+
+// 执行脚本文件, 返回退出码
+// mk run [--output=text|json] [--strict] [--strict-index] [--tolerant] [--no-optimize] [--spec=standard|legacy] [--max-depth=N] [--max-steps=N] [--max-memory=BYTES] [--no-color] [--resume] <file>
+// file 为 '-' 时从标准输入读取脚本
+// --tolerant 时类型错误, 未定义的标识符, 下标错误被记录下来并以 null 代替, 脚本继续执行
+// --no-optimize 时不对语法树做优化(常量折叠等), 用于调试
+// --spec=legacy 时按旧版本的语法解析('+' 为右结合), 包括 import 的模块
+// --max-depth 为函数的最大调用深度, 超过时报 ResourceError, 为0时不限制
+// --max-steps 为最多执行的语法树节点数, 超过时报不可恢复的 ResourceError, 为0时不限制
+// --max-memory 为字符串, 数组和 map 最多分配的字节数(近似值), 超过时报 ResourceError, 为0时不限制
+// --no-color 时 style() 不输出颜色, 设置了环境变量 NO_COLOR 时也一样
+// --output=json 时脚本写到标准输出的内容(puts, printf 等)放在结果的 stdout 字段中, 标准输出只有一个 JSON 文档
+// checkpoint() 保存到 <file>.checkpoint, --resume 时从最后完成的断点之后继续, 脚本成功执行完之后删除这个文件
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	strictIndex := flags.Bool("strict-index", false, "report an error on out-of-range index instead of returning null")
+	strict := flags.Bool("strict", false, "report an error when a name is declared twice in the same scope")
+	tolerant := flags.Bool("tolerant", false, "record type, name and index errors and continue with null")
+	noOptimize := flags.Bool("no-optimize", false, "evaluate the program without AST optimizations")
+	specName := flags.String("spec", "standard", "language spec: standard, or legacy for right-associative '+'")
+	options := evaluator.DefaultOptions()
+	maxDepth := flags.Int("max-depth", options.MaxCallDepth, "maximum function call depth, 0 for no limit")
+	maxSteps := flags.Int64("max-steps", options.MaxSteps, "maximum evaluation steps, 0 for no limit")
+	maxMemory := flags.Int64("max-memory", options.MaxMemory, "maximum bytes allocated for strings, arrays and hashes, 0 for no limit")
+	noColor := flags.Bool("no-color", false, "disable colors and styles in style()")
+	resume := flags.Bool("resume", false, "skip checkpoints completed by an interrupted run and restore their state")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	options.Tolerant = *tolerant
+	options.MaxCallDepth = *maxDepth
+	options.MaxSteps = *maxSteps
+	options.MaxMemory = *maxMemory
+	options.Strict = *strict
+	options.StrictIndex = *strictIndex
+	if *noColor {
+		evaluator.Color = evaluator.COLOR_NEVER
+	}
+
+	spec, ok := parser.LookupSpec(*specName)
+	if flags.NArg() != 1 || (*output != "text" && *output != "json") || !ok || *maxDepth < 0 || *maxSteps < 0 || *maxMemory < 0 {
+		fmt.Fprintln(os.Stderr, "usage: mk run [--output=text|json] [--strict] [--strict-index] [--tolerant] [--no-optimize] [--spec=standard|legacy] [--max-depth=N] [--max-steps=N] [--max-memory=BYTES] [--no-color] [--resume] <file|->")
+		return EXIT_USAGE
+	}
+	parser.DefaultSpec = spec
+
+	var source []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		source, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		source, err = ioutil.ReadFile(flags.Arg(0))
+		// 脚本中 import 的相对路径相对于脚本所在目录
+		options.ModuleDir = filepath.Dir(flags.Arg(0))
+		options.CheckpointFile = flags.Arg(0) + ".checkpoint"
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_USAGE
+	}
+	in := evaluator.New(options)
+	defer in.Close()
+	if *resume {
+		if err := in.LoadCheckpoint(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+	}
+
+	var stdout bytes.Buffer
+	if *output == "json" {
+		evaluator.Stdout = &stdout
+		defer func() { evaluator.Stdout = os.Stdout }()
+	}
+	ex := execute(string(source), !*noOptimize, in)
+	ex.stdout = stdout.String()
+	if ex.exitCode() == EXIT_OK {
+		if err := in.ClearCheckpoint(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if *output == "json" {
+		return ex.reportJSON(os.Stdout)
+	}
+	return ex.report(os.Stderr)
+}
+
+// 执行命令行中给出的代码, 返回退出码
+// mk -e 'code'
+// 标准输入留给脚本使用, 例如: cat data.txt | mk -e 'puts(len(lines()))'
+// 结果不为null时输出到标准输出
+func runExpression(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mk -e <code>")
+		return EXIT_USAGE
+	}
+
+	in := evaluator.New(evaluator.DefaultOptions())
+	defer in.Close()
+	ex := execute(args[0], true, in)
+	if ex.result != nil && ex.result.Type() != object.NULL_OBJ &&
+		ex.result.Type() != object.ERROR_OBJ && ex.result.Type() != object.EXIT_OBJ {
+		fmt.Println(ex.result.Inspect())
+	}
+	return ex.report(os.Stderr)
+}
+
+// 解析并执行源码
+// optimize 为 true 时执行之前先优化语法树, 然后在 in 中执行
+func execute(source string, optimize bool, in *evaluator.Interpreter) *execution {
+	ex := &execution{source: source, warnings: []string{}}
+
+	start := time.Now()
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	ex.parseTime = time.Since(start)
+
+	for _, warning := range p.Warnings() {
+		ex.warnings = append(ex.warnings, warning.Error())
+	}
+
+	if len(p.Errors()) != 0 {
+		ex.parseErrors = p.DetailedErrors()
+		return ex
+	}
+
+	if optimize {
+		program = optimizer.Optimize(program, in.Options)
+	}
+
+	start = time.Now()
+	env := object.NewEnvironment()
+	evaluator.Interrupt = interrupted()
+	ex.result = in.Eval(program, env)
+
+	// 还有定时任务时进入事件循环, 直到任务全部取消或者收到中断信号
+	if !isFailure(ex.result) && evaluator.HasScheduledJobs() {
+		if result := evaluator.RunScheduler(evaluator.Interrupt); isFailure(result) {
+			ex.result = result
+		}
+	}
+
+	// 执行 on_exit 注册的函数
+	if result := evaluator.Shutdown(); isFailure(result) && !isFailure(ex.result) {
+		ex.result = result
+	}
+	ex.evalTime = time.Since(start)
+	ex.tolerated = in.TakeToleratedErrors()
+
+	return ex
+}
+
+// 执行结果是否为错误或者 exit()
+func isFailure(result object.Object) bool {
+	return result != nil &&
+		(result.Type() == object.ERROR_OBJ || result.Type() == object.EXIT_OBJ)
+}
+
+// 收到中断信号(Ctrl-C)时关闭返回的channel
+func interrupted() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(stop)
+	}()
+	return stop
+}
+
+// 根据执行结果计算退出码
+func (ex *execution) exitCode() int {
+	if len(ex.parseErrors) != 0 {
+		return EXIT_PARSE
+	}
+
+	switch result := ex.result.(type) {
+
+	case *object.Exit:
+		return int(result.Code)
+
+	case *object.Error:
+		if result.Kind == object.ResourceError {
+			return EXIT_RESOURCE
+		}
+		return EXIT_RUNTIME
+	}
+
+	// 容错模式下执行完了, 但是有错误
+	if len(ex.tolerated) != 0 {
+		return EXIT_RUNTIME
+	}
+	return EXIT_OK
+}
+
+// 把错误信息写入errOut, 返回退出码
+func (ex *execution) report(errOut io.Writer) int {
+	for _, msg := range ex.warnings {
+		fmt.Fprintln(errOut, "warning: "+msg)
+	}
+
+	for _, err := range ex.parseErrors {
+		fmt.Fprintln(errOut, "parser error: "+err.Format(ex.source))
+	}
+
+	for _, err := range ex.tolerated {
+		fmt.Fprintf(errOut, "line %d, column %d: %s\n", err.Pos.Line, err.Pos.Column, err.Inspect())
+	}
+
+	if err, ok := ex.result.(*object.Error); ok {
+		fmt.Fprintln(errOut, err.Inspect())
+		if trace := err.StackTrace(); trace != "" {
+			fmt.Fprintln(errOut, trace)
+		}
+	}
+
+	return ex.exitCode()
+}
+
+// 以JSON格式输出执行结果, 返回退出码
+//
+//	{
+//	    "exit_code": 0,
+//	    "result": ...,
+//	    "errors": [{"kind": "...", "message": "...", "line": 1, "column": 1, "hint": "...",
+//	                "stack": [{"name": "f", "line": 1, "column": 1}]}],
+//	    "warnings": ["..."],
+//	    "stdout": "...",
+//	    "timing": {"parse_ms": 0.1, "eval_ms": 1.2}
+//	}
+func (ex *execution) reportJSON(out io.Writer) int {
+	type jsonFrame struct {
+		Name   string `json:"name"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	}
+
+	type jsonError struct {
+		Kind    string      `json:"kind"`
+		Message string      `json:"message"`
+		Line    int         `json:"line,omitempty"`
+		Column  int         `json:"column,omitempty"`
+		Hint    string      `json:"hint,omitempty"`
+		Stack   []jsonFrame `json:"stack,omitempty"`
+	}
+
+	errors := []jsonError{}
+	for _, err := range ex.parseErrors {
+		errors = append(errors, jsonError{
+			Kind:    "ParseError",
+			Message: err.Message,
+			Line:    err.Pos.Line,
+			Column:  err.Pos.Column,
+			Hint:    err.Hint,
+		})
+	}
+
+	for _, err := range ex.tolerated {
+		errors = append(errors, jsonError{
+			Kind:    string(err.Kind),
+			Message: err.Message,
+			Line:    err.Pos.Line,
+			Column:  err.Pos.Column,
+		})
+	}
+
+	var result interface{}
+	switch value := ex.result.(type) {
+	case *object.Error:
+		stack := []jsonFrame{}
+		for _, f := range value.Stack {
+			stack = append(stack, jsonFrame{Name: f.Name, Line: f.Pos.Line, Column: f.Pos.Column})
+		}
+		errors = append(errors, jsonError{Kind: string(value.Kind), Message: value.Message,
+			Line: value.Pos.Line, Column: value.Pos.Column, Stack: stack})
+	case *object.Exit:
+	default:
+		result = object.ToJSONValue(value)
+	}
+
+	code := ex.exitCode()
+	report := map[string]interface{}{
+		"exit_code": code,
+		"result":    result,
+		"errors":    errors,
+		"warnings":  ex.warnings,
+		"stdout":    ex.stdout,
+		"timing": map[string]float64{
+			"parse_ms": float64(ex.parseTime) / float64(time.Millisecond),
+			"eval_ms":  float64(ex.evalTime) / float64(time.Millisecond),
+		},
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_RUNTIME
+	}
+
+	fmt.Fprintln(out, string(encoded))
+	return code
+}
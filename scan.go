@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mk/ast"
+	"mk/evaluator"
+	"mk/lexer"
+	"mk/object"
+	"mk/parser"
+)
+
+// 按行处理文本(类似 awk)
+// mk scan -e 'expr' [file ...]
+// 对每一行输入执行 expr, 结果不为null时输出
+// 执行时可以使用的变量:
+//
+//	line   当前行(不包含换行符)
+//	nr     当前行号, 从1开始, 多个文件时连续计数
+//	fields 当前行以空白分隔的字段数组
+//
+// 没有给出文件时从标准输入读取
+func scan(args []string) int {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	code := flags.String("e", "", "expression evaluated for each line")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	if *code == "" {
+		fmt.Fprintln(os.Stderr, "usage: mk scan -e <expr> [file ...]")
+		return EXIT_USAGE
+	}
+
+	l := lexer.New(*code)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		for _, err := range p.DetailedErrors() {
+			fmt.Fprintln(os.Stderr, "parser error: "+err.Format(*code))
+		}
+		return EXIT_PARSE
+	}
+
+	in := evaluator.New(evaluator.DefaultOptions())
+	defer in.Close()
+	env := object.NewEnvironment()
+	env.SetState(in)
+	s := &scanner{program: program, env: env, out: os.Stdout}
+
+	if flags.NArg() == 0 {
+		return s.scan(os.Stdin)
+	}
+
+	for _, name := range flags.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+
+		code := s.scan(file)
+		file.Close()
+		if code != EXIT_OK {
+			return code
+		}
+	}
+	return EXIT_OK
+}
+
+// 按行执行程序
+type scanner struct {
+	program *ast.Program
+	env     *object.Environment // 所有行共用一个环境
+	out     io.Writer
+	nr      int64 // 已经处理的行数
+}
+
+// 处理一个输入, 返回退出码
+func (s *scanner) scan(in io.Reader) int {
+	lines := bufio.NewScanner(in)
+
+	for lines.Scan() {
+		line := lines.Text()
+		s.nr++
+
+		fields := []object.Object{}
+		for _, f := range strings.Fields(line) {
+			fields = append(fields, &object.String{Value: f})
+		}
+
+		s.env.Set("line", &object.String{Value: line})
+		s.env.Set("nr", &object.Integer{Value: s.nr})
+		s.env.Set("fields", &object.Array{Elements: fields})
+
+		switch result := evaluator.Eval(s.program, s.env).(type) {
+
+		case *object.Exit:
+			return int(result.Code)
+
+		case *object.Error:
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", s.nr, result.Inspect())
+			if result.Kind == object.ResourceError {
+				return EXIT_RESOURCE
+			}
+			return EXIT_RUNTIME
+
+		case nil, *object.Null:
+
+		default:
+			fmt.Fprintln(s.out, result.Inspect())
+		}
+	}
+
+	if err := lines.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_RUNTIME
+	}
+	return EXIT_OK
+}
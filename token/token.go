@@ -1,15 +1,20 @@
 package token
 
-import ()
+import (
+	"sort"
+	"strings"
+)
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
 	// Identifiers + literals
-	IDENT  = "IDENT" //add, foobar, x, y, ...
-	INT    = "INT"
-	STRING = "STRING"
+	IDENT    = "IDENT" //add, foobar, x, y, ...
+	INT      = "INT"
+	DECIMAL  = "DECIMAL"  // 12.50d
+	DURATION = "DURATION" // 1h30m, 500ms
+	STRING   = "STRING"
 
 	// Operator
 	ASSIGN   = "="
@@ -18,11 +23,17 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	QUESTION = "?"
+	PIPE     = "|>"
 
 	// Delimiter
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
+	DOT       = "."
+	RANGE     = ".."
+	RANGE_LT  = "..<"
 
 	GT       = ">"
 	LT       = "<"
@@ -36,32 +47,93 @@ const (
 	// Key words
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	YIELD    = "YIELD"
+	STRUCT   = "STRUCT"
 
 	// Two char token
 	EQ     = "=="
 	NOT_EQ = "!="
+	ARROW  = "=>"
 )
 
 type TokenType string
 
+// 源码中的位置
+type Position struct {
+	Line   int // 行号, 从1开始
+	Column int // 列号, 从1开始
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // token第一个字符的位置
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"const":   CONST,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"match":   MATCH,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"yield":   YIELD,
+	"struct":  STRUCT,
+}
+
+// 所有关键字, 按字母顺序排列
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// 是否为关键字
+func IsKeyword(name string) bool {
+	_, ok := keywords[name]
+	return ok
+}
+
+// 宿主注册的自定义运算符, 运算符本身即为TokenType
+var operators = map[string]TokenType{}
+
+// 注册自定义运算符, 返回该运算符的TokenType
+// 一般通过 parser.RegisterOperator 注册, 需要在解析之前调用
+func RegisterOperator(symbol string) TokenType {
+	operators[symbol] = TokenType(symbol)
+	return operators[symbol]
+}
+
+// 查找s开头最长的自定义运算符
+func MatchOperator(s string) (string, bool) {
+	match := ""
+	for symbol := range operators {
+		if len(symbol) > len(match) && strings.HasPrefix(s, symbol) {
+			match = symbol
+		}
+	}
+	return match, match != ""
 }
 
 // LookupIdentifier used to determinate whether identifier is keyword nor not